@@ -0,0 +1,152 @@
+// recommend-eval 推荐算法离线评估命令
+//
+// 以时间切分回放历史阅读和评分数据，输出各推荐策略的 precision@k、recall@k、NDCG、覆盖率和新颖度，
+// 用于比较调整推荐权重前后的效果。
+//
+// 使用配置文件中的 MySQL：
+//
+//	go run ./cmd/recommend-eval -env local -k 5,10,20
+//
+// 使用本地 MySQL 快照：
+//
+//	go run ./cmd/recommend-eval -dsn "root:pass@tcp(127.0.0.1:3306)/xiaoshuo_snapshot?charset=utf8mb4&parseTime=True&loc=Local"
+//
+// 使用 SQLite 快照（需要 sqlite 编译标签；驱动 github.com/mattn/go-sqlite3 依赖 cgo，
+// 编译时需开启 CGO_ENABLED=1 并安装 C 编译器，否则运行时打开数据库会报错）：
+//
+//	CGO_ENABLED=1 go run -tags sqlite ./cmd/recommend-eval -driver sqlite -dsn snapshot.db -cutoff 2024-06-01
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"xiaoshuo-backend/config"
+	"xiaoshuo-backend/services"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// dialectors 支持的数据库驱动
+var dialectors = map[string]func(dsn string) gorm.Dialector{
+	"mysql": mysql.Open,
+}
+
+func main() {
+	env := flag.String("env", "", "运行环境，未指定 -dsn 时从对应配置文件读取 MySQL 连接")
+	driver := flag.String("driver", "mysql", "数据库驱动 (mysql, sqlite)")
+	dsn := flag.String("dsn", "", "数据库连接串，SQLite 为数据库文件路径")
+	cutoff := flag.String("cutoff", "", "训练/测试切分时间 (2006-01-02 或 RFC3339)，默认按 -test-ratio 取分位点")
+	testRatio := flag.Float64("test-ratio", 0.2, "未指定切分时间时作为测试集的最近行为比例")
+	ks := flag.String("k", "5,10,20", "评估的推荐列表长度，逗号分隔")
+	strategies := flag.String("strategies", strings.Join(services.EvalStrategies, ","), "评估的推荐策略，逗号分隔")
+	minTrain := flag.Int("min-train", 1, "参与评估的读者在训练期的最少行为小说数")
+	maxUsers := flag.Int("max-users", 0, "参与评估的最多读者数，0表示不限")
+	asJSON := flag.Bool("json", false, "以 JSON 格式输出报告")
+	flag.Parse()
+
+	opts := services.EvalOptions{
+		TestRatio:      *testRatio,
+		MinTrainEvents: *minTrain,
+		MaxUsers:       *maxUsers,
+	}
+	if *cutoff != "" {
+		t, err := parseTime(*cutoff)
+		if err != nil {
+			log.Fatalf("切分时间格式错误: %v", err)
+		}
+		opts.Cutoff = t
+	}
+	for _, value := range strings.Split(*ks, ",") {
+		k, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			log.Fatalf("推荐列表长度格式错误: %s", value)
+		}
+		opts.Ks = append(opts.Ks, k)
+	}
+	for _, name := range strings.Split(*strategies, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			opts.Strategies = append(opts.Strategies, name)
+		}
+	}
+
+	db, err := openDB(*env, *driver, *dsn)
+	if err != nil {
+		log.Fatalf("数据库连接失败: %v", err)
+	}
+
+	report, err := services.NewRecommendationService(db).EvaluateRecommendations(opts)
+	if err != nil {
+		log.Fatalf("离线评估失败: %v", err)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Fatalf("输出报告失败: %v", err)
+		}
+		return
+	}
+	printReport(report)
+}
+
+// openDB 打开评估使用的数据库，只输出警告级别的SQL日志
+func openDB(env, driver, dsn string) (*gorm.DB, error) {
+	gormConfig := &gorm.Config{Logger: logger.Default.LogMode(logger.Warn)}
+	if dsn == "" {
+		if driver != "mysql" {
+			return nil, fmt.Errorf("使用 %s 驱动时必须指定 -dsn", driver)
+		}
+		if env == "" {
+			env = os.Getenv("APP_ENV")
+		}
+		if env == "" {
+			env = "default"
+		}
+		config.SetEnv(env)
+		config.InitConfig()
+		config.InitDB()
+		return config.DB.Session(&gorm.Session{Logger: gormConfig.Logger}), nil
+	}
+
+	open, ok := dialectors[driver]
+	if !ok {
+		return nil, fmt.Errorf("不支持的数据库驱动: %s（SQLite 需要使用 -tags sqlite 编译）", driver)
+	}
+	return gorm.Open(open(dsn), gormConfig)
+}
+
+// parseTime 解析日期或 RFC3339 时间，日期按本地时区的零点计
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// printReport 以表格形式输出评估报告
+func printReport(report *services.EvalReport) {
+	fmt.Printf("切分时间: %s\n", report.Cutoff.Format(time.RFC3339))
+	fmt.Printf("训练行为: %d  测试行为: %d  评估读者: %d  可推荐小说: %d\n\n",
+		report.TrainEvents, report.TestEvents, report.Users, report.CatalogSize)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "strategy\tk\tprecision\trecall\tndcg\tcoverage\tnovelty\tusers\ttime(ms)\t")
+	for _, strategy := range report.Strategies {
+		for _, m := range strategy.Metrics {
+			fmt.Fprintf(w, "%s\t%d\t%.4f\t%.4f\t%.4f\t%.4f\t%.3f\t%d\t%d\t\n",
+				strategy.Strategy, m.K, m.Precision, m.Recall, m.NDCG, m.Coverage, m.Novelty, strategy.Users, strategy.DurationMs)
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,10 @@
+//go:build sqlite
+
+package main
+
+// SQLite 驱动基于 cgo，需使用 CGO_ENABLED=1 编译
+import "gorm.io/driver/sqlite"
+
+func init() {
+	dialectors["sqlite"] = sqlite.Open
+}
@@ -1541,8 +1541,8 @@ func DeleteFrozenUserPendingNovels(c *gin.Context) {
 	})
 }
 
-// ProcessExpiredNovels 定时处理过期小说的函数（可由定时任务调用）
-func ProcessExpiredNovels() {
+// ProcessExpiredNovels 定时处理过期小说的函数（由定时任务调用），返回自动拒绝的小说数量
+func ProcessExpiredNovels() (int, error) {
 	// 计算30天前的时间点
 	expireTime := time.Now().AddDate(0, 0, -30) // 30天前
 
@@ -1551,10 +1551,11 @@ func ProcessExpiredNovels() {
 	if err := models.DB.Where("status = ? AND created_at < ?", "pending", expireTime).
 		Find(&expiredNovels).Error; err != nil {
 		fmt.Printf("定时任务 - 查询过期小说失败: %v\n", err)
-		return
+		return 0, err
 	}
 
 	// 更新这些小说的状态为"rejected"
+	rejected := 0
 	for _, novel := range expiredNovels {
 		result := models.DB.Model(&models.Novel{}).
 			Where("id = ? AND status = ?", novel.ID, "pending").
@@ -1564,6 +1565,10 @@ func ProcessExpiredNovels() {
 			fmt.Printf("定时任务 - 更新小说状态失败: %v, novel_id: %d\n", result.Error, novel.ID)
 			continue
 		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		rejected++
 
 		fmt.Printf("定时任务 - 已自动拒绝过期小说: %s (ID: %d)\n", novel.Title, novel.ID)
 
@@ -1577,4 +1582,6 @@ func ProcessExpiredNovels() {
 		}
 		models.DB.Create(&log)
 	}
-}
\ No newline at end of file
+
+	return rejected, nil
+}
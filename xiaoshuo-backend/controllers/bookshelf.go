@@ -0,0 +1,370 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/services"
+	"xiaoshuo-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 书架服务实例
+var bookshelfService *services.BookshelfService
+
+// InitBookshelfService 初始化书架服务
+func InitBookshelfService() {
+	bookshelfService = services.NewBookshelfService(models.DB)
+}
+
+// GetBookshelf 获取当前用户的书架
+func GetBookshelf(c *gin.Context) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	var groupID *uint
+	if groupIDStr := c.Query("group_id"); groupIDStr != "" {
+		id, err := strconv.ParseUint(groupIDStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的分组ID"})
+			return
+		}
+		value := uint(id)
+		groupID = &value
+	}
+	sortBy := c.DefaultQuery("sort", services.BookshelfSortLastRead) // last_read(最近阅读), last_updated(最近更新), added(加入时间)
+
+	entries, err := bookshelfService.GetBookshelf(claims.UserID, groupID, sortBy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取书架失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"entries": entries,
+			"total":   len(entries),
+			"sort":    sortBy,
+		},
+	})
+}
+
+// AddToBookshelf 将小说加入书架
+func AddToBookshelf(c *gin.Context) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	var input struct {
+		NovelID    uint   `json:"novel_id" binding:"required"`
+		GroupID    *uint  `json:"group_id"`    // 不传时为未分组
+		NotifyMode string `json:"notify_mode"` // instant(即时通知), digest(每日摘要), off(不通知)
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "data": err.Error()})
+		return
+	}
+
+	entry, err := bookshelfService.AddNovel(claims.UserID, input.NovelID, input.GroupID, input.NotifyMode)
+	if err != nil {
+		respondBookshelfError(c, "加入书架失败", "小说不存在或未审核通过", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "已加入书架",
+			"entry":   entry,
+		},
+	})
+}
+
+// UpdateBookshelfEntry 修改书架中小说的分组、置顶和通知方式
+func UpdateBookshelfEntry(c *gin.Context) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	novelID, err := strconv.ParseUint(c.Param("novel_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的小说ID"})
+		return
+	}
+
+	var input struct {
+		GroupID    *uint   `json:"group_id"`
+		IsPinned   *bool   `json:"is_pinned"`
+		NotifyMode *string `json:"notify_mode"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "data": err.Error()})
+		return
+	}
+
+	entry, err := bookshelfService.UpdateEntry(claims.UserID, uint(novelID), input.GroupID, input.IsPinned, input.NotifyMode)
+	if err != nil {
+		respondBookshelfError(c, "修改书架失败", "书架中没有该小说", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "书架修改成功",
+			"entry":   entry,
+		},
+	})
+}
+
+// RemoveFromBookshelf 将小说移出书架
+func RemoveFromBookshelf(c *gin.Context) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	novelID, err := strconv.ParseUint(c.Param("novel_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的小说ID"})
+		return
+	}
+
+	removed, err := bookshelfService.RemoveNovels(claims.UserID, []uint{uint(novelID)})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "移出书架失败", "data": err.Error()})
+		return
+	}
+	if removed == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "书架中没有该小说"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "已移出书架",
+		},
+	})
+}
+
+// BatchMoveBookshelf 批量移动书架中的小说到指定分组
+func BatchMoveBookshelf(c *gin.Context) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	var input struct {
+		NovelIDs []uint `json:"novel_ids" binding:"required,min=1"`
+		GroupID  uint   `json:"group_id"` // 0表示移出分组
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "data": err.Error()})
+		return
+	}
+
+	moved, err := bookshelfService.MoveNovels(claims.UserID, input.NovelIDs, input.GroupID)
+	if err != nil {
+		respondBookshelfError(c, "移动失败", "书架分组不存在", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "移动成功",
+			"moved":   moved,
+		},
+	})
+}
+
+// BatchRemoveBookshelf 批量将小说移出书架
+func BatchRemoveBookshelf(c *gin.Context) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	var input struct {
+		NovelIDs []uint `json:"novel_ids" binding:"required,min=1"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "data": err.Error()})
+		return
+	}
+
+	removed, err := bookshelfService.RemoveNovels(claims.UserID, input.NovelIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "移出书架失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "已移出书架",
+			"removed": removed,
+		},
+	})
+}
+
+// GetBookshelfGroups 获取当前用户的书架分组
+func GetBookshelfGroups(c *gin.Context) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	groups, err := bookshelfService.GetGroups(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取书架分组失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"groups": groups,
+		},
+	})
+}
+
+// CreateBookshelfGroup 创建书架分组
+func CreateBookshelfGroup(c *gin.Context) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	var input struct {
+		Name string `json:"name" binding:"required,min=1,max=50"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "data": err.Error()})
+		return
+	}
+
+	group, err := bookshelfService.CreateGroup(claims.UserID, input.Name)
+	if err != nil {
+		respondBookshelfError(c, "创建书架分组失败", "书架分组不存在", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "书架分组创建成功",
+			"group":   group,
+		},
+	})
+}
+
+// UpdateBookshelfGroup 修改书架分组
+func UpdateBookshelfGroup(c *gin.Context) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	groupID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的分组ID"})
+		return
+	}
+
+	var input struct {
+		Name     *string `json:"name" binding:"omitempty,max=50"`
+		Position *int    `json:"position"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "data": err.Error()})
+		return
+	}
+
+	group, err := bookshelfService.UpdateGroup(claims.UserID, uint(groupID), input.Name, input.Position)
+	if err != nil {
+		respondBookshelfError(c, "修改书架分组失败", "书架分组不存在", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "书架分组修改成功",
+			"group":   group,
+		},
+	})
+}
+
+// DeleteBookshelfGroup 删除书架分组，分组中的小说变为未分组
+func DeleteBookshelfGroup(c *gin.Context) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	groupID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的分组ID"})
+		return
+	}
+
+	if err := bookshelfService.DeleteGroup(claims.UserID, uint(groupID)); err != nil {
+		respondBookshelfError(c, "删除书架分组失败", "书架分组不存在", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "书架分组删除成功",
+		},
+	})
+}
+
+// respondBookshelfError 根据错误类型返回书架操作失败的响应
+func respondBookshelfError(c *gin.Context, message, notFoundMessage string, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidBookshelfOperation):
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": notFoundMessage})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": message, "data": err.Error()})
+	}
+}
@@ -0,0 +1,291 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/services"
+	"xiaoshuo-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 章节编辑服务实例
+var chapterService *services.ChapterService
+
+// InitChapterService 初始化章节编辑服务
+func InitChapterService() {
+	chapterService = services.NewChapterService(models.DB)
+}
+
+// UpdateChapter 修改章节标题和内容
+func UpdateChapter(c *gin.Context) {
+	chapter, ok := getEditableChapter(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Title   *string `json:"title" binding:"omitempty,max=200"`
+		Content *string `json:"content"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "data": err.Error()})
+		return
+	}
+
+	updated, err := chapterService.UpdateChapter(chapter.ID, input.Title, input.Content)
+	if err != nil {
+		respondChapterEditError(c, "修改章节失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "章节修改成功",
+			"chapter": updated,
+		},
+	})
+}
+
+// InsertChapter 在指定位置插入新章节
+func InsertChapter(c *gin.Context) {
+	novel, ok := getEditableNovel(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Position int    `json:"position" binding:"required,min=1"`
+		Title    string `json:"title" binding:"required,min=1,max=200"`
+		Content  string `json:"content" binding:"required"`
+		VolumeID *uint  `json:"volume_id"` // 不传时继承前一章节的分卷，传0表示不属于任何分卷
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "data": err.Error()})
+		return
+	}
+
+	chapter, err := chapterService.InsertChapter(novel.ID, input.Position, input.Title, input.Content, input.VolumeID)
+	if err != nil {
+		respondChapterEditError(c, "插入章节失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "章节插入成功",
+			"chapter": chapter,
+		},
+	})
+}
+
+// ReorderChapters 按给定顺序重新排列小说的全部章节
+func ReorderChapters(c *gin.Context) {
+	novel, ok := getEditableNovel(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var input struct {
+		ChapterIDs []uint `json:"chapter_ids" binding:"required,min=1"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "data": err.Error()})
+		return
+	}
+
+	if err := chapterService.ReorderChapters(novel.ID, input.ChapterIDs); err != nil {
+		respondChapterEditError(c, "调整章节顺序失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "章节顺序调整成功",
+		},
+	})
+}
+
+// MoveChapter 将章节移动到指定位置
+func MoveChapter(c *gin.Context) {
+	chapter, ok := getEditableChapter(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Position int `json:"position" binding:"required,min=1"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "data": err.Error()})
+		return
+	}
+
+	moved, err := chapterService.MoveChapter(chapter.ID, input.Position)
+	if err != nil {
+		respondChapterEditError(c, "移动章节失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "章节移动成功",
+			"chapter": moved,
+		},
+	})
+}
+
+// SplitChapter 在指定字符偏移处将章节拆分为两章
+func SplitChapter(c *gin.Context) {
+	chapter, ok := getEditableChapter(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Offset   int    `json:"offset" binding:"required,min=1"`            // 拆分位置（字符偏移，从正文开头计算）
+		NewTitle string `json:"new_title" binding:"required,min=1,max=200"` // 拆分出的新章节标题
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "data": err.Error()})
+		return
+	}
+
+	first, second, err := chapterService.SplitChapter(chapter.ID, input.Offset, input.NewTitle)
+	if err != nil {
+		respondChapterEditError(c, "拆分章节失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message":  "章节拆分成功",
+			"chapters": []*models.Chapter{first, second},
+		},
+	})
+}
+
+// MergeChapters 将章节与下一章合并
+func MergeChapters(c *gin.Context) {
+	chapter, ok := getEditableChapter(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		KeepTitle bool `json:"keep_title"` // 是否在正文中保留下一章的标题
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "data": err.Error()})
+		return
+	}
+
+	merged, err := chapterService.MergeChapters(chapter.ID, input.KeepTitle)
+	if err != nil {
+		respondChapterEditError(c, "合并章节失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "章节合并成功",
+			"chapter": merged,
+		},
+	})
+}
+
+// getEditableNovel 获取当前用户有权编辑的小说（上传者或管理员），失败时已写入响应
+func getEditableNovel(c *gin.Context, idParam string) (*models.Novel, bool) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return nil, false
+	}
+
+	id, err := strconv.ParseUint(idParam, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的小说ID"})
+		return nil, false
+	}
+
+	var novel models.Novel
+	if err := models.DB.First(&novel, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "小说不存在"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取小说信息失败", "data": err.Error()})
+		return nil, false
+	}
+
+	// 检查权限：上传者或管理员可以编辑
+	if novel.UploadUserID != claims.UserID && !claims.IsAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "没有权限编辑此小说"})
+		return nil, false
+	}
+
+	// 章节解析完成前不允许编辑，避免与解析任务冲突
+	if novel.ChapterStatus != "completed" {
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "章节尚未解析完成，暂时无法编辑"})
+		return nil, false
+	}
+
+	return &novel, true
+}
+
+// getEditableChapter 获取当前用户有权编辑的章节，失败时已写入响应
+func getEditableChapter(c *gin.Context) (*models.Chapter, bool) {
+	chapterID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的章节ID"})
+		return nil, false
+	}
+
+	var chapter models.Chapter
+	if err := models.DB.First(&chapter, chapterID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "章节不存在"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取章节失败", "data": err.Error()})
+		return nil, false
+	}
+
+	if _, ok := getEditableNovel(c, strconv.FormatUint(uint64(chapter.NovelID), 10)); !ok {
+		return nil, false
+	}
+	return &chapter, true
+}
+
+// respondChapterEditError 根据错误类型返回章节编辑失败的响应
+func respondChapterEditError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidChapterEdit):
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "章节不存在"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": message, "data": err.Error()})
+	}
+}
@@ -0,0 +1,550 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetChapterRules 获取章节标题识别规则列表
+// 数据库中没有规则时返回默认规则，并通过 using_defaults 标识
+func GetChapterRules(c *gin.Context) {
+	var rules []models.ChapterRule
+	if err := models.DB.Order("priority ASC, id ASC").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取章节规则失败", "data": err.Error()})
+		return
+	}
+
+	usingDefaults := len(rules) == 0
+	if usingDefaults {
+		rules = utils.DefaultChapterRules()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"rules":          rules,
+			"using_defaults": usingDefaults,
+		},
+	})
+}
+
+// CreateChapterRule 创建章节标题识别规则
+func CreateChapterRule(c *gin.Context) {
+	// 从上下文获取用户信息（通过AdminAuthMiddleware已验证为管理员）
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	dbUser := user.(models.User)
+
+	var input struct {
+		Name        string `json:"name" binding:"required,min=1,max=100"`
+		Type        string `json:"type" binding:"required,oneof=volume chapter prologue epilogue numbered"`
+		Pattern     string `json:"pattern" binding:"required,max=500"`
+		Priority    int    `json:"priority"`
+		MaxLength   int    `json:"max_length" binding:"min=0,max=200"`
+		Description string `json:"description" binding:"max=500"`
+		IsActive    *bool  `json:"is_active"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "data": err.Error()})
+		return
+	}
+
+	if _, err := regexp.Compile(input.Pattern); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "正则表达式无效", "data": err.Error()})
+		return
+	}
+
+	rule := models.ChapterRule{
+		Name:        input.Name,
+		Type:        input.Type,
+		Pattern:     input.Pattern,
+		Priority:    input.Priority,
+		MaxLength:   input.MaxLength,
+		Description: input.Description,
+		IsActive:    true,
+		CreatedBy:   dbUser.ID,
+		UpdatedBy:   dbUser.ID,
+	}
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		// 首次自定义规则时先写入默认规则，避免默认规则因数据库非空而失效
+		if err := seedDefaultChapterRules(tx, dbUser.ID); err != nil {
+			return err
+		}
+		if err := tx.Create(&rule).Error; err != nil {
+			return err
+		}
+		// is_active 字段带有默认值，显式更新以支持创建停用的规则
+		if input.IsActive != nil && !*input.IsActive {
+			rule.IsActive = false
+			return tx.Model(&rule).Update("is_active", false).Error
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建章节规则失败", "data": err.Error()})
+		return
+	}
+
+	// 记录管理员操作日志
+	log := models.AdminLog{
+		AdminUserID: dbUser.ID,
+		Action:      "create_chapter_rule",
+		TargetType:  "chapter_rule",
+		TargetID:    rule.ID,
+		Details:     fmt.Sprintf("管理员创建了章节规则: %s", rule.Name),
+	}
+	models.DB.Create(&log)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "章节规则创建成功",
+			"rule":    rule,
+		},
+	})
+}
+
+// UpdateChapterRule 更新章节标题识别规则
+func UpdateChapterRule(c *gin.Context) {
+	// 从上下文获取用户信息（通过AdminAuthMiddleware已验证为管理员）
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	dbUser := user.(models.User)
+
+	ruleID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的章节规则ID"})
+		return
+	}
+
+	var input struct {
+		Name        *string `json:"name" binding:"omitempty,min=1,max=100"`
+		Type        *string `json:"type" binding:"omitempty,oneof=volume chapter prologue epilogue numbered"`
+		Pattern     *string `json:"pattern" binding:"omitempty,max=500"`
+		Priority    *int    `json:"priority"`
+		MaxLength   *int    `json:"max_length" binding:"omitempty,min=0,max=200"`
+		Description *string `json:"description" binding:"omitempty,max=500"`
+		IsActive    *bool   `json:"is_active"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "data": err.Error()})
+		return
+	}
+
+	var rule models.ChapterRule
+	if err := models.DB.First(&rule, ruleID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "章节规则不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取章节规则失败", "data": err.Error()})
+		return
+	}
+
+	// 更新字段
+	updates := make(map[string]interface{})
+	if input.Name != nil {
+		updates["name"] = *input.Name
+	}
+	if input.Type != nil {
+		updates["type"] = *input.Type
+	}
+	if input.Pattern != nil {
+		if _, err := regexp.Compile(*input.Pattern); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "正则表达式无效", "data": err.Error()})
+			return
+		}
+		updates["pattern"] = *input.Pattern
+	}
+	if input.Priority != nil {
+		updates["priority"] = *input.Priority
+	}
+	if input.MaxLength != nil {
+		updates["max_length"] = *input.MaxLength
+	}
+	if input.Description != nil {
+		updates["description"] = *input.Description
+	}
+	if input.IsActive != nil {
+		updates["is_active"] = *input.IsActive
+	}
+	updates["updated_by"] = dbUser.ID
+
+	if err := models.DB.Model(&rule).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新章节规则失败", "data": err.Error()})
+		return
+	}
+
+	// 记录管理员操作日志
+	log := models.AdminLog{
+		AdminUserID: dbUser.ID,
+		Action:      "update_chapter_rule",
+		TargetType:  "chapter_rule",
+		TargetID:    rule.ID,
+		Details:     fmt.Sprintf("管理员更新了章节规则: %s", rule.Name),
+	}
+	models.DB.Create(&log)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "章节规则更新成功",
+			"rule":    rule,
+		},
+	})
+}
+
+// DeleteChapterRule 删除章节标题识别规则
+func DeleteChapterRule(c *gin.Context) {
+	// 从上下文获取用户信息（通过AdminAuthMiddleware已验证为管理员）
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	dbUser := user.(models.User)
+
+	ruleID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的章节规则ID"})
+		return
+	}
+
+	var rule models.ChapterRule
+	if err := models.DB.First(&rule, ruleID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "章节规则不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取章节规则失败", "data": err.Error()})
+		return
+	}
+
+	// 物理删除，删除全部规则后解析回退到默认规则
+	if err := models.DB.Unscoped().Delete(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除章节规则失败", "data": err.Error()})
+		return
+	}
+
+	// 记录管理员操作日志
+	log := models.AdminLog{
+		AdminUserID: dbUser.ID,
+		Action:      "delete_chapter_rule",
+		TargetType:  "chapter_rule",
+		TargetID:    rule.ID,
+		Details:     fmt.Sprintf("管理员删除了章节规则: %s", rule.Name),
+	}
+	models.DB.Create(&log)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "章节规则删除成功",
+		},
+	})
+}
+
+// ResetChapterRules 将章节标题识别规则重置为默认规则
+func ResetChapterRules(c *gin.Context) {
+	// 从上下文获取用户信息（通过AdminAuthMiddleware已验证为管理员）
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	dbUser := user.(models.User)
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("1 = 1").Delete(&models.ChapterRule{}).Error; err != nil {
+			return err
+		}
+		return seedDefaultChapterRules(tx, dbUser.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "重置章节规则失败", "data": err.Error()})
+		return
+	}
+
+	var rules []models.ChapterRule
+	models.DB.Order("priority ASC, id ASC").Find(&rules)
+
+	// 记录管理员操作日志
+	log := models.AdminLog{
+		AdminUserID: dbUser.ID,
+		Action:      "reset_chapter_rules",
+		TargetType:  "chapter_rule",
+		Details:     "管理员将章节规则重置为默认规则",
+	}
+	models.DB.Create(&log)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "章节规则已重置为默认规则",
+			"rules":   rules,
+		},
+	})
+}
+
+// GetChapterParseSettings 获取章节解析设置
+func GetChapterParseSettings(c *gin.Context) {
+	setting := utils.DefaultChapterParseSetting()
+	models.DB.First(&setting)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"settings": setting,
+		},
+	})
+}
+
+// UpdateChapterParseSettings 更新章节解析设置（最少字数、是否合并过短章节、标题最大长度）
+func UpdateChapterParseSettings(c *gin.Context) {
+	// 从上下文获取用户信息（通过AdminAuthMiddleware已验证为管理员）
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	dbUser := user.(models.User)
+
+	var input struct {
+		MinChapterLength  *int  `json:"min_chapter_length" binding:"omitempty,min=0,max=10000"`
+		MergeTinyChapters *bool `json:"merge_tiny_chapters"`
+		MaxTitleLength    *int  `json:"max_title_length" binding:"omitempty,min=1,max=200"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "data": err.Error()})
+		return
+	}
+
+	var setting models.ChapterParseSetting
+	if err := models.DB.First(&setting).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取章节解析设置失败", "data": err.Error()})
+			return
+		}
+		setting = utils.DefaultChapterParseSetting()
+		setting.UpdatedBy = dbUser.ID
+		if err := models.DB.Create(&setting).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建章节解析设置失败", "data": err.Error()})
+			return
+		}
+	}
+
+	// 更新字段
+	updates := make(map[string]interface{})
+	if input.MinChapterLength != nil {
+		updates["min_chapter_length"] = *input.MinChapterLength
+	}
+	if input.MergeTinyChapters != nil {
+		updates["merge_tiny_chapters"] = *input.MergeTinyChapters
+	}
+	if input.MaxTitleLength != nil {
+		updates["max_title_length"] = *input.MaxTitleLength
+	}
+	updates["updated_by"] = dbUser.ID
+
+	if err := models.DB.Model(&setting).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新章节解析设置失败", "data": err.Error()})
+		return
+	}
+
+	// 记录管理员操作日志
+	log := models.AdminLog{
+		AdminUserID: dbUser.ID,
+		Action:      "update_chapter_parse_settings",
+		TargetType:  "chapter_parse_setting",
+		TargetID:    setting.ID,
+		Details: fmt.Sprintf("管理员更新了章节解析设置: 最少字数=%d, 合并过短章节=%t, 标题最大长度=%d",
+			setting.MinChapterLength, setting.MergeTinyChapters, setting.MaxTitleLength),
+	}
+	models.DB.Create(&log)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message":  "章节解析设置更新成功",
+			"settings": setting,
+		},
+	})
+}
+
+// PreviewChapterSplit 预览TXT文件的章节切分结果（不保存文件和章节）
+// 可通过表单参数临时覆盖解析设置，rules 参数传入JSON数组可试用未保存的规则
+func PreviewChapterSplit(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "文件上传失败", "data": err.Error()})
+		return
+	}
+
+	if !hasSuffixIgnoreCase(file.Filename, ".txt") {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "章节切分预览仅支持.txt文件"})
+		return
+	}
+
+	if file.Size > 20*1024*1024 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "文件大小不能超过20MB"})
+		return
+	}
+
+	// 加载当前生效的规则和设置
+	rules := utils.DefaultChapterRules()
+	var dbRules []models.ChapterRule
+	if err := models.DB.Order("priority ASC, id ASC").Find(&dbRules).Error; err == nil && len(dbRules) > 0 {
+		rules = dbRules
+	}
+	setting := utils.DefaultChapterParseSetting()
+	models.DB.First(&setting)
+
+	// 使用请求中的临时规则和设置
+	if rulesJSON := c.PostForm("rules"); rulesJSON != "" {
+		var rawRules []json.RawMessage
+		if err := json.Unmarshal([]byte(rulesJSON), &rawRules); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "规则格式错误", "data": err.Error()})
+			return
+		}
+		// 与创建规则一致，未指定 is_active 的临时规则默认启用
+		customRules := make([]models.ChapterRule, 0, len(rawRules))
+		for _, raw := range rawRules {
+			rule := models.ChapterRule{IsActive: true}
+			if err := json.Unmarshal(raw, &rule); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "规则格式错误", "data": err.Error()})
+				return
+			}
+			customRules = append(customRules, rule)
+		}
+		rules = customRules
+	}
+	if value := c.PostForm("min_chapter_length"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			setting.MinChapterLength = n
+		}
+	}
+	if value := c.PostForm("merge_tiny_chapters"); value != "" {
+		setting.MergeTinyChapters = value == "true" || value == "1"
+	}
+	if value := c.PostForm("max_title_length"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			setting.MaxTitleLength = n
+		}
+	}
+
+	options, err := utils.NewChapterParseOptions(rules, setting)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "章节规则无效", "data": err.Error()})
+		return
+	}
+
+	// 保存到临时文件进行解析，解析完成后删除
+	tmpFile, err := os.CreateTemp("", "chapter-preview-*.txt")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建临时文件失败", "data": err.Error()})
+		return
+	}
+	tmpPath := tmpFile.Name()
+	tmpFile.Close()
+	defer utils.DeleteFile(tmpPath)
+
+	if err := c.SaveUploadedFile(file, tmpPath); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "文件保存失败", "data": err.Error()})
+		return
+	}
+
+	splits, err := utils.SplitChaptersFromTXT(tmpPath, options)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "章节解析失败", "data": err.Error()})
+		return
+	}
+
+	// 统计结果，正文只返回开头部分
+	totalWords := 0
+	mergedCount := 0
+	ruleStats := make(map[string]int)
+	chapters := make([]gin.H, 0, len(splits))
+	for _, split := range splits {
+		totalWords += split.Chapter.WordCount
+		mergedCount += split.MergedCount
+		if split.RuleName != "" {
+			ruleStats[split.RuleName]++
+		}
+		preview := []rune(split.Chapter.Content)
+		if len(preview) > 100 {
+			preview = preview[:100]
+		}
+		chapters = append(chapters, gin.H{
+			"position":     split.Chapter.Position,
+			"title":        split.Chapter.Title,
+			"word_count":   split.Chapter.WordCount,
+			"rule_name":    split.RuleName,
+			"rule_type":    split.RuleType,
+			"volume_title": split.VolumeTitle,
+			"start_line":   split.StartLine,
+			"merged_count": split.MergedCount,
+			"preview":      string(preview),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"chapters":      chapters,
+			"chapter_count": len(splits),
+			"total_words":   totalWords,
+			"merged_count":  mergedCount,
+			"rule_stats":    ruleStats,
+			"settings":      setting,
+		},
+	})
+}
+
+// seedDefaultChapterRules 数据库中没有章节规则时写入默认规则
+func seedDefaultChapterRules(tx *gorm.DB, userID uint) error {
+	var count int64
+	if err := tx.Model(&models.ChapterRule{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	rules := utils.DefaultChapterRules()
+	for i := range rules {
+		rules[i].CreatedBy = userID
+		rules[i].UpdatedBy = userID
+	}
+	return tx.Create(&rules).Error
+}
@@ -0,0 +1,261 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/services"
+	"xiaoshuo-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 点击统计服务实例
+var clickStatService *services.ClickStatService
+
+// 点击防刷服务实例
+var clickGuardService *services.ClickGuardService
+
+// InitClickStatService 初始化点击统计和点击防刷服务
+func InitClickStatService() {
+	clickStatService = services.NewClickStatService(models.DB)
+	clickGuardService = services.NewClickGuardService(models.DB)
+}
+
+// recordClick 经过防刷检查后记录点击，返回判定结果；Redis不可用时无法防刷，丢弃该点击
+func recordClick(c *gin.Context, novelID, userID uint) (string, error) {
+	verdict, err := clickGuardService.RecordClick(services.ClickRequest{
+		NovelID:        novelID,
+		UserID:         userID,
+		IP:             c.ClientIP(),
+		UserAgent:      c.GetHeader("User-Agent"),
+		AcceptLanguage: c.GetHeader("Accept-Language"),
+		DeviceID:       c.GetHeader("X-Device-ID"),
+	})
+	if err != nil && !errors.Is(err, services.ErrClickRateLimited) {
+		log.Printf("写入点击缓冲区失败，丢弃点击 (novel ID: %d): %v", novelID, err)
+		return services.ClickVerdictDropped, nil
+	}
+	if err == nil && verdict != services.ClickVerdictBot && verdict != services.ClickVerdictDropped {
+		// 登录用户点击曝光过的推荐小说时计入A/B实验点击率
+		recordExperimentClick(userID, novelID)
+	}
+	return verdict, err
+}
+
+// optionalUserID 从可选的认证token中获取用户ID，未登录或token无效时返回0
+func optionalUserID(c *gin.Context) uint {
+	if claims := utils.GetClaims(c); claims != nil {
+		return claims.UserID
+	}
+	tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if tokenString == "" {
+		return 0
+	}
+	claims, err := utils.ParseToken(tokenString)
+	if err != nil {
+		return 0
+	}
+	return claims.UserID
+}
+
+// applyClickWindows 用聚合表中的滚动窗口点击数填充小说，失败时仅记录日志
+func applyClickWindows(novels ...*models.Novel) {
+	if err := clickStatService.ApplyWindowCounts(novels); err != nil {
+		log.Printf("获取滚动窗口点击数失败: %v", err)
+	}
+}
+
+// GetNovelClickTrend 获取小说的点击趋势
+// granularity 为 hour 时默认返回最近48小时（最多168），为 day 时默认返回最近30天（最多365）
+func GetNovelClickTrend(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的小说ID"})
+		return
+	}
+
+	granularity := c.DefaultQuery("granularity", services.ClickGranularityHour)
+	var defaultPoints, maxPoints int
+	switch granularity {
+	case services.ClickGranularityHour:
+		defaultPoints, maxPoints = 48, 168
+	case services.ClickGranularityDay:
+		defaultPoints, maxPoints = 30, 365
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "统计粒度只能是 hour 或 day"})
+		return
+	}
+	points, _ := strconv.Atoi(c.DefaultQuery("points", strconv.Itoa(defaultPoints)))
+	if points < 1 || points > maxPoints {
+		points = defaultPoints
+	}
+
+	var novel models.Novel
+	if err := models.DB.Select("id, status").First(&novel, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "小说不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取小说信息失败", "data": err.Error()})
+		return
+	}
+	if novel.Status != "approved" {
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "小说尚未通过审核"})
+		return
+	}
+
+	trend, err := clickStatService.GetClickTrend(novel.ID, granularity, points)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取点击趋势失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"novel_id":    novel.ID,
+			"granularity": granularity,
+			"trend":       trend,
+		},
+	})
+}
+
+// GetClickAnomalies 管理员获取点击异常的小说报告
+func GetClickAnomalies(c *gin.Context) {
+	hours, _ := strconv.Atoi(c.DefaultQuery("hours", "24"))
+	minClicks, _ := strconv.ParseInt(c.DefaultQuery("min_clicks", "100"), 10, 64)
+	spikeRatio, _ := strconv.ParseFloat(c.DefaultQuery("spike_ratio", "5"), 64)
+	if hours < 1 || hours > 72 {
+		hours = 24
+	}
+	if minClicks < 1 {
+		minClicks = 100
+	}
+	if spikeRatio <= 1 {
+		spikeRatio = 5
+	}
+
+	anomalies, err := clickGuardService.DetectAnomalies(services.ClickAnomalyOptions{
+		Hours:      hours,
+		MinClicks:  minClicks,
+		SpikeRatio: spikeRatio,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取点击异常报告失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"hours":       hours,
+			"min_clicks":  minClicks,
+			"spike_ratio": spikeRatio,
+			"anomalies":   anomalies,
+		},
+	})
+}
+
+// DiscountNovelClicks 管理员将小说在时间区间内的点击判定为刷量并扣除
+func DiscountNovelClicks(c *gin.Context) {
+	// 从上下文获取用户信息（通过AdminAuthMiddleware已验证为管理员）
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+	dbUser := user.(models.User)
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的小说ID"})
+		return
+	}
+
+	var input struct {
+		StartAt time.Time `json:"start_at" binding:"required"`
+		EndAt   time.Time `json:"end_at" binding:"required"`
+		Ratio   *float64  `json:"ratio"` // 扣除比例，默认1（全部扣除），0表示恢复
+		Reason  string    `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "data": err.Error()})
+		return
+	}
+	ratio := 1.0
+	if input.Ratio != nil {
+		ratio = *input.Ratio
+	}
+
+	discount, err := clickGuardService.DiscountClicks(uint(id), dbUser.ID, input.StartAt, input.EndAt, ratio, input.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "小说不存在"})
+		case errors.Is(err, services.ErrInvalidClickDiscount):
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "扣除点击失败", "data": err.Error()})
+		}
+		return
+	}
+
+	// 记录管理员操作日志
+	adminLog := models.AdminLog{
+		AdminUserID: dbUser.ID,
+		Action:      "discount_clicks",
+		TargetType:  "novel",
+		TargetID:    uint(id),
+		Details: fmt.Sprintf("扣除小说 %s 至 %s 的刷量点击，比例%.2f，调整%d次，原因: %s",
+			discount.StartAt.Format("2006-01-02 15:04"), discount.EndAt.Format("2006-01-02 15:04"),
+			discount.Ratio, discount.DiscountedClicks, discount.Reason),
+	}
+	models.DB.Create(&adminLog)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    discount,
+	})
+}
+
+// GetClickDiscounts 管理员获取点击扣除记录，可按小说筛选
+func GetClickDiscounts(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	novelID, _ := strconv.ParseUint(c.Query("novel_id"), 10, 64)
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	discounts, total, err := clickGuardService.GetClickDiscounts(uint(novelID), page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取点击扣除记录失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"discounts": discounts,
+			"pagination": gin.H{
+				"page":  page,
+				"limit": limit,
+				"total": total,
+			},
+		},
+	})
+}
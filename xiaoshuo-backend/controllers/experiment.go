@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/services"
+	"xiaoshuo-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// A/B实验服务实例
+var experimentService *services.ExperimentService
+
+// 推荐接口获取实验变体使用的分配器，为空时不参与实验
+var variantAssigner services.VariantAssigner
+
+// InitExperimentService 初始化A/B实验服务
+func InitExperimentService() {
+	experimentService = services.NewExperimentService(models.DB)
+	variantAssigner = experimentService
+}
+
+// assignVariant 获取用户在场景进行中实验里的变体，失败时仅记录日志，按默认策略处理
+func assignVariant(userID uint, surface string) *services.ExperimentAssignment {
+	if variantAssigner == nil || userID == 0 {
+		return nil
+	}
+	assignment, err := variantAssigner.Assign(userID, surface)
+	if err != nil {
+		log.Printf("分配实验变体失败 (user ID: %d, surface: %s): %v", userID, surface, err)
+		return nil
+	}
+	return assignment
+}
+
+// logExposures 记录实验曝光，失败时仅记录日志
+func logExposures(assignment *services.ExperimentAssignment, userID uint, novels []models.Novel) {
+	if variantAssigner == nil || assignment == nil {
+		return
+	}
+	novelIDs := make([]uint, len(novels))
+	for i, novel := range novels {
+		novelIDs[i] = novel.ID
+	}
+	if err := variantAssigner.LogExposures(assignment, userID, novelIDs); err != nil {
+		log.Printf("记录实验曝光失败 (experiment: %s, user ID: %d): %v", assignment.ExperimentKey, userID, err)
+	}
+}
+
+// assignSearchVariant 未指定排序方式时，参与搜索排序实验的用户按变体指定的排序方式搜索
+func assignSearchVariant(c *gin.Context, opts *utils.NovelSearchOptions) (*services.ExperimentAssignment, uint) {
+	if c.Query("sort") != "" || opts.Query == "" {
+		return nil, 0
+	}
+	userID := optionalUserID(c)
+	assignment := assignVariant(userID, services.ExperimentSurfaceSearch)
+	if assignment != nil && assignment.Params.SearchSort != "" {
+		opts.Sort = assignment.Params.SearchSort
+	}
+	return assignment, userID
+}
+
+// recordExperimentClick 将登录用户的点击归因到实验曝光，失败时仅记录日志
+func recordExperimentClick(userID, novelID uint) {
+	if experimentService == nil || userID == 0 {
+		return
+	}
+	if err := experimentService.RecordClick(userID, novelID); err != nil {
+		log.Printf("记录实验点击失败 (user ID: %d, novel ID: %d): %v", userID, novelID, err)
+	}
+}
+
+// CreateExperiment 管理员创建A/B实验（草稿状态）
+func CreateExperiment(c *gin.Context) {
+	// 从上下文获取用户信息（通过AdminAuthMiddleware已验证为管理员）
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+	dbUser := user.(models.User)
+
+	var input services.ExperimentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "data": err.Error()})
+		return
+	}
+
+	experiment, err := experimentService.CreateExperiment(input, dbUser.ID)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidExperiment) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建实验失败", "data": err.Error()})
+		return
+	}
+
+	// 记录管理员操作日志
+	adminLog := models.AdminLog{
+		AdminUserID: dbUser.ID,
+		Action:      "create_experiment",
+		TargetType:  "experiment",
+		TargetID:    experiment.ID,
+		Details:     fmt.Sprintf("创建实验 %s（%s），场景 %s，流量 %d%%，%d 个变体", experiment.Key, experiment.Name, experiment.Surface, experiment.TrafficPercent, len(experiment.Variants)),
+	}
+	models.DB.Create(&adminLog)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    experiment,
+	})
+}
+
+// GetExperiments 管理员获取实验列表
+func GetExperiments(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	experiments, total, err := experimentService.ListExperiments(c.Query("status"), page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取实验列表失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"experiments": experiments,
+			"pagination": gin.H{
+				"page":  page,
+				"limit": limit,
+				"total": total,
+			},
+		},
+	})
+}
+
+// UpdateExperimentStatus 管理员启动、暂停或结束实验
+func UpdateExperimentStatus(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+	dbUser := user.(models.User)
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的实验ID"})
+		return
+	}
+
+	var input struct {
+		Status string `json:"status" binding:"required,oneof=running paused finished"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "data": err.Error()})
+		return
+	}
+
+	experiment, err := experimentService.UpdateStatus(uint(id), input.Status)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "实验不存在"})
+		case errors.Is(err, services.ErrInvalidExperiment):
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		case errors.Is(err, services.ErrExperimentConflict):
+			c.JSON(http.StatusConflict, gin.H{"code": 409, "message": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新实验状态失败", "data": err.Error()})
+		}
+		return
+	}
+
+	// 记录管理员操作日志
+	adminLog := models.AdminLog{
+		AdminUserID: dbUser.ID,
+		Action:      "update_experiment_status",
+		TargetType:  "experiment",
+		TargetID:    experiment.ID,
+		Details:     fmt.Sprintf("将实验 %s 的状态变更为 %s", experiment.Key, experiment.Status),
+	}
+	models.DB.Create(&adminLog)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    experiment,
+	})
+}
+
+// GetExperimentReport 管理员查看实验各变体的点击率和阅读转化
+func GetExperimentReport(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的实验ID"})
+		return
+	}
+
+	report, err := experimentService.GetReport(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "实验不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取实验报告失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    report,
+	})
+}
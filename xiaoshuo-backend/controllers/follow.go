@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/services"
+	"xiaoshuo-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 书架更新通知服务实例
+var notificationService *services.NotificationService
+
+// InitNotificationService 初始化书架更新通知服务，每日摘要由定时任务发送
+func InitNotificationService() {
+	notificationService = services.NewNotificationService(models.DB)
+}
+
+// FollowNovel 关注小说（加入书架），已关注时更新通知方式
+func FollowNovel(c *gin.Context) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	novelID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的小说ID"})
+		return
+	}
+
+	var input struct {
+		NotifyMode string `json:"notify_mode"` // instant(即时通知), digest(每日摘要), off(不通知)，不传时新关注为即时通知
+	}
+	if err := c.ShouldBindJSON(&input); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "data": err.Error()})
+		return
+	}
+
+	follow, err := bookshelfService.AddNovel(claims.UserID, uint(novelID), nil, input.NotifyMode)
+	if err != nil {
+		respondBookshelfError(c, "关注小说失败", "小说不存在或未审核通过", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "已加入书架",
+			"follow":  follow,
+		},
+	})
+}
+
+// UnfollowNovel 取消关注小说（移出书架）
+func UnfollowNovel(c *gin.Context) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	novelID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的小说ID"})
+		return
+	}
+
+	// 物理删除，避免唯一索引与软删除记录冲突导致无法重新关注
+	result := models.DB.Unscoped().Where("user_id = ? AND novel_id = ?", claims.UserID, novelID).Delete(&models.NovelFollow{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "取消关注失败", "data": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "未关注该小说"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "已移出书架",
+		},
+	})
+}
+
+// GetFollowStatus 获取当前用户对小说的关注状态
+func GetFollowStatus(c *gin.Context) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	novelID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的小说ID"})
+		return
+	}
+
+	var follow models.NovelFollow
+	err = models.DB.Where("user_id = ? AND novel_id = ?", claims.UserID, novelID).First(&follow).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取关注状态失败", "data": err.Error()})
+		return
+	}
+
+	var followers int64
+	models.DB.Model(&models.NovelFollow{}).Where("novel_id = ?", novelID).Count(&followers)
+
+	data := gin.H{
+		"followed":  err == nil,
+		"followers": followers,
+	}
+	if err == nil {
+		data["notify_mode"] = follow.NotifyMode
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    data,
+	})
+}
+
+// GetUserFollows 获取当前用户关注的小说列表，按最近更新排序
+func GetUserFollows(c *gin.Context) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	var follows []models.NovelFollow
+	var count int64
+
+	query := models.DB.Model(&models.NovelFollow{}).Where("novel_follows.user_id = ?", claims.UserID)
+	query.Count(&count)
+
+	offset := (page - 1) * limit
+	if err := query.Joins("JOIN novels ON novels.id = novel_follows.novel_id").
+		Order("novels.last_chapter_at IS NULL, novels.last_chapter_at DESC, novel_follows.created_at DESC").
+		Offset(offset).Limit(limit).
+		Preload("Novel").
+		Find(&follows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取关注列表失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"follows": follows,
+			"pagination": gin.H{
+				"page":  page,
+				"limit": limit,
+				"total": count,
+			},
+		},
+	})
+}
+
+// GetUnreadMessageCount 获取当前用户消息中心的未读消息数
+func GetUnreadMessageCount(c *gin.Context) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	counts, err := notificationService.GetUnreadCounts(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取未读消息数失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"unread": counts,
+		},
+	})
+}
+
+// MarkMessagesRead 将消息标记为已读，all 为 true 时全部标记为已读（包括系统消息）
+func MarkMessagesRead(c *gin.Context) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	var input struct {
+		IDs []uint `json:"ids"` // 个人消息ID列表
+		All bool   `json:"all"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "data": err.Error()})
+		return
+	}
+	if !input.All && len(input.IDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请指定要标记的消息"})
+		return
+	}
+
+	if input.All {
+		if err := notificationService.MarkAllRead(claims.UserID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "标记已读失败", "data": err.Error()})
+			return
+		}
+	} else {
+		if _, err := notificationService.MarkRead(claims.UserID, input.IDs); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "标记已读失败", "data": err.Error()})
+			return
+		}
+	}
+
+	counts, err := notificationService.GetUnreadCounts(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取未读消息数失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "已标记为已读",
+			"unread":  counts,
+		},
+	})
+}
@@ -2,8 +2,10 @@ package controllers
 
 import (
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
 	"runtime"
@@ -11,14 +13,22 @@ import (
 	"strings"
 	"time"
 	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/services"
 	"xiaoshuo-backend/utils"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-// 控制章节解析的并发数，防止内存占用过高
-var chapterParseSem = make(chan struct{}, getParseConcurrencyLimit())
+// 上传解析任务服务实例
+var uploadJobService *services.UploadJobService
+
+// InitUploadJobService 初始化上传解析任务服务并启动工作协程
+// 工作协程数量控制章节解析的并发数，防止内存占用过高
+func InitUploadJobService() {
+	uploadJobService = services.NewUploadJobService(models.DB, getParseConcurrencyLimit())
+	uploadJobService.Start()
+}
 
 // 根据系统资源动态计算合适的并发解析数量
 func getParseConcurrencyLimit() int {
@@ -81,7 +91,14 @@ func UploadNovel(c *gin.Context) {
 		return
 	}
 
-	// 计算文件hash
+	// 连载状态（可选），不传时默认为已完结
+	serialStatus := c.PostForm("serial_status")
+	if serialStatus != "" && !services.IsValidSerialStatus(serialStatus) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的连载状态"})
+		return
+	}
+
+	// 读取上传文件
 	src, err := file.Open()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "打开上传文件失败", "data": err.Error()})
@@ -89,12 +106,27 @@ func UploadNovel(c *gin.Context) {
 	}
 	defer src.Close()
 
-	hash := sha256.New()
-	if _, err := io.Copy(hash, src); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "计算文件hash失败", "data": err.Error()})
+	fileData, err := io.ReadAll(src)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "读取上传文件失败", "data": err.Error()})
 		return
 	}
-	fileHash := fmt.Sprintf("%x", hash.Sum(nil))
+
+	// TXT文件检测编码并统一转换为UTF-8后再计算hash和保存，避免同一本书因编码不同重复上传
+	fileEncoding := utils.EncodingUTF8
+	isEPUB := hasSuffixIgnoreCase(file.Filename, ".epub")
+	if !isEPUB {
+		decoded, encodingName, err := utils.DecodeToUTF8(fileData)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无法识别文件编码，请转换为UTF-8或GBK编码后重新上传", "data": err.Error()})
+			return
+		}
+		fileData = decoded
+		fileEncoding = encodingName
+	}
+
+	// 计算文件hash
+	fileHash := fmt.Sprintf("%x", sha256.Sum256(fileData))
 
 	// 检查文件hash是否已存在
 	var existingNovel models.Novel
@@ -107,20 +139,24 @@ func UploadNovel(c *gin.Context) {
 	extension := getFileExtension(file.Filename)
 	filePath := fmt.Sprintf("uploads/%s%s", fileHash, extension)
 
-	// 保存文件
-	if err := c.SaveUploadedFile(file, filePath); err != nil {
+	// 保存文件（TXT文件保存转换后的UTF-8内容）
+	if err := os.MkdirAll("uploads", 0750); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "文件保存失败", "data": err.Error()})
+		return
+	}
+	if err := os.WriteFile(filePath, fileData, 0644); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "文件保存失败", "data": err.Error()})
 		return
 	}
 
 	// 估算字数（避免一次性读取大文件）
 	var wordCount int
-	if utils.IsEPUBFile(filePath) {
+	if isEPUB {
 		// 对于EPUB文件，通过读取部分内容估算字数
 		wordCount = estimateWordCountFromEPUB(filePath)
 	} else {
-		// 对于TXT文件，通过读取部分内容估算字数
-		wordCount = estimateWordCountFromTXT(filePath)
+		// TXT内容已在内存中，直接计算字数
+		wordCount = calculateWordCount(string(fileData))
 	}
 
 	// 创建小说记录
@@ -130,12 +166,14 @@ func UploadNovel(c *gin.Context) {
 		Protagonist:   c.PostForm("protagonist"),
 		Description:   c.PostForm("description"),
 		Filepath:      filePath,
-		FileSize:      file.Size,
+		FileSize:      int64(len(fileData)),
 		WordCount:     wordCount,
 		FileHash:      fileHash,
+		Encoding:      fileEncoding,
+		SerialStatus:  serialStatus,
 		UploadUserID:  claims.UserID,
 		Status:        "pending",        // 默认为待审核状态
-		ChapterStatus: "processing",     // 新增：章节解析状态
+		ChapterStatus: "pending",        // 章节解析状态，由解析任务更新
 	}
 
 	// 获取分类ID列表（可选）
@@ -207,46 +245,25 @@ func UploadNovel(c *gin.Context) {
 		}
 	}
 
-	// 同步解析章节（同步处理以确保上传后立即可用）
-	var chapters []models.Chapter
-	var chapterErr error
-
-	// 使用信号量控制并发，避免内存占用过高
-	chapterParseSem <- struct{}{}
-	defer func() { <-chapterParseSem }()
-
-	if utils.IsEPUBFile(filePath) {
-		// 解析EPUB文件的章节
-		chapters, chapterErr = utils.ParseChapterFromEPUB(filePath)
-	} else {
-		// 解析TXT文件的章节
-		chapters, chapterErr = utils.ParseChapterFromTXT(filePath)
+	// 创建章节解析任务，由后台工作协程异步解析
+	job, err := uploadJobService.Enqueue(tx, novel.ID, filePath)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建章节解析任务失败", "data": err.Error()})
+		// 清理已保存的文件
+		utils.DeleteFile(filePath)
+		return
 	}
 
-	if chapterErr == nil && len(chapters) > 0 {
-		// 保存章节信息
-		for i := range chapters {
-			chapters[i].NovelID = novel.ID
-		}
-		if err := tx.Create(&chapters).Error; err != nil {
-			// 如果章节保存失败，记录错误但继续
-			fmt.Printf("章节保存失败 (novel ID: %d): %v\n", novel.ID, err)
-		} else {
-			// 更新小说的章节统计和状态
-			models.DB.Model(&novel).Updates(map[string]interface{}{
-				"chapter_status": "completed", // 更新为完成状态
-			})
-		}
-	} else if chapterErr != nil {
-		// 如果章节解析失败，记录错误但继续，并更新状态
-		fmt.Printf("章节解析失败 (novel ID: %d): %v\n", novel.ID, chapterErr)
-		models.DB.Model(&novel).Update("chapter_status", "failed")
-	} else {
-		// 如果没有解析到章节，更新状态但不报错
-		models.DB.Model(&novel).Update("chapter_status", "completed")
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "提交事务失败", "data": err.Error()})
+		// 清理已保存的文件
+		utils.DeleteFile(filePath)
+		return
 	}
 
-	tx.Commit()
+	// 唤醒解析工作协程
+	uploadJobService.Notify()
 
 	// 记录上传次数到Redis以实现频率限制
 	if !claims.IsAdmin { // 管理员不受限制
@@ -260,24 +277,12 @@ func UploadNovel(c *gin.Context) {
 		"code":    200,
 		"message": "success",
 		"data": gin.H{
-			"novel":          novel,
-			"chapters_count": len(chapters), // 返回实际解析的章节数
+			"novel": novel,
+			"job":   job, // 章节解析任务，可通过章节状态接口查询进度
 		},
 	})
 }
 
-// estimateWordCountFromTXT 估算TXT文件的字数（根据文件大小，按3个字节一个中文字符估算）
-func estimateWordCountFromTXT(filePath string) int {
-	fileInfo, err := os.Stat(filePath)
-	if err != nil {
-		return 0
-	}
-
-	// 按3个字节一个中文字符估算字数
-	// 对于包含大量英文字符的文本，这个估算会偏小，但对中文文本比较准确
-	return int(fileInfo.Size() / 3)
-}
-
 // estimateWordCountFromEPUB 估算EPUB文件的字数
 func estimateWordCountFromEPUB(filePath string) int {
 	// EPUB文件是压缩格式，需要特殊处理
@@ -304,6 +309,8 @@ func GetNovels(c *gin.Context) {
 	author := c.Query("author")
 	categoryIDStr := c.Query("category_id")
 	uploadUserIDStr := c.Query("upload_user_id")
+	serialStatus := c.Query("serial_status") // serializing(连载中), completed(已完结)
+	sortBy := c.Query("sort")                // updated(最近更新), newest(最新上传)
 
 	var categoryID uint
 	if categoryIDStr != "" {
@@ -355,10 +362,21 @@ func GetNovels(c *gin.Context) {
 		dbQuery = dbQuery.Joins("JOIN novel_categories ON novels.id = novel_categories.novel_id").
 			Where("novel_categories.category_id = ?", categoryID)
 	}
+	if serialStatus != "" {
+		dbQuery = dbQuery.Where("serial_status = ?", serialStatus)
+	}
 
 	// 获取总数
 	dbQuery.Model(&models.Novel{}).Count(&count)
 
+	// 排序：最近更新按最新章节时间排序，连载追更后会排到前面
+	switch sortBy {
+	case "updated":
+		dbQuery = dbQuery.Order("novels.last_chapter_at IS NULL, novels.last_chapter_at DESC")
+	case "newest":
+		dbQuery = dbQuery.Order("novels.created_at DESC")
+	}
+
 	// 分页查询
 	offset := (page - 1) * limit
 	if err := dbQuery.Offset(offset).Limit(limit).Preload("UploadUser").Preload("Categories").Find(&novels).Error; err != nil {
@@ -423,23 +441,13 @@ func GetNovel(c *gin.Context) {
 		return
 	}
 
-	// 更新点击量
-	models.DB.Model(novel).UpdateColumns(map[string]interface{}{
-		"click_count":  gorm.Expr("click_count + ?", 1),
-		"today_clicks": gorm.Expr("today_clicks + ?", 1),
-		"week_clicks":  gorm.Expr("week_clicks + ?", 1),
-		"month_clicks": gorm.Expr("month_clicks + ?", 1),
-	})
+	// 记录点击，点击先写入缓冲区，由定时任务汇总后更新总点击量
+	if _, err := recordClick(c, novel.ID, claims.UserID); err != nil && !errors.Is(err, services.ErrClickRateLimited) {
+		log.Printf("记录小说点击失败 (novel ID: %d): %v", novel.ID, err)
+	}
 
-	// 使缓存失效以更新点击量
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				fmt.Printf("缓存失效协程发生panic (novel ID: %d): %v\n", uint(id), r)
-			}
-		}()
-		utils.GlobalCacheService.InvalidateNovelCache(uint(id))
-	}()
+	// 今日/本周/本月点击量从点击统计聚合表读取
+	applyClickWindows(novel)
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
@@ -489,6 +497,34 @@ func DeleteNovel(c *gin.Context) {
 		return
 	}
 
+	// 物理删除小说的分卷
+	if err := tx.Unscoped().Where("novel_id = ?", novel.ID).Delete(&models.Volume{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除分卷失败", "data": err.Error()})
+		return
+	}
+
+	// 物理删除小说的章节解析任务
+	if err := tx.Unscoped().Where("novel_id = ?", novel.ID).Delete(&models.UploadJob{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除章节解析任务失败", "data": err.Error()})
+		return
+	}
+
+	// 物理删除小说的更新记录
+	if err := tx.Unscoped().Where("novel_id = ?", novel.ID).Delete(&models.NovelUpdate{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除更新记录失败", "data": err.Error()})
+		return
+	}
+
+	// 物理删除小说的关注记录
+	if err := tx.Unscoped().Where("novel_id = ?", novel.ID).Delete(&models.NovelFollow{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除关注记录失败", "data": err.Error()})
+		return
+	}
+
 	// 删除小说的评论（包括评论的子评论）
 	var commentIDs []uint
 	var comments []models.Comment
@@ -706,25 +742,23 @@ func RecordNovelClick(c *gin.Context) {
 		return
 	}
 
-	// 更新点击量
-	if err := models.DB.Model(&novel).UpdateColumns(map[string]interface{}{
-		"click_count":  gorm.Expr("click_count + ?", 1),
-		"today_clicks": gorm.Expr("today_clicks + ?", 1),
-		"week_clicks":  gorm.Expr("week_clicks + ?", 1),
-		"month_clicks": gorm.Expr("month_clicks + ?", 1),
-	}).Error; err != nil {
+	// 记录点击，经过爬虫识别、IP限流和去重后写入缓冲区，由定时任务汇总后更新总点击量
+	verdict, err := recordClick(c, novel.ID, optionalUserID(c))
+	if err != nil {
+		if errors.Is(err, services.ErrClickRateLimited) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"code": 429, "message": "点击过于频繁，请稍后再试"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新点击量失败", "data": err.Error()})
 		return
 	}
 
-	// 使缓存失效以更新点击量
-	utils.GlobalCacheService.InvalidateNovelCache(uint(id))
-
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
 		"data": gin.H{
 			"message": "点击量已记录",
+			"counted": verdict == services.ClickVerdictCounted,
 		},
 	})
 }
@@ -904,6 +938,15 @@ func GetNovelChapters(c *gin.Context) {
 		}
 	}
 
+	// 获取分卷列表，构建分卷目录
+	volumes, err := utils.GlobalCacheService.GetNovelVolumesWithCache(uint(id))
+	if err != nil {
+		if err := models.DB.Where("novel_id = ?", novel.ID).Order("position ASC").Find(&volumes).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取分卷列表失败", "data": err.Error()})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
@@ -912,10 +955,55 @@ func GetNovelChapters(c *gin.Context) {
 			"title":          novel.Title,
 			"chapters":       chapters,
 			"total_chapters": len(chapters),
+			"volumes":        buildVolumeTOC(volumes, chapters),
+			"total_volumes":  len(volumes),
 		},
 	})
 }
 
+// buildVolumeTOC 构建分卷目录，未分卷的章节归入ID为0的分组并排在最前面
+// 分卷字数和章节数按当前章节实时统计
+func buildVolumeTOC(volumes []models.Volume, chapters []models.Chapter) []gin.H {
+	chaptersByVolume := make(map[uint][]gin.H)
+	wordsByVolume := make(map[uint]int)
+	for _, chapter := range chapters {
+		chaptersByVolume[chapter.VolumeID] = append(chaptersByVolume[chapter.VolumeID], gin.H{
+			"id":         chapter.ID,
+			"title":      chapter.Title,
+			"position":   chapter.Position,
+			"word_count": chapter.WordCount,
+		})
+		wordsByVolume[chapter.VolumeID] += chapter.WordCount
+	}
+
+	toc := make([]gin.H, 0, len(volumes)+1)
+	if unvolumed, ok := chaptersByVolume[0]; ok {
+		toc = append(toc, gin.H{
+			"id":            0,
+			"title":         "",
+			"position":      0,
+			"word_count":    wordsByVolume[0],
+			"chapter_count": len(unvolumed),
+			"chapters":      unvolumed,
+		})
+	}
+	for _, volume := range volumes {
+		volumeChapters := chaptersByVolume[volume.ID]
+		if volumeChapters == nil {
+			volumeChapters = []gin.H{}
+		}
+		toc = append(toc, gin.H{
+			"id":            volume.ID,
+			"title":         volume.Title,
+			"position":      volume.Position,
+			"word_count":    wordsByVolume[volume.ID],
+			"chapter_count": len(volumeChapters),
+			"chapters":      volumeChapters,
+		})
+	}
+	return toc
+}
+
 // GetChapterContent 获取章节内容
 func GetChapterContent(c *gin.Context) {
 	// 从JWT token获取用户信息
@@ -1048,6 +1136,9 @@ func GetNovelStatus(c *gin.Context) {
 		return
 	}
 
+	// 今日/本周/本月点击量从点击统计聚合表读取
+	applyClickWindows(&novel)
+
 	// 获取小说状态详情
 	statusInfo := gin.H{
 		"id":           novel.ID,
@@ -1236,6 +1327,24 @@ func GetChapterStatus(c *gin.Context) {
 	var chapterCount int64
 	models.DB.Model(&models.Chapter{}).Where("novel_id = ?", novel.ID).Count(&chapterCount)
 
+	// 获取最近一次解析任务的进度
+	var jobInfo gin.H
+	if job, err := uploadJobService.GetLatestJob(novel.ID); err == nil {
+		jobInfo = gin.H{
+			"id":             job.ID,
+			"status":         job.Status,
+			"stage":          job.Stage,
+			"progress":       job.Progress,
+			"chapter_count":  job.ChapterCount,
+			"attempts":       job.Attempts,
+			"max_attempts":   job.MaxAttempts,
+			"failure_reason": job.FailureReason,
+			"next_run_at":    job.NextRunAt,
+			"started_at":     job.StartedAt,
+			"finished_at":    job.FinishedAt,
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
@@ -1243,6 +1352,7 @@ func GetChapterStatus(c *gin.Context) {
 			"novel_id":       novel.ID,
 			"chapter_status": novel.ChapterStatus,
 			"chapter_count":  chapterCount,
+			"job":            jobInfo,
 			"upload_time":    novel.CreatedAt,
 			"update_time":    novel.UpdatedAt,
 		},
@@ -1313,8 +1423,26 @@ func ExportNovel(c *gin.Context) {
 		contentBuilder.WriteString("\n\n")
 	}
 	
+	// 获取分卷标题，导出时在每卷第一章前插入卷标题
+	var volumes []models.Volume
+	models.DB.Where("novel_id = ?", novel.ID).Find(&volumes)
+	volumeTitles := make(map[uint]string, len(volumes))
+	for _, volume := range volumes {
+		volumeTitles[volume.ID] = volume.Title
+	}
+
 	// 添加章节内容
+	var lastVolumeID uint
 	for i, chapter := range chapters {
+		if chapter.VolumeID != 0 && chapter.VolumeID != lastVolumeID {
+			if title, ok := volumeTitles[chapter.VolumeID]; ok {
+				contentBuilder.WriteString(title)
+				contentBuilder.WriteString("\n")
+				contentBuilder.WriteString(strings.Repeat("=", len([]rune(title))))
+				contentBuilder.WriteString("\n\n")
+			}
+		}
+		lastVolumeID = chapter.VolumeID
 		contentBuilder.WriteString(chapter.Title)
 		contentBuilder.WriteString("\n")
 		contentBuilder.WriteString(strings.Repeat("-", len([]rune(chapter.Title))))
@@ -1415,6 +1543,34 @@ func BatchDeleteNovels(c *gin.Context) {
 			return
 		}
 
+		// 物理删除小说的分卷
+		if err := tx.Unscoped().Where("novel_id = ?", novel.ID).Delete(&models.Volume{}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除分卷失败", "data": err.Error()})
+			return
+		}
+
+		// 物理删除小说的章节解析任务
+		if err := tx.Unscoped().Where("novel_id = ?", novel.ID).Delete(&models.UploadJob{}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除章节解析任务失败", "data": err.Error()})
+			return
+		}
+
+		// 物理删除小说的更新记录
+		if err := tx.Unscoped().Where("novel_id = ?", novel.ID).Delete(&models.NovelUpdate{}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除更新记录失败", "data": err.Error()})
+			return
+		}
+
+		// 物理删除小说的关注记录
+		if err := tx.Unscoped().Where("novel_id = ?", novel.ID).Delete(&models.NovelFollow{}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除关注记录失败", "data": err.Error()})
+			return
+		}
+
 		// 删除小说的评论（包括评论的子评论）
 		var commentIDs []uint
 		var comments []models.Comment
@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/services"
+	"xiaoshuo-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 连载追更服务实例
+var novelUpdateService *services.NovelUpdateService
+
+// InitNovelUpdateService 初始化连载追更服务
+func InitNovelUpdateService() {
+	novelUpdateService = services.NewNovelUpdateService(models.DB)
+}
+
+// AppendNovelFile 上传新版本的TXT/EPUB文件，由后台任务与已有章节比对后只追加新章节
+func AppendNovelFile(c *gin.Context) {
+	novel, ok := getEditableNovel(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "文件上传失败", "data": err.Error()})
+		return
+	}
+	if !hasSuffixIgnoreCase(file.Filename, ".txt") && !hasSuffixIgnoreCase(file.Filename, ".epub") {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "不支持的文件格式，仅支持.txt和.epub"})
+		return
+	}
+	if file.Size > 20*1024*1024 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "文件大小不能超过20MB"})
+		return
+	}
+	serialStatus := c.PostForm("serial_status")
+	if serialStatus != "" && !services.IsValidSerialStatus(serialStatus) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的连载状态: " + serialStatus})
+		return
+	}
+
+	// 新版本文件只用于比对章节，追加任务结束后即删除
+	if err := os.MkdirAll("uploads/append", 0750); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "文件保存失败", "data": err.Error()})
+		return
+	}
+	tempFile, err := os.CreateTemp("uploads/append", "append-*"+getFileExtension(file.Filename))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "文件保存失败", "data": err.Error()})
+		return
+	}
+	tempPath := tempFile.Name()
+	tempFile.Close()
+
+	if err := c.SaveUploadedFile(file, tempPath); err != nil {
+		os.Remove(tempPath)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "文件保存失败", "data": err.Error()})
+		return
+	}
+
+	claims := utils.GetClaims(c)
+	job, err := uploadJobService.EnqueueAppend(novel.ID, claims.UserID, tempPath, serialStatus)
+	if err != nil {
+		os.Remove(tempPath)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建章节追加任务失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "文件已上传，正在后台比对并追加新章节",
+			"job":     job,
+		},
+	})
+}
+
+// GetAppendJob 查询追加章节任务的进度，完成后返回生成的更新记录ID
+func GetAppendJob(c *gin.Context) {
+	novel, ok := getEditableNovel(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	jobID, err := strconv.ParseUint(c.Param("job_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的任务ID"})
+		return
+	}
+
+	job, err := uploadJobService.GetJob(novel.ID, uint(jobID))
+	if err != nil || job.Kind != services.UploadJobKindAppend {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "追加任务不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    job,
+	})
+}
+
+// AppendNovelChapters 提交章节批次，已存在的章节会被跳过
+func AppendNovelChapters(c *gin.Context) {
+	novel, ok := getEditableNovel(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Chapters []struct {
+			Title       string `json:"title" binding:"required,min=1,max=200"`
+			Content     string `json:"content" binding:"required"`
+			VolumeTitle string `json:"volume_title"` // 所属分卷标题，不传时归入最后一章所在的分卷
+		} `json:"chapters" binding:"required,min=1,dive"`
+		SerialStatus string `json:"serial_status"` // serializing(连载中), completed(已完结)，默认连载中
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "data": err.Error()})
+		return
+	}
+
+	chapters := make([]models.Chapter, len(input.Chapters))
+	volumeTitles := make([]string, len(input.Chapters))
+	for i, chapter := range input.Chapters {
+		chapters[i] = models.Chapter{Title: chapter.Title, Content: chapter.Content}
+		volumeTitles[i] = strings.TrimSpace(chapter.VolumeTitle)
+	}
+
+	claims := utils.GetClaims(c)
+	update, err := novelUpdateService.AppendChapters(novel.ID, claims.UserID, services.NovelUpdateSourceBatch,
+		utils.GroupChaptersByVolume(chapters, volumeTitles), input.SerialStatus)
+	if err != nil {
+		respondChapterEditError(c, "追加章节失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "章节更新成功",
+			"update":  update,
+		},
+	})
+}
+
+// UpdateNovelSerialStatus 修改小说的连载状态
+func UpdateNovelSerialStatus(c *gin.Context) {
+	novel, ok := getEditableNovel(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var input struct {
+		SerialStatus string `json:"serial_status" binding:"required,oneof=serializing completed"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "data": err.Error()})
+		return
+	}
+
+	if err := novelUpdateService.UpdateSerialStatus(novel.ID, input.SerialStatus); err != nil {
+		respondChapterEditError(c, "修改连载状态失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message":       "连载状态修改成功",
+			"serial_status": input.SerialStatus,
+		},
+	})
+}
+
+// GetNovelUpdates 获取小说的更新记录
+func GetNovelUpdates(c *gin.Context) {
+	novelID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的小说ID"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	updates, total, err := novelUpdateService.GetNovelUpdates(uint(novelID), page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取更新记录失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"updates": updates,
+			"pagination": gin.H{
+				"page":  page,
+				"limit": limit,
+				"total": total,
+			},
+		},
+	})
+}
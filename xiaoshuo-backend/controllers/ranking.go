@@ -1,15 +1,25 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/services"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
+// 排行榜服务实例
+var rankingService *services.RankingService
+
+// InitRankingService 初始化排行榜服务
+func InitRankingService() {
+	rankingService = services.NewRankingService(models.DB)
+}
+
 // GetRankings 获取排行榜
 func GetRankings(c *gin.Context) {
 	rankingType := c.Query("type") // total, today, week, month
@@ -20,29 +30,62 @@ func GetRankings(c *gin.Context) {
 		limit = 100
 	}
 
+	// 指定周期标识时返回已保存的历史榜单快照
+	if periodKey := c.Query("period_key"); periodKey != "" {
+		period := c.DefaultQuery("period", services.RankingPeriodDaily)
+		if !services.IsValidRankingPeriod(period) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "统计周期只能是 daily、weekly 或 monthly"})
+			return
+		}
+		if limit < 1 {
+			limit = 10
+		}
+		board := services.RankingBoardForType(strings.ToLower(rankingType))
+		snapshot, err := rankingService.GetBoard(board, services.RankingBoardPeriod(board, period), uint(categoryID), periodKey, limit)
+		if err != nil {
+			if errors.Is(err, services.ErrRankingNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "该周期的榜单快照不存在"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取排行榜失败", "data": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "success",
+			"data": gin.H{
+				"type":     rankingType,
+				"snapshot": snapshot,
+				"limit":    limit,
+			},
+		})
+		return
+	}
+
 	var novels []models.Novel
-	var query *gorm.DB
+	var err error
 
-	// 根据排行榜类型构建查询
+	// 根据排行榜类型构建查询，今日/本周/本月按点击统计聚合表的滚动窗口排序
 	switch strings.ToLower(rankingType) {
 	case "today":
-		query = models.DB.Where("status = ?", "approved").Order("today_clicks DESC")
+		novels, err = clickStatService.RankNovelsByWindow(services.ClickWindowDay, uint(categoryID), limit)
 	case "week":
-		query = models.DB.Where("status = ?", "approved").Order("week_clicks DESC")
+		novels, err = clickStatService.RankNovelsByWindow(services.ClickWindowWeek, uint(categoryID), limit)
 	case "month":
-		query = models.DB.Where("status = ?", "approved").Order("month_clicks DESC")
+		novels, err = clickStatService.RankNovelsByWindow(services.ClickWindowMonth, uint(categoryID), limit)
 	default: // total
-		query = models.DB.Where("status = ?", "approved").Order("click_count DESC")
-	}
+		query := models.DB.Where("status = ?", "approved").Order("click_count DESC")
 
-	// 如果指定了分类
-	if categoryID > 0 {
-		query = query.Joins("JOIN novel_categories ON novels.id = novel_categories.novel_id").
-			Where("novel_categories.category_id = ?", categoryID)
+		// 如果指定了分类
+		if categoryID > 0 {
+			query = query.Joins("JOIN novel_categories ON novels.id = novel_categories.novel_id").
+				Where("novel_categories.category_id = ?", categoryID)
+		}
+		err = query.Limit(limit).Preload("UploadUser").Find(&novels).Error
 	}
 
 	// 获取排行榜数据
-	if err := query.Limit(limit).Preload("UploadUser").Find(&novels).Error; err != nil {
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取排行榜失败", "data": err.Error()})
 		return
 	}
@@ -56,4 +99,163 @@ func GetRankings(c *gin.Context) {
 			"limit":   limit,
 		},
 	})
-}
\ No newline at end of file
+}
+
+// GetRankingBoards 获取可用的榜单和统计周期
+func GetRankingBoards(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"boards":  services.RankingBoards,
+			"periods": services.RankingPeriods,
+		},
+	})
+}
+
+// parseRankingBoardQuery 解析榜单类型、统计周期和分类参数，参数无效时返回错误响应并返回 false
+func parseRankingBoardQuery(c *gin.Context) (string, string, uint, bool) {
+	board := c.Param("board")
+	if !services.IsValidRankingBoard(board) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的榜单类型"})
+		return "", "", 0, false
+	}
+	period := c.DefaultQuery("period", services.RankingPeriodWeekly)
+	if !services.IsValidRankingPeriod(period) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "统计周期只能是 daily、weekly 或 monthly"})
+		return "", "", 0, false
+	}
+	categoryID, _ := strconv.ParseUint(c.DefaultQuery("category_id", "0"), 10, 64)
+	return board, services.RankingBoardPeriod(board, period), uint(categoryID), true
+}
+
+// GetRankingBoard 获取榜单快照，默认返回最新一期，可通过 period_key 查看历史榜单
+func GetRankingBoard(c *gin.Context) {
+	board, period, categoryID, ok := parseRankingBoardQuery(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	snapshot, err := rankingService.GetBoard(board, period, categoryID, c.Query("period_key"), limit)
+	if err != nil {
+		if errors.Is(err, services.ErrRankingNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "榜单尚未生成"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取排行榜失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    snapshot,
+	})
+}
+
+// GetRankingBoardHistory 获取榜单的历史快照列表
+func GetRankingBoardHistory(c *gin.Context) {
+	board, period, categoryID, ok := parseRankingBoardQuery(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "30"))
+	if limit < 1 || limit > 100 {
+		limit = 30
+	}
+
+	snapshots, err := rankingService.GetBoardHistory(board, period, categoryID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取榜单历史失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"board":     board,
+			"period":    period,
+			"snapshots": snapshots,
+		},
+	})
+}
+
+// GetNovelRankHistory 获取小说的榜单名次历史
+// 指定 board 时返回该榜单各期的名次和升降；不指定时返回小说在各榜单上的上榜概况（首次上榜、最高名次、最近名次）
+func GetNovelRankHistory(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的小说ID"})
+		return
+	}
+	categoryID, _ := strconv.ParseUint(c.DefaultQuery("category_id", "0"), 10, 64)
+
+	var novel models.Novel
+	if err := models.DB.Select("id, title").First(&novel, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "小说不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取小说信息失败", "data": err.Error()})
+		return
+	}
+
+	board := c.Query("board")
+	if board == "" {
+		summaries, err := rankingService.GetNovelRankSummary(novel.ID, uint(categoryID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取上榜记录失败", "data": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "success",
+			"data": gin.H{
+				"novel_id":    novel.ID,
+				"title":       novel.Title,
+				"category_id": categoryID,
+				"boards":      summaries,
+			},
+		})
+		return
+	}
+
+	if !services.IsValidRankingBoard(board) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的榜单类型"})
+		return
+	}
+	period := c.DefaultQuery("period", services.RankingPeriodDaily)
+	if !services.IsValidRankingPeriod(period) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "统计周期只能是 daily、weekly 或 monthly"})
+		return
+	}
+	period = services.RankingBoardPeriod(board, period)
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "90"))
+	if limit < 1 || limit > 365 {
+		limit = 90
+	}
+
+	history, err := rankingService.GetNovelRankHistory(novel.ID, board, period, uint(categoryID), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取名次历史失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"novel_id":    novel.ID,
+			"title":       novel.Title,
+			"board":       board,
+			"period":      period,
+			"category_id": categoryID,
+			"history":     history,
+		},
+	})
+}
@@ -50,6 +50,27 @@ func SaveReadingProgress(c *gin.Context) {
 		return
 	}
 
+	// 根据章节确定所属分卷，章节名称未提供时使用章节标题
+	var volumeID uint
+	var volumeTitle string
+	if input.ChapterID > 0 {
+		var chapter models.Chapter
+		if err := models.DB.Where("id = ? AND novel_id = ?", input.ChapterID, novelID).First(&chapter).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "章节不存在"})
+			return
+		}
+		if input.ChapterName == "" {
+			input.ChapterName = chapter.Title
+		}
+		if chapter.VolumeID != 0 {
+			var volume models.Volume
+			if err := models.DB.First(&volume, chapter.VolumeID).Error; err == nil {
+				volumeID = volume.ID
+				volumeTitle = volume.Title
+			}
+		}
+	}
+
 	// 查找或创建用户的阅读进度记录
 	var progress models.ReadingProgress
 	result := models.DB.Where("user_id = ? AND novel_id = ?", claims.UserID, novelID).First(&progress)
@@ -62,6 +83,8 @@ func SaveReadingProgress(c *gin.Context) {
 				NovelID:     uint(novelID),
 				ChapterID:   input.ChapterID,
 				ChapterName: input.ChapterName,
+				VolumeID:    volumeID,
+				VolumeTitle: volumeTitle,
 				Position:    input.Position,
 				Progress:    input.Progress,
 				ReadingTime: input.ReadingTime,
@@ -85,6 +108,8 @@ func SaveReadingProgress(c *gin.Context) {
 		// 更新现有的阅读进度记录
 		progress.ChapterID = input.ChapterID
 		progress.ChapterName = input.ChapterName
+		progress.VolumeID = volumeID
+		progress.VolumeTitle = volumeTitle
 		progress.Position = input.Position
 		progress.Progress = input.Progress
 		progress.ReadingTime = newReadingTime
@@ -1,12 +1,14 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"xiaoshuo-backend/models"
 	"xiaoshuo-backend/services"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // 推荐服务实例
@@ -35,6 +37,16 @@ func GetRecommendations(c *gin.Context) {
 	// 获取推荐类型
 	recommendType := c.Query("type") // popular, new, similar, random
 
+	// 未指定推荐类型时，参与A/B实验的用户使用变体指定的推荐类型；明确请求的类型（如相关推荐）不参与实验
+	userID := optionalUserID(c)
+	var assignment *services.ExperimentAssignment
+	if recommendType == "" {
+		assignment = assignVariant(userID, services.ExperimentSurfaceRecommendations)
+		if assignment != nil && assignment.Params.Strategy != "" {
+			recommendType = assignment.Params.Strategy
+		}
+	}
+
 	var novels []models.Novel
 	var queryErr error
 
@@ -77,6 +89,8 @@ func GetRecommendations(c *gin.Context) {
 		return
 	}
 
+	logExposures(assignment, userID, novels)
+
 	// 计算总数（这里简化处理）
 	totalCount := len(novels)
 
@@ -85,6 +99,7 @@ func GetRecommendations(c *gin.Context) {
 		"message": "success",
 		"data": gin.H{
 			"novels": novels,
+			"experiment": assignment,
 			"pagination": gin.H{
 				"page":  page,
 				"limit": limit,
@@ -119,18 +134,36 @@ func GetPersonalizedRecommendations(c *gin.Context) {
 		limit = 10
 	}
 
+	// 参与A/B实验的用户使用变体指定的协同过滤权重
+	service := recommendationService
+	assignment := assignVariant(userModel.ID, services.ExperimentSurfacePersonalized)
+	if assignment != nil && assignment.Params.CFBlendWeight != nil {
+		service = recommendationService.WithCFBlendWeight(*assignment.Params.CFBlendWeight)
+	}
+
 	// 使用个性化推荐服务
-	novels, err := recommendationService.PersonalizedRecommendation(userModel.ID, limit)
+	recommendations, err := service.ExplainedPersonalizedRecommendation(userModel.ID, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取个性化推荐失败", "data": err.Error()})
 		return
 	}
 
+	// 小说列表与推荐理由按相同顺序返回
+	novels := make([]models.Novel, len(recommendations))
+	explanations := make([]services.RecommendationExplanation, len(recommendations))
+	for i, recommendation := range recommendations {
+		novels[i] = recommendation.Novel
+		explanations[i] = recommendation.Explanation
+	}
+	logExposures(assignment, userModel.ID, novels)
+
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 		"message": "success",
 		"data": gin.H{
 			"novels": novels,
+			"explanations": explanations,
+			"experiment": assignment,
 			"type": "personalized",
 			"pagination": gin.H{
 				"page":  page,
@@ -139,4 +172,48 @@ func GetPersonalizedRecommendations(c *gin.Context) {
 			},
 		},
 	})
-}
\ No newline at end of file
+}
+
+// GetAlsoReadRecommendations 读过这本书的读者还读过
+// 优先使用协同过滤计算的相似小说，尚无足够读者行为时回退到基于内容的推荐
+func GetAlsoReadRecommendations(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的小说ID"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if limit < 1 || limit > 50 {
+		limit = 10
+	}
+
+	source := "collaborative"
+	neighbors, err := recommendationService.AlsoReadRecommendation(uint(id), limit)
+	if err == nil && len(neighbors) == 0 {
+		// 回退到基于内容的推荐
+		source = "content"
+		var novels []models.Novel
+		novels, err = recommendationService.ContentBasedRecommendation(uint(id), limit)
+		for _, novel := range novels {
+			neighbors = append(neighbors, services.NeighborNovel{Novel: novel})
+		}
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "小说不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取相关推荐失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"novel_id": id,
+			"source":   source,
+			"novels":   neighbors,
+		},
+	})
+}
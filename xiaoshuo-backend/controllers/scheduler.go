@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 定时任务调度器实例
+var scheduler *services.Scheduler
+
+// InitScheduler 初始化定时任务调度器，注册维护任务并启动调度
+func InitScheduler() {
+	scheduler = services.NewScheduler(models.DB)
+
+	jobs := []services.ScheduledJob{
+		{
+			Name:        "flush_click_stats",
+			Description: "将Redis缓冲区中的点击汇总到按小时/按天的点击统计表",
+			Spec:        "*/5 * * * *",
+			Timeout:     4 * time.Minute,
+			Run: func(ctx context.Context) (string, error) {
+				return clickStatService.FlushClickBuffer()
+			},
+		},
+		{
+			Name:        "prune_click_stats",
+			Description: "清理超过8天的按小时点击统计",
+			Spec:        "20 4 * * *",
+			Timeout:     10 * time.Minute,
+			Run: func(ctx context.Context) (string, error) {
+				deleted, err := clickStatService.PruneHourlyStats(8 * 24 * time.Hour)
+				return fmt.Sprintf("删除%d条按小时点击统计", deleted), err
+			},
+		},
+		{
+			Name:        "compute_rankings",
+			Description: "计算点击、评分、热评、完读、飙升、新完结和字数榜的日榜、周榜和月榜快照",
+			Spec:        "10 0 * * *",
+			Timeout:     30 * time.Minute,
+			Run: func(ctx context.Context) (string, error) {
+				return rankingService.ComputeAll(time.Now())
+			},
+		},
+		{
+			Name:        "build_item_neighbors",
+			Description: "根据读者的阅读、评分和评论行为重新计算小说之间的协同过滤相似度",
+			Spec:        "40 2 * * *",
+			Timeout:     time.Hour,
+			Run: func(ctx context.Context) (string, error) {
+				return recommendationService.BuildItemNeighbors()
+			},
+		},
+		{
+			Name:        "expire_pending_novels",
+			Description: "自动拒绝超过30天未审核的小说",
+			Spec:        "30 3 * * *",
+			Timeout:     30 * time.Minute,
+			Run: func(ctx context.Context) (string, error) {
+				rejected, err := ProcessExpiredNovels()
+				return fmt.Sprintf("自动拒绝%d本过期小说", rejected), err
+			},
+		},
+		{
+			Name:        "send_update_digests",
+			Description: "向选择每日摘要的读者发送书架更新摘要",
+			Spec:        "0 8 * * *",
+			Timeout:     30 * time.Minute,
+			Run: func(ctx context.Context) (string, error) {
+				sent, err := notificationService.SendDigests()
+				return fmt.Sprintf("发送%d条更新摘要", sent), err
+			},
+		},
+		{
+			Name:        "prune_search_outbox",
+			Description: "清理超过7天的搜索索引变更记录",
+			Spec:        "50 4 * * *",
+			Timeout:     10 * time.Minute,
+			Run: func(ctx context.Context) (string, error) {
+				deleted, err := searchIndexer.PruneOutbox(7 * 24 * time.Hour)
+				return fmt.Sprintf("删除%d条搜索索引变更记录", deleted), err
+			},
+		},
+	}
+	for _, job := range jobs {
+		if err := scheduler.Register(job); err != nil {
+			log.Printf("注册定时任务 %s 失败: %v", job.Name, err)
+		}
+	}
+
+	scheduler.Start()
+}
+
+// GetScheduledJobs 管理员获取定时任务列表及最近一次运行结果
+func GetScheduledJobs(c *gin.Context) {
+	jobs, err := scheduler.ListJobs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取定时任务失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"jobs": jobs,
+		},
+	})
+}
+
+// GetScheduledJobRuns 管理员获取定时任务的运行历史
+func GetScheduledJobRuns(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	runs, total, err := scheduler.GetJobRuns(c.Param("name"), page, limit)
+	if err != nil {
+		if errors.Is(err, services.ErrJobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "定时任务不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取运行记录失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"runs": runs,
+			"pagination": gin.H{
+				"page":  page,
+				"limit": limit,
+				"total": total,
+			},
+		},
+	})
+}
+
+// TriggerScheduledJob 管理员手动触发定时任务，任务在后台运行
+func TriggerScheduledJob(c *gin.Context) {
+	// 从上下文获取用户信息（通过AdminAuthMiddleware已验证为管理员）
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	dbUser := user.(models.User)
+	name := c.Param("name")
+
+	run, err := scheduler.Trigger(name, dbUser.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrJobNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "定时任务不存在"})
+		case errors.Is(err, services.ErrJobRunning):
+			c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "定时任务正在运行，请稍后再试"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "触发定时任务失败", "data": err.Error()})
+		}
+		return
+	}
+
+	// 记录管理员操作日志
+	adminLog := models.AdminLog{
+		AdminUserID: dbUser.ID,
+		Action:      "trigger_scheduled_job",
+		TargetType:  "scheduled_job",
+		TargetID:    run.ID,
+		Details:     fmt.Sprintf("管理员手动触发定时任务: %s", name),
+	}
+	models.DB.Create(&adminLog)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "定时任务已开始运行",
+			"run":     run,
+		},
+	})
+}
@@ -1,185 +1,85 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/services"
 	"xiaoshuo-backend/utils"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-// SearchNovels 搜索小说（基础搜索）
+// SearchNovels 搜索小说（基础搜索），过滤、排序和分面统计均由搜索索引完成
 func SearchNovels(c *gin.Context) {
-	keyword := c.Query("q")
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-	categoryID, _ := strconv.Atoi(c.Query("category_id"))
-	minScore, _ := strconv.ParseFloat(c.Query("min_score"), 64)
-	maxScore, _ := strconv.ParseFloat(c.Query("max_score"), 64)
-
-	var novels []models.Novel
-	var count int64
-
-	// 构建查询
-	query := models.DB.Where("status = ?", "approved")
-
-	// 添加搜索关键词条件
-	if keyword != "" {
-		keyword = "%" + keyword + "%"
-		query = query.Where("title LIKE ? OR author LIKE ? OR protagonist LIKE ? OR description LIKE ?", 
-			keyword, keyword, keyword, keyword)
+	opts, err := parseNovelSearchOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
 	}
-
-	// 添加分类条件
-	if categoryID > 0 {
-		query = query.Joins("JOIN novel_categories ON novels.id = novel_categories.novel_id").
-			Where("novel_categories.category_id = ?", categoryID)
+	if utils.GlobalSearchIndex == nil {
+		searchIndexUnavailable(c)
+		return
 	}
+	assignment, userID := assignSearchVariant(c, &opts)
 
-	// 添加评分范围条件
-	if minScore > 0 || maxScore > 0 {
-		// 获取所有小说ID，然后在应用层过滤评分
-		// 这样避免了复杂的JOIN和GROUP BY查询问题
-		var novelIDs []uint
-		tempQuery := models.DB.Table("novels").Where("status = ?", "approved")
-		
-		// 添加搜索关键词条件
-		if keyword != "" {
-			keyword = "%" + keyword + "%"
-			tempQuery = tempQuery.Where("title LIKE ? OR author LIKE ? OR protagonist LIKE ? OR description LIKE ?", 
-				keyword, keyword, keyword, keyword)
-		}
-
-		// 添加分类条件
-		if categoryID > 0 {
-			tempQuery = tempQuery.Joins("JOIN novel_categories ON novels.id = novel_categories.novel_id").
-				Where("novel_categories.category_id = ?", categoryID)
-		}
-		
-		tempQuery.Pluck("novels.id", &novelIDs)
-		
-		// 过滤评分范围
-		if len(novelIDs) > 0 {
-			// 获取评分数据
-			var ratedNovels []struct {
-				ID    uint
-				AvgRating float64
-			}
-			
-			// 使用子查询获取每本小说的平均评分
-			ratingQuery := `SELECT n.id, COALESCE(AVG(r.score), 0) as avg_rating
-							FROM novels n
-							LEFT JOIN ratings r ON n.id = r.novel_id
-							WHERE n.id IN ? 
-							GROUP BY n.id`
-							
-			if minScore > 0 && maxScore > 0 {
-				ratingQuery += " HAVING AVG(r.score) >= ? AND AVG(r.score) <= ?"
-				if err := models.DB.Raw(ratingQuery, novelIDs, minScore, maxScore).Scan(&ratedNovels).Error; err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "搜索小说失败", "data": err.Error()})
-					return
-				}
-			} else if minScore > 0 {
-				ratingQuery += " HAVING AVG(r.score) >= ?"
-				if err := models.DB.Raw(ratingQuery, novelIDs, minScore).Scan(&ratedNovels).Error; err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "搜索小说失败", "data": err.Error()})
-					return
-				}
-			} else if maxScore > 0 {
-				ratingQuery += " HAVING AVG(r.score) <= ?"
-				if err := models.DB.Raw(ratingQuery, novelIDs, maxScore).Scan(&ratedNovels).Error; err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "搜索小说失败", "data": err.Error()})
-					return
-				}
-			} else {
-				if err := models.DB.Raw(ratingQuery, novelIDs).Scan(&ratedNovels).Error; err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "搜索小说失败", "data": err.Error()})
-					return
-				}
-			}
-			
-			// 提取符合条件的小说ID
-			var filteredNovelIDs []uint
-			for _, rn := range ratedNovels {
-				filteredNovelIDs = append(filteredNovelIDs, rn.ID)
-			}
-			
-			if len(filteredNovelIDs) == 0 {
-				// 如果没有符合条件的小说，返回空结果
-				c.JSON(http.StatusOK, gin.H{
-					"code": 200,
-					"message": "success",
-					"data": gin.H{
-						"novels": []models.Novel{},
-						"pagination": gin.H{
-							"page":  page,
-							"limit": limit,
-							"total": 0,
-						},
-					},
-				})
-				return
-			}
-			
-			// 构建最终查询
-			query = query.Where("novels.id IN ?", filteredNovelIDs)
-		} else {
-			// 如果没有小说ID匹配其他条件，直接返回空结果
-			c.JSON(http.StatusOK, gin.H{
-				"code": 200,
-				"message": "success",
-				"data": gin.H{
-					"novels": []models.Novel{},
-					"pagination": gin.H{
-						"page":  page,
-						"limit": limit,
-						"total": 0,
-					},
-				},
-			})
-			return
-		}
+	result, err := utils.GlobalSearchIndex.SearchNovelsWithOptions(opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "搜索小说失败", "data": err.Error()})
+		return
 	}
-
-	// 获取总数
-	query.Model(&models.Novel{}).Count(&count)
-
-	// 分页查询
-	offset := (page - 1) * limit
-	if err := query.Offset(offset).Limit(limit).
-		Preload("UploadUser").
-		Preload("Categories").
-		Order("click_count DESC").
-		Find(&novels).Error; err != nil {
+	novels, err := loadSearchNovels(result.NovelIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "搜索小说失败", "data": err.Error()})
+		return
+	}
+	if err := nameCategoryFacets(result.Facets); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "搜索小说失败", "data": err.Error()})
 		return
 	}
+	facets, total := result.Facets, result.Total
+	logExposures(assignment, userID, novels)
 
 	// 记录搜索统计和搜索历史
 	go func() {
-		recordSearchStat(keyword)
-		recordSearchHistory(c, keyword)
+		recordSearchStat(opts.Query)
+		recordSearchHistory(c, opts.Query)
 	}()
 
+	// 没有结果时给出纠错建议
+	suggestion := ""
+	if total == 0 {
+		suggestion = didYouMean(opts)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"code": 200,
+		"code":    200,
 		"message": "success",
 		"data": gin.H{
-			"novels": novels,
+			"novels":     novels,
+			"facets":     facets,
+			"suggestion": suggestion,
+			"experiment": assignment,
 			"pagination": gin.H{
-				"page":  page,
-				"limit": limit,
-				"total": count,
+				"page":  opts.Page,
+				"limit": opts.Size,
+				"total": total,
+				"sort":  opts.Sort,
 			},
 		},
 	})
 }
 
+// searchIndexUnavailable 搜索索引未初始化时返回503
+func searchIndexUnavailable(c *gin.Context) {
+	c.JSON(http.StatusServiceUnavailable, gin.H{"code": 503, "message": "搜索服务暂不可用"})
+}
+
 // 记录搜索统计的辅助函数
 func recordSearchStat(keyword string) {
 	SearchStatForKeyword(keyword)
@@ -283,20 +183,26 @@ func SearchStatForKeyword(keyword string) {
 }
 
 // FullTextSearchNovels 全文搜索小说
+// type=metadata（默认）搜索元数据，查询词支持字段限定、短语、排除、OR 和数值范围等搜索语法（见 utils.ParseNovelQuery），
+// 并支持与基础搜索相同的过滤、排序和分面统计；type=content 按章节内容搜索
 func FullTextSearchNovels(c *gin.Context) {
 	defer func() {
 		if r := recover(); r != nil {
 			// 捕获任何panic并返回错误
 			c.JSON(http.StatusInternalServerError, gin.H{
-				"code": 500,
+				"code":    500,
 				"message": "搜索过程中发生错误",
 			})
 		}
 	}()
-	
+
 	// 获取搜索参数
-	queryStr := c.Query("q")
-	if queryStr == "" {
+	opts, err := parseNovelSearchOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	if opts.Query == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    400,
 			"message": "搜索关键词不能为空",
@@ -304,17 +210,10 @@ func FullTextSearchNovels(c *gin.Context) {
 		return
 	}
 
-	// 获取分页参数
-	pageStr := c.Query("page")
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		page = 1
-	}
-
-	limitStr := c.Query("limit")
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit < 1 {
-		limit = 10
+	// 检查搜索索引是否已初始化，未初始化时不能返回空结果冒充没有匹配
+	if utils.GlobalSearchIndex == nil {
+		searchIndexUnavailable(c)
+		return
 	}
 
 	// 搜索类型，默认为metadata（元数据搜索）
@@ -323,117 +222,68 @@ func FullTextSearchNovels(c *gin.Context) {
 		searchType = "metadata"
 	}
 
-	var novelIDs []uint
-	var total int
+	// 按相关度等排序的元数据搜索参与搜索排序实验，章节内容搜索不参与
+	var assignment *services.ExperimentAssignment
+	var userID uint
+	if searchType != "content" {
+		assignment, userID = assignSearchVariant(c, &opts)
+	}
 
-	// 检查搜索索引是否已初始化
-	if utils.GlobalSearchIndex == nil {
-		// 如果索引未初始化，返回空结果而不是错误
+	respond := func(novels []models.Novel, facets map[string][]utils.FacetCount, total int) {
 		c.JSON(http.StatusOK, gin.H{
-			"code": 200,
+			"code":    200,
 			"message": "success",
 			"data": gin.H{
-				"novels": []models.Novel{},
+				"novels":     novels,
+				"facets":     facets,
+				"experiment": assignment,
 				"pagination": gin.H{
-					"page":  page,
-					"limit": limit,
-					"total": 0,
-					"query": queryStr,
+					"page":  opts.Page,
+					"limit": opts.Size,
+					"total": total,
+					"query": opts.Query,
 					"type":  searchType,
+					"sort":  opts.Sort,
 				},
 			},
 		})
-		return
 	}
 
-	// 根据搜索类型执行不同的搜索，使用更安全的错误处理
-	var searchErr error
-	switch searchType {
-	case "content":
-		// 搜索小说内容
-		novelIDs, total, searchErr = func() (ids []uint, t int, err error) {
-			defer func() {
-				if r := recover(); r != nil {
-					err = fmt.Errorf("搜索内容时发生错误: %v", r)
-				}
-			}()
-			ids, t, err = utils.GlobalSearchIndex.SearchNovelContent(queryStr, page, limit)
-			return
-		}()
-	case "metadata":
+	var novelIDs []uint
+	var total int
+	facets := emptySearchFacets()
+	if searchType == "content" {
+		// 搜索小说章节内容
+		novelIDs, total, err = utils.GlobalSearchIndex.SearchNovelContent(opts.Query, opts.Page, opts.Size)
+	} else {
 		// 搜索小说元数据（标题、作者、描述等）
-		novelIDs, total, searchErr = func() (ids []uint, t int, err error) {
-			defer func() {
-				if r := recover(); r != nil {
-					err = fmt.Errorf("搜索元数据时发生错误: %v", r)
-				}
-			}()
-			ids, t, err = utils.GlobalSearchIndex.SearchNovels(queryStr, page, limit)
-			return
-		}()
-	default:
-		// 默认搜索元数据
-		novelIDs, total, searchErr = func() (ids []uint, t int, err error) {
-			defer func() {
-				if r := recover(); r != nil {
-					err = fmt.Errorf("搜索元数据时发生错误: %v", r)
-				}
-			}()
-			ids, t, err = utils.GlobalSearchIndex.SearchNovels(queryStr, page, limit)
-			return
-		}()
+		var result *utils.NovelSearchResult
+		opts.Advanced = true
+		if result, err = utils.GlobalSearchIndex.SearchNovelsWithOptions(opts); err == nil {
+			novelIDs, total, facets = result.NovelIDs, result.Total, result.Facets
+			err = nameCategoryFacets(facets)
+		}
 	}
-
-	if searchErr != nil {
+	if errors.Is(err, utils.ErrInvalidSearchQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	if err != nil {
 		// 如果搜索出错，记录错误但返回空结果而不是错误
-		c.Error(fmt.Errorf("全文搜索错误: %v", searchErr))
-		c.JSON(http.StatusOK, gin.H{
-			"code": 200,
-			"message": "success",
-			"data": gin.H{
-				"novels": []models.Novel{},
-				"pagination": gin.H{
-					"page":  page,
-					"limit": limit,
-					"total": 0,
-					"query": queryStr,
-					"type":  searchType,
-				},
-			},
-		})
+		c.Error(fmt.Errorf("全文搜索错误: %v", err))
+		respond([]models.Novel{}, emptySearchFacets(), 0)
 		return
 	}
 
-	// 根据搜索结果获取小说详情
-	var novels []models.Novel
-	if len(novelIDs) > 0 {
-		// 构建查询条件，按搜索结果的顺序返回小说
-		for _, id := range novelIDs {
-			var novel models.Novel
-			if err := models.DB.Where("id = ? AND status = ?", id, "approved").
-				Preload("UploadUser").
-				Preload("Categories").
-				Preload("Keywords").
-				First(&novel).Error; err == nil {
-				novels = append(novels, novel)
-			}
-		}
+	// 根据搜索结果获取小说详情，按搜索结果的顺序返回
+	novels, err := loadSearchNovels(novelIDs)
+	if err != nil {
+		c.Error(fmt.Errorf("全文搜索错误: %v", err))
+		respond([]models.Novel{}, emptySearchFacets(), 0)
+		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"code": 200,
-		"message": "success",
-		"data": gin.H{
-			"novels": novels,
-			"pagination": gin.H{
-				"page":  page,
-				"limit": limit,
-				"total": total,
-				"query": queryStr,
-				"type":  searchType,
-			},
-		},
-	})
+	logExposures(assignment, userID, novels)
+	respond(novels, facets, total)
 }
 
 // IndexNovelForSearch 为小说建立搜索索引
@@ -479,8 +329,8 @@ func IndexNovelForSearch(c *gin.Context) {
 		return
 	}
 
-	// 为小说建立索引
-	if err := utils.GlobalSearchIndex.IndexNovel(novel); err != nil {
+	// 为小说元数据和全部章节建立索引
+	if err := services.ReindexNovel(models.DB, novel.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    500,
 			"message": "建立索引失败",
@@ -489,20 +339,6 @@ func IndexNovelForSearch(c *gin.Context) {
 		return
 	}
 
-	// 如果小说文件存在，也为内容建立索引
-	content, err := utils.ReadFileContent(novel.Filepath)
-	if err == nil {
-		if err := utils.GlobalSearchIndex.IndexNovelContent(uint(id), content); err != nil {
-			// 内容索引失败不影响整体流程，仅记录日志
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"code":    500,
-				"message": "为小说内容建立索引失败",
-				"data":    err.Error(),
-			})
-			return
-		}
-	}
-
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 		"message": "success",
@@ -535,41 +371,23 @@ func RebuildSearchIndex(c *gin.Context) {
 		return
 	}
 
-	// 获取所有已批准的小说
-	var novels []models.Novel
-	if err := models.DB.Where("status = ?", "approved").
-		Preload("Keywords").
-		Find(&novels).Error; err != nil {
+	// 为所有小说及其章节重建索引，审核状态随文档写入索引，搜索时再按状态过滤
+	total, failedCount, err := services.RebuildSearchIndex(models.DB)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    500,
-			"message": "获取小说列表失败",
+			"message": "重建搜索索引失败",
 			"data":    err.Error(),
 		})
 		return
 	}
 
-	// 为每本小说建立索引
-	failedCount := 0
-	for _, novel := range novels {
-		// 为小说元数据建立索引
-		if err := utils.GlobalSearchIndex.IndexNovel(novel); err != nil {
-			failedCount++
-			continue
-		}
-
-		// 为小说内容建立索引
-		content, err := utils.ReadFileContent(novel.Filepath)
-		if err == nil {
-			utils.GlobalSearchIndex.IndexNovelContent(novel.ID, content)
-		}
-	}
-
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 		"message": "success",
 		"data": gin.H{
 			"message":      "搜索索引重建完成",
-			"total_novels": len(novels),
+			"total_novels": total,
 			"failed_count": failedCount,
 		},
 	})
@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// chapterSearchResult 章节搜索结果，附带所属小说的标题和作者
+type chapterSearchResult struct {
+	utils.ChapterHit
+	NovelTitle  string `json:"novel_title"`
+	NovelAuthor string `json:"novel_author"`
+}
+
+// SearchChapters 全站章节搜索，返回匹配章节的高亮片段和匹配位置
+func SearchChapters(c *gin.Context) {
+	queryStr := strings.TrimSpace(c.Query("q"))
+	if queryStr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "搜索关键词不能为空"})
+		return
+	}
+	page, limit := chapterSearchPaging(c)
+
+	hits, total, err := searchChapterHits(queryStr, 0, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "搜索章节失败", "data": err.Error()})
+		return
+	}
+
+	// 索引只返回已审核小说的章节，这里补充小说标题和作者
+	// 状态变更尚未同步到索引时按数据库中的状态再过滤一次
+	novelIDs := make([]uint, 0, len(hits))
+	for _, hit := range hits {
+		novelIDs = append(novelIDs, hit.NovelID)
+	}
+	novels := make(map[uint]models.Novel)
+	if len(novelIDs) > 0 {
+		var list []models.Novel
+		if err := models.DB.Select("id", "title", "author").Where("id IN ? AND status = ?", novelIDs, "approved").Find(&list).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "搜索章节失败", "data": err.Error()})
+			return
+		}
+		for _, novel := range list {
+			novels[novel.ID] = novel
+		}
+	}
+
+	results := make([]chapterSearchResult, 0, len(hits))
+	for _, hit := range hits {
+		novel, ok := novels[hit.NovelID]
+		if !ok {
+			continue
+		}
+		results = append(results, chapterSearchResult{ChapterHit: hit, NovelTitle: novel.Title, NovelAuthor: novel.Author})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"chapters": results,
+			"pagination": gin.H{
+				"page":  page,
+				"limit": limit,
+				"total": total,
+				"query": queryStr,
+			},
+		},
+	})
+}
+
+// SearchWithinNovel 在一本小说内搜索，结果按章节顺序返回，读者可根据匹配位置跳转到对应段落
+func SearchWithinNovel(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的小说ID"})
+		return
+	}
+	queryStr := strings.TrimSpace(c.Query("q"))
+	if queryStr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "搜索关键词不能为空"})
+		return
+	}
+	page, limit := chapterSearchPaging(c)
+
+	var novel models.Novel
+	if err := models.DB.Select("id", "title", "status").First(&novel, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "小说不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取小说信息失败", "data": err.Error()})
+		return
+	}
+	if novel.Status != "approved" {
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "小说尚未通过审核"})
+		return
+	}
+
+	hits, total, err := searchChapterHits(queryStr, novel.ID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "搜索章节失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"novel_id": novel.ID,
+			"chapters": hits,
+			"pagination": gin.H{
+				"page":  page,
+				"limit": limit,
+				"total": total,
+				"query": queryStr,
+			},
+		},
+	})
+}
+
+// chapterSearchPaging 读取章节搜索的分页参数，每页最多50条
+func chapterSearchPaging(c *gin.Context) (int, int) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 {
+		limit = 10
+	}
+	if limit > 50 {
+		limit = 50
+	}
+	return page, limit
+}
+
+// searchChapterHits 执行章节搜索，索引未初始化时返回空结果
+func searchChapterHits(queryStr string, novelID uint, page, limit int) (hits []utils.ChapterHit, total int, err error) {
+	if utils.GlobalSearchIndex == nil {
+		return []utils.ChapterHit{}, 0, nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("搜索章节时发生错误: %v", r)
+		}
+	}()
+	return utils.GlobalSearchIndex.SearchChapters(queryStr, novelID, page, limit)
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errInvalidSearchParam = errors.New("无效的搜索参数")
+
+// parseNovelSearchOptions 读取小说搜索的过滤、排序和分页参数，只搜索已审核的小说
+// 支持的参数：q, category_ids（或 category_id，逗号分隔）, keywords（逗号分隔）, min_words, max_words,
+// min_score, max_score, serial_status, updated_after, updated_before, sort, page, limit
+func parseNovelSearchOptions(c *gin.Context) (utils.NovelSearchOptions, error) {
+	opts := utils.NovelSearchOptions{
+		Query:  strings.TrimSpace(c.Query("q")),
+		Status: "approved",
+		Sort:   c.DefaultQuery("sort", utils.SearchSortRelevance),
+		Facets: true,
+	}
+
+	var err error
+	if opts.Page, err = strconv.Atoi(c.DefaultQuery("page", "1")); err != nil || opts.Page < 1 {
+		opts.Page = 1
+	}
+	if opts.Size, err = strconv.Atoi(c.DefaultQuery("limit", "10")); err != nil || opts.Size < 1 {
+		opts.Size = 10
+	}
+	if opts.Size > 100 {
+		opts.Size = 100
+	}
+
+	categoryParam := c.Query("category_ids")
+	if categoryParam == "" {
+		categoryParam = c.Query("category_id")
+	}
+	for _, part := range splitParam(categoryParam) {
+		id, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return opts, fmt.Errorf("%w: 分类ID %s", errInvalidSearchParam, part)
+		}
+		opts.CategoryIDs = append(opts.CategoryIDs, uint(id))
+	}
+	opts.Keywords = splitParam(c.Query("keywords"))
+
+	if opts.MinWords, err = intParam(c, "min_words"); err != nil {
+		return opts, err
+	}
+	if opts.MaxWords, err = intParam(c, "max_words"); err != nil {
+		return opts, err
+	}
+	if opts.MinRating, err = floatParam(c, "min_score"); err != nil {
+		return opts, err
+	}
+	if opts.MaxRating, err = floatParam(c, "max_score"); err != nil {
+		return opts, err
+	}
+
+	switch opts.SerialStatus = c.Query("serial_status"); opts.SerialStatus {
+	case "", "serializing", "completed":
+	default:
+		return opts, fmt.Errorf("%w: 连载状态只能为 serializing 或 completed", errInvalidSearchParam)
+	}
+
+	if opts.UpdatedAfter, err = timeParam(c, "updated_after"); err != nil {
+		return opts, err
+	}
+	if opts.UpdatedBefore, err = timeParam(c, "updated_before"); err != nil {
+		return opts, err
+	}
+
+	switch opts.Sort {
+	case utils.SearchSortRelevance, utils.SearchSortRating, utils.SearchSortClicks, utils.SearchSortNewest:
+	default:
+		return opts, fmt.Errorf("%w: 排序方式只能为 relevance、rating、clicks 或 newest", errInvalidSearchParam)
+	}
+	return opts, nil
+}
+
+// splitParam 按逗号拆分参数并去掉空项
+func splitParam(value string) []string {
+	parts := make([]string, 0)
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+func intParam(c *gin.Context, name string) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%w: %s", errInvalidSearchParam, name)
+	}
+	return n, nil
+}
+
+func floatParam(c *gin.Context, name string) (float64, error) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("%w: %s", errInvalidSearchParam, name)
+	}
+	return f, nil
+}
+
+// timeParam 解析日期参数，支持 2006-01-02 和 RFC3339 格式
+func timeParam(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidSearchParam, name)
+	}
+	return &t, nil
+}
+
+// loadSearchNovels 按搜索结果的顺序加载已审核的小说
+func loadSearchNovels(novelIDs []uint) ([]models.Novel, error) {
+	novels := make([]models.Novel, 0, len(novelIDs))
+	if len(novelIDs) == 0 {
+		return novels, nil
+	}
+
+	var list []models.Novel
+	if err := models.DB.Where("id IN ? AND status = ?", novelIDs, "approved").
+		Preload("UploadUser").
+		Preload("Categories").
+		Preload("Keywords").
+		Find(&list).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Novel, len(list))
+	for _, novel := range list {
+		byID[novel.ID] = novel
+	}
+	for _, id := range novelIDs {
+		if novel, ok := byID[id]; ok {
+			novels = append(novels, novel)
+		}
+	}
+	return novels, nil
+}
+
+// nameCategoryFacets 为分类分面填充分类名称
+func nameCategoryFacets(facets map[string][]utils.FacetCount) error {
+	counts := facets[utils.FacetCategory]
+	if len(counts) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(counts))
+	for _, count := range counts {
+		ids = append(ids, count.Key)
+	}
+	var categories []models.Category
+	if err := models.DB.Select("id", "name").Where("id IN ?", ids).Find(&categories).Error; err != nil {
+		return err
+	}
+	names := make(map[string]string, len(categories))
+	for _, category := range categories {
+		names[strconv.FormatUint(uint64(category.ID), 10)] = category.Name
+	}
+	for i := range counts {
+		counts[i].Name = names[counts[i].Key]
+	}
+	return nil
+}
+
+// emptySearchFacets 索引不可用时返回的空分面
+func emptySearchFacets() map[string][]utils.FacetCount {
+	return map[string][]utils.FacetCount{
+		utils.FacetCategory:  {},
+		utils.FacetWordCount: {},
+		utils.FacetRating:    {},
+	}
+}
+
+// didYouMean 为没有结果的搜索返回纠错建议，只返回按当前过滤条件能搜到小说的候选词，没有时返回空字符串
+func didYouMean(opts utils.NovelSearchOptions) string {
+	if utils.GlobalSearchIndex == nil || opts.Query == "" {
+		return ""
+	}
+	for _, suggestion := range utils.SuggestQuery(opts.Query, 3) {
+		check := opts
+		check.Query, check.Facets, check.Page, check.Size = suggestion, false, 1, 1
+		if result, err := utils.GlobalSearchIndex.SearchNovelsWithOptions(check); err == nil && result.Total > 0 {
+			return suggestion
+		}
+	}
+	return ""
+}
@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	"net/http"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 搜索索引同步器实例
+var searchIndexer *services.SearchIndexer
+
+// InitSearchIndexer 初始化搜索索引同步器并启动后台同步
+func InitSearchIndexer() {
+	searchIndexer = services.NewSearchIndexer(models.DB)
+	searchIndexer.Start()
+}
+
+// GetSearchIndexStatus 获取搜索索引的同步延迟，并对比数据库与索引中的小说和章节数量
+func GetSearchIndexStatus(c *gin.Context) {
+	status, err := searchIndexer.Status()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取搜索索引状态失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    status,
+	})
+}
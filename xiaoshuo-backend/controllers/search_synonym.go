@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 搜索词典服务实例
+var searchDictionaryService *services.SearchDictionaryService
+
+// InitSearchDictionaryService 初始化搜索词典服务，加载同义词和纠错建议候选词并定期刷新
+func InitSearchDictionaryService() {
+	searchDictionaryService = services.NewSearchDictionaryService(models.DB)
+	searchDictionaryService.Start()
+}
+
+// synonymInput 创建或修改同义词组的参数
+type synonymInput struct {
+	Words []string `json:"words" binding:"required,min=2"`
+}
+
+// GetSearchSynonyms 管理员获取同义词组列表
+func GetSearchSynonyms(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	synonyms, total, err := searchDictionaryService.ListSynonyms(c.Query("keyword"), page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取同义词列表失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"synonyms": synonyms,
+			"pagination": gin.H{
+				"page":  page,
+				"limit": limit,
+				"total": total,
+			},
+		},
+	})
+}
+
+// CreateSearchSynonym 管理员创建同义词组，如 {"words": ["网游", "游戏"]}
+func CreateSearchSynonym(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+	dbUser := user.(models.User)
+
+	var input synonymInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "data": err.Error()})
+		return
+	}
+
+	synonym, err := searchDictionaryService.CreateSynonym(input.Words, dbUser.ID)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidSynonym) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建同义词失败", "data": err.Error()})
+		return
+	}
+
+	// 记录管理员操作日志
+	adminLog := models.AdminLog{
+		AdminUserID: dbUser.ID,
+		Action:      "create_search_synonym",
+		TargetType:  "search_synonym",
+		TargetID:    synonym.ID,
+		Details:     fmt.Sprintf("创建同义词组 %s", synonym.Words),
+	}
+	models.DB.Create(&adminLog)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    synonym,
+	})
+}
+
+// UpdateSearchSynonym 管理员修改同义词组
+func UpdateSearchSynonym(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+	dbUser := user.(models.User)
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的同义词ID"})
+		return
+	}
+
+	var input synonymInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "data": err.Error()})
+		return
+	}
+
+	synonym, err := searchDictionaryService.UpdateSynonym(uint(id), input.Words)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "同义词组不存在"})
+		case errors.Is(err, services.ErrInvalidSynonym):
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "修改同义词失败", "data": err.Error()})
+		}
+		return
+	}
+
+	// 记录管理员操作日志
+	adminLog := models.AdminLog{
+		AdminUserID: dbUser.ID,
+		Action:      "update_search_synonym",
+		TargetType:  "search_synonym",
+		TargetID:    synonym.ID,
+		Details:     fmt.Sprintf("将同义词组修改为 %s", synonym.Words),
+	}
+	models.DB.Create(&adminLog)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    synonym,
+	})
+}
+
+// DeleteSearchSynonym 管理员删除同义词组
+func DeleteSearchSynonym(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+	dbUser := user.(models.User)
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的同义词ID"})
+		return
+	}
+
+	synonym, err := searchDictionaryService.DeleteSynonym(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "同义词组不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除同义词失败", "data": err.Error()})
+		return
+	}
+
+	// 记录管理员操作日志
+	adminLog := models.AdminLog{
+		AdminUserID: dbUser.ID,
+		Action:      "delete_search_synonym",
+		TargetType:  "search_synonym",
+		TargetID:    synonym.ID,
+		Details:     fmt.Sprintf("删除同义词组 %s", synonym.Words),
+	}
+	models.DB.Create(&adminLog)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+	})
+}
@@ -996,38 +996,36 @@ func GetUserSocialStats(c *gin.Context) {
 	})
 }
 
-// GetUserSystemMessages 获取系统消息列表（普通用户可访问，仅返回已发布的消息）
+// GetUserSystemMessages 获取消息中心的消息列表（普通用户可访问）
+// 合并已发布的系统消息和书架更新等个人消息，按时间倒序排列
 func GetUserSystemMessages(c *gin.Context) {
 	// 从中间件获取用户信息（验证用户是否已登录）
-	_, exists := c.Get("user")
+	user, exists := c.Get("user")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "未授权访问"})
 		return
 	}
+	dbUser := user.(models.User)
 
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
 	messageType := c.Query("type")
 
-	var messages []models.SystemMessage
-	var count int64
-
-	// 构建查询，只获取已发布的系统消息
-	query := models.DB.Where("is_published = ?", true)
-
-	if messageType != "" {
-		query = query.Where("type = ?", messageType)
+	messages, count, err := notificationService.GetInbox(dbUser.ID, messageType, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取系统消息失败", "data": err.Error()})
+		return
 	}
 
-	// 获取总数
-	query.Model(&models.SystemMessage{}).Count(&count)
-
-	// 分页查询
-	offset := (page - 1) * limit
-	if err := query.Offset(offset).Limit(limit).
-		Order("created_at DESC").
-		Find(&messages).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取系统消息失败", "data": err.Error()})
+	unread, err := notificationService.GetUnreadCounts(dbUser.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取未读消息数失败", "data": err.Error()})
 		return
 	}
 
@@ -1036,6 +1034,7 @@ func GetUserSystemMessages(c *gin.Context) {
 		"message": "success",
 		"data": gin.H{
 			"messages": messages,
+			"unread":   unread,
 			"pagination": gin.H{
 				"page":  page,
 				"limit": limit,
@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/services"
+	"xiaoshuo-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 用户偏好服务实例
+var userPreferenceService *services.UserPreferenceService
+
+// InitUserPreferenceService 初始化用户偏好服务
+func InitUserPreferenceService() {
+	userPreferenceService = services.NewUserPreferenceService(models.DB)
+}
+
+// GetOnboardingOptions 获取新用户引导的可选分类和热门关键词，以及当前用户是否已完成引导
+func GetOnboardingOptions(c *gin.Context) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("keyword_limit", "30"))
+	if limit < 1 || limit > 100 {
+		limit = 30
+	}
+
+	categories, keywords, err := userPreferenceService.GetOnboardingOptions(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取引导选项失败", "data": err.Error()})
+		return
+	}
+	preference, err := userPreferenceService.GetPreference(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取偏好设置失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"onboarded":  preference.OnboardedAt != nil,
+			"categories": categories,
+			"keywords":   keywords,
+		},
+	})
+}
+
+// GetUserPreferences 获取当前用户的偏好设置
+func GetUserPreferences(c *gin.Context) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	preference, err := userPreferenceService.GetPreference(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取偏好设置失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    preference,
+	})
+}
+
+// UpdateUserPreferences 保存当前用户的偏好设置（新用户引导提交时也调用此接口）
+func UpdateUserPreferences(c *gin.Context) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	var input services.PreferenceInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "data": err.Error()})
+		return
+	}
+
+	preference, err := userPreferenceService.SavePreference(claims.UserID, input)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPreference) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "保存偏好设置失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    preference,
+	})
+}
+
+// MarkNovelNotInterested 将推荐的小说标记为不感兴趣
+func MarkNovelNotInterested(c *gin.Context) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	novelID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的小说ID"})
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason" binding:"max=255"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "data": err.Error()})
+		return
+	}
+
+	feedback, err := userPreferenceService.MarkNotInterested(claims.UserID, uint(novelID), input.Reason)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "小说不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "提交反馈失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message":  "将减少此类推荐",
+			"feedback": feedback,
+		},
+	})
+}
+
+// UndoNovelNotInterested 撤销对小说的不感兴趣反馈
+func UndoNovelNotInterested(c *gin.Context) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	novelID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的小说ID"})
+		return
+	}
+
+	removed, err := userPreferenceService.RemoveFeedback(claims.UserID, uint(novelID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "撤销反馈失败", "data": err.Error()})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "未找到该反馈"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message": "已撤销不感兴趣",
+		},
+	})
+}
+
+// GetNotInterestedNovels 获取当前用户标记为不感兴趣的小说
+func GetNotInterestedNovels(c *gin.Context) {
+	claims := utils.GetClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户信息失败"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	feedbacks, total, err := userPreferenceService.GetFeedbacks(claims.UserID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取反馈列表失败", "data": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"feedbacks": feedbacks,
+			"pagination": gin.H{
+				"page":  page,
+				"limit": limit,
+				"total": total,
+			},
+		},
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"xiaoshuo-backend/middleware"
 	"xiaoshuo-backend/models"
 	"xiaoshuo-backend/routes"
+	"xiaoshuo-backend/services"
 	"xiaoshuo-backend/utils"
 
 	"github.com/gin-gonic/gin"
@@ -57,12 +58,62 @@ func main() {
 		log.Printf("初始化搜索索引失败: %v", err)
 	} else {
 		log.Println("搜索索引初始化成功")
+		// 加载分词词典，映射版本变化时在后台重建索引
+		go services.PrepareSearchIndex(models.DB)
 	}
 
+	// 初始化搜索索引同步服务（消费索引变更发件箱）
+	controllers.InitSearchIndexer()
+	log.Println("搜索索引同步服务初始化成功")
+
+	// 初始化搜索词典服务（同义词和纠错建议）
+	controllers.InitSearchDictionaryService()
+	log.Println("搜索词典服务初始化成功")
+
 	// 初始化推荐服务
 	controllers.InitRecommendationService()
 	log.Println("推荐服务初始化成功")
 
+	// 初始化上传解析任务服务（恢复中断任务并启动工作协程）
+	controllers.InitUploadJobService()
+	log.Println("上传解析任务服务初始化成功")
+
+	// 初始化章节编辑服务
+	controllers.InitChapterService()
+	log.Println("章节编辑服务初始化成功")
+
+	// 初始化连载追更服务
+	controllers.InitNovelUpdateService()
+	log.Println("连载追更服务初始化成功")
+
+	// 初始化书架服务
+	controllers.InitBookshelfService()
+	log.Println("书架服务初始化成功")
+
+	// 初始化书架更新通知服务
+	controllers.InitNotificationService()
+	log.Println("书架更新通知服务初始化成功")
+
+	// 初始化点击统计服务
+	controllers.InitClickStatService()
+	log.Println("点击统计服务初始化成功")
+
+	// 初始化A/B实验服务
+	controllers.InitExperimentService()
+	log.Println("A/B实验服务初始化成功")
+
+	// 初始化用户偏好服务
+	controllers.InitUserPreferenceService()
+	log.Println("用户偏好服务初始化成功")
+
+	// 初始化排行榜服务
+	controllers.InitRankingService()
+	log.Println("排行榜服务初始化成功")
+
+	// 初始化定时任务调度器（点击统计汇总、排行榜计算、过期小说处理、更新摘要等）
+	controllers.InitScheduler()
+	log.Println("定时任务调度器初始化成功")
+
 	// 设置运行模式
 	gin.SetMode(config.GlobalConfig.Server.Mode)
 
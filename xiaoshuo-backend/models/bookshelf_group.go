@@ -0,0 +1,18 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// BookshelfGroup 书架分组模型
+type BookshelfGroup struct {
+	gorm.Model
+	UserID   uint   `gorm:"index;comment:所属用户ID" json:"user_id"`       // 所属用户ID
+	Name     string `gorm:"size:50;not null;comment:分组名称" json:"name"` // 分组名称
+	Position int    `gorm:"default:0;comment:分组排序位置" json:"position"`  // 分组排序位置
+}
+
+// TableName 指定表名
+func (BookshelfGroup) TableName() string {
+	return "bookshelf_groups"
+}
@@ -10,9 +10,11 @@ type Chapter struct {
 	Title     string `gorm:"not null;size:255;comment:章节标题" json:"title" validate:"required,min=1,max=200"` // 章节标题
 	Content   string `gorm:"type:text;comment:章节内容" json:"content"`                                         // 章节内容
 	WordCount int    `gorm:"comment:章节字数" json:"word_count"`                                                // 章节字数
+	ContentHash string `gorm:"size:64;comment:章节内容哈希值，用于连载更新去重" json:"content_hash"`                       // 章节内容哈希值，用于连载更新去重
 	Position  int    `gorm:"index:idx_novel_position;comment:章节在小说中的位置" json:"position"`                     // 章节在小说中的位置
 	NovelID   uint   `gorm:"index:idx_novel_position;comment:所属小说ID" json:"novel_id"`                        // 所属小说ID
 	Novel     Novel  `json:"novel"`                                                                         // 关联的小说
+	VolumeID  uint   `gorm:"index;default:0;comment:所属分卷ID，0表示未分卷" json:"volume_id"`                     // 所属分卷ID，0表示未分卷
 	FilePath  string `gorm:"comment:章节内容文件路径（对于大章节）" json:"file_path"`                                      // 章节内容文件路径（对于大章节）
 	FileSize  int64  `gorm:"comment:章节文件大小（字节）" json:"file_size"`                                           // 章节文件大小（字节）
 }
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// ChapterRule 章节标题识别规则模型
+type ChapterRule struct {
+	gorm.Model
+	Name        string `gorm:"not null;size:100;comment:规则名称" json:"name" validate:"required,min=1,max=100"`                                                                                  // 规则名称
+	Type        string `gorm:"size:20;comment:规则类型：volume(卷), chapter(章), prologue(序章), epilogue(尾声), numbered(数字编号)" json:"type" validate:"oneof=volume chapter prologue epilogue numbered"` // 规则类型：volume(卷), chapter(章), prologue(序章), epilogue(尾声), numbered(数字编号)
+	Pattern     string `gorm:"not null;size:500;comment:匹配章节标题行的正则表达式" json:"pattern" validate:"required,max=500"`                                                                            // 匹配章节标题行的正则表达式
+	Priority    int    `gorm:"default:0;comment:匹配顺序，数值越小越先匹配" json:"priority"`                                                                                                               // 匹配顺序，数值越小越先匹配
+	MaxLength   int    `gorm:"default:0;comment:标题最大字符数，0表示使用全局设置" json:"max_length"`                                                                                                         // 标题最大字符数，0表示使用全局设置
+	Description string `gorm:"comment:规则说明" json:"description" validate:"max=500"`                                                                                                            // 规则说明
+	IsActive    bool   `gorm:"default:true;comment:是否启用该规则" json:"is_active"`                                                                                                                 // 是否启用该规则
+	CreatedBy   uint   `gorm:"comment:创建者ID" json:"created_by"`                                                                                                                               // 创建者ID
+	UpdatedBy   uint   `gorm:"comment:更新者ID" json:"updated_by"`                                                                                                                               // 更新者ID
+}
+
+// TableName 指定表名
+func (ChapterRule) TableName() string {
+	return "chapter_rules"
+}
+
+// ChapterParseSetting 章节解析全局设置模型（仅使用一条记录）
+type ChapterParseSetting struct {
+	gorm.Model
+	MinChapterLength  int  `gorm:"default:20;comment:章节最少字数，低于该值视为过短章节" json:"min_chapter_length"` // 章节最少字数，低于该值视为过短章节
+	MergeTinyChapters bool `gorm:"default:true;comment:是否将过短章节合并到上一章" json:"merge_tiny_chapters"`  // 是否将过短章节合并到上一章
+	MaxTitleLength    int  `gorm:"default:40;comment:章节标题最大字符数" json:"max_title_length"`           // 章节标题最大字符数
+	UpdatedBy         uint `gorm:"comment:更新者ID" json:"updated_by"`                                // 更新者ID
+}
+
+// TableName 指定表名
+func (ChapterParseSetting) TableName() string {
+	return "chapter_parse_settings"
+}
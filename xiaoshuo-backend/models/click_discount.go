@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ClickDiscount 刷量点击扣除记录模型，管理员将某段时间内的点击判定为刷量后按比例扣除
+type ClickDiscount struct {
+	gorm.Model
+	NovelID          uint      `gorm:"index;comment:小说ID" json:"novel_id"`                    // 小说ID
+	Novel            Novel     `gorm:"foreignKey:NovelID" json:"novel,omitempty"`             // 小说
+	AdminUserID      uint      `gorm:"index;comment:操作管理员ID" json:"admin_user_id"`            // 操作管理员ID
+	StartAt          time.Time `gorm:"comment:扣除区间开始时间" json:"start_at"`                      // 扣除区间开始时间（按小时对齐）
+	EndAt            time.Time `gorm:"comment:扣除区间结束时间" json:"end_at"`                        // 扣除区间结束时间（按小时对齐）
+	Ratio            float64   `gorm:"comment:扣除比例" json:"ratio"`                             // 扣除比例，0-1
+	DiscountedClicks int64     `gorm:"default:0;comment:本次调整的扣除点击数" json:"discounted_clicks"` // 本次调整的扣除点击数，负数表示恢复
+	Reason           string    `gorm:"type:text;comment:扣除原因" json:"reason"`                  // 扣除原因
+}
+
+// TableName 指定表名
+func (ClickDiscount) TableName() string {
+	return "click_discounts"
+}
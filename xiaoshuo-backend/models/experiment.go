@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Experiment A/B实验模型，按用户ID哈希将部分流量分配到不同的策略变体
+type Experiment struct {
+	gorm.Model
+	Key            string              `gorm:"column:experiment_key;uniqueIndex;size:50;not null;comment:实验标识，同时作为分桶哈希的盐" json:"key"`                        // 实验标识，同时作为分桶哈希的盐，创建后不可修改（key 为MySQL保留字，列名使用 experiment_key）
+	Name           string              `gorm:"size:100;not null;comment:实验名称" json:"name"`                                                                   // 实验名称
+	Description    string              `gorm:"type:text;comment:实验说明" json:"description"`                                                                    // 实验说明
+	Surface        string              `gorm:"size:30;index;not null;comment:实验作用的场景：recommendations(推荐), personalized(个性化推荐), search(搜索排序)" json:"surface"` // 实验作用的场景：recommendations(推荐), personalized(个性化推荐), search(搜索排序)
+	Status         string              `gorm:"size:20;default:'draft';comment:实验状态：draft(草稿), running(进行中), paused(已暂停), finished(已结束)" json:"status"`       // 实验状态：draft(草稿), running(进行中), paused(已暂停), finished(已结束)
+	TrafficPercent int                 `gorm:"default:100;comment:进入实验的用户比例（百分比）" json:"traffic_percent"`                                                    // 进入实验的用户比例（百分比），其余用户使用默认策略
+	StartedAt      *time.Time          `gorm:"comment:开始时间" json:"started_at"`                                                                               // 开始时间
+	EndedAt        *time.Time          `gorm:"comment:结束时间" json:"ended_at"`                                                                                 // 结束时间
+	CreatedBy      uint                `gorm:"comment:创建管理员ID" json:"created_by"`                                                                            // 创建管理员ID
+	Variants       []ExperimentVariant `gorm:"foreignKey:ExperimentID" json:"variants"`                                                                      // 实验变体
+}
+
+// TableName 指定表名
+func (Experiment) TableName() string {
+	return "experiments"
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ExperimentExposure 实验曝光记录模型，每条记录对应一本展示给用户的小说
+type ExperimentExposure struct {
+	gorm.Model
+	ExperimentID uint       `gorm:"index:idx_exposure_experiment_variant;comment:实验ID" json:"experiment_id"` // 实验ID
+	VariantID    uint       `gorm:"index:idx_exposure_experiment_variant;comment:变体ID" json:"variant_id"`    // 变体ID
+	UserID       uint       `gorm:"index:idx_exposure_user_novel;comment:用户ID" json:"user_id"`               // 用户ID
+	NovelID      uint       `gorm:"index:idx_exposure_user_novel;comment:小说ID" json:"novel_id"`              // 小说ID
+	Position     int        `gorm:"comment:展示位置，从1开始" json:"position"`                                       // 展示位置，从1开始
+	Clicked      bool       `gorm:"default:false;comment:是否被点击" json:"clicked"`                              // 是否被点击
+	ClickedAt    *time.Time `gorm:"comment:点击时间" json:"clicked_at"`                                          // 点击时间
+}
+
+// TableName 指定表名
+func (ExperimentExposure) TableName() string {
+	return "experiment_exposures"
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// ExperimentVariant 实验变体模型
+type ExperimentVariant struct {
+	gorm.Model
+	ExperimentID uint   `gorm:"uniqueIndex:idx_experiment_variant_key;comment:实验ID" json:"experiment_id"`                  // 实验ID
+	Key          string `gorm:"column:variant_key;uniqueIndex:idx_experiment_variant_key;size:50;comment:变体标识" json:"key"` // 变体标识，如 control、cf_heavy（列名使用 variant_key）
+	Name         string `gorm:"size:100;comment:变体名称" json:"name"`                                                         // 变体名称
+	Weight       int    `gorm:"default:1;comment:流量分配权重" json:"weight"`                                                    // 流量分配权重，实验内流量按权重比例分配
+	IsControl    bool   `gorm:"default:false;comment:是否为对照组" json:"is_control"`                                            // 是否为对照组
+	Params       string `gorm:"type:text;comment:变体参数（JSON），如推荐类型、协同过滤权重" json:"params"`                                   // 变体参数（JSON），如推荐类型、协同过滤权重
+}
+
+// TableName 指定表名
+func (ExperimentVariant) TableName() string {
+	return "experiment_variants"
+}
@@ -29,10 +29,36 @@ func InitializeDB() {
 		&SearchHistory{},
 		&ReviewCriteria{},
 		&Chapter{},
+		&Volume{},
+		&NovelUpdate{},
+		&NovelFollow{},
+		&BookshelfGroup{},
+		&UserMessage{},
 		&UserActivity{},
+		&UploadJob{},
+		&ChapterRule{},
+		&ChapterParseSetting{},
+		&ScheduledJobRun{},
+		&NovelClickStat{},
+		&ClickDiscount{},
+		&RankingSnapshot{},
+		&RankingEntry{},
+		&NovelNeighbor{},
+		&UserPreference{},
+		&RecommendationFeedback{},
+		&Experiment{},
+		&ExperimentVariant{},
+		&ExperimentExposure{},
+		&SearchOutbox{},
+		&SearchSynonym{},
 	)
 
 	if err != nil {
 		panic("数据库迁移失败: " + err.Error())
 	}
+
+	// 小说和章节的写入同步记录到搜索索引发件箱
+	if err := registerSearchOutboxCallbacks(DB); err != nil {
+		panic("注册搜索索引同步回调失败: " + err.Error())
+	}
 }
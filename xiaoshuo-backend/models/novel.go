@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -15,14 +17,18 @@ type Novel struct {
 	FileSize      int64           `gorm:"comment:小说文件大小（字节）" json:"file_size"`                                                     // 小说文件大小（字节）
 	WordCount     int             `gorm:"comment:小说总字数" json:"word_count"`                                                         // 小说总字数
 	ClickCount    int             `gorm:"default:0;comment:总点击量" json:"click_count"`                                               // 总点击量
-	TodayClicks   int             `gorm:"default:0;comment:今日点击量" json:"today_clicks"`                                             // 今日点击量
-	WeekClicks    int             `gorm:"default:0;comment:本周点击量" json:"week_clicks"`                                              // 本周点击量
-	MonthClicks   int             `gorm:"default:0;comment:本月点击量" json:"month_clicks"`                                             // 本月点击量
+	TodayClicks   int             `gorm:"default:0;comment:今日点击量" json:"today_clicks"`                                             // 近24小时点击量，由点击统计聚合表计算后填充
+	WeekClicks    int             `gorm:"default:0;comment:本周点击量" json:"week_clicks"`                                              // 近7天点击量，由点击统计聚合表计算后填充
+	MonthClicks   int             `gorm:"default:0;comment:本月点击量" json:"month_clicks"`                                             // 近30天点击量，由点击统计聚合表计算后填充
 	UploadTime    *gorm.DeletedAt `json:"upload_time"`                                                                             // 上传时间
 	LastReadTime  *gorm.DeletedAt `json:"last_read_time"`                                                                          // 最后阅读时间
 	Status        string          `gorm:"default:'pending';comment:小说状态：pending(待审核), approved(已通过), rejected(已拒绝)" json:"status"` // 小说状态：pending(待审核), approved(已通过), rejected(已拒绝)
 	ChapterStatus string          `gorm:"default:'pending';comment:章节解析状态：pending(待解析), processing(解析中), completed(已完成), failed(解析失败)" json:"chapter_status"` // 章节解析状态：pending(待解析), processing(解析中), completed(已完成), failed(解析失败)
 	FileHash      string          `gorm:"uniqueIndex;size:255;comment:小说文件哈希值，用于去重" json:"file_hash"`                              // 小说文件哈希值，用于去重
+	SerialStatus  string          `gorm:"size:20;default:'completed';comment:连载状态：serializing(连载中), completed(已完结)" json:"serial_status"` // 连载状态：serializing(连载中), completed(已完结)
+	LastChapterAt *time.Time      `gorm:"index;comment:最新章节更新时间" json:"last_chapter_at"`                                   // 最新章节更新时间
+	CompletedAt   *time.Time      `gorm:"comment:完结时间" json:"completed_at"`                                                // 完结时间，上传时即已完结的小说为空（以上传时间为准）
+	Encoding      string          `gorm:"size:20;default:'UTF-8';comment:上传文件的原始编码" json:"encoding"`                               // 上传文件的原始编码
 	UploadUserID  uint            `gorm:"comment:上传用户ID" json:"upload_user_id"`                                                    // 上传用户ID
 	UploadUser    User            `json:"upload_user"`                                                                             // 上传用户信息
 	Categories    []Category      `gorm:"many2many:novel_categories;" json:"categories"`                                           // 小说分类
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// NovelClickStat 小说点击统计聚合模型，按小时和按天两种粒度保存
+type NovelClickStat struct {
+	gorm.Model
+	NovelID          uint      `gorm:"uniqueIndex:idx_click_stat_bucket;index;comment:小说ID" json:"novel_id"`                       // 小说ID
+	Granularity      string    `gorm:"size:10;uniqueIndex:idx_click_stat_bucket;comment:统计粒度：hour(小时), day(天)" json:"granularity"` // 统计粒度：hour(小时), day(天)
+	BucketStart      time.Time `gorm:"uniqueIndex:idx_click_stat_bucket;index;comment:统计区间开始时间" json:"bucket_start"`               // 统计区间开始时间
+	Clicks           int64     `gorm:"default:0;comment:点击次数" json:"clicks"`                                                       // 点击次数
+	UniqueReaders    int64     `gorm:"default:0;comment:独立读者数（HyperLogLog估算）" json:"unique_readers"`                               // 独立读者数（HyperLogLog估算）
+	RejectedClicks   int64     `gorm:"default:0;comment:被拦截的点击次数" json:"rejected_clicks"`                                          // 被拦截的点击次数（爬虫、超频、重复点击）
+	DiscountedClicks int64     `gorm:"default:0;comment:被判定为刷量而扣除的点击次数" json:"discounted_clicks"`                                  // 被判定为刷量而扣除的点击次数，排行时不计入
+}
+
+// TableName 指定表名
+func (NovelClickStat) TableName() string {
+	return "novel_click_stats"
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// NovelFollow 用户关注（加入书架）的小说模型，即书架中的一本书
+type NovelFollow struct {
+	gorm.Model
+	UserID         uint       `gorm:"uniqueIndex:idx_follow_user_novel;comment:用户ID" json:"user_id"`                                     // 用户ID
+	NovelID        uint       `gorm:"uniqueIndex:idx_follow_user_novel;index;comment:小说ID" json:"novel_id"`                              // 小说ID
+	Novel          Novel      `json:"novel"`                                                                                             // 小说信息
+	NotifyMode     string     `gorm:"size:20;default:'instant';comment:更新通知方式：instant(即时通知), digest(每日摘要), off(不通知)" json:"notify_mode"` // 更新通知方式：instant(即时通知), digest(每日摘要), off(不通知)
+	LastNotifiedAt *time.Time `gorm:"comment:最后一次发送更新通知的时间" json:"last_notified_at"`                                                     // 最后一次发送更新通知的时间
+	GroupID        uint       `gorm:"index;comment:书架分组ID，0表示未分组" json:"group_id"`                                                       // 书架分组ID，0表示未分组
+	IsPinned       bool       `gorm:"default:false;comment:是否置顶" json:"is_pinned"`                                                       // 是否置顶
+	PinnedAt       *time.Time `gorm:"comment:置顶时间" json:"pinned_at"`                                                                     // 置顶时间
+}
+
+// TableName 指定表名
+func (NovelFollow) TableName() string {
+	return "novel_follows"
+}
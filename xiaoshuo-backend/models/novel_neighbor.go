@@ -0,0 +1,21 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// NovelNeighbor 小说协同过滤相似度模型，由批处理任务根据读者的阅读、评分和评论行为计算
+type NovelNeighbor struct {
+	gorm.Model
+	NovelID    uint    `gorm:"uniqueIndex:idx_neighbor_pair;index;comment:小说ID" json:"novel_id"` // 小说ID
+	NeighborID uint    `gorm:"uniqueIndex:idx_neighbor_pair;comment:相似小说ID" json:"neighbor_id"`  // 相似小说ID
+	Similarity float64 `gorm:"index;comment:综合相似度" json:"similarity"`                            // 综合相似度（余弦相似度与Jaccard相似度的平均）
+	Cosine     float64 `gorm:"comment:加权余弦相似度" json:"cosine"`                                    // 按行为权重计算的余弦相似度
+	Jaccard    float64 `gorm:"comment:Jaccard相似度" json:"jaccard"`                                // 读者集合的Jaccard相似度
+	CoReaders  int     `gorm:"comment:共同读者数" json:"co_readers"`                                  // 同时读过两本小说的读者数
+}
+
+// TableName 指定表名
+func (NovelNeighbor) TableName() string {
+	return "novel_neighbors"
+}
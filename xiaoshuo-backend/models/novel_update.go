@@ -0,0 +1,26 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// NovelUpdate 小说连载更新记录模型
+type NovelUpdate struct {
+	gorm.Model
+	NovelID         uint   `gorm:"index;comment:小说ID" json:"novel_id"`                                             // 小说ID
+	UserID          uint   `gorm:"comment:提交更新的用户ID" json:"user_id"`                                               // 提交更新的用户ID
+	Source          string `gorm:"size:20;comment:更新来源：file(上传新版本文件), batch(提交章节批次)" json:"source"`                // 更新来源：file(上传新版本文件), batch(提交章节批次)
+	AddedChapters   int    `gorm:"default:0;comment:新增章节数" json:"added_chapters"`                                  // 新增章节数
+	SkippedChapters int    `gorm:"default:0;comment:已存在而跳过的章节数" json:"skipped_chapters"`                           // 已存在而跳过的章节数
+	AddedWords      int    `gorm:"default:0;comment:新增字数" json:"added_words"`                                      // 新增字数
+	FirstChapterID  uint   `gorm:"comment:本次新增的第一个章节ID" json:"first_chapter_id"`                                   // 本次新增的第一个章节ID
+	FromPosition    int    `gorm:"comment:新增章节的起始位置" json:"from_position"`                                         // 新增章节的起始位置
+	ToPosition      int    `gorm:"comment:新增章节的结束位置" json:"to_position"`                                           // 新增章节的结束位置
+	LatestTitle     string `gorm:"size:255;comment:最新章节标题" json:"latest_title"`                                    // 最新章节标题
+	SerialStatus    string `gorm:"size:20;comment:更新后的连载状态：serializing(连载中), completed(已完结)" json:"serial_status"` // 更新后的连载状态：serializing(连载中), completed(已完结)
+}
+
+// TableName 指定表名
+func (NovelUpdate) TableName() string {
+	return "novel_updates"
+}
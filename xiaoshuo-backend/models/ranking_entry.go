@@ -0,0 +1,24 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// RankingEntry 排行榜快照中的条目模型
+type RankingEntry struct {
+	gorm.Model
+	SnapshotID   uint    `gorm:"index;comment:排行榜快照ID" json:"snapshot_id"`                                  // 排行榜快照ID
+	NovelID      uint    `gorm:"index;comment:小说ID" json:"novel_id"`                                        // 小说ID
+	Novel        Novel   `gorm:"foreignKey:NovelID" json:"novel"`                                           // 小说
+	Rank         int     `gorm:"column:rank_no;comment:名次" json:"rank"`                                     // 名次，从1开始（rank 为MySQL保留字，列名使用 rank_no）
+	Score        float64 `gorm:"comment:排序得分" json:"score"`                                                 // 排序得分
+	Metric       float64 `gorm:"comment:榜单指标原始值" json:"metric"`                                             // 榜单指标原始值，如评论数、平均阅读进度、点击增长数
+	PreviousRank *int    `gorm:"comment:上一周期的名次，为空表示新上榜" json:"previous_rank"`                              // 上一周期的名次，为空表示新上榜
+	RankChange   int     `gorm:"default:0;comment:名次变化，正数表示上升" json:"rank_change"`                          // 名次变化，正数表示上升，新上榜为0
+	Movement     string  `gorm:"size:10;comment:名次变动：new(新上榜), up(上升), down(下降), same(持平)" json:"movement"` // 名次变动：new(新上榜), up(上升), down(下降), same(持平)
+}
+
+// TableName 指定表名
+func (RankingEntry) TableName() string {
+	return "ranking_entries"
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RankingSnapshot 排行榜快照模型，每个榜单、周期、分类和周期标识保存一份，周期内重复计算时覆盖
+type RankingSnapshot struct {
+	gorm.Model
+	Board      string         `gorm:"size:30;uniqueIndex:idx_ranking_snapshot_key;comment:榜单类型" json:"board"`                         // 榜单类型
+	Period     string         `gorm:"size:10;uniqueIndex:idx_ranking_snapshot_key;comment:统计周期：daily, weekly, monthly" json:"period"` // 统计周期：daily(日榜), weekly(周榜), monthly(月榜)
+	CategoryID uint           `gorm:"uniqueIndex:idx_ranking_snapshot_key;default:0;comment:分类ID，0表示全部分类" json:"category_id"`         // 分类ID，0表示全部分类
+	PeriodKey  string         `gorm:"size:20;uniqueIndex:idx_ranking_snapshot_key;comment:周期标识" json:"period_key"`                    // 周期标识，如 2024-05-01、2024-W18、2024-05
+	WindowFrom time.Time      `gorm:"comment:统计区间开始时间" json:"window_from"`                                                            // 统计区间开始时间
+	WindowTo   time.Time      `gorm:"comment:统计区间结束时间" json:"window_to"`                                                              // 统计区间结束时间
+	ComputedAt time.Time      `gorm:"index;comment:计算时间" json:"computed_at"`                                                          // 计算时间
+	EntryCount int            `gorm:"default:0;comment:上榜小说数" json:"entry_count"`                                                     // 上榜小说数
+	Entries    []RankingEntry `gorm:"foreignKey:SnapshotID" json:"entries,omitempty"`                                                 // 榜单条目
+}
+
+// TableName 指定表名
+func (RankingSnapshot) TableName() string {
+	return "ranking_snapshots"
+}
@@ -13,6 +13,8 @@ type ReadingProgress struct {
 	Novel       Novel           `json:"novel"`                                   // 小说信息
 	ChapterID   uint            `gorm:"comment:当前阅读章节ID" json:"chapter_id"`      // 当前阅读章节ID
 	ChapterName string          `gorm:"comment:当前阅读章节名称" json:"chapter_name"`    // 当前阅读章节名称
+	VolumeID    uint            `gorm:"comment:当前阅读分卷ID" json:"volume_id"`       // 当前阅读分卷ID
+	VolumeTitle string          `gorm:"comment:当前阅读分卷标题" json:"volume_title"`    // 当前阅读分卷标题
 	Position    int             `gorm:"comment:当前阅读位置（字符位置或页数）" json:"position"` // 当前阅读位置（字符位置或页数）
 	Progress    int             `gorm:"comment:阅读进度百分比" json:"progress"`         // 阅读进度百分比
 	ReadingTime int             `gorm:"comment:阅读时长（秒）" json:"reading_time"`     // 阅读时长（秒）
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// RecommendationFeedback 推荐反馈模型，记录用户对推荐小说的“不感兴趣”等反馈
+type RecommendationFeedback struct {
+	gorm.Model
+	UserID  uint   `gorm:"uniqueIndex:idx_feedback_user_novel;comment:用户ID" json:"user_id"`                // 用户ID
+	NovelID uint   `gorm:"uniqueIndex:idx_feedback_user_novel;index;comment:小说ID" json:"novel_id"`         // 小说ID
+	Novel   Novel  `gorm:"foreignKey:NovelID" json:"novel,omitempty"`                                      // 小说
+	Type    string `gorm:"size:20;default:'not_interested';comment:反馈类型：not_interested(不感兴趣)" json:"type"` // 反馈类型：not_interested(不感兴趣)
+	Reason  string `gorm:"size:255;comment:反馈原因" json:"reason"`                                            // 反馈原因，可选
+}
+
+// TableName 指定表名
+func (RecommendationFeedback) TableName() string {
+	return "recommendation_feedbacks"
+}
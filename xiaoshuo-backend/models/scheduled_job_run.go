@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ScheduledJobRun 定时任务运行记录模型
+type ScheduledJobRun struct {
+	gorm.Model
+	JobName     string     `gorm:"size:100;index:idx_job_run_name_started;comment:任务名称" json:"job_name"`           // 任务名称
+	Trigger     string     `gorm:"size:20;comment:触发方式：schedule(定时), manual(手动)" json:"trigger"`                   // 触发方式：schedule(定时), manual(手动)
+	TriggeredBy uint       `gorm:"comment:手动触发的管理员ID，定时触发为0" json:"triggered_by"`                                  // 手动触发的管理员ID，定时触发为0
+	Instance    string     `gorm:"size:255;comment:执行任务的实例标识" json:"instance"`                                     // 执行任务的实例标识
+	Status      string     `gorm:"size:20;index;comment:运行状态：running(运行中), success(成功), failed(失败)" json:"status"` // 运行状态：running(运行中), success(成功), failed(失败)
+	StartedAt   time.Time  `gorm:"index:idx_job_run_name_started;comment:开始时间" json:"started_at"`                  // 开始时间
+	FinishedAt  *time.Time `gorm:"comment:结束时间" json:"finished_at"`                                                // 结束时间
+	DurationMs  int64      `gorm:"comment:运行耗时（毫秒）" json:"duration_ms"`                                            // 运行耗时（毫秒）
+	Result      string     `gorm:"type:text;comment:运行结果摘要" json:"result"`                                         // 运行结果摘要
+	Error       string     `gorm:"type:text;comment:错误信息" json:"error"`                                            // 错误信息
+}
+
+// TableName 指定表名
+func (ScheduledJobRun) TableName() string {
+	return "scheduled_job_runs"
+}
@@ -0,0 +1,175 @@
+package models
+
+import (
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 搜索索引发件箱的变更类型
+const (
+	SearchOutboxNovel    = "novel"    // 小说元数据、分类或关键词变更，只需重建小说文档
+	SearchOutboxChapters = "chapters" // 章节变更，需重建小说文档和全部章节文档
+)
+
+// SearchOutbox 搜索索引发件箱模型
+// 小说和章节的每次写入都会在同一事务中写入一条记录，由搜索索引同步器按ID顺序消费
+type SearchOutbox struct {
+	gorm.Model
+	NovelID uint   `gorm:"index;comment:变更的小说ID" json:"novel_id"`                         // 变更的小说ID
+	Change  string `gorm:"size:20;comment:变更类型：novel(小说元数据), chapters(章节)" json:"change"` // 变更类型：novel(小说元数据), chapters(章节)
+}
+
+// TableName 指定表名
+func (SearchOutbox) TableName() string {
+	return "search_outbox"
+}
+
+// searchOutboxSource 需要同步到搜索索引的表
+type searchOutboxSource struct {
+	field  string // 模型中保存小说ID的字段
+	column string // 表中保存小说ID的列
+	change string // 变更类型
+}
+
+var searchOutboxSources = map[string]searchOutboxSource{
+	"novels":           {field: "ID", column: "id", change: SearchOutboxNovel},
+	"chapters":         {field: "NovelID", column: "novel_id", change: SearchOutboxChapters},
+	"novel_categories": {field: "NovelID", column: "novel_id", change: SearchOutboxNovel},
+	"novel_keywords":   {field: "NovelID", column: "novel_id", change: SearchOutboxNovel},
+}
+
+// 更新和删除前查出的受影响小说ID，在语句设置中传递给写入后的回调
+const searchOutboxNovelIDsKey = "search_outbox:novel_ids"
+
+// registerSearchOutboxCallbacks 注册写入搜索索引发件箱的回调
+// 回调在GORM默认事务内执行，发件箱写入失败时整个写操作回滚；
+// 更新和删除在执行前按模型主键或WHERE条件查出受影响的小说
+func registerSearchOutboxCallbacks(db *gorm.DB) error {
+	callback := db.Callback()
+	if err := callback.Create().After("gorm:create").Before("gorm:commit_or_rollback_transaction").
+		Register("search_outbox:create", func(tx *gorm.DB) {
+			if source, ok := searchOutboxSources[tx.Statement.Table]; ok {
+				writeSearchOutbox(tx, source, modelNovelIDs(tx.Statement, source.field))
+			}
+		}); err != nil {
+		return err
+	}
+
+	collect := func(tx *gorm.DB) {
+		if source, ok := searchOutboxSources[tx.Statement.Table]; ok && tx.Error == nil {
+			tx.Statement.Settings.Store(searchOutboxNovelIDsKey, affectedNovelIDs(tx, source))
+		}
+	}
+	write := func(tx *gorm.DB) {
+		source, ok := searchOutboxSources[tx.Statement.Table]
+		if !ok {
+			return
+		}
+		if ids, ok := tx.Statement.Settings.Load(searchOutboxNovelIDsKey); ok {
+			writeSearchOutbox(tx, source, ids.([]uint))
+		}
+	}
+
+	if err := callback.Update().Before("gorm:update").Register("search_outbox:collect_update", collect); err != nil {
+		return err
+	}
+	if err := callback.Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").
+		Register("search_outbox:update", write); err != nil {
+		return err
+	}
+	if err := callback.Delete().Before("gorm:delete").Register("search_outbox:collect_delete", collect); err != nil {
+		return err
+	}
+	return callback.Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").
+		Register("search_outbox:delete", write)
+}
+
+// affectedNovelIDs 查出更新或删除语句影响的小说ID
+func affectedNovelIDs(tx *gorm.DB, source searchOutboxSource) []uint {
+	if ids := modelNovelIDs(tx.Statement, source.field); len(ids) > 0 {
+		return ids
+	}
+
+	// 按主键删除等条件引用模型主键，查询需带上模型（使用零值，避免附加模型自身的主键条件）
+	query := tx.Session(&gorm.Session{NewDB: true}).Table(tx.Statement.Table)
+	if tx.Statement.Schema != nil {
+		query = query.Model(reflect.New(tx.Statement.Schema.ModelType).Interface())
+	}
+	if ids := modelNovelIDs(tx.Statement, "ID"); len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	} else if where, ok := tx.Statement.Clauses["WHERE"]; ok {
+		query = query.Clauses(where.Expression.(clause.Where))
+	} else {
+		return nil
+	}
+
+	var ids []uint
+	if err := query.Distinct().Pluck(source.column, &ids).Error; err != nil {
+		tx.AddError(err)
+		return nil
+	}
+	return ids
+}
+
+// modelNovelIDs 从语句的模型值中读取非零的字段值
+func modelNovelIDs(stmt *gorm.Statement, fieldName string) []uint {
+	if stmt.Schema == nil || !stmt.ReflectValue.IsValid() {
+		return nil
+	}
+	field := stmt.Schema.LookUpField(fieldName)
+	if field == nil {
+		return nil
+	}
+
+	ids := make([]uint, 0)
+	add := func(value reflect.Value) {
+		value = reflect.Indirect(value)
+		if value.Kind() != reflect.Struct {
+			return
+		}
+		v, zero := field.ValueOf(stmt.Context, value)
+		if zero {
+			return
+		}
+		switch id := reflect.ValueOf(v); {
+		case id.CanUint():
+			ids = append(ids, uint(id.Uint()))
+		case id.CanInt():
+			ids = append(ids, uint(id.Int()))
+		}
+	}
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			add(stmt.ReflectValue.Index(i))
+		}
+	default:
+		add(stmt.ReflectValue)
+	}
+	return ids
+}
+
+// writeSearchOutbox 在当前事务中为每本受影响的小说写入一条发件箱记录
+func writeSearchOutbox(tx *gorm.DB, source searchOutboxSource, novelIDs []uint) {
+	if tx.Error != nil || tx.Statement.DryRun || tx.Statement.RowsAffected == 0 || len(novelIDs) == 0 {
+		return
+	}
+
+	seen := make(map[uint]bool, len(novelIDs))
+	rows := make([]SearchOutbox, 0, len(novelIDs))
+	for _, novelID := range novelIDs {
+		if novelID == 0 || seen[novelID] {
+			continue
+		}
+		seen[novelID] = true
+		rows = append(rows, SearchOutbox{NovelID: novelID, Change: source.change})
+	}
+	if len(rows) == 0 {
+		return
+	}
+	if err := tx.Session(&gorm.Session{NewDB: true}).Create(&rows).Error; err != nil {
+		tx.AddError(err)
+	}
+}
@@ -0,0 +1,138 @@
+//go:build sqlite
+
+package models
+
+// 使用 SQLite 测试发件箱回调，驱动依赖 cgo：
+//
+//	CGO_ENABLED=1 go test -tags sqlite ./models/
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openOutboxTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&User{}, &Category{}, &Keyword{}, &Novel{}, &Chapter{}, &SearchOutbox{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registerSearchOutboxCallbacks(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// takeOutbox 返回并清空发件箱记录，格式为 "变更类型:小说ID"
+func takeOutbox(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+	var rows []SearchOutbox
+	if err := db.Order("id ASC").Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Unscoped().Where("1 = 1").Delete(&SearchOutbox{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0, len(rows))
+	for _, row := range rows {
+		got = append(got, fmt.Sprintf("%s:%d", row.Change, row.NovelID))
+	}
+	sort.Strings(got)
+	return got
+}
+
+func TestSearchOutboxCallbacks(t *testing.T) {
+	db := openOutboxTestDB(t)
+
+	for i := uint(1); i <= 3; i++ {
+		novel := Novel{Model: gorm.Model{ID: i}, Title: fmt.Sprintf("小说%d", i), Author: "作者", Filepath: "x", FileHash: fmt.Sprint(i)}
+		if err := db.Create(&novel).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	chapters := []Chapter{
+		{NovelID: 1, Position: 1, Title: "第一章"},
+		{NovelID: 1, Position: 2, Title: "第二章"},
+		{NovelID: 2, Position: 1, Title: "第一章"},
+		{NovelID: 3, Position: 1, Title: "第一章"},
+	}
+	if err := db.Create(&chapters).Error; err != nil {
+		t.Fatal(err)
+	}
+	takeOutbox(t, db)
+
+	tests := []struct {
+		name  string
+		write func() error
+		want  []string
+	}{
+		{"create chapters", func() error {
+			return db.Create(&[]Chapter{{NovelID: 2, Position: 2, Title: "第二章"}, {NovelID: 3, Position: 2, Title: "第二章"}}).Error
+		}, []string{"chapters:2", "chapters:3"}},
+		{"update novel by model", func() error {
+			return db.Model(&Novel{Model: gorm.Model{ID: 2}}).Update("status", "approved").Error
+		}, []string{"novel:2"}},
+		{"update novels by where", func() error {
+			return db.Model(&Novel{}).Where("status = ?", "pending").Update("status", "rejected").Error
+		}, []string{"novel:1", "novel:3"}},
+		{"update chapters by where", func() error {
+			return db.Model(&Chapter{}).Where("position = ?", 1).Update("word_count", 100).Error
+		}, []string{"chapters:1", "chapters:2", "chapters:3"}},
+		{"update chapter by primary key", func() error {
+			return db.Model(&Chapter{Model: gorm.Model{ID: chapters[3].ID}}).Update("title", "序章").Error
+		}, []string{"chapters:3"}},
+		{"update without matches", func() error {
+			return db.Model(&Chapter{}).Where("novel_id = ?", 99).Update("title", "无").Error
+		}, []string{}},
+		{"delete chapters by where", func() error {
+			return db.Where("novel_id = ? AND position > ?", 1, 1).Delete(&Chapter{}).Error
+		}, []string{"chapters:1"}},
+		{"delete chapters by primary key", func() error {
+			return db.Delete(&Chapter{}, chapters[2].ID).Error
+		}, []string{"chapters:2"}},
+		{"delete novel", func() error {
+			return db.Delete(&Novel{Model: gorm.Model{ID: 3}}).Error
+		}, []string{"novel:3"}},
+	}
+	for _, tt := range tests {
+		if err := tt.write(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := takeOutbox(t, db); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: outbox = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSearchOutboxRollback(t *testing.T) {
+	db := openOutboxTestDB(t)
+	novel := Novel{Title: "小说", Author: "作者", Filepath: "x", FileHash: "1"}
+	if err := db.Create(&novel).Error; err != nil {
+		t.Fatal(err)
+	}
+	takeOutbox(t, db)
+
+	// 发件箱记录与业务写入在同一事务中，事务回滚时一并撤销
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&Chapter{NovelID: novel.ID, Position: 1, Title: "第一章"}).Error; err != nil {
+			return err
+		}
+		return fmt.Errorf("rollback")
+	})
+	if err == nil {
+		t.Fatal("transaction succeeded, want rollback")
+	}
+	if got := takeOutbox(t, db); len(got) != 0 {
+		t.Errorf("outbox after rollback = %v, want empty", got)
+	}
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// SearchSynonym 搜索同义词组模型
+// 组内的词互为同义词，搜索时查询词中的词语会同时按同义词匹配
+type SearchSynonym struct {
+	gorm.Model
+	Words       string `gorm:"size:500;not null;comment:同义词，逗号分隔" json:"words"` // 同义词，逗号分隔
+	CreatedByID uint   `gorm:"comment:创建该同义词组的管理员ID" json:"created_by_id"`      // 创建该同义词组的管理员ID
+}
+
+// TableName 指定表名
+func (SearchSynonym) TableName() string {
+	return "search_synonyms"
+}
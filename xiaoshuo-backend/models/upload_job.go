@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UploadJob 上传文件解析任务模型
+type UploadJob struct {
+	gorm.Model
+	NovelID       uint       `gorm:"index;comment:所属小说ID" json:"novel_id"`                                                                                  // 所属小说ID
+	FilePath      string     `gorm:"not null;comment:待解析文件路径" json:"file_path"`                                                                             // 待解析文件路径
+	Kind          string     `gorm:"size:20;default:'import';comment:任务类型：import(首次导入), append(追加新章节)" json:"kind"`                                         // 任务类型：import(首次导入), append(追加新章节)
+	UserID        uint       `gorm:"comment:发起追加的用户ID" json:"user_id"`                                                                                      // 发起追加的用户ID
+	SerialStatus  string     `gorm:"size:20;comment:追加后的连载状态" json:"serial_status"`                                                                         // 追加后的连载状态
+	UpdateID      uint       `gorm:"comment:追加完成后生成的更新记录ID" json:"update_id"`                                                                               // 追加完成后生成的更新记录ID
+	Status        string     `gorm:"index;size:20;default:'pending';comment:任务状态：pending(排队中), processing(处理中), completed(已完成), failed(已失败)" json:"status"` // 任务状态：pending(排队中), processing(处理中), completed(已完成), failed(已失败)
+	Stage         string     `gorm:"size:20;comment:当前处理阶段：parsing(解析), saving(保存章节), indexing(建立索引)" json:"stage"`                                         // 当前处理阶段：parsing(解析), saving(保存章节), indexing(建立索引)
+	Progress      int        `gorm:"default:0;comment:处理进度百分比" json:"progress"`                                                                             // 处理进度百分比
+	ChapterCount  int        `gorm:"default:0;comment:已解析的章节数" json:"chapter_count"`                                                                        // 已解析的章节数
+	Attempts      int        `gorm:"default:0;comment:已尝试次数" json:"attempts"`                                                                               // 已尝试次数
+	MaxAttempts   int        `gorm:"default:3;comment:最大尝试次数" json:"max_attempts"`                                                                          // 最大尝试次数
+	FailureReason string     `gorm:"type:text;comment:最近一次失败原因" json:"failure_reason"`                                                                      // 最近一次失败原因
+	NextRunAt     time.Time  `gorm:"index;comment:下次可执行时间，用于重试退避" json:"next_run_at"`                                                                       // 下次可执行时间，用于重试退避
+	HeartbeatAt   *time.Time `gorm:"index;comment:处理中任务的最近心跳时间，超过租约时长未更新视为执行实例已退出" json:"heartbeat_at"`                                                     // 处理中任务的最近心跳时间，超过租约时长未更新视为执行实例已退出
+	StartedAt     *time.Time `gorm:"comment:最近一次开始处理时间" json:"started_at"`                                                                                  // 最近一次开始处理时间
+	FinishedAt    *time.Time `gorm:"comment:处理结束时间" json:"finished_at"`                                                                                     // 处理结束时间
+}
+
+// TableName 指定表名
+func (UploadJob) TableName() string {
+	return "upload_jobs"
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -18,6 +20,7 @@ type User struct {
 	ActivationCode  string          `gorm:"size:255;comment:激活码" json:"-"`                                                               // 激活码
 	LastLoginAt     *gorm.DeletedAt `json:"last_login_at"`                                                                               // 最后登录时间
 	LastReadNovelID *uint           `gorm:"comment:最后阅读的小说ID" json:"last_read_novel_id"`                                                 // 最后阅读的小说ID
+	MessagesReadAt  *time.Time      `gorm:"comment:系统消息全部已读的时间，之后发布的系统消息为未读" json:"messages_read_at"`                                    // 系统消息全部已读的时间，之后发布的系统消息为未读
 }
 
 // TableName 指定表名
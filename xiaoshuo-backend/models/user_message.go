@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserMessage 用户个人消息模型，与系统消息一起在消息中心展示
+type UserMessage struct {
+	gorm.Model
+	UserID        uint       `gorm:"index:idx_user_message_user_read;comment:接收用户ID" json:"user_id"`             // 接收用户ID
+	Type          string     `gorm:"size:20;comment:消息类型：chapter_update(章节更新), update_digest(更新摘要)" json:"type"` // 消息类型：chapter_update(章节更新), update_digest(更新摘要)
+	Title         string     `gorm:"size:255;not null;comment:消息标题" json:"title"`                                // 消息标题
+	Content       string     `gorm:"type:text;comment:消息内容" json:"content"`                                      // 消息内容
+	NovelID       uint       `gorm:"index;comment:关联小说ID，摘要消息为0" json:"novel_id"`                                // 关联小说ID，摘要消息为0
+	NovelUpdateID uint       `gorm:"comment:关联的小说更新记录ID" json:"novel_update_id"`                                 // 关联的小说更新记录ID
+	IsRead        bool       `gorm:"default:false;index:idx_user_message_user_read;comment:是否已读" json:"is_read"` // 是否已读
+	ReadAt        *time.Time `gorm:"comment:阅读时间" json:"read_at"`                                                // 阅读时间
+}
+
+// TableName 指定表名
+func (UserMessage) TableName() string {
+	return "user_messages"
+}
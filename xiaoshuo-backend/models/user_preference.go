@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserPreference 用户显式偏好模型，由新用户引导或偏好设置填写，推荐时与阅读行为推断的偏好合并
+type UserPreference struct {
+	gorm.Model
+	UserID              uint       `gorm:"uniqueIndex;comment:用户ID" json:"user_id"`                          // 用户ID
+	PreferredCategories []Category `gorm:"many2many:user_preferred_categories;" json:"preferred_categories"` // 喜欢的分类
+	DislikedCategories  []Category `gorm:"many2many:user_disliked_categories;" json:"disliked_categories"`   // 不喜欢的分类
+	PreferredKeywords   []Keyword  `gorm:"many2many:user_preferred_keywords;" json:"preferred_keywords"`     // 喜欢的关键词
+	DislikedKeywords    []Keyword  `gorm:"many2many:user_disliked_keywords;" json:"disliked_keywords"`       // 不喜欢的关键词
+	OnboardedAt         *time.Time `gorm:"comment:完成新用户引导的时间" json:"onboarded_at"`                           // 完成新用户引导的时间
+}
+
+// TableName 指定表名
+func (UserPreference) TableName() string {
+	return "user_preferences"
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Volume 分卷模型
+type Volume struct {
+	gorm.Model
+	NovelID      uint      `gorm:"index:idx_volume_novel_position;comment:所属小说ID" json:"novel_id"`    // 所属小说ID
+	Title        string    `gorm:"not null;size:255;comment:分卷标题" json:"title"`                       // 分卷标题
+	Position     int       `gorm:"index:idx_volume_novel_position;comment:分卷在小说中的位置" json:"position"` // 分卷在小说中的位置
+	WordCount    int       `gorm:"default:0;comment:分卷总字数" json:"word_count"`                         // 分卷总字数
+	ChapterCount int       `gorm:"default:0;comment:分卷章节数" json:"chapter_count"`                      // 分卷章节数
+	Chapters     []Chapter `gorm:"foreignKey:VolumeID" json:"chapters,omitempty"`                     // 分卷下的章节
+}
+
+// TableName 指定表名
+func (Volume) TableName() string {
+	return "volumes"
+}
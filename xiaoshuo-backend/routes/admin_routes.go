@@ -42,5 +42,30 @@ func InitAdminRoutes(apiV1 *gin.RouterGroup) {
 		admin.POST("/admin/review-criteria", controllers.CreateReviewCriteria)
 		admin.PUT("/admin/review-criteria/:id", controllers.UpdateReviewCriteria)
 		admin.DELETE("/admin/review-criteria/:id", controllers.DeleteReviewCriteria)
+
+		// 章节标题识别规则管理路由
+		admin.GET("/admin/chapter-rules", controllers.GetChapterRules)
+		admin.POST("/admin/chapter-rules", controllers.CreateChapterRule)
+		admin.PUT("/admin/chapter-rules/:id", controllers.UpdateChapterRule)
+		admin.DELETE("/admin/chapter-rules/:id", controllers.DeleteChapterRule)
+		admin.POST("/admin/chapter-rules/reset", controllers.ResetChapterRules)
+		admin.GET("/admin/chapter-parse-settings", controllers.GetChapterParseSettings)
+		admin.PUT("/admin/chapter-parse-settings", controllers.UpdateChapterParseSettings)
+
+		// 点击防刷管理路由
+		admin.GET("/admin/click-anomalies", controllers.GetClickAnomalies)
+		admin.GET("/admin/click-discounts", controllers.GetClickDiscounts)
+		admin.POST("/admin/novels/:id/click-discounts", controllers.DiscountNovelClicks)
+
+		// A/B实验管理路由
+		admin.POST("/admin/experiments", controllers.CreateExperiment)
+		admin.GET("/admin/experiments", controllers.GetExperiments)
+		admin.PUT("/admin/experiments/:id/status", controllers.UpdateExperimentStatus)
+		admin.GET("/admin/experiments/:id/report", controllers.GetExperimentReport)
+
+		// 定时任务管理路由
+		admin.GET("/admin/scheduled-jobs", controllers.GetScheduledJobs)
+		admin.GET("/admin/scheduled-jobs/:name/runs", controllers.GetScheduledJobRuns)
+		admin.POST("/admin/scheduled-jobs/:name/run", controllers.TriggerScheduledJob)
 	}
 }
\ No newline at end of file
@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"xiaoshuo-backend/controllers"
+	"xiaoshuo-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InitBookshelfRoutes 初始化书架相关路由
+func InitBookshelfRoutes(apiV1 *gin.RouterGroup) {
+	bookshelf := apiV1.Group("/bookshelf")
+	bookshelf.Use(middleware.AuthMiddleware())
+	{
+		bookshelf.GET("", controllers.GetBookshelf)
+		bookshelf.POST("", controllers.AddToBookshelf)
+		bookshelf.PUT("/novels/:novel_id", controllers.UpdateBookshelfEntry)
+		bookshelf.DELETE("/novels/:novel_id", controllers.RemoveFromBookshelf)
+		bookshelf.POST("/batch-move", controllers.BatchMoveBookshelf)
+		bookshelf.POST("/batch-remove", controllers.BatchRemoveBookshelf)
+
+		// 书架分组
+		bookshelf.GET("/groups", controllers.GetBookshelfGroups)
+		bookshelf.POST("/groups", controllers.CreateBookshelfGroup)
+		bookshelf.PUT("/groups/:id", controllers.UpdateBookshelfGroup)
+		bookshelf.DELETE("/groups/:id", controllers.DeleteBookshelfGroup)
+	}
+}
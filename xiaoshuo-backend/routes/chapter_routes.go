@@ -14,4 +14,19 @@ func InitChapterRoutes(apiV1 *gin.RouterGroup) {
 	apiV1.GET("/novels/:id/chapters", middleware.AuthMiddleware(), controllers.GetNovelChapters)
 	apiV1.GET("/novels/:id/chapter-status", middleware.AuthMiddleware(), controllers.GetChapterStatus)
 	apiV1.GET("/novels/:id/export", middleware.AuthMiddleware(), controllers.ExportNovel)
+
+	// 章节编辑路由（上传者或管理员）
+	apiV1.POST("/novels/:id/chapters", middleware.AuthMiddleware(), controllers.InsertChapter)
+	apiV1.PUT("/novels/:id/chapters/order", middleware.AuthMiddleware(), controllers.ReorderChapters)
+	apiV1.PUT("/chapters/:id", middleware.AuthMiddleware(), controllers.UpdateChapter)
+	apiV1.POST("/chapters/:id/move", middleware.AuthMiddleware(), controllers.MoveChapter)
+	apiV1.POST("/chapters/:id/split", middleware.AuthMiddleware(), controllers.SplitChapter)
+	apiV1.POST("/chapters/:id/merge", middleware.AuthMiddleware(), controllers.MergeChapters)
+
+	// 连载追更路由（上传者或管理员）
+	apiV1.GET("/novels/:id/updates", middleware.AuthMiddleware(), controllers.GetNovelUpdates)
+	apiV1.POST("/novels/:id/append", middleware.AuthMiddleware(), controllers.AppendNovelFile)
+	apiV1.GET("/novels/:id/append-jobs/:job_id", middleware.AuthMiddleware(), controllers.GetAppendJob)
+	apiV1.POST("/novels/:id/append-chapters", middleware.AuthMiddleware(), controllers.AppendNovelChapters)
+	apiV1.PUT("/novels/:id/serial-status", middleware.AuthMiddleware(), controllers.UpdateNovelSerialStatus)
 }
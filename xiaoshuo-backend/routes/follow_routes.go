@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"xiaoshuo-backend/controllers"
+	"xiaoshuo-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InitFollowRoutes 初始化关注（书架）和消息中心相关路由
+func InitFollowRoutes(apiV1 *gin.RouterGroup) {
+	// 关注小说相关路由
+	apiV1.POST("/novels/:id/follow", middleware.AuthMiddleware(), controllers.FollowNovel)
+	apiV1.DELETE("/novels/:id/follow", middleware.AuthMiddleware(), controllers.UnfollowNovel)
+	apiV1.GET("/novels/:id/follow", middleware.AuthMiddleware(), controllers.GetFollowStatus)
+	apiV1.GET("/users/follows", middleware.AuthMiddleware(), controllers.GetUserFollows)
+
+	// 消息中心未读数和已读标记，消息列表见 /users/system-messages
+	apiV1.GET("/users/system-messages/unread-count", middleware.AuthMiddleware(), controllers.GetUnreadMessageCount)
+	apiV1.POST("/users/system-messages/read", middleware.AuthMiddleware(), controllers.MarkMessagesRead)
+}
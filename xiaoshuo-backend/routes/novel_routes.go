@@ -11,11 +11,13 @@ import (
 func InitNovelRoutes(apiV1 *gin.RouterGroup) {
 	// 小说相关路由
 	apiV1.POST("/novels/upload", middleware.AuthMiddleware(), controllers.UploadNovel)
+	apiV1.POST("/novels/upload/preview", middleware.AuthMiddleware(), controllers.PreviewChapterSplit)
 	apiV1.GET("/novels", controllers.GetNovels)
 	apiV1.GET("/novels/:id", controllers.GetNovel)
 	apiV1.GET("/novels/:id/content", middleware.AuthMiddleware(), controllers.GetNovelContent)
 	apiV1.GET("/novels/:id/content-stream", middleware.AuthMiddleware(), controllers.GetNovelContentStream)
 	apiV1.POST("/novels/:id/click", controllers.RecordNovelClick)
+	apiV1.GET("/novels/:id/click-trend", controllers.GetNovelClickTrend)
 	apiV1.DELETE("/novels/:id", middleware.AuthMiddleware(), controllers.DeleteNovel)
 
 	// 批量删除小说路由
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"xiaoshuo-backend/controllers"
+	"xiaoshuo-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InitPreferenceRoutes 初始化用户偏好和推荐反馈相关路由
+func InitPreferenceRoutes(apiV1 *gin.RouterGroup) {
+	// 新用户引导和偏好设置路由
+	apiV1.GET("/users/onboarding", middleware.AuthMiddleware(), controllers.GetOnboardingOptions)
+	apiV1.GET("/users/preferences", middleware.AuthMiddleware(), controllers.GetUserPreferences)
+	apiV1.PUT("/users/preferences", middleware.AuthMiddleware(), controllers.UpdateUserPreferences)
+
+	// 推荐反馈路由
+	apiV1.POST("/novels/:id/not-interested", middleware.AuthMiddleware(), controllers.MarkNovelNotInterested)
+	apiV1.DELETE("/novels/:id/not-interested", middleware.AuthMiddleware(), controllers.UndoNovelNotInterested)
+	apiV1.GET("/users/not-interested", middleware.AuthMiddleware(), controllers.GetNotInterestedNovels)
+}
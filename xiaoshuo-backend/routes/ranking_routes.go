@@ -10,4 +10,8 @@ import (
 func InitRankingRoutes(apiV1 *gin.RouterGroup) {
 	// 排行榜相关路由
 	apiV1.GET("/rankings", controllers.GetRankings)
+	apiV1.GET("/rankings/boards", controllers.GetRankingBoards)
+	apiV1.GET("/rankings/boards/:board", controllers.GetRankingBoard)
+	apiV1.GET("/rankings/boards/:board/history", controllers.GetRankingBoardHistory)
+	apiV1.GET("/novels/:id/rank-history", controllers.GetNovelRankHistory)
 }
\ No newline at end of file
@@ -12,4 +12,5 @@ func InitRecommendationRoutes(apiV1 *gin.RouterGroup) {
 	// 推荐系统相关路由
 	apiV1.GET("/recommendations", controllers.GetRecommendations)
 	apiV1.GET("/recommendations/personalized", middleware.AuthMiddleware(), controllers.GetPersonalizedRecommendations)
+	apiV1.GET("/novels/:id/also-read", controllers.GetAlsoReadRecommendations)
 }
\ No newline at end of file
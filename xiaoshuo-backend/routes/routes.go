@@ -20,6 +20,9 @@ func InitRoutes(r *gin.Engine) {
 		InitRecommendationRoutes(apiV1)
 		InitSearchRoutes(apiV1)
 		InitReadingProgressRoutes(apiV1)
+		InitFollowRoutes(apiV1)
+		InitBookshelfRoutes(apiV1)
+		InitPreferenceRoutes(apiV1)
 		InitAdminRoutes(apiV1)
 	}
 }
\ No newline at end of file
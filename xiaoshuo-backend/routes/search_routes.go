@@ -16,6 +16,10 @@ func InitSearchRoutes(apiV1 *gin.RouterGroup) {
 	apiV1.GET("/search/hot-words", controllers.GetHotSearchKeywords)
 	apiV1.GET("/search/suggestions", controllers.SearchSuggestions)
 
+	// 章节搜索，返回正文片段需要登录
+	apiV1.GET("/search/chapters", middleware.AuthMiddleware(), controllers.SearchChapters)
+	apiV1.GET("/novels/:id/search", middleware.AuthMiddleware(), controllers.SearchWithinNovel)
+
 	// 搜索索引管理路由（仅管理员）
 	adminSearch := apiV1.Group("/")
 	adminSearch.Use(middleware.AdminAuthMiddleware())
@@ -23,5 +27,10 @@ func InitSearchRoutes(apiV1 *gin.RouterGroup) {
 		adminSearch.GET("/search/stats", controllers.GetSearchStats) // 搜索统计接口需要管理员权限
 		adminSearch.POST("/search/index/:id", controllers.IndexNovelForSearch)
 		adminSearch.POST("/search/rebuild-index", controllers.RebuildSearchIndex)
+		adminSearch.GET("/search/index-status", controllers.GetSearchIndexStatus)
+		adminSearch.GET("/search/synonyms", controllers.GetSearchSynonyms)
+		adminSearch.POST("/search/synonyms", controllers.CreateSearchSynonym)
+		adminSearch.PUT("/search/synonyms/:id", controllers.UpdateSearchSynonym)
+		adminSearch.DELETE("/search/synonyms/:id", controllers.DeleteSearchSynonym)
 	}
 }
\ No newline at end of file
@@ -0,0 +1,404 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"xiaoshuo-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidBookshelfOperation 书架操作参数不合法
+var ErrInvalidBookshelfOperation = errors.New("书架操作参数不合法")
+
+// 书架排序方式
+const (
+	BookshelfSortLastRead    = "last_read"
+	BookshelfSortLastUpdated = "last_updated"
+	BookshelfSortAdded       = "added"
+)
+
+// DefaultBookshelfGroups 新用户书架的默认分组
+var DefaultBookshelfGroups = []string{"在读", "想读", "已读完"}
+
+// BookshelfEntry 书架中的一本书，包含阅读进度和未读章节数
+type BookshelfEntry struct {
+	models.NovelFollow
+	GroupName          string     `json:"group_name"`           // 分组名称，未分组为空
+	LastReadAt         *time.Time `json:"last_read_at"`         // 最后阅读时间，未阅读为空
+	ReadChapterID      uint       `json:"read_chapter_id"`      // 当前阅读章节ID
+	ReadChapterName    string     `json:"read_chapter_name"`    // 当前阅读章节名称
+	ReadProgress       int        `json:"read_progress"`        // 阅读进度百分比
+	TotalChapters      int        `json:"total_chapters"`       // 章节总数
+	LatestChapterTitle string     `json:"latest_chapter_title"` // 最新章节标题
+	UnreadChapters     int        `json:"unread_chapters"`      // 上次阅读章节之后的未读章节数
+}
+
+// BookshelfService 书架服务
+type BookshelfService struct {
+	DB *gorm.DB
+}
+
+// NewBookshelfService 创建书架服务实例
+func NewBookshelfService(db *gorm.DB) *BookshelfService {
+	return &BookshelfService{DB: db}
+}
+
+// invalidBookshelfOperation 构造参数不合法错误
+func invalidBookshelfOperation(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidBookshelfOperation, fmt.Sprintf(format, args...))
+}
+
+// AddNovel 将已审核通过的小说加入书架，已在书架中时更新分组和通知方式
+// groupID 为nil时保持原分组（新加入时为未分组），notifyMode 为空时保持原通知方式（新加入时为即时通知）
+func (s *BookshelfService) AddNovel(userID, novelID uint, groupID *uint, notifyMode string) (*models.NovelFollow, error) {
+	if notifyMode != "" && !IsValidNotifyMode(notifyMode) {
+		return nil, invalidBookshelfOperation("无效的通知方式: %s", notifyMode)
+	}
+	if groupID != nil {
+		if err := s.checkGroup(userID, *groupID); err != nil {
+			return nil, err
+		}
+	}
+
+	var novel models.Novel
+	if err := s.DB.Select("id").Where("id = ? AND status = ?", novelID, "approved").First(&novel).Error; err != nil {
+		return nil, err
+	}
+
+	var follow models.NovelFollow
+	err := s.DB.Where("user_id = ? AND novel_id = ?", userID, novelID).First(&follow).Error
+	if err == gorm.ErrRecordNotFound {
+		follow = models.NovelFollow{
+			UserID:     userID,
+			NovelID:    novelID,
+			NotifyMode: notifyMode,
+		}
+		if follow.NotifyMode == "" {
+			follow.NotifyMode = NotifyModeInstant
+		}
+		if groupID != nil {
+			follow.GroupID = *groupID
+		}
+		if err := s.DB.Create(&follow).Error; err != nil {
+			return nil, err
+		}
+		return &follow, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{})
+	if groupID != nil {
+		updates["group_id"] = *groupID
+	}
+	if notifyMode != "" {
+		updates["notify_mode"] = notifyMode
+	}
+	if len(updates) > 0 {
+		if err := s.DB.Model(&follow).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &follow, nil
+}
+
+// UpdateEntry 修改书架中小说的分组、置顶和通知方式，参数为nil的字段保持不变
+func (s *BookshelfService) UpdateEntry(userID, novelID uint, groupID *uint, isPinned *bool, notifyMode *string) (*models.NovelFollow, error) {
+	var follow models.NovelFollow
+	if err := s.DB.Where("user_id = ? AND novel_id = ?", userID, novelID).First(&follow).Error; err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{})
+	if groupID != nil {
+		if err := s.checkGroup(userID, *groupID); err != nil {
+			return nil, err
+		}
+		updates["group_id"] = *groupID
+	}
+	if isPinned != nil && *isPinned != follow.IsPinned {
+		updates["is_pinned"] = *isPinned
+		if *isPinned {
+			updates["pinned_at"] = time.Now()
+		} else {
+			updates["pinned_at"] = nil
+		}
+	}
+	if notifyMode != nil {
+		if !IsValidNotifyMode(*notifyMode) {
+			return nil, invalidBookshelfOperation("无效的通知方式: %s", *notifyMode)
+		}
+		updates["notify_mode"] = *notifyMode
+	}
+	if len(updates) > 0 {
+		if err := s.DB.Model(&follow).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &follow, nil
+}
+
+// RemoveNovels 将小说移出书架，返回实际移除的数量
+// 使用物理删除，避免唯一索引与软删除记录冲突导致无法重新加入
+func (s *BookshelfService) RemoveNovels(userID uint, novelIDs []uint) (int64, error) {
+	result := s.DB.Unscoped().Where("user_id = ? AND novel_id IN ?", userID, novelIDs).Delete(&models.NovelFollow{})
+	return result.RowsAffected, result.Error
+}
+
+// MoveNovels 将书架中的小说批量移动到指定分组，groupID 为0表示移出分组
+func (s *BookshelfService) MoveNovels(userID uint, novelIDs []uint, groupID uint) (int64, error) {
+	if err := s.checkGroup(userID, groupID); err != nil {
+		return 0, err
+	}
+	result := s.DB.Model(&models.NovelFollow{}).
+		Where("user_id = ? AND novel_id IN ?", userID, novelIDs).
+		Update("group_id", groupID)
+	return result.RowsAffected, result.Error
+}
+
+// GetGroups 获取用户的书架分组，用户没有任何分组时创建默认分组
+func (s *BookshelfService) GetGroups(userID uint) ([]models.BookshelfGroup, error) {
+	var groups []models.BookshelfGroup
+	if err := s.DB.Where("user_id = ?", userID).Order("position ASC, id ASC").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	if len(groups) > 0 {
+		return groups, nil
+	}
+
+	groups = make([]models.BookshelfGroup, len(DefaultBookshelfGroups))
+	for i, name := range DefaultBookshelfGroups {
+		groups[i] = models.BookshelfGroup{UserID: userID, Name: name, Position: i + 1}
+	}
+	if err := s.DB.Create(&groups).Error; err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// CreateGroup 创建书架分组，新分组排在最后
+func (s *BookshelfService) CreateGroup(userID uint, name string) (*models.BookshelfGroup, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, invalidBookshelfOperation("分组名称不能为空")
+	}
+	groups, err := s.GetGroups(userID)
+	if err != nil {
+		return nil, err
+	}
+	position := 0
+	for _, group := range groups {
+		if group.Name == name {
+			return nil, invalidBookshelfOperation("分组“%s”已存在", name)
+		}
+		if group.Position > position {
+			position = group.Position
+		}
+	}
+
+	group := models.BookshelfGroup{UserID: userID, Name: name, Position: position + 1}
+	if err := s.DB.Create(&group).Error; err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// UpdateGroup 修改书架分组的名称和排序位置，参数为nil的字段保持不变
+func (s *BookshelfService) UpdateGroup(userID, groupID uint, name *string, position *int) (*models.BookshelfGroup, error) {
+	var group models.BookshelfGroup
+	if err := s.DB.Where("id = ? AND user_id = ?", groupID, userID).First(&group).Error; err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{})
+	if name != nil {
+		trimmed := strings.TrimSpace(*name)
+		if trimmed == "" {
+			return nil, invalidBookshelfOperation("分组名称不能为空")
+		}
+		var count int64
+		s.DB.Model(&models.BookshelfGroup{}).Where("user_id = ? AND name = ? AND id <> ?", userID, trimmed, groupID).Count(&count)
+		if count > 0 {
+			return nil, invalidBookshelfOperation("分组“%s”已存在", trimmed)
+		}
+		updates["name"] = trimmed
+	}
+	if position != nil {
+		updates["position"] = *position
+	}
+	if len(updates) > 0 {
+		if err := s.DB.Model(&group).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &group, nil
+}
+
+// DeleteGroup 删除书架分组，分组中的小说变为未分组
+func (s *BookshelfService) DeleteGroup(userID, groupID uint) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", groupID, userID).Delete(&models.BookshelfGroup{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&models.NovelFollow{}).
+			Where("user_id = ? AND group_id = ?", userID, groupID).
+			Update("group_id", 0).Error
+	})
+}
+
+// GetBookshelf 获取用户书架，置顶的小说排在最前，其余按指定方式排序
+// groupID 为nil时返回全部分组的小说，为0时只返回未分组的小说
+func (s *BookshelfService) GetBookshelf(userID uint, groupID *uint, sortBy string) ([]BookshelfEntry, error) {
+	query := s.DB.Where("user_id = ?", userID)
+	if groupID != nil {
+		query = query.Where("group_id = ?", *groupID)
+	}
+	var follows []models.NovelFollow
+	if err := query.Preload("Novel").Find(&follows).Error; err != nil {
+		return nil, err
+	}
+	entries := make([]BookshelfEntry, len(follows))
+	if len(follows) == 0 {
+		return entries, nil
+	}
+
+	novelIDs := make([]uint, len(follows))
+	for i, follow := range follows {
+		novelIDs[i] = follow.NovelID
+	}
+
+	groups, err := s.GetGroups(userID)
+	if err != nil {
+		return nil, err
+	}
+	groupNames := make(map[uint]string, len(groups))
+	for _, group := range groups {
+		groupNames[group.ID] = group.Name
+	}
+
+	// 阅读进度及当前阅读章节的位置
+	var progresses []models.ReadingProgress
+	if err := s.DB.Where("user_id = ? AND novel_id IN ?", userID, novelIDs).Order("updated_at ASC").Find(&progresses).Error; err != nil {
+		return nil, err
+	}
+	progressByNovel := make(map[uint]models.ReadingProgress, len(progresses))
+	var readChapterIDs []uint
+	for _, progress := range progresses {
+		progressByNovel[progress.NovelID] = progress
+		if progress.ChapterID != 0 {
+			readChapterIDs = append(readChapterIDs, progress.ChapterID)
+		}
+	}
+	readPositions := make(map[uint]int, len(readChapterIDs))
+	if len(readChapterIDs) > 0 {
+		var readChapters []models.Chapter
+		if err := s.DB.Select("id", "position").Where("id IN ?", readChapterIDs).Find(&readChapters).Error; err != nil {
+			return nil, err
+		}
+		for _, chapter := range readChapters {
+			readPositions[chapter.ID] = chapter.Position
+		}
+	}
+
+	// 每本小说的最新章节
+	var latestChapters []struct {
+		NovelID  uint
+		Position int
+		Title    string
+	}
+	if err := s.DB.Raw(`SELECT c.novel_id, c.position, c.title FROM chapters c
+		JOIN (SELECT novel_id, MAX(position) AS position FROM chapters
+			WHERE novel_id IN ? AND deleted_at IS NULL GROUP BY novel_id) latest
+		ON c.novel_id = latest.novel_id AND c.position = latest.position
+		WHERE c.deleted_at IS NULL`, novelIDs).Scan(&latestChapters).Error; err != nil {
+		return nil, err
+	}
+	latestByNovel := make(map[uint]int, len(latestChapters))
+	latestTitles := make(map[uint]string, len(latestChapters))
+	for _, chapter := range latestChapters {
+		latestByNovel[chapter.NovelID] = chapter.Position
+		latestTitles[chapter.NovelID] = chapter.Title
+	}
+
+	for i, follow := range follows {
+		entry := BookshelfEntry{
+			NovelFollow:        follow,
+			GroupName:          groupNames[follow.GroupID],
+			TotalChapters:      latestByNovel[follow.NovelID],
+			LatestChapterTitle: latestTitles[follow.NovelID],
+		}
+		entry.UnreadChapters = entry.TotalChapters
+		if progress, ok := progressByNovel[follow.NovelID]; ok {
+			lastReadAt := progress.UpdatedAt
+			entry.LastReadAt = &lastReadAt
+			entry.ReadChapterID = progress.ChapterID
+			entry.ReadChapterName = progress.ChapterName
+			entry.ReadProgress = progress.Progress
+			if position, ok := readPositions[progress.ChapterID]; ok {
+				entry.UnreadChapters = entry.TotalChapters - position
+				if entry.UnreadChapters < 0 {
+					entry.UnreadChapters = 0
+				}
+			}
+		}
+		entries[i] = entry
+	}
+
+	sortBookshelfEntries(entries, sortBy)
+	return entries, nil
+}
+
+// sortBookshelfEntries 书架排序：置顶的按置顶时间倒序排在最前，其余按指定方式倒序
+func sortBookshelfEntries(entries []BookshelfEntry, sortBy string) {
+	sortTime := func(entry BookshelfEntry) time.Time {
+		switch sortBy {
+		case BookshelfSortLastRead:
+			if entry.LastReadAt != nil {
+				return *entry.LastReadAt
+			}
+		case BookshelfSortLastUpdated:
+			if entry.Novel.LastChapterAt != nil {
+				return *entry.Novel.LastChapterAt
+			}
+			return entry.Novel.UpdatedAt
+		default:
+			return entry.CreatedAt
+		}
+		return time.Time{}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.IsPinned != b.IsPinned {
+			return a.IsPinned
+		}
+		if a.IsPinned && a.PinnedAt != nil && b.PinnedAt != nil && !a.PinnedAt.Equal(*b.PinnedAt) {
+			return a.PinnedAt.After(*b.PinnedAt)
+		}
+		return sortTime(a).After(sortTime(b))
+	})
+}
+
+// checkGroup 检查分组是否属于用户，groupID 为0表示未分组
+func (s *BookshelfService) checkGroup(userID, groupID uint) error {
+	if groupID == 0 {
+		return nil
+	}
+	var count int64
+	if err := s.DB.Model(&models.BookshelfGroup{}).Where("id = ? AND user_id = ?", groupID, userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return invalidBookshelfOperation("书架分组不存在")
+	}
+	return nil
+}
@@ -0,0 +1,582 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidChapterEdit 章节编辑参数不合法
+var ErrInvalidChapterEdit = errors.New("章节编辑参数不合法")
+
+// ChapterService 章节编辑服务
+// 所有编辑操作在事务中先锁定小说行再完成章节位置重排，同一小说的编辑依次执行，提交后重新统计字数并清理缓存
+type ChapterService struct {
+	DB *gorm.DB
+}
+
+// NewChapterService 创建章节编辑服务实例
+func NewChapterService(db *gorm.DB) *ChapterService {
+	return &ChapterService{DB: db}
+}
+
+// invalidChapterEdit 构造参数不合法错误
+func invalidChapterEdit(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidChapterEdit, fmt.Sprintf(format, args...))
+}
+
+// UpdateChapter 修改章节标题和内容，参数为nil的字段保持不变
+func (s *ChapterService) UpdateChapter(chapterID uint, title, content *string) (*models.Chapter, error) {
+	var chapter models.Chapter
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&chapter, chapterID).Error; err != nil {
+			return err
+		}
+
+		updates := make(map[string]interface{})
+		if title != nil {
+			trimmed := strings.TrimSpace(*title)
+			if trimmed == "" {
+				return invalidChapterEdit("章节标题不能为空")
+			}
+			updates["title"] = trimmed
+		}
+		if content != nil {
+			updates["content"] = *content
+			updates["word_count"] = utils.CalculateWordCount(*content)
+			updates["content_hash"] = utils.ChapterContentHash(*content)
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		if err := tx.Model(&chapter).Updates(updates).Error; err != nil {
+			return err
+		}
+		return recalculateNovelWordCounts(tx, chapter.NovelID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.afterChapterEdit(chapter.NovelID, chapter.ID)
+	return &chapter, nil
+}
+
+// InsertChapter 在指定位置插入新章节，原位置及之后的章节顺延
+// position 取值为 1 到 章节数+1；volumeID 为nil时继承前一章节的分卷
+func (s *ChapterService) InsertChapter(novelID uint, position int, title, content string, volumeID *uint) (*models.Chapter, error) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return nil, invalidChapterEdit("章节标题不能为空")
+	}
+
+	var chapter models.Chapter
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockNovel(tx, novelID); err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&models.Chapter{}).Where("novel_id = ?", novelID).Count(&count).Error; err != nil {
+			return err
+		}
+		if position < 1 || position > int(count)+1 {
+			return invalidChapterEdit("插入位置必须在1到%d之间", count+1)
+		}
+
+		targetVolumeID, err := s.resolveInsertVolume(tx, novelID, position, volumeID)
+		if err != nil {
+			return err
+		}
+
+		if err := shiftChapterPositions(tx, novelID, position, 1); err != nil {
+			return err
+		}
+
+		chapter = models.Chapter{
+			NovelID:     novelID,
+			VolumeID:    targetVolumeID,
+			Title:       title,
+			Content:     content,
+			Position:    position,
+			WordCount:   utils.CalculateWordCount(content),
+			ContentHash: utils.ChapterContentHash(content),
+		}
+		if err := tx.Create(&chapter).Error; err != nil {
+			return err
+		}
+		return recalculateNovelWordCounts(tx, novelID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.afterChapterEdit(novelID, chapter.ID)
+	return &chapter, nil
+}
+
+// ReorderChapters 按给定的章节ID顺序重新排列小说的全部章节
+// 被移动到其他分卷中间的章节归入新位置所在的分卷（见 reorderedVolumes）
+func (s *ChapterService) ReorderChapters(novelID uint, chapterIDs []uint) error {
+	var affected []uint
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockNovel(tx, novelID); err != nil {
+			return err
+		}
+		var chapters []models.Chapter
+		if err := tx.Select("id", "position", "volume_id").Where("novel_id = ?", novelID).Find(&chapters).Error; err != nil {
+			return err
+		}
+		if len(chapterIDs) != len(chapters) {
+			return invalidChapterEdit("章节ID列表必须包含小说的全部%d个章节", len(chapters))
+		}
+
+		currentPositions := make(map[uint]int, len(chapters))
+		currentVolumes := make(map[uint]uint, len(chapters))
+		for _, chapter := range chapters {
+			currentPositions[chapter.ID] = chapter.Position
+			currentVolumes[chapter.ID] = chapter.VolumeID
+		}
+		seen := make(map[uint]bool, len(chapterIDs))
+		for _, id := range chapterIDs {
+			if _, ok := currentPositions[id]; !ok {
+				return invalidChapterEdit("章节%d不属于该小说", id)
+			}
+			if seen[id] {
+				return invalidChapterEdit("章节%d重复出现", id)
+			}
+			seen[id] = true
+		}
+
+		// 只更新位置或分卷发生变化的章节
+		volumes := reorderedVolumes(chapterIDs, currentPositions, currentVolumes)
+		volumeChanged := false
+		for i, id := range chapterIDs {
+			if currentPositions[id] == i+1 && currentVolumes[id] == volumes[i] {
+				continue
+			}
+			if err := tx.Model(&models.Chapter{}).Where("id = ?", id).Updates(map[string]interface{}{
+				"position":  i + 1,
+				"volume_id": volumes[i],
+			}).Error; err != nil {
+				return err
+			}
+			if currentVolumes[id] != volumes[i] {
+				volumeChanged = true
+			}
+			affected = append(affected, id)
+		}
+		if volumeChanged {
+			return recalculateNovelWordCounts(tx, novelID)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.afterChapterEdit(novelID, affected...)
+	return nil
+}
+
+// MoveChapter 将章节移动到指定位置，中间的章节依次前移或后移
+// 移动后章节归入新位置前一章所在的分卷，移到第一章时归入原第一章的分卷
+func (s *ChapterService) MoveChapter(chapterID uint, position int) (*models.Chapter, error) {
+	var chapter models.Chapter
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockChapterNovel(tx, &chapter, chapterID); err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&models.Chapter{}).Where("novel_id = ?", chapter.NovelID).Count(&count).Error; err != nil {
+			return err
+		}
+		if position < 1 || position > int(count) {
+			return invalidChapterEdit("目标位置必须在1到%d之间", count)
+		}
+		if position == chapter.Position {
+			return nil
+		}
+
+		query := tx.Model(&models.Chapter{}).Where("novel_id = ? AND id <> ?", chapter.NovelID, chapter.ID)
+		var err error
+		if position < chapter.Position {
+			err = query.Where("position >= ? AND position < ?", position, chapter.Position).
+				Update("position", gorm.Expr("position + 1")).Error
+		} else {
+			err = query.Where("position > ? AND position <= ?", chapter.Position, position).
+				Update("position", gorm.Expr("position - 1")).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		// 新位置的相邻章节此时已完成移位
+		neighborPosition := position - 1
+		if neighborPosition < 1 {
+			neighborPosition = 2
+		}
+		var neighbor models.Chapter
+		if err := tx.Select("volume_id").Where("novel_id = ? AND id <> ? AND position = ?", chapter.NovelID, chapter.ID, neighborPosition).
+			First(&neighbor).Error; err != nil {
+			return err
+		}
+
+		volumeChanged := neighbor.VolumeID != chapter.VolumeID
+		chapter.Position = position
+		chapter.VolumeID = neighbor.VolumeID
+		if err := tx.Model(&chapter).Updates(map[string]interface{}{
+			"position":  position,
+			"volume_id": chapter.VolumeID,
+		}).Error; err != nil {
+			return err
+		}
+		if volumeChanged {
+			return recalculateNovelWordCounts(tx, chapter.NovelID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.afterChapterEdit(chapter.NovelID, chapter.ID)
+	return &chapter, nil
+}
+
+// SplitChapter 在内容的指定字符偏移处将章节拆分为两章，后半部分作为新章节插入到原章节之后
+func (s *ChapterService) SplitChapter(chapterID uint, offset int, newTitle string) (*models.Chapter, *models.Chapter, error) {
+	newTitle = strings.TrimSpace(newTitle)
+	if newTitle == "" {
+		return nil, nil, invalidChapterEdit("新章节标题不能为空")
+	}
+
+	var first, second models.Chapter
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockChapterNovel(tx, &first, chapterID); err != nil {
+			return err
+		}
+
+		// 按字符偏移拆分，避免截断多字节字符
+		runes := []rune(first.Content)
+		if len(runes) < 2 {
+			return invalidChapterEdit("章节内容不足两个字，无法拆分")
+		}
+		if offset <= 0 || offset >= len(runes) {
+			return invalidChapterEdit("拆分位置必须在1到%d之间", len(runes)-1)
+		}
+		head := strings.TrimRight(string(runes[:offset]), "\r\n")
+		tail := strings.TrimLeft(string(runes[offset:]), "\r\n")
+
+		if err := shiftChapterPositions(tx, first.NovelID, first.Position+1, 1); err != nil {
+			return err
+		}
+
+		first.Content = head
+		first.WordCount = utils.CalculateWordCount(head)
+		first.ContentHash = utils.ChapterContentHash(head)
+		if err := tx.Model(&first).Updates(map[string]interface{}{
+			"content":      first.Content,
+			"word_count":   first.WordCount,
+			"content_hash": first.ContentHash,
+		}).Error; err != nil {
+			return err
+		}
+
+		second = models.Chapter{
+			NovelID:     first.NovelID,
+			VolumeID:    first.VolumeID,
+			Title:       newTitle,
+			Content:     tail,
+			Position:    first.Position + 1,
+			WordCount:   utils.CalculateWordCount(tail),
+			ContentHash: utils.ChapterContentHash(tail),
+		}
+		if err := tx.Create(&second).Error; err != nil {
+			return err
+		}
+		return recalculateNovelWordCounts(tx, first.NovelID)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.afterChapterEdit(first.NovelID, first.ID, second.ID)
+	return &first, &second, nil
+}
+
+// MergeChapters 将章节与其后一章合并，合并后保留前一章的标题
+// keepTitle 为true时将后一章标题作为一行保留在正文中；后一章的阅读进度和评论转移到合并后的章节
+func (s *ChapterService) MergeChapters(chapterID uint, keepTitle bool) (*models.Chapter, error) {
+	var first models.Chapter
+	var second models.Chapter
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockChapterNovel(tx, &first, chapterID); err != nil {
+			return err
+		}
+		if err := tx.Where("novel_id = ? AND position = ?", first.NovelID, first.Position+1).First(&second).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return invalidChapterEdit("已经是最后一章，没有可合并的下一章")
+			}
+			return err
+		}
+
+		var builder strings.Builder
+		builder.WriteString(first.Content)
+		if keepTitle {
+			builder.WriteString("\n")
+			builder.WriteString(second.Title)
+		}
+		builder.WriteString("\n")
+		builder.WriteString(second.Content)
+
+		first.Content = builder.String()
+		first.WordCount = utils.CalculateWordCount(first.Content)
+		first.ContentHash = utils.ChapterContentHash(first.Content)
+		if err := tx.Model(&first).Updates(map[string]interface{}{
+			"content":      first.Content,
+			"word_count":   first.WordCount,
+			"content_hash": first.ContentHash,
+		}).Error; err != nil {
+			return err
+		}
+
+		// 转移被合并章节的阅读进度和章节评论
+		if err := tx.Model(&models.ReadingProgress{}).Where("chapter_id = ?", second.ID).
+			Updates(map[string]interface{}{"chapter_id": first.ID, "chapter_name": first.Title}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Comment{}).Where("chapter_id = ?", second.ID).Update("chapter_id", first.ID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Delete(&second).Error; err != nil {
+			return err
+		}
+		if err := shiftChapterPositions(tx, first.NovelID, second.Position+1, -1); err != nil {
+			return err
+		}
+		return recalculateNovelWordCounts(tx, first.NovelID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.afterChapterEdit(first.NovelID, first.ID, second.ID)
+	return &first, nil
+}
+
+// resolveInsertVolume 确定新插入章节所属的分卷
+func (s *ChapterService) resolveInsertVolume(tx *gorm.DB, novelID uint, position int, volumeID *uint) (uint, error) {
+	if volumeID != nil {
+		if *volumeID == 0 {
+			return 0, nil
+		}
+		var volume models.Volume
+		if err := tx.Where("id = ? AND novel_id = ?", *volumeID, novelID).First(&volume).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return 0, invalidChapterEdit("分卷不存在")
+			}
+			return 0, err
+		}
+		return volume.ID, nil
+	}
+
+	// 继承前一章节的分卷，插入到第一章时继承原第一章的分卷
+	neighborPosition := position - 1
+	if neighborPosition < 1 {
+		neighborPosition = 1
+	}
+	var neighbor models.Chapter
+	err := tx.Select("volume_id").Where("novel_id = ? AND position = ?", novelID, neighborPosition).First(&neighbor).Error
+	if err == gorm.ErrRecordNotFound {
+		return 0, nil
+	}
+	return neighbor.VolumeID, err
+}
+
+// lockNovel 锁定小说行，使同一小说的章节位置调整依次执行
+func lockNovel(tx *gorm.DB, novelID uint) error {
+	var novel models.Novel
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&novel, novelID).Error
+}
+
+// lockChapterNovel 锁定章节所属的小说行，并在加锁后重新读取章节，避免使用加锁前的旧位置
+func lockChapterNovel(tx *gorm.DB, chapter *models.Chapter, chapterID uint) error {
+	if err := tx.Select("novel_id").First(chapter, chapterID).Error; err != nil {
+		return err
+	}
+	if err := lockNovel(tx, chapter.NovelID); err != nil {
+		return err
+	}
+	*chapter = models.Chapter{}
+	return tx.First(chapter, chapterID).Error
+}
+
+// reorderedVolumes 计算重新排列后每个位置上章节所属的分卷
+// 相对顺序没有改变的章节（原位置的最长递增子序列）保留原分卷，其余视为被移动的章节，
+// 归入新位置前一章的分卷，移到最前面时归入其后第一个未移动章节的分卷
+func reorderedVolumes(order []uint, positions map[uint]int, volumes map[uint]uint) []uint {
+	n := len(order)
+	// tails[k] 为长度 k+1 的递增子序列结尾元素在 order 中的下标
+	tails := make([]int, 0, n)
+	prev := make([]int, n)
+	for i, id := range order {
+		p := positions[id]
+		lo, hi := 0, len(tails)
+		for lo < hi {
+			mid := (lo + hi) / 2
+			if positions[order[tails[mid]]] < p {
+				lo = mid + 1
+			} else {
+				hi = mid
+			}
+		}
+		prev[i] = -1
+		if lo > 0 {
+			prev[i] = tails[lo-1]
+		}
+		if lo == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[lo] = i
+		}
+	}
+	kept := make([]bool, n)
+	if len(tails) > 0 {
+		for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+			kept[i] = true
+		}
+	}
+
+	result := make([]uint, n)
+	for i, id := range order {
+		switch {
+		case kept[i]:
+			result[i] = volumes[id]
+		case i > 0:
+			result[i] = result[i-1]
+		default:
+			for j := 1; j < n; j++ {
+				if kept[j] {
+					result[i] = volumes[order[j]]
+					break
+				}
+			}
+		}
+	}
+	return result
+}
+
+// shiftChapterPositions 将小说中位置大于等于 from 的章节位置加上 delta
+func shiftChapterPositions(tx *gorm.DB, novelID uint, from int, delta int) error {
+	return tx.Model(&models.Chapter{}).
+		Where("novel_id = ? AND position >= ?", novelID, from).
+		Update("position", gorm.Expr("position + ?", delta)).Error
+}
+
+// recalculateNovelWordCounts 重新统计分卷和小说的字数
+func recalculateNovelWordCounts(tx *gorm.DB, novelID uint) error {
+	var volumes []models.Volume
+	if err := tx.Where("novel_id = ?", novelID).Find(&volumes).Error; err != nil {
+		return err
+	}
+	for _, volume := range volumes {
+		var stats struct {
+			WordCount    int
+			ChapterCount int
+		}
+		if err := tx.Model(&models.Chapter{}).
+			Select("COALESCE(SUM(word_count), 0) AS word_count, COUNT(*) AS chapter_count").
+			Where("volume_id = ?", volume.ID).
+			Scan(&stats).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&volume).Updates(map[string]interface{}{
+			"word_count":    stats.WordCount,
+			"chapter_count": stats.ChapterCount,
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	var totalWords int64
+	if err := tx.Model(&models.Chapter{}).Where("novel_id = ?", novelID).
+		Select("COALESCE(SUM(word_count), 0)").Scan(&totalWords).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Novel{}).Where("id = ?", novelID).Update("word_count", totalWords).Error
+}
+
+// afterChapterEdit 章节编辑提交后清理缓存
+func (s *ChapterService) afterChapterEdit(novelID uint, chapterIDs ...uint) {
+	refreshNovelAfterChapterChange(novelID, chapterIDs...)
+}
+
+// refreshNovelAfterChapterChange 章节变更提交后清理小说和章节缓存，搜索索引由 SearchIndexer 根据发件箱同步
+func refreshNovelAfterChapterChange(novelID uint, chapterIDs ...uint) {
+	utils.GlobalCacheService.InvalidateNovelCache(novelID)
+	for _, chapterID := range chapterIDs {
+		utils.GlobalCacheService.InvalidateChapterCache(chapterID)
+	}
+}
+
+// ReindexNovel 重新为小说元数据和全部章节建立搜索索引
+func ReindexNovel(db *gorm.DB, novelID uint) error {
+	if utils.GlobalSearchIndex == nil {
+		return nil
+	}
+
+	var novel models.Novel
+	if err := db.Preload("Categories").Preload("Keywords").First(&novel, novelID).Error; err != nil {
+		return err
+	}
+	var chapters []models.Chapter
+	if err := db.Where("novel_id = ?", novelID).Order("position ASC").Find(&chapters).Error; err != nil {
+		return err
+	}
+	return indexNovelChapters(novel, chapters)
+}
+
+// ReindexNovelMetadata 只重新为小说元数据建立索引，用于评分、点击量等统计变化后刷新过滤和排序字段
+// 审核状态与索引中不一致时章节文档也需要更新，此时重建整本小说的索引
+func ReindexNovelMetadata(db *gorm.DB, novelID uint) error {
+	if utils.GlobalSearchIndex == nil {
+		return nil
+	}
+
+	var novel models.Novel
+	if err := db.Preload("Categories").Preload("Keywords").First(&novel, novelID).Error; err != nil {
+		return err
+	}
+	indexedStatus, err := utils.GlobalSearchIndex.IndexedNovelStatus(novelID)
+	if err != nil {
+		return err
+	}
+	if indexedStatus != novel.Status {
+		var chapters []models.Chapter
+		if err := db.Where("novel_id = ?", novelID).Order("position ASC").Find(&chapters).Error; err != nil {
+			return err
+		}
+		return indexNovelChapters(novel, chapters)
+	}
+	return utils.GlobalSearchIndex.IndexNovel(novel)
+}
+
+// indexNovelChapters 为小说元数据和给定章节逐章建立搜索索引，索引中多余的章节会被删除
+func indexNovelChapters(novel models.Novel, chapters []models.Chapter) error {
+	if utils.GlobalSearchIndex == nil {
+		return nil
+	}
+	if err := utils.GlobalSearchIndex.IndexNovel(novel); err != nil {
+		return fmt.Errorf("小说索引失败: %v", err)
+	}
+	if err := utils.GlobalSearchIndex.IndexNovelChapters(novel, chapters); err != nil {
+		return fmt.Errorf("章节索引失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+//go:build sqlite
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"xiaoshuo-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// seedChapterNovel 写入一本两卷四章的小说：卷一为第一、二章，卷二为第三、四章
+// 返回章节标题到章节ID的映射
+func seedChapterNovel(t *testing.T, db *gorm.DB) (uint, map[string]uint) {
+	t.Helper()
+	novel := models.Novel{Title: "小说", Author: "作者", Filepath: "x", FileHash: "1"}
+	if err := db.Create(&novel).Error; err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[string]uint)
+	for v, volumeTitle := range []string{"卷一", "卷二"} {
+		volume := models.Volume{NovelID: novel.ID, Title: volumeTitle, Position: v + 1}
+		if err := db.Create(&volume).Error; err != nil {
+			t.Fatal(err)
+		}
+		for c := 1; c <= 2; c++ {
+			position := v*2 + c
+			chapter := models.Chapter{
+				NovelID:   novel.ID,
+				VolumeID:  volume.ID,
+				Position:  position,
+				Title:     fmt.Sprintf("第%d章", position),
+				Content:   fmt.Sprintf("第%d章正文", position),
+				WordCount: 5,
+			}
+			if err := db.Create(&chapter).Error; err != nil {
+				t.Fatal(err)
+			}
+			ids[chapter.Title] = chapter.ID
+		}
+	}
+	return novel.ID, ids
+}
+
+// chapterLayout 按位置返回章节，格式为 "分卷/章节标题:正文"
+func chapterLayout(t *testing.T, db *gorm.DB, novelID uint) []string {
+	t.Helper()
+	var volumes []models.Volume
+	if err := db.Where("novel_id = ?", novelID).Find(&volumes).Error; err != nil {
+		t.Fatal(err)
+	}
+	volumeTitles := map[uint]string{0: "-"}
+	for _, volume := range volumes {
+		volumeTitles[volume.ID] = volume.Title
+	}
+	var chapters []models.Chapter
+	if err := db.Where("novel_id = ?", novelID).Order("position ASC").Find(&chapters).Error; err != nil {
+		t.Fatal(err)
+	}
+	layout := make([]string, 0, len(chapters))
+	for i, chapter := range chapters {
+		if chapter.Position != i+1 {
+			t.Errorf("chapter %q at position %d, want %d", chapter.Title, chapter.Position, i+1)
+		}
+		layout = append(layout, fmt.Sprintf("%s/%s:%s", volumeTitles[chapter.VolumeID], chapter.Title, chapter.Content))
+	}
+	return layout
+}
+
+// volumeChapterCounts 返回各分卷记录的章节数
+func volumeChapterCounts(t *testing.T, db *gorm.DB, novelID uint) map[string]int {
+	t.Helper()
+	var volumes []models.Volume
+	if err := db.Where("novel_id = ?", novelID).Find(&volumes).Error; err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int, len(volumes))
+	for _, volume := range volumes {
+		counts[volume.Title] = volume.ChapterCount
+	}
+	return counts
+}
+
+func TestChapterEdits(t *testing.T) {
+	tests := []struct {
+		name   string
+		edit   func(s *ChapterService, novelID uint, ids map[string]uint) error
+		layout []string
+		counts map[string]int
+	}{
+		{
+			name: "reorder across volumes",
+			edit: func(s *ChapterService, novelID uint, ids map[string]uint) error {
+				return s.ReorderChapters(novelID, []uint{ids["第2章"], ids["第3章"], ids["第4章"], ids["第1章"]})
+			},
+			layout: []string{"卷一/第2章:第2章正文", "卷二/第3章:第3章正文", "卷二/第4章:第4章正文", "卷二/第1章:第1章正文"},
+			counts: map[string]int{"卷一": 1, "卷二": 3},
+		},
+		{
+			name: "split last chapter",
+			edit: func(s *ChapterService, novelID uint, ids map[string]uint) error {
+				_, _, err := s.SplitChapter(ids["第4章"], 3, "第5章")
+				return err
+			},
+			layout: []string{"卷一/第1章:第1章正文", "卷一/第2章:第2章正文", "卷二/第3章:第3章正文", "卷二/第4章:第4章", "卷二/第5章:正文"},
+			counts: map[string]int{"卷一": 2, "卷二": 3},
+		},
+		{
+			name: "merge across volume boundary",
+			edit: func(s *ChapterService, novelID uint, ids map[string]uint) error {
+				_, err := s.MergeChapters(ids["第2章"], true)
+				return err
+			},
+			layout: []string{"卷一/第1章:第1章正文", "卷一/第2章:第2章正文\n第3章\n第3章正文", "卷二/第4章:第4章正文"},
+			counts: map[string]int{"卷一": 2, "卷二": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t, &models.ReadingProgress{}, &models.Comment{})
+			useUnreachableCache(t)
+			novelID, ids := seedChapterNovel(t, db)
+			if err := tt.edit(NewChapterService(db), novelID, ids); err != nil {
+				t.Fatal(err)
+			}
+			if got := chapterLayout(t, db, novelID); !reflect.DeepEqual(got, tt.layout) {
+				t.Errorf("layout = %q, want %q", got, tt.layout)
+			}
+			if got := volumeChapterCounts(t, db, novelID); !reflect.DeepEqual(got, tt.counts) {
+				t.Errorf("volume chapter counts = %v, want %v", got, tt.counts)
+			}
+		})
+	}
+}
+
+func TestMergeChaptersMovesReadingProgress(t *testing.T) {
+	db := openTestDB(t, &models.ReadingProgress{}, &models.Comment{})
+	useUnreachableCache(t)
+	novelID, ids := seedChapterNovel(t, db)
+	progress := models.ReadingProgress{UserID: 1, NovelID: novelID, ChapterID: ids["第3章"], ChapterName: "第3章"}
+	if err := db.Create(&progress).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewChapterService(db).MergeChapters(ids["第2章"], false); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.First(&progress, progress.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if progress.ChapterID != ids["第2章"] || progress.ChapterName != "第2章" {
+		t.Errorf("reading progress = chapter %d %q, want chapter %d 第2章", progress.ChapterID, progress.ChapterName, ids["第2章"])
+	}
+}
+
+func TestChapterEditsRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string // 非空时先替换第一章的正文
+		edit    func(s *ChapterService, novelID uint, ids map[string]uint) error
+	}{
+		{"split one-character chapter", "一", func(s *ChapterService, novelID uint, ids map[string]uint) error {
+			_, _, err := s.SplitChapter(ids["第1章"], 1, "新章节")
+			return err
+		}},
+		{"split at start", "", func(s *ChapterService, novelID uint, ids map[string]uint) error {
+			_, _, err := s.SplitChapter(ids["第1章"], 0, "新章节")
+			return err
+		}},
+		{"split at end", "", func(s *ChapterService, novelID uint, ids map[string]uint) error {
+			_, _, err := s.SplitChapter(ids["第1章"], 5, "新章节")
+			return err
+		}},
+		{"split without title", "", func(s *ChapterService, novelID uint, ids map[string]uint) error {
+			_, _, err := s.SplitChapter(ids["第1章"], 2, " ")
+			return err
+		}},
+		{"merge last chapter", "", func(s *ChapterService, novelID uint, ids map[string]uint) error {
+			_, err := s.MergeChapters(ids["第4章"], false)
+			return err
+		}},
+		{"reorder missing chapter", "", func(s *ChapterService, novelID uint, ids map[string]uint) error {
+			return s.ReorderChapters(novelID, []uint{ids["第1章"], ids["第2章"], ids["第3章"]})
+		}},
+		{"reorder duplicate chapter", "", func(s *ChapterService, novelID uint, ids map[string]uint) error {
+			return s.ReorderChapters(novelID, []uint{ids["第1章"], ids["第1章"], ids["第3章"], ids["第4章"]})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t, &models.ReadingProgress{}, &models.Comment{})
+			useUnreachableCache(t)
+			novelID, ids := seedChapterNovel(t, db)
+			if tt.content != "" {
+				if err := db.Model(&models.Chapter{}).Where("id = ?", ids["第1章"]).Update("content", tt.content).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			before := chapterLayout(t, db, novelID)
+			if err := tt.edit(NewChapterService(db), novelID, ids); !errors.Is(err, ErrInvalidChapterEdit) {
+				t.Fatalf("error = %v, want %v", err, ErrInvalidChapterEdit)
+			}
+			if got := chapterLayout(t, db, novelID); !reflect.DeepEqual(got, before) {
+				t.Errorf("layout changed to %q", got)
+			}
+		})
+	}
+}
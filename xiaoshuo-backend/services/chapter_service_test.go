@@ -0,0 +1,32 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReorderedVolumes(t *testing.T) {
+	// 章节1、2属于分卷10，章节3、4属于分卷20，原位置与章节ID相同
+	positions := map[uint]int{1: 1, 2: 2, 3: 3, 4: 4}
+	volumes := map[uint]uint{1: 10, 2: 10, 3: 20, 4: 20}
+	tests := []struct {
+		name  string
+		order []uint
+		want  []uint
+	}{
+		{"unchanged", []uint{1, 2, 3, 4}, []uint{10, 10, 20, 20}},
+		{"move last to front", []uint{4, 1, 2, 3}, []uint{10, 10, 10, 20}},
+		{"move first into next volume", []uint{2, 3, 1, 4}, []uint{10, 20, 20, 20}},
+		{"move first to end", []uint{2, 3, 4, 1}, []uint{10, 20, 20, 20}},
+		// 交换相邻的跨卷章节时保留较早的章节，后一卷的第一章被移入前一卷
+		{"swap across volumes", []uint{1, 3, 2, 4}, []uint{10, 10, 10, 20}},
+		// 完全倒序时只有原第一章保持相对顺序，其余章节都归入它的分卷
+		{"reverse", []uint{4, 3, 2, 1}, []uint{10, 10, 10, 10}},
+		{"empty", []uint{}, []uint{}},
+	}
+	for _, tt := range tests {
+		if got := reorderedVolumes(tt.order, positions, volumes); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: reorderedVolumes(%v) = %v, want %v", tt.name, tt.order, got, tt.want)
+		}
+	}
+}
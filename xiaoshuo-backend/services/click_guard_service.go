@@ -0,0 +1,368 @@
+package services
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// 点击判定结果
+const (
+	ClickVerdictCounted     = "counted"      // 计入点击
+	ClickVerdictDuplicate   = "duplicate"    // 去重窗口内的重复点击
+	ClickVerdictBot         = "bot"          // 爬虫或脚本
+	ClickVerdictRateLimited = "rate_limited" // IP点击过于频繁
+	ClickVerdictDropped     = "dropped"      // 缓存不可用或所在区间已汇总结束，未计入
+)
+
+const (
+	clickDedupeWindow = 30 * time.Minute // 同一读者对同一本小说的点击去重窗口
+	clickRateWindow   = time.Minute      // IP限流窗口
+	clickRateLimit    = 60               // 每个IP在限流窗口内允许的点击次数
+	clickRetention    = 8 * 24 * time.Hour
+)
+
+// ErrClickRateLimited IP点击过于频繁
+var ErrClickRateLimited = errors.New("点击过于频繁")
+
+// ErrInvalidClickDiscount 点击扣除参数无效
+var ErrInvalidClickDiscount = errors.New("点击扣除参数无效")
+
+// botUserAgentMarkers 常见爬虫、命令行工具和自动化框架的User-Agent特征（小写）
+var botUserAgentMarkers = []string{
+	"bot", "spider", "crawl", "slurp", "curl", "wget", "python-requests", "python-urllib",
+	"go-http-client", "java/", "okhttp", "httpclient", "apache-http", "scrapy", "postman",
+	"headlesschrome", "phantomjs", "selenium", "puppeteer", "playwright",
+}
+
+// ClickRequest 一次点击请求的来源信息
+type ClickRequest struct {
+	NovelID        uint
+	UserID         uint   // 登录用户ID，匿名点击为0
+	IP             string // 客户端IP
+	UserAgent      string
+	AcceptLanguage string
+	DeviceID       string // 客户端上报的设备标识，可为空
+}
+
+// ClickAnomaly 点击异常的小说
+type ClickAnomaly struct {
+	NovelID           uint      `json:"novel_id"`
+	Title             string    `json:"title"`
+	WindowClicks      int64     `json:"window_clicks"`       // 统计窗口内的点击数
+	RejectedClicks    int64     `json:"rejected_clicks"`     // 统计窗口内被拦截的点击数
+	DiscountedClicks  int64     `json:"discounted_clicks"`   // 统计窗口内已扣除的点击数
+	PeakHour          time.Time `json:"peak_hour"`           // 点击最多的小时
+	PeakClicks        int64     `json:"peak_clicks"`         // 峰值小时的点击数
+	PeakUniqueReaders int64     `json:"peak_unique_readers"` // 峰值小时的独立读者数
+	BaselineHourly    float64   `json:"baseline_hourly"`     // 之前7天的平均每小时点击数
+	SpikeRatio        float64   `json:"spike_ratio"`         // 峰值相对基线的倍数
+	Reasons           []string  `json:"reasons"`             // 判定为异常的原因
+}
+
+// ClickAnomalyOptions 点击异常检测参数
+type ClickAnomalyOptions struct {
+	Hours      int     // 统计最近多少小时
+	MinClicks  int64   // 峰值小时点击数（或被拦截点击数）低于该值时不视为异常
+	SpikeRatio float64 // 峰值超过基线多少倍视为突增
+}
+
+// ClickGuardService 点击防刷服务
+// 点击计入统计前进行爬虫识别、IP限流和去重，并提供异常点击报告和刷量点击扣除
+type ClickGuardService struct {
+	DB *gorm.DB
+}
+
+// NewClickGuardService 创建点击防刷服务实例
+func NewClickGuardService(db *gorm.DB) *ClickGuardService {
+	return &ClickGuardService{DB: db}
+}
+
+// RecordClick 检查点击来源后记录点击，返回判定结果；IP超过限流时返回 ErrClickRateLimited
+func (s *ClickGuardService) RecordClick(req ClickRequest) (string, error) {
+	if utils.GlobalCache == nil {
+		return "", fmt.Errorf("缓存未初始化")
+	}
+	now := time.Now()
+
+	if IsBotUserAgent(req.UserAgent) {
+		s.recordRejected(req.NovelID, now)
+		return ClickVerdictBot, nil
+	}
+
+	count, err := utils.GlobalCache.IncrClickRate(req.IP, clickRateWindow)
+	if err != nil {
+		return "", err
+	}
+	if count > clickRateLimit {
+		s.recordRejected(req.NovelID, now)
+		return ClickVerdictRateLimited, ErrClickRateLimited
+	}
+
+	fingerprint := clickFingerprint(req)
+	identities := []string{"d:" + fingerprint}
+	if req.UserID > 0 {
+		identities = append(identities, fmt.Sprintf("u:%d", req.UserID))
+	} else if req.DeviceID != "" {
+		// 匿名点击上报的设备标识可随意更换，同时按IP、User-Agent和语言组合去重；
+		// 不单独按IP去重，避免同一出口IP下的不同读者被误判为重复点击
+		network := req
+		network.DeviceID = ""
+		identities = append(identities, "ip:"+clickFingerprint(network))
+	}
+	duplicate, err := utils.GlobalCache.MarkClickSeen(req.NovelID, identities, clickDedupeWindow)
+	if err != nil {
+		return "", err
+	}
+	if duplicate {
+		s.recordRejected(req.NovelID, now)
+		return ClickVerdictDuplicate, nil
+	}
+
+	reader := "d:" + fingerprint
+	if req.UserID > 0 {
+		reader = fmt.Sprintf("u:%d", req.UserID)
+	}
+	if err := utils.GlobalCache.RecordClick(req.NovelID, reader, now); err != nil {
+		if errors.Is(err, utils.ErrClickBucketFinished) {
+			// 请求处理过慢，所在小时区间已汇总结束
+			return ClickVerdictDropped, nil
+		}
+		return "", err
+	}
+	return ClickVerdictCounted, nil
+}
+
+// recordRejected 记录被拦截的点击，失败时仅记录日志
+func (s *ClickGuardService) recordRejected(novelID uint, at time.Time) {
+	if err := utils.GlobalCache.RecordRejectedClick(novelID, at); err != nil {
+		log.Printf("记录被拦截的点击失败 (novel ID: %d): %v", novelID, err)
+	}
+}
+
+// clickFingerprint 生成设备指纹，优先使用客户端上报的设备标识，否则由IP、User-Agent和语言组合
+func clickFingerprint(req ClickRequest) string {
+	source := "device|" + req.DeviceID
+	if req.DeviceID == "" {
+		source = strings.Join([]string{req.IP, req.UserAgent, req.AcceptLanguage}, "|")
+	}
+	sum := sha1.Sum([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsBotUserAgent 判断User-Agent是否来自爬虫或脚本，空User-Agent同样视为脚本
+func IsBotUserAgent(userAgent string) bool {
+	ua := strings.ToLower(strings.TrimSpace(userAgent))
+	if ua == "" {
+		return true
+	}
+	for _, marker := range botUserAgentMarkers {
+		if strings.Contains(ua, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectAnomalies 检测最近一段时间点击异常的小说，按突增倍数降序
+// 判定条件：峰值小时点击数相对之前7天的小时均值突增、峰值小时人均点击过高、被拦截点击占比过高
+func (s *ClickGuardService) DetectAnomalies(opts ClickAnomalyOptions) ([]ClickAnomaly, error) {
+	now := time.Now()
+	windowStart := now.Truncate(time.Hour).Add(-time.Duration(opts.Hours-1) * time.Hour)
+	baselineStart := windowStart.AddDate(0, 0, -7)
+
+	var rows []models.NovelClickStat
+	if err := s.DB.Where("granularity = ? AND bucket_start >= ?", ClickGranularityHour, windowStart).
+		Where("clicks > 0 OR rejected_clicks > 0").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	candidates := make(map[uint]*ClickAnomaly)
+	for _, row := range rows {
+		anomaly, ok := candidates[row.NovelID]
+		if !ok {
+			anomaly = &ClickAnomaly{NovelID: row.NovelID}
+			candidates[row.NovelID] = anomaly
+		}
+		anomaly.WindowClicks += row.Clicks
+		anomaly.RejectedClicks += row.RejectedClicks
+		anomaly.DiscountedClicks += row.DiscountedClicks
+		if row.Clicks > anomaly.PeakClicks {
+			anomaly.PeakClicks = row.Clicks
+			anomaly.PeakHour = row.BucketStart
+			anomaly.PeakUniqueReaders = row.UniqueReaders
+		}
+	}
+
+	novelIDs := make([]uint, 0, len(candidates))
+	for novelID, anomaly := range candidates {
+		if anomaly.PeakClicks >= opts.MinClicks || anomaly.RejectedClicks >= opts.MinClicks {
+			novelIDs = append(novelIDs, novelID)
+		}
+	}
+	if len(novelIDs) == 0 {
+		return []ClickAnomaly{}, nil
+	}
+
+	// 之前7天的平均每小时点击数作为基线
+	var baselines []struct {
+		NovelID uint
+		Clicks  int64
+	}
+	if err := s.DB.Model(&models.NovelClickStat{}).
+		Select("novel_id, SUM(clicks) AS clicks").
+		Where("granularity = ? AND bucket_start >= ? AND bucket_start < ? AND novel_id IN ?",
+			ClickGranularityHour, baselineStart, windowStart, novelIDs).
+		Group("novel_id").
+		Scan(&baselines).Error; err != nil {
+		return nil, err
+	}
+	baselineByNovel := make(map[uint]float64, len(baselines))
+	for _, baseline := range baselines {
+		baselineByNovel[baseline.NovelID] = float64(baseline.Clicks) / (7 * 24)
+	}
+
+	var novels []models.Novel
+	if err := s.DB.Select("id, title").Where("id IN ?", novelIDs).Find(&novels).Error; err != nil {
+		return nil, err
+	}
+	titles := make(map[uint]string, len(novels))
+	for _, novel := range novels {
+		titles[novel.ID] = novel.Title
+	}
+
+	anomalies := make([]ClickAnomaly, 0)
+	for _, novelID := range novelIDs {
+		anomaly := candidates[novelID]
+		anomaly.Title = titles[novelID]
+		anomaly.BaselineHourly = math.Round(baselineByNovel[novelID]*100) / 100
+		anomaly.SpikeRatio = math.Round(float64(anomaly.PeakClicks)/math.Max(baselineByNovel[novelID], 1)*100) / 100
+
+		if anomaly.PeakClicks >= opts.MinClicks && anomaly.SpikeRatio >= opts.SpikeRatio {
+			anomaly.Reasons = append(anomaly.Reasons, fmt.Sprintf("峰值小时点击数为基线的%.1f倍", anomaly.SpikeRatio))
+		}
+		if anomaly.PeakClicks >= opts.MinClicks && anomaly.PeakUniqueReaders > 0 &&
+			float64(anomaly.PeakClicks)/float64(anomaly.PeakUniqueReaders) >= 5 {
+			anomaly.Reasons = append(anomaly.Reasons, fmt.Sprintf("峰值小时人均点击%.1f次", float64(anomaly.PeakClicks)/float64(anomaly.PeakUniqueReaders)))
+		}
+		if total := anomaly.WindowClicks + anomaly.RejectedClicks; anomaly.RejectedClicks >= opts.MinClicks &&
+			float64(anomaly.RejectedClicks) >= float64(total)*0.5 {
+			anomaly.Reasons = append(anomaly.Reasons, fmt.Sprintf("被拦截点击占比%.0f%%", float64(anomaly.RejectedClicks)*100/float64(total)))
+		}
+		if len(anomaly.Reasons) > 0 {
+			anomalies = append(anomalies, *anomaly)
+		}
+	}
+
+	sort.Slice(anomalies, func(i, j int) bool { return anomalies[i].SpikeRatio > anomalies[j].SpikeRatio })
+	return anomalies, nil
+}
+
+// DiscountClicks 将小说在时间区间内的点击按比例判定为刷量并扣除，ratio 为0时恢复区间内已扣除的点击
+// 扣除只能作用于仍保留按小时统计的区间；重复扣除同一区间时以最后一次的比例为准
+func (s *ClickGuardService) DiscountClicks(novelID, adminUserID uint, start, end time.Time, ratio float64, reason string) (*models.ClickDiscount, error) {
+	start = start.Truncate(time.Hour)
+	if !end.Equal(end.Truncate(time.Hour)) {
+		end = end.Truncate(time.Hour).Add(time.Hour)
+	}
+	if ratio < 0 || ratio > 1 {
+		return nil, fmt.Errorf("%w: 扣除比例必须在0到1之间", ErrInvalidClickDiscount)
+	}
+	if !start.Before(end) {
+		return nil, fmt.Errorf("%w: 开始时间必须早于结束时间", ErrInvalidClickDiscount)
+	}
+	if start.Before(time.Now().Add(-clickRetention)) {
+		return nil, fmt.Errorf("%w: 只能扣除最近8天内的点击", ErrInvalidClickDiscount)
+	}
+
+	discount := models.ClickDiscount{
+		NovelID:     novelID,
+		AdminUserID: adminUserID,
+		StartAt:     start,
+		EndAt:       end,
+		Ratio:       ratio,
+		Reason:      reason,
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var novel models.Novel
+		if err := tx.Select("id").First(&novel, novelID).Error; err != nil {
+			return err
+		}
+
+		var rows []models.NovelClickStat
+		if err := tx.Where("novel_id = ? AND granularity = ? AND bucket_start >= ? AND bucket_start < ?",
+			novelID, ClickGranularityHour, start, end).Find(&rows).Error; err != nil {
+			return err
+		}
+
+		// 按天累计扣除数的变化，同步到按天的统计
+		dayDeltas := make(map[time.Time]int64)
+		for _, row := range rows {
+			discounted := int64(math.Round(float64(row.Clicks) * ratio))
+			delta := discounted - row.DiscountedClicks
+			if delta == 0 {
+				continue
+			}
+			if err := tx.Model(&models.NovelClickStat{}).Where("id = ?", row.ID).
+				UpdateColumn("discounted_clicks", discounted).Error; err != nil {
+				return err
+			}
+			day := time.Date(row.BucketStart.Year(), row.BucketStart.Month(), row.BucketStart.Day(), 0, 0, 0, 0, row.BucketStart.Location())
+			dayDeltas[day] += delta
+			discount.DiscountedClicks += delta
+		}
+		for day, delta := range dayDeltas {
+			if err := tx.Model(&models.NovelClickStat{}).
+				Where("novel_id = ? AND granularity = ? AND bucket_start = ?", novelID, ClickGranularityDay, day).
+				UpdateColumn("discounted_clicks", gorm.Expr("GREATEST(0, discounted_clicks + ?)", delta)).Error; err != nil {
+				return err
+			}
+		}
+
+		if discount.DiscountedClicks != 0 {
+			if err := tx.Model(&models.Novel{}).Where("id = ?", novelID).
+				UpdateColumn("click_count", gorm.Expr("GREATEST(0, click_count - ?)", discount.DiscountedClicks)).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(&discount).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if utils.GlobalCacheService != nil {
+		utils.GlobalCacheService.InvalidateNovelCache(novelID)
+	}
+	return &discount, nil
+}
+
+// GetClickDiscounts 分页获取点击扣除记录，novelID 为0时获取全部小说
+func (s *ClickGuardService) GetClickDiscounts(novelID uint, page, limit int) ([]models.ClickDiscount, int64, error) {
+	var discounts []models.ClickDiscount
+	var total int64
+
+	query := s.DB.Model(&models.ClickDiscount{})
+	if novelID > 0 {
+		query = query.Where("novel_id = ?", novelID)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * limit
+	if err := query.Preload("Novel").Order("created_at DESC").Offset(offset).Limit(limit).Find(&discounts).Error; err != nil {
+		return nil, 0, err
+	}
+	return discounts, total, nil
+}
@@ -0,0 +1,384 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 点击统计粒度
+const (
+	ClickGranularityHour = "hour"
+	ClickGranularityDay  = "day"
+)
+
+// 点击排行的滚动时间窗口
+const (
+	ClickWindowDay   = "today" // 近24小时
+	ClickWindowWeek  = "week"  // 近7天
+	ClickWindowMonth = "month" // 近30天
+)
+
+// clickBucketGrace 小时区间结束后等待的时间，之后不再有该区间的点击写入，可以清理缓冲区
+const clickBucketGrace = 2 * time.Minute
+
+// ClickWindowCounts 小说在各滚动窗口内的点击数
+type ClickWindowCounts struct {
+	Day   int64 `json:"day"`   // 近24小时
+	Week  int64 `json:"week"`  // 近7天
+	Month int64 `json:"month"` // 近30天
+}
+
+// ClickTrendPoint 点击趋势中的一个时间点
+type ClickTrendPoint struct {
+	BucketStart      time.Time `json:"bucket_start"`
+	Clicks           int64     `json:"clicks"`
+	UniqueReaders    int64     `json:"unique_readers"`
+	RejectedClicks   int64     `json:"rejected_clicks"`
+	DiscountedClicks int64     `json:"discounted_clicks"`
+}
+
+// ClickStatService 点击统计服务
+// 点击先写入Redis缓冲区，由定时任务汇总到按小时/按天的聚合表，排行和详情从聚合表读取滚动窗口
+type ClickStatService struct {
+	DB *gorm.DB
+}
+
+// NewClickStatService 创建点击统计服务实例
+func NewClickStatService(db *gorm.DB) *ClickStatService {
+	return &ClickStatService{DB: db}
+}
+
+// FlushClickBuffer 将Redis缓冲区中的点击汇总到聚合表，并按增量更新小说总点击量
+// 缓冲区中保存的是区间累计值，重复汇总是幂等的；已结束的小时区间汇总后从缓冲区删除
+func (s *ClickStatService) FlushClickBuffer() (string, error) {
+	if utils.GlobalCache == nil {
+		return "", fmt.Errorf("缓存未初始化")
+	}
+	buckets, err := utils.GlobalCache.PendingClickBuckets()
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(buckets)
+
+	now := time.Now()
+	touched := make(map[uint]bool)
+	var totalDelta int64
+	finished := 0
+	for _, bucket := range buckets {
+		start, err := time.ParseInLocation(utils.ClickHourLayout, bucket, time.Local)
+		if err != nil {
+			log.Printf("跳过无效的点击区间 %s: %v", bucket, err)
+			continue
+		}
+		stats, err := utils.GlobalCache.GetClickBucket(bucket)
+		if err != nil {
+			return "", err
+		}
+
+		delta, err := s.flushBucket(start, stats)
+		if err != nil {
+			return "", fmt.Errorf("汇总点击区间 %s 失败: %v", bucket, err)
+		}
+		totalDelta += delta
+		for _, stat := range stats {
+			touched[stat.NovelID] = true
+		}
+
+		if now.After(start.Add(time.Hour + clickBucketGrace)) {
+			if err := utils.GlobalCache.FinishClickBucket(bucket); err != nil {
+				return "", err
+			}
+			finished++
+		}
+	}
+
+	// 总点击量已变化，清理小说缓存
+	if utils.GlobalCacheService != nil {
+		for novelID := range touched {
+			utils.GlobalCacheService.InvalidateNovelCache(novelID)
+		}
+	}
+	return fmt.Sprintf("汇总%d个小时区间（%d个已结束），新增点击%d次，涉及%d本小说", len(buckets), finished, totalDelta, len(touched)), nil
+}
+
+// flushBucket 在事务中写入一个小时区间的聚合数据，返回新增的点击数
+func (s *ClickStatService) flushBucket(start time.Time, stats []utils.ClickBucketStat) (int64, error) {
+	if len(stats) == 0 {
+		return 0, nil
+	}
+	dayStart := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+
+	var totalDelta int64
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		novelIDs := make([]uint, len(stats))
+		for i, stat := range stats {
+			novelIDs[i] = stat.NovelID
+		}
+
+		// 已汇总的值，用于计算增量
+		var existing []models.NovelClickStat
+		if err := tx.Where("granularity = ? AND bucket_start = ? AND novel_id IN ?", ClickGranularityHour, start, novelIDs).
+			Find(&existing).Error; err != nil {
+			return err
+		}
+		previous := make(map[uint]int64, len(existing))
+		for _, row := range existing {
+			previous[row.NovelID] = row.Clicks
+		}
+
+		hourly := make([]models.NovelClickStat, len(stats))
+		for i, stat := range stats {
+			hourly[i] = models.NovelClickStat{
+				NovelID:        stat.NovelID,
+				Granularity:    ClickGranularityHour,
+				BucketStart:    start,
+				Clicks:         stat.Clicks,
+				UniqueReaders:  stat.HourUnique,
+				RejectedClicks: stat.Rejected,
+			}
+		}
+		if err := upsertClickStats(tx, hourly, "clicks", "unique_readers", "rejected_clicks"); err != nil {
+			return err
+		}
+
+		// 当天的点击数由小时数据重新求和，独立读者数取当天的HyperLogLog
+		var dayTotals []dayClickTotal
+		if err := tx.Model(&models.NovelClickStat{}).
+			Select("novel_id, SUM(clicks) AS clicks, SUM(rejected_clicks) AS rejected_clicks, SUM(discounted_clicks) AS discounted_clicks").
+			Where("granularity = ? AND bucket_start >= ? AND bucket_start < ? AND novel_id IN ?",
+				ClickGranularityHour, dayStart, dayStart.AddDate(0, 0, 1), novelIDs).
+			Group("novel_id").
+			Scan(&dayTotals).Error; err != nil {
+			return err
+		}
+		dayClicks := make(map[uint]dayClickTotal, len(dayTotals))
+		for _, total := range dayTotals {
+			dayClicks[total.NovelID] = total
+		}
+
+		daily := make([]models.NovelClickStat, len(stats))
+		for i, stat := range stats {
+			daily[i] = models.NovelClickStat{
+				NovelID:          stat.NovelID,
+				Granularity:      ClickGranularityDay,
+				BucketStart:      dayStart,
+				Clicks:           dayClicks[stat.NovelID].Clicks,
+				UniqueReaders:    stat.DayUnique,
+				RejectedClicks:   dayClicks[stat.NovelID].RejectedClicks,
+				DiscountedClicks: dayClicks[stat.NovelID].DiscountedClicks,
+			}
+		}
+		if err := upsertClickStats(tx, daily, "clicks", "unique_readers", "rejected_clicks", "discounted_clicks"); err != nil {
+			return err
+		}
+
+		for _, stat := range stats {
+			delta := stat.Clicks - previous[stat.NovelID]
+			if delta <= 0 {
+				continue
+			}
+			totalDelta += delta
+			if err := tx.Model(&models.Novel{}).Where("id = ?", stat.NovelID).
+				UpdateColumn("click_count", gorm.Expr("click_count + ?", delta)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return totalDelta, err
+}
+
+// dayClickTotal 由小时数据汇总的单日点击数
+type dayClickTotal struct {
+	NovelID          uint
+	Clicks           int64
+	RejectedClicks   int64
+	DiscountedClicks int64
+}
+
+// upsertClickStats 写入聚合数据，已存在的区间覆盖 columns 指定的统计字段
+func upsertClickStats(tx *gorm.DB, rows []models.NovelClickStat, columns ...string) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "novel_id"}, {Name: "granularity"}, {Name: "bucket_start"}},
+		DoUpdates: clause.AssignmentColumns(append(columns, "updated_at")),
+	}).CreateInBatches(&rows, 200).Error
+}
+
+// PruneHourlyStats 删除早于保留期的小时数据，按天的数据永久保留
+func (s *ClickStatService) PruneHourlyStats(retention time.Duration) (int64, error) {
+	result := s.DB.Unscoped().
+		Where("granularity = ? AND bucket_start < ?", ClickGranularityHour, time.Now().Add(-retention)).
+		Delete(&models.NovelClickStat{})
+	return result.RowsAffected, result.Error
+}
+
+// windowRange 返回滚动窗口对应的统计粒度和开始时间
+func windowRange(window string, now time.Time) (string, time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch window {
+	case ClickWindowDay:
+		return ClickGranularityHour, now.Truncate(time.Hour).Add(-23 * time.Hour), nil
+	case ClickWindowWeek:
+		return ClickGranularityDay, today.AddDate(0, 0, -6), nil
+	case ClickWindowMonth:
+		return ClickGranularityDay, today.AddDate(0, 0, -29), nil
+	}
+	return "", time.Time{}, fmt.Errorf("不支持的时间窗口: %s", window)
+}
+
+// GetWindowCounts 获取小说在各滚动窗口内的点击数，已扣除判定为刷量的点击
+func (s *ClickStatService) GetWindowCounts(novelIDs []uint) (map[uint]ClickWindowCounts, error) {
+	counts := make(map[uint]ClickWindowCounts, len(novelIDs))
+	if len(novelIDs) == 0 {
+		return counts, nil
+	}
+
+	now := time.Now()
+	for _, window := range []string{ClickWindowDay, ClickWindowWeek, ClickWindowMonth} {
+		granularity, since, _ := windowRange(window, now)
+		var rows []struct {
+			NovelID uint
+			Clicks  int64
+		}
+		if err := s.DB.Model(&models.NovelClickStat{}).
+			Select("novel_id, SUM(clicks - discounted_clicks) AS clicks").
+			Where("granularity = ? AND bucket_start >= ? AND novel_id IN ?", granularity, since, novelIDs).
+			Group("novel_id").
+			Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			entry := counts[row.NovelID]
+			switch window {
+			case ClickWindowDay:
+				entry.Day = row.Clicks
+			case ClickWindowWeek:
+				entry.Week = row.Clicks
+			case ClickWindowMonth:
+				entry.Month = row.Clicks
+			}
+			counts[row.NovelID] = entry
+		}
+	}
+	return counts, nil
+}
+
+// ApplyWindowCounts 用聚合表中的滚动窗口点击数填充小说的今日/本周/本月点击量字段
+func (s *ClickStatService) ApplyWindowCounts(novels []*models.Novel) error {
+	novelIDs := make([]uint, len(novels))
+	for i, novel := range novels {
+		novelIDs[i] = novel.ID
+	}
+	counts, err := s.GetWindowCounts(novelIDs)
+	if err != nil {
+		return err
+	}
+	for _, novel := range novels {
+		entry := counts[novel.ID]
+		novel.TodayClicks = int(entry.Day)
+		novel.WeekClicks = int(entry.Week)
+		novel.MonthClicks = int(entry.Month)
+	}
+	return nil
+}
+
+// RankNovelsByWindow 按滚动窗口内的点击数获取已审核小说排行，categoryID 为0时不限分类
+func (s *ClickStatService) RankNovelsByWindow(window string, categoryID uint, limit int) ([]models.Novel, error) {
+	granularity, since, err := windowRange(window, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	windowStats := s.DB.Model(&models.NovelClickStat{}).
+		Select("novel_id, SUM(clicks - discounted_clicks) AS window_clicks").
+		Where("granularity = ? AND bucket_start >= ?", granularity, since).
+		Group("novel_id")
+
+	query := s.DB.Model(&models.Novel{}).
+		Select("novels.id").
+		Joins("JOIN (?) AS window_stats ON window_stats.novel_id = novels.id", windowStats).
+		Where("novels.status = ?", "approved")
+	if categoryID > 0 {
+		query = query.Joins("JOIN novel_categories ON novels.id = novel_categories.novel_id").
+			Where("novel_categories.category_id = ?", categoryID)
+	}
+	var rankedIDs []uint
+	if err := query.Order("window_stats.window_clicks DESC").Limit(limit).Pluck("novels.id", &rankedIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(rankedIDs) == 0 {
+		return []models.Novel{}, nil
+	}
+
+	var novels []models.Novel
+	if err := s.DB.Preload("UploadUser").Where("id IN ?", rankedIDs).Find(&novels).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]*models.Novel, len(novels))
+	for i := range novels {
+		byID[novels[i].ID] = &novels[i]
+	}
+	ranked := make([]*models.Novel, 0, len(rankedIDs))
+	for _, id := range rankedIDs {
+		if novel, ok := byID[id]; ok {
+			ranked = append(ranked, novel)
+		}
+	}
+	if err := s.ApplyWindowCounts(ranked); err != nil {
+		return nil, err
+	}
+
+	result := make([]models.Novel, len(ranked))
+	for i, novel := range ranked {
+		result[i] = *novel
+	}
+	return result, nil
+}
+
+// GetClickTrend 获取小说最近一段时间的点击趋势，没有点击的区间补零
+// granularity 为 hour 时返回最近 points 个小时，为 day 时返回最近 points 天
+func (s *ClickStatService) GetClickTrend(novelID uint, granularity string, points int) ([]ClickTrendPoint, error) {
+	now := time.Now()
+	var start time.Time
+	step := func(t time.Time) time.Time { return t.Add(time.Hour) }
+	switch granularity {
+	case ClickGranularityHour:
+		start = now.Truncate(time.Hour).Add(-time.Duration(points-1) * time.Hour)
+	case ClickGranularityDay:
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		start = today.AddDate(0, 0, -(points - 1))
+		step = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	default:
+		return nil, fmt.Errorf("不支持的统计粒度: %s", granularity)
+	}
+
+	var rows []models.NovelClickStat
+	if err := s.DB.Where("novel_id = ? AND granularity = ? AND bucket_start >= ?", novelID, granularity, start).
+		Order("bucket_start ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	byStart := make(map[int64]models.NovelClickStat, len(rows))
+	for _, row := range rows {
+		byStart[row.BucketStart.Unix()] = row
+	}
+
+	trend := make([]ClickTrendPoint, 0, points)
+	for t := start; len(trend) < points; t = step(t) {
+		point := ClickTrendPoint{BucketStart: t}
+		if row, ok := byStart[t.Unix()]; ok {
+			point.Clicks = row.Clicks
+			point.UniqueReaders = row.UniqueReaders
+			point.RejectedClicks = row.RejectedClicks
+			point.DiscountedClicks = row.DiscountedClicks
+		}
+		trend = append(trend, point)
+	}
+	return trend, nil
+}
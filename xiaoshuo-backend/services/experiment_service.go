@@ -0,0 +1,484 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// 实验作用的场景
+const (
+	ExperimentSurfaceRecommendations = "recommendations" // 推荐列表 GET /recommendations
+	ExperimentSurfacePersonalized    = "personalized"    // 个性化推荐 GET /recommendations/personalized
+	ExperimentSurfaceSearch          = "search"          // 搜索结果排序 GET /search/novels、GET /search/fulltext
+)
+
+// 实验状态
+const (
+	ExperimentStatusDraft    = "draft"
+	ExperimentStatusRunning  = "running"
+	ExperimentStatusPaused   = "paused"
+	ExperimentStatusFinished = "finished"
+)
+
+const (
+	exposureClickWindow = 24 * time.Hour // 曝光后该时间内的点击计入实验点击率
+	readThroughProgress = 90             // 阅读进度达到该百分比视为读完
+)
+
+var (
+	// ErrInvalidExperiment 实验配置无效
+	ErrInvalidExperiment = errors.New("实验配置无效")
+	// ErrExperimentConflict 同一场景已有进行中的实验
+	ErrExperimentConflict = errors.New("同一场景已有进行中的实验")
+)
+
+// experimentStrategies 推荐列表实验中变体可使用的推荐类型
+var experimentStrategies = map[string]bool{"popular": true, "new": true, "random": true}
+
+// experimentSearchSorts 搜索排序实验中变体可使用的排序方式
+var experimentSearchSorts = map[string]bool{
+	utils.SearchSortRelevance: true,
+	utils.SearchSortRating:    true,
+	utils.SearchSortClicks:    true,
+	utils.SearchSortNewest:    true,
+}
+
+// experimentTransitions 允许的实验状态变更
+var experimentTransitions = map[string][]string{
+	ExperimentStatusDraft:   {ExperimentStatusRunning},
+	ExperimentStatusRunning: {ExperimentStatusPaused, ExperimentStatusFinished},
+	ExperimentStatusPaused:  {ExperimentStatusRunning, ExperimentStatusFinished},
+}
+
+// VariantParams 变体参数，未设置的参数使用默认策略
+type VariantParams struct {
+	Strategy      string   `json:"strategy,omitempty"`        // 推荐列表使用的推荐类型：popular、new、random
+	CFBlendWeight *float64 `json:"cf_blend_weight,omitempty"` // 个性化推荐中协同过滤得分的权重，0-1
+	SearchSort    string   `json:"search_sort,omitempty"`     // 搜索结果的默认排序方式：relevance、rating、clicks、newest
+}
+
+// ExperimentAssignment 用户在实验中被分配到的变体
+type ExperimentAssignment struct {
+	ExperimentID  uint          `json:"-"`
+	ExperimentKey string        `json:"experiment"`
+	VariantID     uint          `json:"-"`
+	VariantKey    string        `json:"variant"`
+	IsControl     bool          `json:"is_control"`
+	Params        VariantParams `json:"-"`
+}
+
+// VariantAssigner 为用户分配实验变体并记录曝光，控制器通过该接口获取变体
+type VariantAssigner interface {
+	// Assign 返回用户在场景进行中实验里的变体，未进入实验时返回nil
+	Assign(userID uint, surface string) (*ExperimentAssignment, error)
+	// LogExposures 记录展示给用户的小说
+	LogExposures(assignment *ExperimentAssignment, userID uint, novelIDs []uint) error
+}
+
+// VariantInput 创建实验时的变体参数
+type VariantInput struct {
+	Key       string          `json:"key" binding:"required,max=50"`
+	Name      string          `json:"name" binding:"max=100"`
+	Weight    int             `json:"weight"`
+	IsControl bool            `json:"is_control"`
+	Params    json.RawMessage `json:"params"`
+}
+
+// ExperimentInput 创建实验的参数
+type ExperimentInput struct {
+	Key            string         `json:"key" binding:"required,max=50"`
+	Name           string         `json:"name" binding:"required,max=100"`
+	Description    string         `json:"description"`
+	Surface        string         `json:"surface" binding:"required"`
+	TrafficPercent *int           `json:"traffic_percent"`
+	Variants       []VariantInput `json:"variants" binding:"required"`
+}
+
+// VariantReport 变体的实验指标
+type VariantReport struct {
+	VariantID   uint    `json:"variant_id"`
+	Key         string  `json:"key"`
+	Name        string  `json:"name"`
+	IsControl   bool    `json:"is_control"`
+	Exposures   int64   `json:"exposures"`    // 曝光次数
+	Users       int64   `json:"users"`        // 曝光用户数
+	Clicks      int64   `json:"clicks"`       // 曝光后被点击的次数
+	CTR         float64 `json:"ctr"`          // 点击率 = 点击/曝光
+	Reads       int64   `json:"reads"`        // 曝光后开始阅读的次数
+	ReadRate    float64 `json:"read_rate"`    // 阅读转化率 = 阅读/曝光
+	Completions int64   `json:"completions"`  // 曝光后读完的次数
+	ReadThrough float64 `json:"read_through"` // 读完率 = 读完/阅读
+	AvgProgress float64 `json:"avg_progress"` // 曝光后阅读的平均进度
+	CTRLift     float64 `json:"ctr_lift"`     // 点击率相对对照组的提升比例
+}
+
+// ExperimentReport 实验报告
+type ExperimentReport struct {
+	Experiment models.Experiment `json:"experiment"`
+	Variants   []VariantReport   `json:"variants"`
+}
+
+// ExperimentService A/B实验服务
+type ExperimentService struct {
+	DB *gorm.DB
+}
+
+// NewExperimentService 创建A/B实验服务实例
+func NewExperimentService(db *gorm.DB) *ExperimentService {
+	return &ExperimentService{DB: db}
+}
+
+// experimentBucket 根据实验标识和用户ID计算确定性的分桶，同一用户在同一实验中始终落在同一个桶
+func experimentBucket(experimentKey, purpose string, userID uint, buckets uint32) uint32 {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s:%s:%d", experimentKey, purpose, userID)
+	return h.Sum32() % buckets
+}
+
+// pickVariant 为用户选择变体：先按流量比例决定是否进入实验，再按权重在变体间分配
+func pickVariant(experiment *models.Experiment, userID uint) *models.ExperimentVariant {
+	if experimentBucket(experiment.Key, "traffic", userID, 100) >= uint32(experiment.TrafficPercent) {
+		return nil
+	}
+	total := 0
+	for _, variant := range experiment.Variants {
+		total += variant.Weight
+	}
+	if total <= 0 {
+		return nil
+	}
+	bucket := int(experimentBucket(experiment.Key, "variant", userID, uint32(total)))
+	for i := range experiment.Variants {
+		bucket -= experiment.Variants[i].Weight
+		if bucket < 0 {
+			return &experiment.Variants[i]
+		}
+	}
+	return nil
+}
+
+// Assign 返回用户在场景进行中实验里的变体，未登录用户或未进入实验时返回nil
+func (s *ExperimentService) Assign(userID uint, surface string) (*ExperimentAssignment, error) {
+	if userID == 0 {
+		return nil, nil
+	}
+	var experiment models.Experiment
+	err := s.DB.Preload("Variants", func(db *gorm.DB) *gorm.DB { return db.Order("id ASC") }).
+		Where("surface = ? AND status = ?", surface, ExperimentStatusRunning).First(&experiment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	variant := pickVariant(&experiment, userID)
+	if variant == nil {
+		return nil, nil
+	}
+	assignment := &ExperimentAssignment{
+		ExperimentID:  experiment.ID,
+		ExperimentKey: experiment.Key,
+		VariantID:     variant.ID,
+		VariantKey:    variant.Key,
+		IsControl:     variant.IsControl,
+	}
+	if variant.Params != "" {
+		if err := json.Unmarshal([]byte(variant.Params), &assignment.Params); err != nil {
+			return nil, fmt.Errorf("解析变体 %s 参数失败: %w", variant.Key, err)
+		}
+	}
+	return assignment, nil
+}
+
+// LogExposures 记录展示给用户的小说，位置从1开始
+func (s *ExperimentService) LogExposures(assignment *ExperimentAssignment, userID uint, novelIDs []uint) error {
+	if assignment == nil || len(novelIDs) == 0 {
+		return nil
+	}
+	exposures := make([]models.ExperimentExposure, len(novelIDs))
+	for i, novelID := range novelIDs {
+		exposures[i] = models.ExperimentExposure{
+			ExperimentID: assignment.ExperimentID,
+			VariantID:    assignment.VariantID,
+			UserID:       userID,
+			NovelID:      novelID,
+			Position:     i + 1,
+		}
+	}
+	return s.DB.CreateInBatches(&exposures, 100).Error
+}
+
+// RecordClick 将用户对小说的点击归因到各实验中最近一次未点击的曝光
+func (s *ExperimentService) RecordClick(userID, novelID uint) error {
+	var exposures []models.ExperimentExposure
+	if err := s.DB.Select("id, experiment_id").
+		Where("user_id = ? AND novel_id = ? AND clicked = ? AND created_at >= ?", userID, novelID, false, time.Now().Add(-exposureClickWindow)).
+		Order("id DESC").Find(&exposures).Error; err != nil {
+		return err
+	}
+	seen := make(map[uint]bool)
+	ids := make([]uint, 0)
+	for _, exposure := range exposures {
+		if !seen[exposure.ExperimentID] {
+			seen[exposure.ExperimentID] = true
+			ids = append(ids, exposure.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	now := time.Now()
+	return s.DB.Model(&models.ExperimentExposure{}).Where("id IN ?", ids).
+		Updates(map[string]interface{}{"clicked": true, "clicked_at": now}).Error
+}
+
+// CreateExperiment 创建草稿状态的实验
+func (s *ExperimentService) CreateExperiment(input ExperimentInput, adminID uint) (*models.Experiment, error) {
+	input.Key = strings.TrimSpace(input.Key)
+	if input.Key == "" {
+		return nil, fmt.Errorf("%w: 实验标识不能为空", ErrInvalidExperiment)
+	}
+	if input.Surface != ExperimentSurfaceRecommendations && input.Surface != ExperimentSurfacePersonalized &&
+		input.Surface != ExperimentSurfaceSearch {
+		return nil, fmt.Errorf("%w: 不支持的场景 %s", ErrInvalidExperiment, input.Surface)
+	}
+	traffic := 100
+	if input.TrafficPercent != nil {
+		traffic = *input.TrafficPercent
+	}
+	if traffic < 0 || traffic > 100 {
+		return nil, fmt.Errorf("%w: 流量比例必须在0-100之间", ErrInvalidExperiment)
+	}
+	if len(input.Variants) < 2 {
+		return nil, fmt.Errorf("%w: 至少需要两个变体", ErrInvalidExperiment)
+	}
+
+	experiment := models.Experiment{
+		Key:            input.Key,
+		Name:           input.Name,
+		Description:    input.Description,
+		Surface:        input.Surface,
+		Status:         ExperimentStatusDraft,
+		TrafficPercent: traffic,
+		CreatedBy:      adminID,
+	}
+	keys := make(map[string]bool)
+	controls := 0
+	for _, v := range input.Variants {
+		v.Key = strings.TrimSpace(v.Key)
+		if v.Key == "" || keys[v.Key] {
+			return nil, fmt.Errorf("%w: 变体标识为空或重复: %q", ErrInvalidExperiment, v.Key)
+		}
+		keys[v.Key] = true
+		if v.Weight == 0 {
+			v.Weight = 1
+		}
+		if v.Weight < 0 {
+			return nil, fmt.Errorf("%w: 变体 %s 的权重不能为负数", ErrInvalidExperiment, v.Key)
+		}
+		if v.IsControl {
+			controls++
+		}
+		params, err := validateVariantParams(input.Surface, v.Params)
+		if err != nil {
+			return nil, fmt.Errorf("%w: 变体 %s %v", ErrInvalidExperiment, v.Key, err)
+		}
+		experiment.Variants = append(experiment.Variants, models.ExperimentVariant{
+			Key:       v.Key,
+			Name:      v.Name,
+			Weight:    v.Weight,
+			IsControl: v.IsControl,
+			Params:    params,
+		})
+	}
+	if controls != 1 {
+		return nil, fmt.Errorf("%w: 必须有且只有一个对照组", ErrInvalidExperiment)
+	}
+
+	var count int64
+	if err := s.DB.Model(&models.Experiment{}).Unscoped().Where("experiment_key = ?", experiment.Key).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("%w: 实验标识 %s 已存在", ErrInvalidExperiment, experiment.Key)
+	}
+	if err := s.DB.Create(&experiment).Error; err != nil {
+		return nil, err
+	}
+	return &experiment, nil
+}
+
+// validateVariantParams 校验变体参数并返回规范化后的JSON
+func validateVariantParams(surface string, raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var params VariantParams
+	decoder := json.NewDecoder(strings.NewReader(string(raw)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&params); err != nil {
+		return "", fmt.Errorf("参数格式错误: %v", err)
+	}
+	if params.Strategy != "" && (surface != ExperimentSurfaceRecommendations || !experimentStrategies[params.Strategy]) {
+		return "", fmt.Errorf("不支持的推荐类型 %s", params.Strategy)
+	}
+	if params.CFBlendWeight != nil && (surface != ExperimentSurfacePersonalized || *params.CFBlendWeight < 0 || *params.CFBlendWeight > 1) {
+		return "", fmt.Errorf("协同过滤权重只适用于个性化推荐且必须在0-1之间")
+	}
+	if params.SearchSort != "" && (surface != ExperimentSurfaceSearch || !experimentSearchSorts[params.SearchSort]) {
+		return "", fmt.Errorf("不支持的搜索排序方式 %s", params.SearchSort)
+	}
+	normalized, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	return string(normalized), nil
+}
+
+// UpdateStatus 变更实验状态，同一场景同时只能有一个进行中的实验
+func (s *ExperimentService) UpdateStatus(id uint, status string) (*models.Experiment, error) {
+	var experiment models.Experiment
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&experiment, id).Error; err != nil {
+			return err
+		}
+		allowed := false
+		for _, next := range experimentTransitions[experiment.Status] {
+			if next == status {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("%w: 不能从 %s 变更为 %s", ErrInvalidExperiment, experiment.Status, status)
+		}
+
+		updates := map[string]interface{}{"status": status}
+		now := time.Now()
+		switch status {
+		case ExperimentStatusRunning:
+			var running int64
+			if err := tx.Model(&models.Experiment{}).
+				Where("surface = ? AND status = ? AND id != ?", experiment.Surface, ExperimentStatusRunning, experiment.ID).
+				Count(&running).Error; err != nil {
+				return err
+			}
+			if running > 0 {
+				return ErrExperimentConflict
+			}
+			if experiment.StartedAt == nil {
+				updates["started_at"] = now
+			}
+		case ExperimentStatusFinished:
+			updates["ended_at"] = now
+		}
+		return tx.Model(&experiment).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.DB.Preload("Variants").First(&experiment, id).Error; err != nil {
+		return nil, err
+	}
+	return &experiment, nil
+}
+
+// ListExperiments 分页获取实验列表，可按状态筛选
+func (s *ExperimentService) ListExperiments(status string, page, limit int) ([]models.Experiment, int64, error) {
+	var experiments []models.Experiment
+	var total int64
+	query := s.DB.Model(&models.Experiment{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * limit
+	if err := query.Preload("Variants").Order("created_at DESC").Offset(offset).Limit(limit).Find(&experiments).Error; err != nil {
+		return nil, 0, err
+	}
+	return experiments, total, nil
+}
+
+// GetReport 统计实验各变体的曝光、点击率和阅读转化
+// 阅读以曝光之后该用户对该小说的阅读进度计，读完指进度达到90%
+func (s *ExperimentService) GetReport(id uint) (*ExperimentReport, error) {
+	var experiment models.Experiment
+	if err := s.DB.Preload("Variants", func(db *gorm.DB) *gorm.DB { return db.Order("id ASC") }).First(&experiment, id).Error; err != nil {
+		return nil, err
+	}
+
+	var exposures []struct {
+		VariantID uint
+		Exposures int64
+		Users     int64
+		Clicks    int64
+	}
+	if err := s.DB.Model(&models.ExperimentExposure{}).
+		Select("variant_id, COUNT(*) AS exposures, COUNT(DISTINCT user_id) AS users, SUM(CASE WHEN clicked THEN 1 ELSE 0 END) AS clicks").
+		Where("experiment_id = ?", id).Group("variant_id").Scan(&exposures).Error; err != nil {
+		return nil, err
+	}
+
+	var reads []struct {
+		VariantID   uint
+		ReadCount   int64
+		Completions int64
+		AvgProgress float64
+	}
+	if err := s.DB.Table("experiment_exposures AS e").
+		Select("e.variant_id, COUNT(DISTINCT e.id) AS read_count, COUNT(DISTINCT CASE WHEN rp.progress >= ? THEN e.id END) AS completions, AVG(rp.progress) AS avg_progress", readThroughProgress).
+		Joins("JOIN reading_progress rp ON rp.user_id = e.user_id AND rp.novel_id = e.novel_id AND rp.updated_at >= e.created_at AND rp.deleted_at IS NULL").
+		Where("e.experiment_id = ? AND e.deleted_at IS NULL", id).
+		Group("e.variant_id").Scan(&reads).Error; err != nil {
+		return nil, err
+	}
+
+	reports := make(map[uint]*VariantReport, len(experiment.Variants))
+	result := make([]VariantReport, len(experiment.Variants))
+	for i, variant := range experiment.Variants {
+		result[i] = VariantReport{VariantID: variant.ID, Key: variant.Key, Name: variant.Name, IsControl: variant.IsControl}
+		reports[variant.ID] = &result[i]
+	}
+	for _, row := range exposures {
+		if report, ok := reports[row.VariantID]; ok {
+			report.Exposures, report.Users, report.Clicks = row.Exposures, row.Users, row.Clicks
+		}
+	}
+	for _, row := range reads {
+		if report, ok := reports[row.VariantID]; ok {
+			report.Reads, report.Completions, report.AvgProgress = row.ReadCount, row.Completions, row.AvgProgress
+		}
+	}
+
+	controlCTR := 0.0
+	for i := range result {
+		report := &result[i]
+		if report.Exposures > 0 {
+			report.CTR = float64(report.Clicks) / float64(report.Exposures)
+			report.ReadRate = float64(report.Reads) / float64(report.Exposures)
+		}
+		if report.Reads > 0 {
+			report.ReadThrough = float64(report.Completions) / float64(report.Reads)
+		}
+		if report.IsControl {
+			controlCTR = report.CTR
+		}
+	}
+	if controlCTR > 0 {
+		for i := range result {
+			result[i].CTRLift = result[i].CTR/controlCTR - 1
+		}
+	}
+	return &ExperimentReport{Experiment: experiment, Variants: result}, nil
+}
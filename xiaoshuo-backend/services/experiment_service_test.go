@@ -0,0 +1,112 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"xiaoshuo-backend/models"
+)
+
+func testExperiment(trafficPercent int, weights ...int) *models.Experiment {
+	experiment := &models.Experiment{Key: "rec_cf_weight", TrafficPercent: trafficPercent}
+	for i, weight := range weights {
+		experiment.Variants = append(experiment.Variants, models.ExperimentVariant{Key: string(rune('a' + i)), Weight: weight})
+	}
+	return experiment
+}
+
+func TestExperimentBucket(t *testing.T) {
+	for userID := uint(1); userID <= 1000; userID++ {
+		bucket := experimentBucket("rec_cf_weight", "traffic", userID, 100)
+		if bucket >= 100 {
+			t.Fatalf("experimentBucket(user %d) = %d, want < 100", userID, bucket)
+		}
+		if again := experimentBucket("rec_cf_weight", "traffic", userID, 100); again != bucket {
+			t.Fatalf("experimentBucket(user %d) = %d then %d, want stable", userID, bucket, again)
+		}
+	}
+
+	// 不同实验的分桶相互独立，同一批用户不会总落在相同的桶
+	same := 0
+	for userID := uint(1); userID <= 1000; userID++ {
+		if experimentBucket("rec_cf_weight", "traffic", userID, 100) == experimentBucket("search_rank", "traffic", userID, 100) {
+			same++
+		}
+	}
+	if same > 50 {
+		t.Errorf("%d of 1000 users share buckets across experiments, want about 10", same)
+	}
+}
+
+func TestPickVariantDeterministic(t *testing.T) {
+	experiment := testExperiment(50, 1, 1, 1)
+	for userID := uint(1); userID <= 1000; userID++ {
+		first := pickVariant(experiment, userID)
+		for i := 0; i < 3; i++ {
+			if again := pickVariant(experiment, userID); again != first {
+				t.Fatalf("pickVariant(user %d) changed between calls", userID)
+			}
+		}
+	}
+}
+
+func TestPickVariantTraffic(t *testing.T) {
+	const users = 10000
+	tests := []struct {
+		trafficPercent int
+		want           float64 // 进入实验的用户比例
+	}{
+		{0, 0},
+		{30, 0.3},
+		{100, 1},
+	}
+	for _, tt := range tests {
+		experiment := testExperiment(tt.trafficPercent, 1)
+		assigned := 0
+		for userID := uint(1); userID <= users; userID++ {
+			if pickVariant(experiment, userID) != nil {
+				assigned++
+			}
+		}
+		if got := float64(assigned) / users; math.Abs(got-tt.want) > 0.02 {
+			t.Errorf("TrafficPercent %d: %.3f of users assigned, want %.2f", tt.trafficPercent, got, tt.want)
+		}
+	}
+}
+
+func TestPickVariantWeights(t *testing.T) {
+	const users = 20000
+	tests := []struct {
+		weights []int
+	}{
+		{[]int{1, 1}},
+		{[]int{1, 3}},
+		{[]int{2, 3, 5}},
+		{[]int{0, 1}}, // 权重为0的变体不分配用户
+	}
+	for _, tt := range tests {
+		experiment := testExperiment(100, tt.weights...)
+		counts := make(map[string]int)
+		for userID := uint(1); userID <= users; userID++ {
+			variant := pickVariant(experiment, userID)
+			if variant == nil {
+				t.Fatalf("weights %v: user %d not assigned", tt.weights, userID)
+			}
+			counts[variant.Key]++
+		}
+
+		total := 0
+		for _, weight := range tt.weights {
+			total += weight
+		}
+		for i, variant := range experiment.Variants {
+			want := float64(tt.weights[i]) / float64(total)
+			if got := float64(counts[variant.Key]) / users; math.Abs(got-want) > 0.02 {
+				t.Errorf("weights %v: variant %s got %.3f of users, want %.2f", tt.weights, variant.Key, got, want)
+			}
+		}
+	}
+
+	if variant := pickVariant(testExperiment(100, 0, 0), 1); variant != nil {
+		t.Errorf("pickVariant with zero total weight = %s, want nil", variant.Key)
+	}
+}
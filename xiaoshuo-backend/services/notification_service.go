@@ -0,0 +1,326 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"xiaoshuo-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// 书架更新通知方式
+const (
+	NotifyModeInstant = "instant"
+	NotifyModeDigest  = "digest"
+	NotifyModeOff     = "off"
+)
+
+// 用户个人消息类型
+const (
+	UserMessageTypeChapterUpdate = "chapter_update"
+	UserMessageTypeUpdateDigest  = "update_digest"
+)
+
+// 消息中心的消息来源
+const (
+	InboxSourceSystem = "system"
+	InboxSourceUser   = "user"
+)
+
+// IsValidNotifyMode 判断通知方式是否合法
+func IsValidNotifyMode(mode string) bool {
+	return mode == NotifyModeInstant || mode == NotifyModeDigest || mode == NotifyModeOff
+}
+
+// isUserMessageType 判断消息类型是否属于用户个人消息
+func isUserMessageType(messageType string) bool {
+	return messageType == UserMessageTypeChapterUpdate || messageType == UserMessageTypeUpdateDigest
+}
+
+// InboxMessage 消息中心中的一条消息，统一系统消息和用户个人消息的展示格式
+type InboxMessage struct {
+	ID        uint      `json:"id"`
+	Source    string    `json:"source"` // system(系统消息), user(个人消息)
+	Type      string    `json:"type"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	NovelID   uint      `json:"novel_id,omitempty"`
+	IsRead    bool      `json:"is_read"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UnreadCounts 未读消息数
+type UnreadCounts struct {
+	System int64 `json:"system"` // 未读系统消息数
+	User   int64 `json:"user"`   // 未读个人消息数
+	Total  int64 `json:"total"`  // 未读消息总数
+}
+
+// NotificationService 书架更新通知服务
+// 小说追加章节后为关注的读者生成个人消息，与系统消息一起通过消息中心投递
+type NotificationService struct {
+	DB *gorm.DB
+}
+
+// NewNotificationService 创建通知服务实例
+func NewNotificationService(db *gorm.DB) *NotificationService {
+	return &NotificationService{DB: db}
+}
+
+// NotifyNovelUpdate 为选择即时通知的关注者生成章节更新消息，提交更新的用户本人不会收到通知
+func (s *NotificationService) NotifyNovelUpdate(update *models.NovelUpdate) error {
+	var novel models.Novel
+	if err := s.DB.Select("id", "title", "status").First(&novel, update.NovelID).Error; err != nil {
+		return err
+	}
+	// 未通过审核的小说不通知读者
+	if novel.Status != "approved" {
+		return nil
+	}
+
+	var follows []models.NovelFollow
+	if err := s.DB.Where("novel_id = ? AND notify_mode = ? AND user_id <> ?", update.NovelID, NotifyModeInstant, update.UserID).
+		Find(&follows).Error; err != nil {
+		return err
+	}
+	if len(follows) == 0 {
+		return nil
+	}
+
+	title := fmt.Sprintf("《%s》更新了%d章", novel.Title, update.AddedChapters)
+	content := fmt.Sprintf("《%s》新增%d章，共%d字，最新章节：%s", novel.Title, update.AddedChapters, update.AddedWords, update.LatestTitle)
+	if update.SerialStatus == SerialStatusCompleted {
+		content += "（已完结）"
+	}
+
+	messages := make([]models.UserMessage, len(follows))
+	followIDs := make([]uint, len(follows))
+	for i, follow := range follows {
+		messages[i] = models.UserMessage{
+			UserID:        follow.UserID,
+			Type:          UserMessageTypeChapterUpdate,
+			Title:         title,
+			Content:       content,
+			NovelID:       novel.ID,
+			NovelUpdateID: update.ID,
+		}
+		followIDs[i] = follow.ID
+	}
+
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(&messages, 100).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.NovelFollow{}).Where("id IN ?", followIDs).Update("last_notified_at", time.Now()).Error
+	})
+}
+
+// SendDigests 为选择摘要通知的用户汇总上次通知以来关注小说的更新，每个用户生成一条摘要消息
+// 返回发送的摘要消息数
+func (s *NotificationService) SendDigests() (int, error) {
+	// 只汇总截止时间之前的更新并记为已通知，汇总期间新产生的更新留到下一次
+	cutoff := time.Now()
+
+	var follows []models.NovelFollow
+	if err := s.DB.Preload("Novel").Where("notify_mode = ?", NotifyModeDigest).Find(&follows).Error; err != nil {
+		return 0, err
+	}
+
+	type digestLine struct {
+		followID uint
+		text     string
+	}
+	digests := make(map[uint][]digestLine)
+	for _, follow := range follows {
+		if follow.Novel.ID == 0 || follow.Novel.Status != "approved" {
+			continue
+		}
+		since := follow.CreatedAt
+		if follow.LastNotifiedAt != nil {
+			since = *follow.LastNotifiedAt
+		}
+
+		var updates []models.NovelUpdate
+		if err := s.DB.Where("novel_id = ? AND user_id <> ? AND created_at > ? AND created_at <= ?", follow.NovelID, follow.UserID, since, cutoff).
+			Order("created_at ASC").Find(&updates).Error; err != nil {
+			return 0, err
+		}
+		if len(updates) == 0 {
+			continue
+		}
+		chapters := 0
+		for _, update := range updates {
+			chapters += update.AddedChapters
+		}
+		latest := updates[len(updates)-1]
+
+		digests[follow.UserID] = append(digests[follow.UserID], digestLine{
+			followID: follow.ID,
+			text:     fmt.Sprintf("《%s》更新了%d章，最新章节：%s", follow.Novel.Title, chapters, latest.LatestTitle),
+		})
+	}
+
+	sent := 0
+	for userID, lines := range digests {
+		texts := make([]string, len(lines))
+		followIDs := make([]uint, len(lines))
+		for i, line := range lines {
+			texts[i] = line.text
+			followIDs[i] = line.followID
+		}
+
+		message := models.UserMessage{
+			UserID:  userID,
+			Type:    UserMessageTypeUpdateDigest,
+			Title:   fmt.Sprintf("书架中有%d本小说更新了", len(lines)),
+			Content: strings.Join(texts, "\n"),
+		}
+		err := s.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&message).Error; err != nil {
+				return err
+			}
+			return tx.Model(&models.NovelFollow{}).Where("id IN ?", followIDs).Update("last_notified_at", cutoff).Error
+		})
+		if err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// GetInbox 获取用户消息中心的消息，合并已发布的系统消息和用户个人消息，按时间倒序分页
+// messageType 为空时返回全部消息，为系统消息类型或个人消息类型时只查询对应来源
+func (s *NotificationService) GetInbox(userID uint, messageType string, page, limit int) ([]InboxMessage, int64, error) {
+	readAt, err := s.messagesReadAt(userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// 两个来源各取前 offset+limit 条，合并排序后再截取当前页
+	window := page * limit
+	var messages []InboxMessage
+	var total int64
+
+	if messageType == "" || !isUserMessageType(messageType) {
+		query := s.DB.Model(&models.SystemMessage{}).Where("is_published = ?", true)
+		if messageType != "" {
+			query = query.Where("type = ?", messageType)
+		}
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			return nil, 0, err
+		}
+		var systemMessages []models.SystemMessage
+		if err := query.Order("created_at DESC").Limit(window).Find(&systemMessages).Error; err != nil {
+			return nil, 0, err
+		}
+		total += count
+		for _, message := range systemMessages {
+			messages = append(messages, InboxMessage{
+				ID:        message.ID,
+				Source:    InboxSourceSystem,
+				Type:      message.Type,
+				Title:     message.Title,
+				Content:   message.Content,
+				IsRead:    readAt != nil && !message.CreatedAt.After(*readAt),
+				CreatedAt: message.CreatedAt,
+			})
+		}
+	}
+
+	if messageType == "" || isUserMessageType(messageType) {
+		query := s.DB.Model(&models.UserMessage{}).Where("user_id = ?", userID)
+		if messageType != "" {
+			query = query.Where("type = ?", messageType)
+		}
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			return nil, 0, err
+		}
+		var userMessages []models.UserMessage
+		if err := query.Order("created_at DESC").Limit(window).Find(&userMessages).Error; err != nil {
+			return nil, 0, err
+		}
+		total += count
+		for _, message := range userMessages {
+			messages = append(messages, InboxMessage{
+				ID:        message.ID,
+				Source:    InboxSourceUser,
+				Type:      message.Type,
+				Title:     message.Title,
+				Content:   message.Content,
+				NovelID:   message.NovelID,
+				IsRead:    message.IsRead,
+				CreatedAt: message.CreatedAt,
+			})
+		}
+	}
+
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].CreatedAt.After(messages[j].CreatedAt)
+	})
+	offset := (page - 1) * limit
+	if offset >= len(messages) {
+		return []InboxMessage{}, total, nil
+	}
+	end := offset + limit
+	if end > len(messages) {
+		end = len(messages)
+	}
+	return messages[offset:end], total, nil
+}
+
+// GetUnreadCounts 统计用户的未读消息数
+func (s *NotificationService) GetUnreadCounts(userID uint) (*UnreadCounts, error) {
+	readAt, err := s.messagesReadAt(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var counts UnreadCounts
+	systemQuery := s.DB.Model(&models.SystemMessage{}).Where("is_published = ?", true)
+	if readAt != nil {
+		systemQuery = systemQuery.Where("created_at > ?", *readAt)
+	}
+	if err := systemQuery.Count(&counts.System).Error; err != nil {
+		return nil, err
+	}
+	if err := s.DB.Model(&models.UserMessage{}).Where("user_id = ? AND is_read = ?", userID, false).
+		Count(&counts.User).Error; err != nil {
+		return nil, err
+	}
+	counts.Total = counts.System + counts.User
+	return &counts, nil
+}
+
+// MarkRead 将用户的指定个人消息标记为已读，返回实际更新的消息数
+func (s *NotificationService) MarkRead(userID uint, messageIDs []uint) (int64, error) {
+	result := s.DB.Model(&models.UserMessage{}).
+		Where("user_id = ? AND id IN ? AND is_read = ?", userID, messageIDs, false).
+		Updates(map[string]interface{}{"is_read": true, "read_at": time.Now()})
+	return result.RowsAffected, result.Error
+}
+
+// MarkAllRead 将用户的全部个人消息和系统消息标记为已读
+func (s *NotificationService) MarkAllRead(userID uint) error {
+	now := time.Now()
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.UserMessage{}).Where("user_id = ? AND is_read = ?", userID, false).
+			Updates(map[string]interface{}{"is_read": true, "read_at": now}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", userID).Update("messages_read_at", now).Error
+	})
+}
+
+// messagesReadAt 获取用户系统消息全部已读的时间
+func (s *NotificationService) messagesReadAt(userID uint) (*time.Time, error) {
+	var user models.User
+	if err := s.DB.Select("id", "messages_read_at").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	return user.MessagesReadAt, nil
+}
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"log"
+	"strings"
+	"time"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// 小说连载状态
+const (
+	SerialStatusSerializing = "serializing"
+	SerialStatusCompleted   = "completed"
+)
+
+// 连载更新来源
+const (
+	NovelUpdateSourceFile  = "file"
+	NovelUpdateSourceBatch = "batch"
+)
+
+// IsValidSerialStatus 判断连载状态是否合法
+func IsValidSerialStatus(status string) bool {
+	return status == SerialStatusSerializing || status == SerialStatusCompleted
+}
+
+// NovelUpdateService 连载小说追更服务
+// 将新版本文件或章节批次与已有章节比对，只追加新章节并记录更新事件
+type NovelUpdateService struct {
+	DB *gorm.DB
+}
+
+// NewNovelUpdateService 创建连载追更服务实例
+func NewNovelUpdateService(db *gorm.DB) *NovelUpdateService {
+	return &NovelUpdateService{DB: db}
+}
+
+// AppendChapters 追加新章节
+// volumes 为解析得到的分卷分组（标题为空的分组表示未分卷），已存在的章节按（分卷, 标题）或内容哈希识别并跳过；
+// serialStatus 为空时小说标记为连载中
+func (s *NovelUpdateService) AppendChapters(novelID, userID uint, source string, volumes []models.Volume, serialStatus string) (*models.NovelUpdate, error) {
+	if serialStatus == "" {
+		serialStatus = SerialStatusSerializing
+	}
+	if !IsValidSerialStatus(serialStatus) {
+		return nil, invalidChapterEdit("无效的连载状态: %s", serialStatus)
+	}
+
+	var update models.NovelUpdate
+	var added []uint
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockNovel(tx, novelID); err != nil {
+			return err
+		}
+		var existing []models.Chapter
+		if err := tx.Select("id", "title", "content_hash", "position", "volume_id").
+			Where("novel_id = ?", novelID).Order("position ASC").Find(&existing).Error; err != nil {
+			return err
+		}
+		if err := backfillChapterHashes(tx, existing); err != nil {
+			return err
+		}
+
+		var existingVolumes []models.Volume
+		if err := tx.Where("novel_id = ?", novelID).Order("position ASC").Find(&existingVolumes).Error; err != nil {
+			return err
+		}
+		volumeIDs := make(map[string]uint, len(existingVolumes))
+		volumeTitles := make(map[uint]string, len(existingVolumes))
+		volumePosition := 0
+		for _, volume := range existingVolumes {
+			volumeIDs[volume.Title] = volume.ID
+			volumeTitles[volume.ID] = volume.Title
+			if volume.Position > volumePosition {
+				volumePosition = volume.Position
+			}
+		}
+
+		// 同一分卷下的同名章节按出现次数对应：文件中第 N 个同名章节对应已有的第 N 个，
+		// 超出已有数量的（如新分卷的"第一章"、又一篇"番外"）才是新章节；内容哈希已存在的章节不论标题都跳过
+		existingTitles := make(map[chapterTitleKey]int, len(existing))
+		knownHashes := make(map[string]bool, len(existing))
+		for _, chapter := range existing {
+			existingTitles[chapterTitleKey{volumeTitles[chapter.VolumeID], normalizeChapterTitle(chapter.Title)}]++
+			knownHashes[chapter.ContentHash] = true
+		}
+		seenTitles := make(map[chapterTitleKey]int)
+
+		// 未标明分卷的新章节归入最后一章所在的分卷
+		position := len(existing)
+		currentVolumeID := uint(0)
+		if len(existing) > 0 {
+			position = existing[len(existing)-1].Position
+			currentVolumeID = existing[len(existing)-1].VolumeID
+		}
+		currentVolumeTitle := volumeTitles[currentVolumeID]
+
+		var chapters []models.Chapter
+		for _, group := range volumes {
+			if group.Title != "" {
+				currentVolumeTitle = group.Title
+			}
+			for _, chapter := range group.Chapters {
+				title := strings.TrimSpace(chapter.Title)
+				hash := utils.ChapterContentHash(chapter.Content)
+				key := chapterTitleKey{currentVolumeTitle, normalizeChapterTitle(title)}
+				seenTitles[key]++
+				if title == "" || seenTitles[key] <= existingTitles[key] || knownHashes[hash] {
+					update.SkippedChapters++
+					continue
+				}
+				knownHashes[hash] = true
+
+				if group.Title != "" {
+					volumeID, ok := volumeIDs[group.Title]
+					if !ok {
+						volumePosition++
+						volume := models.Volume{NovelID: novelID, Title: group.Title, Position: volumePosition}
+						if err := tx.Create(&volume).Error; err != nil {
+							return err
+						}
+						volumeID = volume.ID
+						volumeIDs[group.Title] = volumeID
+					}
+					currentVolumeID = volumeID
+				}
+
+				position++
+				chapters = append(chapters, models.Chapter{
+					NovelID:     novelID,
+					VolumeID:    currentVolumeID,
+					Title:       title,
+					Content:     chapter.Content,
+					Position:    position,
+					WordCount:   utils.CalculateWordCount(chapter.Content),
+					ContentHash: hash,
+				})
+			}
+		}
+
+		if len(chapters) == 0 {
+			return invalidChapterEdit("没有发现新章节，%d个章节均已存在", update.SkippedChapters)
+		}
+		if err := tx.CreateInBatches(&chapters, 100).Error; err != nil {
+			return err
+		}
+		if err := recalculateNovelWordCounts(tx, novelID); err != nil {
+			return err
+		}
+
+		last := chapters[len(chapters)-1]
+		if err := markCompletedAt(tx, novelID, serialStatus); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Novel{}).Where("id = ?", novelID).Updates(map[string]interface{}{
+			"serial_status":   serialStatus,
+			"last_chapter_at": time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+
+		update.NovelID = novelID
+		update.UserID = userID
+		update.Source = source
+		update.AddedChapters = len(chapters)
+		update.FirstChapterID = chapters[0].ID
+		update.FromPosition = chapters[0].Position
+		update.ToPosition = last.Position
+		update.LatestTitle = last.Title
+		update.SerialStatus = serialStatus
+		for _, chapter := range chapters {
+			update.AddedWords += chapter.WordCount
+			added = append(added, chapter.ID)
+		}
+		return tx.Create(&update).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refreshNovelAfterChapterChange(novelID, added...)
+
+	// 异步通知关注该小说的读者
+	go func() {
+		if err := NewNotificationService(s.DB).NotifyNovelUpdate(&update); err != nil {
+			log.Printf("发送章节更新通知失败 (novel ID: %d): %v", novelID, err)
+		}
+	}()
+	return &update, nil
+}
+
+// UpdateSerialStatus 修改小说的连载状态
+func (s *NovelUpdateService) UpdateSerialStatus(novelID uint, serialStatus string) error {
+	if !IsValidSerialStatus(serialStatus) {
+		return invalidChapterEdit("无效的连载状态: %s", serialStatus)
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := markCompletedAt(tx, novelID, serialStatus); err != nil {
+			return err
+		}
+		return tx.Model(&models.Novel{}).Where("id = ?", novelID).Update("serial_status", serialStatus).Error
+	})
+	if err != nil {
+		return err
+	}
+	utils.GlobalCacheService.InvalidateNovelCache(novelID)
+	return nil
+}
+
+// markCompletedAt 小说由连载变为完结时记录完结时间，恢复连载时清空，需在更新 serial_status 之前调用
+func markCompletedAt(tx *gorm.DB, novelID uint, serialStatus string) error {
+	query := tx.Model(&models.Novel{}).Where("id = ?", novelID)
+	if serialStatus == SerialStatusCompleted {
+		return query.Where("serial_status <> ?", SerialStatusCompleted).Update("completed_at", time.Now()).Error
+	}
+	return query.Update("completed_at", nil).Error
+}
+
+// GetNovelUpdates 分页获取小说的更新记录，按时间倒序
+func (s *NovelUpdateService) GetNovelUpdates(novelID uint, page, limit int) ([]models.NovelUpdate, int64, error) {
+	var updates []models.NovelUpdate
+	var total int64
+	query := s.DB.Model(&models.NovelUpdate{}).Where("novel_id = ?", novelID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * limit
+	if err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&updates).Error; err != nil {
+		return nil, 0, err
+	}
+	return updates, total, nil
+}
+
+// chapterTitleKey 用于比对章节的（分卷标题, 规范化章节标题）
+type chapterTitleKey struct {
+	volume string
+	title  string
+}
+
+// backfillChapterHashes 为缺少内容哈希的历史章节补算哈希
+// 每批章节一次读取内容，并用一条 CASE 语句写回哈希
+func backfillChapterHashes(tx *gorm.DB, chapters []models.Chapter) error {
+	const batchSize = 500
+	indexes := make(map[uint]int)
+	var ids []uint
+	for i := range chapters {
+		if chapters[i].ContentHash == "" {
+			indexes[chapters[i].ID] = i
+			ids = append(ids, chapters[i].ID)
+		}
+	}
+
+	for start := 0; start < len(ids); start += batchSize {
+		end := start + batchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		var rows []models.Chapter
+		if err := tx.Select("id", "content").Where("id IN ?", ids[start:end]).Find(&rows).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			continue
+		}
+
+		var caseSQL strings.Builder
+		args := make([]interface{}, 0, len(rows)*2)
+		caseSQL.WriteString("CASE id")
+		for _, row := range rows {
+			hash := utils.ChapterContentHash(row.Content)
+			chapters[indexes[row.ID]].ContentHash = hash
+			caseSQL.WriteString(" WHEN ? THEN ?")
+			args = append(args, row.ID, hash)
+		}
+		caseSQL.WriteString(" END")
+		if err := tx.Model(&models.Chapter{}).Where("id IN ?", ids[start:end]).
+			Update("content_hash", gorm.Expr(caseSQL.String(), args...)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeChapterTitle 去除标题中的空白，用于比较章节标题
+func normalizeChapterTitle(title string) string {
+	return strings.Join(strings.Fields(title), "")
+}
@@ -0,0 +1,499 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"xiaoshuo-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// 榜单类型
+const (
+	RankingBoardRating      = "rating"       // 评分榜，按贝叶斯加权评分排序
+	RankingBoardComments    = "comments"     // 热评榜，按周期内评论数排序
+	RankingBoardReadThrough = "read_through" // 完读榜，按读者平均阅读进度排序
+	RankingBoardRising      = "rising"       // 飙升榜，按周期内点击增长率排序
+	RankingBoardCompleted   = "completed"    // 新完结榜，周期内完结的小说按总点击排序
+	RankingBoardLongest     = "longest"      // 字数榜，按总字数排序
+
+	// 点击榜，与 GetRankings 的 total/today/week/month 对应
+	RankingBoardClicksTotal = "clicks_total" // 总点击榜
+	RankingBoardClicksToday = "clicks_today" // 24小时点击榜
+	RankingBoardClicksWeek  = "clicks_week"  // 7天点击榜
+	RankingBoardClicksMonth = "clicks_month" // 月点击榜
+)
+
+// 榜单名次变动
+const (
+	RankMovementNew  = "new"
+	RankMovementUp   = "up"
+	RankMovementDown = "down"
+	RankMovementSame = "same"
+)
+
+// 榜单统计周期
+const (
+	RankingPeriodDaily   = "daily"
+	RankingPeriodWeekly  = "weekly"
+	RankingPeriodMonthly = "monthly"
+)
+
+const (
+	rankingSize           = 100 // 每个榜单保存的小说数
+	bayesianMinVotes      = 10  // 贝叶斯加权评分的先验票数
+	readThroughMinReaders = 5   // 进入完读榜所需的最少读者数
+	risingMinClicks       = 20  // 进入飙升榜所需的周期内最少点击数，同时作为增长率的最小基数
+	dailySnapshotDays     = 180 // 日榜快照的保留天数，周榜和月榜永久保留
+)
+
+// ErrRankingNotFound 榜单快照不存在（尚未计算）
+var ErrRankingNotFound = errors.New("榜单尚未生成")
+
+// RankingBoardInfo 榜单说明
+type RankingBoardInfo struct {
+	Board       string `json:"board"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Period      string `json:"period,omitempty"` // 固定的统计周期，为空时在每个周期都计算
+}
+
+// RankingBoards 可用的榜单
+var RankingBoards = []RankingBoardInfo{
+	{RankingBoardRating, "评分榜", "按平均评分排序，评分人数较少的小说向全站平均分收敛", ""},
+	{RankingBoardComments, "热评榜", "按统计周期内的评论数排序", ""},
+	{RankingBoardReadThrough, "完读榜", "按读者的平均阅读进度排序，至少5位读者", ""},
+	{RankingBoardRising, "飙升榜", "按统计周期内点击数相对上一周期的增长率排序", ""},
+	{RankingBoardCompleted, "新完结榜", "统计周期内完结的小说，按总点击量排序", ""},
+	{RankingBoardLongest, "字数榜", "按小说总字数排序", ""},
+	{RankingBoardClicksTotal, "总点击榜", "按总点击量排序", ""},
+	// 点击榜的时间窗口由榜单本身决定，只在对应的周期计算，避免各周期生成相同的快照
+	{RankingBoardClicksToday, "24小时点击榜", "按快照时刻前24小时的点击数排序", RankingPeriodDaily},
+	{RankingBoardClicksWeek, "7天点击榜", "按快照时刻前7天的点击数排序", RankingPeriodWeekly},
+	{RankingBoardClicksMonth, "月点击榜", "按当月1日至快照时刻的点击数排序", RankingPeriodMonthly},
+}
+
+// RankingBoardForType 返回 GetRankings 的排行类型对应的点击榜
+func RankingBoardForType(rankingType string) string {
+	switch rankingType {
+	case "today":
+		return RankingBoardClicksToday
+	case "week":
+		return RankingBoardClicksWeek
+	case "month":
+		return RankingBoardClicksMonth
+	}
+	return RankingBoardClicksTotal
+}
+
+// RankingBoardPeriod 返回榜单实际使用的统计周期，固定周期的榜单忽略请求的周期
+func RankingBoardPeriod(board, period string) string {
+	for _, info := range RankingBoards {
+		if info.Board == board && info.Period != "" {
+			return info.Period
+		}
+	}
+	return period
+}
+
+// RankingPeriods 可用的统计周期
+var RankingPeriods = []string{RankingPeriodDaily, RankingPeriodWeekly, RankingPeriodMonthly}
+
+// IsValidRankingBoard 判断榜单类型是否有效
+func IsValidRankingBoard(board string) bool {
+	for _, info := range RankingBoards {
+		if info.Board == board {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidRankingPeriod 判断统计周期是否有效
+func IsValidRankingPeriod(period string) bool {
+	for _, p := range RankingPeriods {
+		if p == period {
+			return true
+		}
+	}
+	return false
+}
+
+// rankingScore 榜单计算结果中的一本小说
+type rankingScore struct {
+	NovelID uint
+	Score   float64
+	Metric  float64
+}
+
+// rankingWindow 榜单的统计区间
+type rankingWindow struct {
+	Period string
+	Key    string
+	From   time.Time
+	To     time.Time
+}
+
+// RankingService 排行榜服务
+// 各榜单由定时任务按周期和分类计算后保存为快照，历史快照用于计算名次变化
+type RankingService struct {
+	DB *gorm.DB
+}
+
+// NewRankingService 创建排行榜服务实例
+func NewRankingService(db *gorm.DB) *RankingService {
+	return &RankingService{DB: db}
+}
+
+// rankingWindowFor 返回截至参考时间当天零点的统计区间
+// 日榜为前一天，周榜为滚动的最近7天，月榜为区间最后一天所在月份的1日起至今；
+// 周期标识取区间最后一天所在的日期、ISO周或月份，因此每个周期最后一次计算的快照恰好覆盖整个自然日、自然周和自然月
+func rankingWindowFor(period string, ref time.Time) rankingWindow {
+	to := time.Date(ref.Year(), ref.Month(), ref.Day(), 0, 0, 0, 0, ref.Location())
+	lastDay := to.AddDate(0, 0, -1)
+	window := rankingWindow{Period: period, To: to}
+	switch period {
+	case RankingPeriodWeekly:
+		year, week := lastDay.ISOWeek()
+		window.From = to.AddDate(0, 0, -7)
+		window.Key = fmt.Sprintf("%d-W%02d", year, week)
+	case RankingPeriodMonthly:
+		window.From = time.Date(lastDay.Year(), lastDay.Month(), 1, 0, 0, 0, 0, lastDay.Location())
+		window.Key = lastDay.Format("2006-01")
+	default:
+		window.From = lastDay
+		window.Key = lastDay.Format("2006-01-02")
+	}
+	return window
+}
+
+// ComputeAll 计算全部榜单在各周期、全部分类和每个分类下的快照
+func (s *RankingService) ComputeAll(now time.Time) (string, error) {
+	var categoryIDs []uint
+	if err := s.DB.Model(&models.Category{}).Pluck("id", &categoryIDs).Error; err != nil {
+		return "", err
+	}
+	categoryIDs = append([]uint{0}, categoryIDs...)
+
+	// 全站平均评分作为贝叶斯加权的先验
+	var meanRating float64
+	if err := s.DB.Model(&models.Novel{}).
+		Where("status = ? AND rating_count > 0", "approved").
+		Select("COALESCE(AVG(average_rating), 0)").
+		Scan(&meanRating).Error; err != nil {
+		return "", err
+	}
+
+	snapshots := 0
+	for _, period := range RankingPeriods {
+		window := rankingWindowFor(period, now)
+		for _, info := range RankingBoards {
+			if info.Period != "" && info.Period != period {
+				continue
+			}
+			for _, categoryID := range categoryIDs {
+				scores, err := s.scoreBoard(info.Board, window, categoryID, meanRating)
+				if err != nil {
+					return "", fmt.Errorf("计算榜单 %s/%s 失败: %v", info.Board, period, err)
+				}
+				if err := s.saveSnapshot(info.Board, window, categoryID, now, scores); err != nil {
+					return "", fmt.Errorf("保存榜单 %s/%s 失败: %v", info.Board, period, err)
+				}
+				snapshots++
+			}
+		}
+	}
+	pruned, err := s.PruneDailySnapshots(now.AddDate(0, 0, -dailySnapshotDays))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("计算%d个榜单快照（%d个分类），清理%d个过期日榜快照", snapshots, len(categoryIDs)-1, pruned), nil
+}
+
+// PruneDailySnapshots 删除早于指定时间的日榜快照及其条目
+func (s *RankingService) PruneDailySnapshots(before time.Time) (int64, error) {
+	expired := s.DB.Model(&models.RankingSnapshot{}).Select("id").
+		Where("period = ? AND window_to < ?", RankingPeriodDaily, before)
+	if err := s.DB.Unscoped().Where("snapshot_id IN (?)", expired).Delete(&models.RankingEntry{}).Error; err != nil {
+		return 0, err
+	}
+	result := s.DB.Unscoped().Where("period = ? AND window_to < ?", RankingPeriodDaily, before).Delete(&models.RankingSnapshot{})
+	return result.RowsAffected, result.Error
+}
+
+// rankingBase 已审核小说的查询，categoryID 大于0时限定分类
+func (s *RankingService) rankingBase(categoryID uint) *gorm.DB {
+	query := s.DB.Model(&models.Novel{}).Where("novels.status = ?", "approved")
+	if categoryID > 0 {
+		query = query.Joins("JOIN novel_categories ON novels.id = novel_categories.novel_id").
+			Where("novel_categories.category_id = ?", categoryID)
+	}
+	return query
+}
+
+// scoreBoard 计算单个榜单的排名
+func (s *RankingService) scoreBoard(board string, window rankingWindow, categoryID uint, meanRating float64) ([]rankingScore, error) {
+	query := s.rankingBase(categoryID)
+	switch board {
+	case RankingBoardRating:
+		// 贝叶斯加权评分：(v/(v+m))*R + (m/(v+m))*C
+		query = query.Select("novels.id AS novel_id, "+
+			"(novels.rating_count * novels.average_rating + ? * ?) / (novels.rating_count + ?) AS score, "+
+			"novels.average_rating AS metric", bayesianMinVotes, meanRating, bayesianMinVotes).
+			Where("novels.rating_count > 0")
+	case RankingBoardComments:
+		query = query.Select("novels.id AS novel_id, COUNT(comments.id) AS score, COUNT(comments.id) AS metric").
+			Joins("JOIN comments ON comments.novel_id = novels.id AND comments.deleted_at IS NULL AND comments.is_approved = ? "+
+				"AND comments.created_at >= ? AND comments.created_at < ?", true, window.From, window.To).
+			Group("novels.id")
+	case RankingBoardReadThrough:
+		query = query.Select("novels.id AS novel_id, AVG(reading_progress.progress) AS score, COUNT(reading_progress.id) AS metric").
+			Joins("JOIN reading_progress ON reading_progress.novel_id = novels.id AND reading_progress.deleted_at IS NULL").
+			Group("novels.id").
+			Having("COUNT(reading_progress.id) >= ?", readThroughMinReaders)
+	case RankingBoardRising:
+		// 本周期与上一周期的点击数（已扣除刷量点击），增长率 = (本期 - 上期) / max(上期, 最小基数)
+		length := window.To.Sub(window.From)
+		clickStats := s.DB.Model(&models.NovelClickStat{}).
+			Select("novel_id, "+
+				"SUM(CASE WHEN bucket_start >= ? THEN clicks - discounted_clicks ELSE 0 END) AS current_clicks, "+
+				"SUM(CASE WHEN bucket_start < ? THEN clicks - discounted_clicks ELSE 0 END) AS previous_clicks",
+				window.From, window.From).
+			Where("granularity = ? AND bucket_start >= ? AND bucket_start < ?", ClickGranularityDay, window.From.Add(-length), window.To).
+			Group("novel_id")
+		query = query.Select("novels.id AS novel_id, "+
+			"(click_window.current_clicks - click_window.previous_clicks) / GREATEST(click_window.previous_clicks, ?) AS score, "+
+			"click_window.current_clicks - click_window.previous_clicks AS metric", risingMinClicks).
+			Joins("JOIN (?) AS click_window ON click_window.novel_id = novels.id", clickStats).
+			Where("click_window.current_clicks >= ? AND click_window.current_clicks > click_window.previous_clicks", risingMinClicks)
+	case RankingBoardCompleted:
+		query = query.Select("novels.id AS novel_id, novels.click_count AS score, novels.click_count AS metric").
+			Where("novels.serial_status = ?", SerialStatusCompleted).
+			Where("COALESCE(novels.completed_at, novels.created_at) >= ? AND COALESCE(novels.completed_at, novels.created_at) < ?", window.From, window.To)
+	case RankingBoardLongest:
+		query = query.Select("novels.id AS novel_id, novels.word_count AS score, novels.word_count AS metric").
+			Where("novels.word_count > 0")
+	case RankingBoardClicksTotal:
+		query = query.Select("novels.id AS novel_id, novels.click_count AS score, novels.click_count AS metric")
+	case RankingBoardClicksToday, RankingBoardClicksWeek, RankingBoardClicksMonth:
+		// 榜单固定在对应周期计算，统计区间即前24小时、前7天或当月，已扣除刷量点击
+		granularity := ClickGranularityDay
+		if board == RankingBoardClicksToday {
+			granularity = ClickGranularityHour
+		}
+		clickStats := s.DB.Model(&models.NovelClickStat{}).
+			Select("novel_id, SUM(clicks - discounted_clicks) AS window_clicks").
+			Where("granularity = ? AND bucket_start >= ? AND bucket_start < ?", granularity, window.From, window.To).
+			Group("novel_id")
+		query = query.Select("novels.id AS novel_id, click_window.window_clicks AS score, click_window.window_clicks AS metric").
+			Joins("JOIN (?) AS click_window ON click_window.novel_id = novels.id", clickStats).
+			Where("click_window.window_clicks > 0")
+	default:
+		return nil, fmt.Errorf("不支持的榜单类型: %s", board)
+	}
+
+	var scores []rankingScore
+	if err := query.Order("score DESC").Order("novels.id ASC").Limit(rankingSize).Scan(&scores).Error; err != nil {
+		return nil, err
+	}
+	return scores, nil
+}
+
+// saveSnapshot 保存榜单快照，同一周期标识的快照会被覆盖；名次变化与上一周期的快照比较
+func (s *RankingService) saveSnapshot(board string, window rankingWindow, categoryID uint, computedAt time.Time, scores []rankingScore) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var snapshot models.RankingSnapshot
+		err := tx.Where("board = ? AND period = ? AND category_id = ? AND period_key = ?", board, window.Period, categoryID, window.Key).
+			First(&snapshot).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		snapshot.Board = board
+		snapshot.Period = window.Period
+		snapshot.CategoryID = categoryID
+		snapshot.PeriodKey = window.Key
+		snapshot.WindowFrom = window.From
+		snapshot.WindowTo = window.To
+		snapshot.ComputedAt = computedAt
+		snapshot.EntryCount = len(scores)
+		if err := tx.Save(&snapshot).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("snapshot_id = ?", snapshot.ID).Delete(&models.RankingEntry{}).Error; err != nil {
+			return err
+		}
+		if len(scores) == 0 {
+			return nil
+		}
+
+		// 上一周期的名次
+		previousRanks := make(map[uint]int)
+		var previous models.RankingSnapshot
+		err = tx.Where("board = ? AND period = ? AND category_id = ? AND period_key < ?", board, window.Period, categoryID, window.Key).
+			Order("period_key DESC").First(&previous).Error
+		if err == nil {
+			var previousEntries []models.RankingEntry
+			if err := tx.Select("novel_id, rank_no").Where("snapshot_id = ?", previous.ID).Find(&previousEntries).Error; err != nil {
+				return err
+			}
+			for _, entry := range previousEntries {
+				previousRanks[entry.NovelID] = entry.Rank
+			}
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		entries := make([]models.RankingEntry, len(scores))
+		for i, score := range scores {
+			entries[i] = models.RankingEntry{
+				SnapshotID: snapshot.ID,
+				NovelID:    score.NovelID,
+				Rank:       i + 1,
+				Score:      score.Score,
+				Metric:     score.Metric,
+				Movement:   RankMovementNew,
+			}
+			if rank, ok := previousRanks[score.NovelID]; ok {
+				entries[i].PreviousRank = &rank
+				entries[i].RankChange = rank - entries[i].Rank
+				switch {
+				case entries[i].RankChange > 0:
+					entries[i].Movement = RankMovementUp
+				case entries[i].RankChange < 0:
+					entries[i].Movement = RankMovementDown
+				default:
+					entries[i].Movement = RankMovementSame
+				}
+			}
+		}
+		return tx.CreateInBatches(&entries, 100).Error
+	})
+}
+
+// GetBoard 获取榜单快照及前 limit 名，periodKey 为空时返回最新一期
+func (s *RankingService) GetBoard(board, period string, categoryID uint, periodKey string, limit int) (*models.RankingSnapshot, error) {
+	query := s.DB.Where("board = ? AND period = ? AND category_id = ?", board, period, categoryID)
+	if periodKey != "" {
+		query = query.Where("period_key = ?", periodKey)
+	}
+
+	var snapshot models.RankingSnapshot
+	err := query.Preload("Entries", func(db *gorm.DB) *gorm.DB {
+		return db.Order("rank_no ASC").Limit(limit)
+	}).Preload("Entries.Novel").Preload("Entries.Novel.UploadUser").
+		Order("period_key DESC").First(&snapshot).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRankingNotFound
+		}
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// GetBoardHistory 获取榜单的历史快照列表（不含条目），按周期标识倒序
+func (s *RankingService) GetBoardHistory(board, period string, categoryID uint, limit int) ([]models.RankingSnapshot, error) {
+	var snapshots []models.RankingSnapshot
+	err := s.DB.Where("board = ? AND period = ? AND category_id = ?", board, period, categoryID).
+		Order("period_key DESC").Limit(limit).Find(&snapshots).Error
+	return snapshots, err
+}
+
+// NovelRankPoint 小说在某一期榜单中的名次
+type NovelRankPoint struct {
+	PeriodKey    string    `json:"period_key"`
+	WindowFrom   time.Time `json:"window_from"`
+	WindowTo     time.Time `json:"window_to"`
+	ComputedAt   time.Time `json:"computed_at"`
+	Rank         int       `json:"rank"`
+	PreviousRank *int      `json:"previous_rank"`
+	RankChange   int       `json:"rank_change"`
+	Movement     string    `json:"movement"`
+	Score        float64   `json:"score"`
+	Metric       float64   `json:"metric"`
+}
+
+// NovelBoardSummary 小说在某个榜单上的上榜概况
+type NovelBoardSummary struct {
+	Board           string `json:"board"`
+	Period          string `json:"period"`
+	Appearances     int    `json:"appearances"`       // 上榜期数
+	FirstPeriodKey  string `json:"first_period_key"`  // 首次上榜的周期
+	BestRank        int    `json:"best_rank"`         // 最高名次
+	BestPeriodKey   string `json:"best_period_key"`   // 取得最高名次的周期（最早一次）
+	LatestRank      int    `json:"latest_rank"`       // 最近一次上榜的名次
+	LatestPeriodKey string `json:"latest_period_key"` // 最近一次上榜的周期
+}
+
+// novelRankRow 小说上榜记录查询结果
+type novelRankRow struct {
+	Board  string
+	Period string
+	NovelRankPoint
+}
+
+// novelRankQuery 查询小说在快照中的上榜记录
+func (s *RankingService) novelRankQuery(novelID, categoryID uint) *gorm.DB {
+	return s.DB.Table("ranking_entries").
+		Select("ranking_snapshots.board, ranking_snapshots.period, ranking_snapshots.period_key, "+
+			"ranking_snapshots.window_from, ranking_snapshots.window_to, ranking_snapshots.computed_at, "+
+			"ranking_entries.rank_no AS `rank`, ranking_entries.previous_rank, ranking_entries.rank_change, "+
+			"ranking_entries.movement, ranking_entries.score, ranking_entries.metric").
+		Joins("JOIN ranking_snapshots ON ranking_snapshots.id = ranking_entries.snapshot_id AND ranking_snapshots.deleted_at IS NULL").
+		Where("ranking_entries.deleted_at IS NULL AND ranking_entries.novel_id = ? AND ranking_snapshots.category_id = ?", novelID, categoryID)
+}
+
+// GetNovelRankHistory 获取小说在一个榜单上最近 limit 期的名次，按周期先后排序；未上榜的周期不返回
+func (s *RankingService) GetNovelRankHistory(novelID uint, board, period string, categoryID uint, limit int) ([]NovelRankPoint, error) {
+	var rows []novelRankRow
+	if err := s.novelRankQuery(novelID, categoryID).
+		Where("ranking_snapshots.board = ? AND ranking_snapshots.period = ?", board, period).
+		Order("ranking_snapshots.period_key DESC").Limit(limit).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	points := make([]NovelRankPoint, len(rows))
+	for i, row := range rows {
+		points[len(rows)-1-i] = row.NovelRankPoint
+	}
+	return points, nil
+}
+
+// GetNovelRankSummary 获取小说在各榜单、各周期的上榜概况，用于回答“这本书什么时候上榜”
+func (s *RankingService) GetNovelRankSummary(novelID, categoryID uint) ([]NovelBoardSummary, error) {
+	var rows []novelRankRow
+	if err := s.novelRankQuery(novelID, categoryID).
+		Order("ranking_snapshots.period_key ASC").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	summaries := make([]NovelBoardSummary, 0)
+	index := make(map[string]int)
+	for _, row := range rows {
+		key := row.Board + "/" + row.Period
+		i, ok := index[key]
+		if !ok {
+			i = len(summaries)
+			index[key] = i
+			summaries = append(summaries, NovelBoardSummary{
+				Board:          row.Board,
+				Period:         row.Period,
+				FirstPeriodKey: row.PeriodKey,
+				BestRank:       row.Rank,
+				BestPeriodKey:  row.PeriodKey,
+			})
+		}
+		summary := &summaries[i]
+		summary.Appearances++
+		if row.Rank < summary.BestRank {
+			summary.BestRank = row.Rank
+			summary.BestPeriodKey = row.PeriodKey
+		}
+		summary.LatestRank = row.Rank
+		summary.LatestPeriodKey = row.PeriodKey
+	}
+	return summaries, nil
+}
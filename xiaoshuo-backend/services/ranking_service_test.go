@@ -0,0 +1,34 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRankingWindowFor(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		period string
+		ref    time.Time
+		from   time.Time
+		to     time.Time
+		key    string
+	}{
+		{RankingPeriodDaily, time.Date(2024, 3, 5, 8, 30, 0, 0, time.UTC), date(2024, 3, 4), date(2024, 3, 5), "2024-03-04"},
+		// 2024-03-11 是周一，前7天恰好是第10周
+		{RankingPeriodWeekly, time.Date(2024, 3, 11, 1, 0, 0, 0, time.UTC), date(2024, 3, 4), date(2024, 3, 11), "2024-W10"},
+		{RankingPeriodMonthly, time.Date(2024, 3, 5, 8, 30, 0, 0, time.UTC), date(2024, 3, 1), date(2024, 3, 5), "2024-03"},
+		// 每月1日计算的快照覆盖上个自然月，包括只有29天的2月
+		{RankingPeriodMonthly, time.Date(2024, 3, 1, 1, 0, 0, 0, time.UTC), date(2024, 2, 1), date(2024, 3, 1), "2024-02"},
+		{RankingPeriodMonthly, time.Date(2024, 8, 1, 1, 0, 0, 0, time.UTC), date(2024, 7, 1), date(2024, 8, 1), "2024-07"},
+	}
+	for _, tt := range tests {
+		window := rankingWindowFor(tt.period, tt.ref)
+		if !window.From.Equal(tt.from) || !window.To.Equal(tt.to) || window.Key != tt.key {
+			t.Errorf("rankingWindowFor(%s, %v) = %v..%v %s, want %v..%v %s",
+				tt.period, tt.ref, window.From, window.To, window.Key, tt.from, tt.to, tt.key)
+		}
+	}
+}
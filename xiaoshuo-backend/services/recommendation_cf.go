@@ -0,0 +1,360 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"xiaoshuo-backend/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	cfNeighborsPerNovel = 50  // 每本小说保存的相似小说数
+	cfMinCoReaders      = 2   // 计算相似度所需的最少共同读者数
+	cfMaxItemsPerUser   = 200 // 每个读者参与计算的最多小说数，防止重度读者主导计算量
+	cfBlendWeight       = 0.5 // 个性化推荐中协同过滤得分的权重，其余为内容得分
+)
+
+// NeighborNovel 协同过滤得到的相似小说
+type NeighborNovel struct {
+	Novel      models.Novel `json:"novel"`
+	Similarity float64      `json:"similarity"`
+	CoReaders  int          `json:"co_readers"`
+}
+
+// cfPairStat 两本小说之间的共现统计
+type cfPairStat struct {
+	dot       float64
+	coReaders int
+}
+
+// interactionWeight 读者对小说的行为权重：阅读 1~2（随进度增加），评分 0~2（随分数增加），评论 0.5
+func interactionWeight(progress int, hasProgress bool, ratingScore float64, hasRating, hasComment bool) float64 {
+	weight := 0.0
+	if hasProgress {
+		weight += 1 + math.Min(math.Max(float64(progress), 0), 100)/100
+	}
+	if hasRating {
+		weight += math.Min(math.Max(ratingScore, 0), 10) / 5
+	}
+	if hasComment {
+		weight += 0.5
+	}
+	return weight
+}
+
+// userInteraction 读者对一本小说的行为汇总
+type userInteraction struct {
+	progress    int
+	hasProgress bool
+	ratingScore float64
+	hasRating   bool
+	hasComment  bool
+}
+
+func (i *userInteraction) weight() float64 {
+	return interactionWeight(i.progress, i.hasProgress, i.ratingScore, i.hasRating, i.hasComment)
+}
+
+// loadInteractions 加载全部读者对已审核小说的阅读、评分和评论行为
+func (rs *RecommendationService) loadInteractions() (map[uint]map[uint]*userInteraction, error) {
+	interactions := make(map[uint]map[uint]*userInteraction)
+	get := func(userID, novelID uint) *userInteraction {
+		items, ok := interactions[userID]
+		if !ok {
+			items = make(map[uint]*userInteraction)
+			interactions[userID] = items
+		}
+		item, ok := items[novelID]
+		if !ok {
+			item = &userInteraction{}
+			items[novelID] = item
+		}
+		return item
+	}
+	approved := rs.DB.Model(&models.Novel{}).Select("id").Where("status = ?", "approved")
+
+	var progresses []struct {
+		UserID   uint
+		NovelID  uint
+		Progress int
+	}
+	if err := rs.DB.Model(&models.ReadingProgress{}).Select("user_id, novel_id, MAX(progress) AS progress").
+		Where("novel_id IN (?)", approved).Group("user_id, novel_id").Scan(&progresses).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range progresses {
+		item := get(p.UserID, p.NovelID)
+		item.progress, item.hasProgress = p.Progress, true
+	}
+
+	var ratings []struct {
+		UserID  uint
+		NovelID uint
+		Score   float64
+	}
+	if err := rs.DB.Model(&models.Rating{}).Select("user_id, novel_id, MAX(score) AS score").
+		Where("is_approved = ? AND novel_id IN (?)", true, approved).Group("user_id, novel_id").Scan(&ratings).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range ratings {
+		item := get(r.UserID, r.NovelID)
+		item.ratingScore, item.hasRating = r.Score, true
+	}
+
+	var comments []struct {
+		UserID  uint
+		NovelID uint
+	}
+	if err := rs.DB.Model(&models.Comment{}).Select("DISTINCT user_id, novel_id").
+		Where("is_approved = ? AND novel_id IN (?)", true, approved).Scan(&comments).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range comments {
+		get(c.UserID, c.NovelID).hasComment = true
+	}
+	return interactions, nil
+}
+
+// BuildItemNeighbors 根据读者行为的共现计算小说之间的相似度，并整体替换相似小说表
+func (rs *RecommendationService) BuildItemNeighbors() (string, error) {
+	interactions, err := rs.loadInteractions()
+	if err != nil {
+		return "", err
+	}
+	rows, novelCount := computeItemNeighbors(interactions)
+
+	err = rs.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(&models.NovelNeighbor{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&rows, 500).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("根据%d位读者的行为计算%d本小说的%d条相似关系", len(interactions), novelCount, len(rows)), nil
+}
+
+// computeItemNeighbors 由读者行为计算小说之间的相似关系，返回相似关系及涉及的小说数
+// 相似度为加权余弦相似度与读者集合Jaccard相似度的平均，每本小说保留最相似的若干本
+func computeItemNeighbors(interactions map[uint]map[uint]*userInteraction) ([]models.NovelNeighbor, int) {
+	norms := make(map[uint]float64)
+	readers := make(map[uint]int)
+	pairs := make(map[[2]uint]*cfPairStat)
+	type weightedItem struct {
+		novelID uint
+		weight  float64
+	}
+	for _, items := range interactions {
+		list := make([]weightedItem, 0, len(items))
+		for novelID, item := range items {
+			list = append(list, weightedItem{novelID, item.weight()})
+		}
+		if len(list) > cfMaxItemsPerUser {
+			sort.Slice(list, func(i, j int) bool { return list[i].weight > list[j].weight })
+			list = list[:cfMaxItemsPerUser]
+		}
+
+		for _, item := range list {
+			norms[item.novelID] += item.weight * item.weight
+			readers[item.novelID]++
+		}
+		for i := 0; i < len(list); i++ {
+			for j := i + 1; j < len(list); j++ {
+				a, b := list[i], list[j]
+				if a.novelID > b.novelID {
+					a, b = b, a
+				}
+				key := [2]uint{a.novelID, b.novelID}
+				pair, ok := pairs[key]
+				if !ok {
+					pair = &cfPairStat{}
+					pairs[key] = pair
+				}
+				pair.dot += a.weight * b.weight
+				pair.coReaders++
+			}
+		}
+	}
+
+	neighbors := make(map[uint][]models.NovelNeighbor)
+	for key, pair := range pairs {
+		if pair.coReaders < cfMinCoReaders {
+			continue
+		}
+		cosine := pair.dot / math.Sqrt(norms[key[0]]*norms[key[1]])
+		jaccard := float64(pair.coReaders) / float64(readers[key[0]]+readers[key[1]]-pair.coReaders)
+		similarity := (cosine + jaccard) / 2
+		for _, ids := range [][2]uint{{key[0], key[1]}, {key[1], key[0]}} {
+			neighbors[ids[0]] = append(neighbors[ids[0]], models.NovelNeighbor{
+				NovelID:    ids[0],
+				NeighborID: ids[1],
+				Similarity: similarity,
+				Cosine:     cosine,
+				Jaccard:    jaccard,
+				CoReaders:  pair.coReaders,
+			})
+		}
+	}
+
+	rows := make([]models.NovelNeighbor, 0)
+	for _, list := range neighbors {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Similarity != list[j].Similarity {
+				return list[i].Similarity > list[j].Similarity
+			}
+			return list[i].NeighborID < list[j].NeighborID
+		})
+		if len(list) > cfNeighborsPerNovel {
+			list = list[:cfNeighborsPerNovel]
+		}
+		rows = append(rows, list...)
+	}
+	return rows, len(neighbors)
+}
+
+// AlsoReadRecommendation 读过这本书的读者还读过：按协同过滤相似度返回已审核的相似小说
+func (rs *RecommendationService) AlsoReadRecommendation(novelID uint, limit int) ([]NeighborNovel, error) {
+	var neighbors []models.NovelNeighbor
+	if err := rs.DB.Joins("JOIN novels ON novels.id = novel_neighbors.neighbor_id AND novels.deleted_at IS NULL").
+		Where("novel_neighbors.novel_id = ? AND novels.status = ?", novelID, "approved").
+		Order("novel_neighbors.similarity DESC").Limit(limit).
+		Find(&neighbors).Error; err != nil {
+		return nil, err
+	}
+	if len(neighbors) == 0 {
+		return []NeighborNovel{}, nil
+	}
+
+	ids := make([]uint, len(neighbors))
+	for i, neighbor := range neighbors {
+		ids[i] = neighbor.NeighborID
+	}
+	var novels []models.Novel
+	if err := rs.DB.Preload("UploadUser").Preload("Categories").Where("id IN ?", ids).Find(&novels).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Novel, len(novels))
+	for _, novel := range novels {
+		byID[novel.ID] = novel
+	}
+
+	result := make([]NeighborNovel, 0, len(neighbors))
+	for _, neighbor := range neighbors {
+		if novel, ok := byID[neighbor.NeighborID]; ok {
+			result = append(result, NeighborNovel{Novel: novel, Similarity: neighbor.Similarity, CoReaders: neighbor.CoReaders})
+		}
+	}
+	return result, nil
+}
+
+// collaborativeScores 根据读者已有行为的小说及其相似小说计算候选小说的协同过滤得分
+// 得分为 Σ 行为权重 × 相似度，已有行为的小说不参与打分
+func (rs *RecommendationService) collaborativeScores(weights map[uint]float64, limit int) (map[uint]float64, error) {
+	scores := make(map[uint]float64)
+	if len(weights) == 0 {
+		return scores, nil
+	}
+
+	seedIDs := make([]uint, 0, len(weights))
+	for novelID := range weights {
+		seedIDs = append(seedIDs, novelID)
+	}
+	var neighbors []models.NovelNeighbor
+	if err := rs.DB.Where("novel_id IN ?", seedIDs).Find(&neighbors).Error; err != nil {
+		return nil, err
+	}
+	return neighborScores(weights, neighbors, limit), nil
+}
+
+// neighborScores 由行为权重和相似关系计算候选小说得分，只保留得分最高的 limit 本
+func neighborScores(weights map[uint]float64, neighbors []models.NovelNeighbor, limit int) map[uint]float64 {
+	scores := make(map[uint]float64)
+	for _, neighbor := range neighbors {
+		if _, seen := weights[neighbor.NeighborID]; seen {
+			continue
+		}
+		scores[neighbor.NeighborID] += weights[neighbor.NovelID] * neighbor.Similarity
+	}
+
+	// 只保留得分最高的候选
+	if len(scores) > limit {
+		type scored struct {
+			id    uint
+			score float64
+		}
+		list := make([]scored, 0, len(scores))
+		for id, score := range scores {
+			list = append(list, scored{id, score})
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].score > list[j].score })
+		scores = make(map[uint]float64, limit)
+		for _, item := range list[:limit] {
+			scores[item.id] = item.score
+		}
+	}
+	return scores
+}
+
+// userInteractionWeights 根据读者的阅读、评分和评论历史计算对每本小说的行为权重
+func userInteractionWeights(readingHistory []models.ReadingProgress, ratingHistory []models.Rating, commentHistory []models.Comment) map[uint]float64 {
+	items := make(map[uint]*userInteraction)
+	get := func(novelID uint) *userInteraction {
+		item, ok := items[novelID]
+		if !ok {
+			item = &userInteraction{}
+			items[novelID] = item
+		}
+		return item
+	}
+	for _, history := range readingHistory {
+		item := get(history.NovelID)
+		if !item.hasProgress || history.Progress > item.progress {
+			item.progress = history.Progress
+		}
+		item.hasProgress = true
+	}
+	for _, rating := range ratingHistory {
+		item := get(rating.NovelID)
+		item.ratingScore = math.Max(item.ratingScore, rating.Score)
+		item.hasRating = true
+	}
+	for _, comment := range commentHistory {
+		get(comment.NovelID).hasComment = true
+	}
+
+	weights := make(map[uint]float64, len(items))
+	for novelID, item := range items {
+		weights[novelID] = item.weight()
+	}
+	return weights
+}
+
+// appendCandidates 将协同过滤得到的小说补充到候选列表中（去重，仅限已审核小说）
+func (rs *RecommendationService) appendCandidates(candidates []models.Novel, cfScores map[uint]float64) ([]models.Novel, error) {
+	existing := make(map[uint]bool, len(candidates))
+	for _, novel := range candidates {
+		existing[novel.ID] = true
+	}
+	missing := make([]uint, 0)
+	for novelID := range cfScores {
+		if !existing[novelID] {
+			missing = append(missing, novelID)
+		}
+	}
+	if len(missing) == 0 {
+		return candidates, nil
+	}
+
+	var extra []models.Novel
+	if err := rs.DB.Preload("UploadUser").Preload("Categories").Preload("Keywords").
+		Where("status = ? AND id IN ?", "approved", missing).Find(&extra).Error; err != nil {
+		return nil, err
+	}
+	return append(candidates, extra...), nil
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+	"xiaoshuo-backend/models"
+)
+
+// readingInteractions 由阅读进度构造读者行为，进度0的权重为1，进度100的权重为2
+func readingInteractions(progress map[uint]map[uint]int) map[uint]map[uint]*userInteraction {
+	interactions := make(map[uint]map[uint]*userInteraction, len(progress))
+	for userID, novels := range progress {
+		items := make(map[uint]*userInteraction, len(novels))
+		for novelID, p := range novels {
+			items[novelID] = &userInteraction{progress: p, hasProgress: true}
+		}
+		interactions[userID] = items
+	}
+	return interactions
+}
+
+func TestComputeItemNeighbors(t *testing.T) {
+	// 小说1的权重向量 (1, 1, 2)，小说2为 (2, 1, 0)，小说3为 (0, 0, 1)
+	interactions := readingInteractions(map[uint]map[uint]int{
+		1: {1: 0, 2: 100},
+		2: {1: 0, 2: 0},
+		3: {1: 100, 3: 0},
+	})
+	rows, novelCount := computeItemNeighbors(interactions)
+
+	// 小说1和3只有一位共同读者，不足 cfMinCoReaders
+	if novelCount != 2 || len(rows) != 2 {
+		t.Fatalf("computeItemNeighbors = %d rows for %d novels, want 2 rows for 2 novels", len(rows), novelCount)
+	}
+	// 余弦 (1·2+1·1+2·0)/√(6·5)，Jaccard 为共同读者2 / 读者并集3
+	cosine := 3 / math.Sqrt(30)
+	jaccard := 2.0 / 3
+	sort.Slice(rows, func(i, j int) bool { return rows[i].NovelID < rows[j].NovelID })
+	for i, pair := range [][2]uint{{1, 2}, {2, 1}} {
+		row := rows[i]
+		if row.NovelID != pair[0] || row.NeighborID != pair[1] || row.CoReaders != 2 {
+			t.Errorf("row %d = %d->%d with %d co-readers, want %d->%d with 2", i, row.NovelID, row.NeighborID, row.CoReaders, pair[0], pair[1])
+		}
+		if math.Abs(row.Cosine-cosine) > 1e-9 || math.Abs(row.Jaccard-jaccard) > 1e-9 ||
+			math.Abs(row.Similarity-(cosine+jaccard)/2) > 1e-9 {
+			t.Errorf("row %d similarity = %v (cosine %v, jaccard %v), want %v (cosine %v, jaccard %v)",
+				i, row.Similarity, row.Cosine, row.Jaccard, (cosine+jaccard)/2, cosine, jaccard)
+		}
+	}
+}
+
+func TestComputeItemNeighborsTruncates(t *testing.T) {
+	// 两位读者读过同样的 cfNeighborsPerNovel+5 本小说，相似度全部相同时按小说ID保留
+	novels := make(map[uint]int)
+	for id := uint(1); id <= cfNeighborsPerNovel+5; id++ {
+		novels[id] = 50
+	}
+	rows, novelCount := computeItemNeighbors(readingInteractions(map[uint]map[uint]int{1: novels, 2: novels}))
+	if novelCount != cfNeighborsPerNovel+5 {
+		t.Errorf("novelCount = %d, want %d", novelCount, cfNeighborsPerNovel+5)
+	}
+
+	var neighborIDs []uint
+	for _, row := range rows {
+		if row.NovelID == 1 {
+			neighborIDs = append(neighborIDs, row.NeighborID)
+		}
+	}
+	if len(neighborIDs) != cfNeighborsPerNovel {
+		t.Fatalf("novel 1 has %d neighbors, want %d", len(neighborIDs), cfNeighborsPerNovel)
+	}
+	if neighborIDs[0] != 2 || neighborIDs[len(neighborIDs)-1] != cfNeighborsPerNovel+1 {
+		t.Errorf("novel 1 neighbors = %d..%d, want 2..%d", neighborIDs[0], neighborIDs[len(neighborIDs)-1], cfNeighborsPerNovel+1)
+	}
+	if len(rows) != (cfNeighborsPerNovel+5)*cfNeighborsPerNovel {
+		t.Errorf("got %d rows, want %d", len(rows), (cfNeighborsPerNovel+5)*cfNeighborsPerNovel)
+	}
+}
+
+func TestNeighborScores(t *testing.T) {
+	weights := map[uint]float64{1: 2, 2: 1}
+	neighbors := []models.NovelNeighbor{
+		{NovelID: 1, NeighborID: 3, Similarity: 0.5},
+		{NovelID: 2, NeighborID: 3, Similarity: 0.4},
+		{NovelID: 1, NeighborID: 2, Similarity: 0.9}, // 已读过的小说不参与打分
+		{NovelID: 2, NeighborID: 4, Similarity: 0.3},
+		{NovelID: 1, NeighborID: 5, Similarity: 0.1},
+	}
+	tests := []struct {
+		limit int
+		want  map[uint]float64
+	}{
+		// 小说3：2×0.5 + 1×0.4
+		{10, map[uint]float64{3: 1.4, 4: 0.3, 5: 0.2}},
+		{2, map[uint]float64{3: 1.4, 4: 0.3}},
+	}
+	for _, tt := range tests {
+		got := neighborScores(weights, neighbors, tt.limit)
+		if len(got) != len(tt.want) {
+			t.Errorf("neighborScores(limit %d) = %v, want %v", tt.limit, got, tt.want)
+			continue
+		}
+		for id, score := range tt.want {
+			if math.Abs(got[id]-score) > 1e-9 {
+				t.Errorf("neighborScores(limit %d) = %v, want %v", tt.limit, got, tt.want)
+				break
+			}
+		}
+	}
+	if got := neighborScores(weights, nil, 10); !reflect.DeepEqual(got, map[uint]float64{}) {
+		t.Errorf("neighborScores without neighbors = %v, want empty", got)
+	}
+}
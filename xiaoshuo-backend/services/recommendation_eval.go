@@ -0,0 +1,540 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+	"xiaoshuo-backend/models"
+)
+
+// 离线评估支持的推荐策略
+const (
+	EvalStrategyHot           = "hot"           // 热门推荐
+	EvalStrategyNewBook       = "new_book"      // 新书推荐
+	EvalStrategyContent       = "content"       // 基于读者最近阅读小说的内容推荐
+	EvalStrategyCollaborative = "collaborative" // 仅协同过滤
+	EvalStrategyPersonalized  = "personalized"  // 个性化推荐（内容与协同过滤混合）
+)
+
+// EvalStrategies 全部可评估的策略
+var EvalStrategies = []string{EvalStrategyHot, EvalStrategyNewBook, EvalStrategyContent, EvalStrategyCollaborative, EvalStrategyPersonalized}
+
+var (
+	// ErrNoEvalData 没有可用于评估的行为数据
+	ErrNoEvalData = errors.New("没有可用于评估的行为数据")
+	// ErrUnknownEvalStrategy 未知的推荐策略
+	ErrUnknownEvalStrategy = errors.New("未知的推荐策略")
+)
+
+// EvalOptions 离线评估参数
+type EvalOptions struct {
+	Cutoff         time.Time // 训练/测试切分时间，为零值时按 TestRatio 取行为时间的分位点
+	TestRatio      float64   // 作为测试集的最近行为比例，默认0.2
+	Ks             []int     // 评估的推荐列表长度，默认 5、10、20
+	Strategies     []string  // 评估的策略，默认全部
+	MinTrainEvents int       // 参与评估的读者在训练期的最少行为小说数，默认1
+	MaxUsers       int       // 参与评估的最多读者数，0表示不限
+}
+
+// EvalMetrics 某一推荐列表长度下的评估指标
+type EvalMetrics struct {
+	K         int     `json:"k"`
+	Precision float64 `json:"precision"` // 命中数/K 的平均值
+	Recall    float64 `json:"recall"`    // 命中数/测试集小说数 的平均值
+	NDCG      float64 `json:"ndcg"`      // 二值相关性的归一化折损累计增益平均值
+	Coverage  float64 `json:"coverage"`  // 被推荐过的小说占可推荐小说的比例
+	Novelty   float64 `json:"novelty"`   // 推荐小说的平均自信息 -log2(训练期读者占比)，越大越冷门
+}
+
+// StrategyReport 单个策略的评估结果
+type StrategyReport struct {
+	Strategy   string        `json:"strategy"`
+	Users      int           `json:"users"` // 得到非空推荐列表的读者数
+	Metrics    []EvalMetrics `json:"metrics"`
+	DurationMs int64         `json:"duration_ms"`
+}
+
+// EvalReport 离线评估报告
+type EvalReport struct {
+	Cutoff      time.Time        `json:"cutoff"`
+	TrainEvents int              `json:"train_events"`
+	TestEvents  int              `json:"test_events"`
+	Users       int              `json:"users"`        // 参与评估的读者数
+	CatalogSize int              `json:"catalog_size"` // 切分时间之前已上架的小说数
+	Strategies  []StrategyReport `json:"strategies"`
+}
+
+// evalEvent 读者对一本小说的行为（开始阅读或评分）
+type evalEvent struct {
+	userID    uint
+	novelID   uint
+	at        time.Time
+	updatedAt time.Time // 阅读进度最后更新的时间
+	isRating  bool
+	progress  int
+	position  int
+	score     float64
+}
+
+// evalSnapshot 按切分时间回放得到的训练期数据
+type evalSnapshot struct {
+	cutoff     time.Time
+	catalog    []models.Novel // 切分时间之前上架的小说，点击量和平均评分替换为训练期数据
+	byID       map[uint]models.Novel
+	reading    map[uint][]models.ReadingProgress // 读者训练期的阅读历史，按时间倒序
+	ratings    map[uint][]models.Rating          // 读者训练期的评分历史，按时间倒序
+	seen       map[uint]map[uint]bool            // 读者训练期有行为的小说
+	test       map[uint]map[uint]bool            // 读者测试期新产生行为的小说
+	readers    map[uint]int                      // 每本小说训练期的读者数
+	ratingNum  map[uint]int                      // 每本小说训练期的评分数
+	trainUsers int
+	neighbors  map[uint][]models.NovelNeighbor
+}
+
+// EvaluateRecommendations 离线评估推荐策略：以切分时间之前的阅读和评分行为作为训练数据，
+// 对每位读者生成推荐列表，与其切分时间之后新阅读或评分的小说比较。
+// 小说的点击量和平均评分按训练期数据回放；用户显式偏好和不感兴趣反馈没有历史版本，不参与评估。
+func (rs *RecommendationService) EvaluateRecommendations(opts EvalOptions) (*EvalReport, error) {
+	if opts.TestRatio <= 0 || opts.TestRatio >= 1 {
+		opts.TestRatio = 0.2
+	}
+	if len(opts.Ks) == 0 {
+		opts.Ks = []int{5, 10, 20}
+	}
+	if len(opts.Strategies) == 0 {
+		opts.Strategies = EvalStrategies
+	}
+	if opts.MinTrainEvents < 1 {
+		opts.MinTrainEvents = 1
+	}
+	strategies := make(map[string]func(*evalSnapshot, uint, int) []uint)
+	for _, name := range opts.Strategies {
+		strategy := rs.evalStrategy(name)
+		if strategy == nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownEvalStrategy, name)
+		}
+		strategies[name] = strategy
+	}
+	maxK := 0
+	for _, k := range opts.Ks {
+		if k < 1 {
+			return nil, fmt.Errorf("推荐列表长度必须大于0: %d", k)
+		}
+		if k > maxK {
+			maxK = k
+		}
+	}
+
+	events, err := rs.loadEvalEvents()
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, ErrNoEvalData
+	}
+	cutoff := opts.Cutoff
+	if cutoff.IsZero() {
+		times := make([]time.Time, len(events))
+		for i, event := range events {
+			times[i] = event.at
+		}
+		sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+		cutoff = times[int(float64(len(times))*(1-opts.TestRatio))]
+	}
+
+	snapshot, report, err := rs.buildEvalSnapshot(events, cutoff)
+	if err != nil {
+		return nil, err
+	}
+
+	// 参与评估的读者：训练期有足够行为且测试期有新行为
+	users := make([]uint, 0)
+	for userID, items := range snapshot.test {
+		if len(snapshot.seen[userID]) >= opts.MinTrainEvents && len(items) > 0 {
+			users = append(users, userID)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+	if opts.MaxUsers > 0 && len(users) > opts.MaxUsers {
+		users = users[:opts.MaxUsers]
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("%w: 切分时间 %s 前后都有行为的读者为0", ErrNoEvalData, cutoff.Format(time.RFC3339))
+	}
+	report.Users = len(users)
+
+	for _, name := range opts.Strategies {
+		start := time.Now()
+		lists := make(map[uint][]uint, len(users))
+		for _, userID := range users {
+			lists[userID] = strategies[name](snapshot, userID, maxK)
+		}
+		strategyReport := StrategyReport{Strategy: name}
+		for _, list := range lists {
+			if len(list) > 0 {
+				strategyReport.Users++
+			}
+		}
+		for _, k := range opts.Ks {
+			strategyReport.Metrics = append(strategyReport.Metrics, snapshot.metrics(users, lists, k))
+		}
+		strategyReport.DurationMs = time.Since(start).Milliseconds()
+		report.Strategies = append(report.Strategies, strategyReport)
+	}
+	return report, nil
+}
+
+// loadEvalEvents 加载读者对已审核小说的阅读和评分行为，阅读行为以首次阅读时间计
+func (rs *RecommendationService) loadEvalEvents() ([]evalEvent, error) {
+	approved := rs.DB.Model(&models.Novel{}).Select("id").Where("status = ?", "approved")
+
+	var progresses []models.ReadingProgress
+	if err := rs.DB.Select("user_id, novel_id, position, progress, created_at, updated_at").
+		Where("novel_id IN (?)", approved).Find(&progresses).Error; err != nil {
+		return nil, err
+	}
+	first := make(map[[2]uint]*evalEvent)
+	for _, p := range progresses {
+		key := [2]uint{p.UserID, p.NovelID}
+		event, ok := first[key]
+		if !ok {
+			first[key] = &evalEvent{userID: p.UserID, novelID: p.NovelID, at: p.CreatedAt, updatedAt: p.UpdatedAt, progress: p.Progress, position: p.Position}
+			continue
+		}
+		if p.CreatedAt.Before(event.at) {
+			event.at = p.CreatedAt
+		}
+		if p.UpdatedAt.After(event.updatedAt) {
+			event.updatedAt = p.UpdatedAt
+		}
+		if p.Progress > event.progress {
+			event.progress, event.position = p.Progress, p.Position
+		}
+	}
+	events := make([]evalEvent, 0, len(first))
+	for _, event := range first {
+		events = append(events, *event)
+	}
+
+	var ratings []models.Rating
+	if err := rs.DB.Select("user_id, novel_id, score, created_at").
+		Where("is_approved = ? AND novel_id IN (?)", true, approved).Find(&ratings).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range ratings {
+		events = append(events, evalEvent{userID: r.UserID, novelID: r.NovelID, at: r.CreatedAt, isRating: true, score: r.Score})
+	}
+	return events, nil
+}
+
+// buildEvalSnapshot 按切分时间划分训练和测试数据，并回放训练期的小说热度
+func (rs *RecommendationService) buildEvalSnapshot(events []evalEvent, cutoff time.Time) (*evalSnapshot, *EvalReport, error) {
+	snapshot := &evalSnapshot{
+		cutoff:    cutoff,
+		byID:      make(map[uint]models.Novel),
+		reading:   make(map[uint][]models.ReadingProgress),
+		ratings:   make(map[uint][]models.Rating),
+		seen:      make(map[uint]map[uint]bool),
+		test:      make(map[uint]map[uint]bool),
+		readers:   make(map[uint]int),
+		ratingNum: make(map[uint]int),
+		neighbors: make(map[uint][]models.NovelNeighbor),
+	}
+	report := &EvalReport{Cutoff: cutoff}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].at.After(events[j].at) })
+	interactions := make(map[uint]map[uint]*userInteraction)
+	ratingSum := make(map[uint]float64)
+	for _, event := range events {
+		if !event.at.Before(cutoff) {
+			continue
+		}
+		report.TrainEvents++
+		if snapshot.seen[event.userID] == nil {
+			snapshot.seen[event.userID] = make(map[uint]bool)
+			interactions[event.userID] = make(map[uint]*userInteraction)
+		}
+		if !snapshot.seen[event.userID][event.novelID] {
+			snapshot.seen[event.userID][event.novelID] = true
+			snapshot.readers[event.novelID]++
+			interactions[event.userID][event.novelID] = &userInteraction{}
+		}
+		item := interactions[event.userID][event.novelID]
+		if event.isRating {
+			snapshot.ratings[event.userID] = append(snapshot.ratings[event.userID], models.Rating{UserID: event.userID, NovelID: event.novelID, Score: event.score})
+			snapshot.ratingNum[event.novelID]++
+			ratingSum[event.novelID] += event.score
+			item.ratingScore, item.hasRating = math.Max(item.ratingScore, event.score), true
+		} else {
+			// 切分时间之后更新过的进度包含测试期的阅读，无法还原切分时的值，只记为已开始阅读（进度0）
+			progress, position := event.progress, event.position
+			if !event.updatedAt.Before(cutoff) {
+				progress, position = 0, 0
+			}
+			snapshot.reading[event.userID] = append(snapshot.reading[event.userID], models.ReadingProgress{UserID: event.userID, NovelID: event.novelID, Position: position, Progress: progress})
+			item.progress, item.hasProgress = progress, true
+		}
+	}
+	snapshot.trainUsers = len(snapshot.seen)
+	for _, event := range events {
+		if event.at.Before(cutoff) || snapshot.seen[event.userID][event.novelID] {
+			continue
+		}
+		report.TestEvents++
+		if snapshot.test[event.userID] == nil {
+			snapshot.test[event.userID] = make(map[uint]bool)
+		}
+		snapshot.test[event.userID][event.novelID] = true
+	}
+
+	// 可推荐的小说：切分时间之前上架，点击量取训练期的点击统计，平均评分取训练期评分
+	if err := rs.DB.Preload("Categories").Preload("Keywords").
+		Where("status = ? AND created_at < ?", "approved", cutoff).Order("id ASC").
+		Find(&snapshot.catalog).Error; err != nil {
+		return nil, nil, err
+	}
+	var clicks []struct {
+		NovelID uint
+		Clicks  int
+	}
+	if err := rs.DB.Model(&models.NovelClickStat{}).
+		Select("novel_id, SUM(clicks - discounted_clicks) AS clicks").
+		Where("granularity = ? AND bucket_start < ?", ClickGranularityDay, cutoff).
+		Group("novel_id").Scan(&clicks).Error; err != nil {
+		return nil, nil, err
+	}
+	clickCounts := make(map[uint]int, len(clicks))
+	for _, c := range clicks {
+		clickCounts[c.NovelID] = c.Clicks
+	}
+	for i := range snapshot.catalog {
+		novel := &snapshot.catalog[i]
+		novel.ClickCount = clickCounts[novel.ID]
+		novel.AverageRating = 0
+		if n := snapshot.ratingNum[novel.ID]; n > 0 {
+			novel.AverageRating = ratingSum[novel.ID] / float64(n)
+		}
+		snapshot.byID[novel.ID] = *novel
+	}
+	report.CatalogSize = len(snapshot.catalog)
+
+	rows, _ := computeItemNeighbors(interactions)
+	for _, row := range rows {
+		snapshot.neighbors[row.NovelID] = append(snapshot.neighbors[row.NovelID], row)
+	}
+	return snapshot, report, nil
+}
+
+// evalStrategy 返回按训练期数据为读者生成推荐列表的函数，结果不包含读者训练期已有行为的小说
+func (rs *RecommendationService) evalStrategy(name string) func(*evalSnapshot, uint, int) []uint {
+	switch name {
+	case EvalStrategyHot:
+		var ranked []models.Novel
+		return func(s *evalSnapshot, userID uint, k int) []uint {
+			if ranked == nil {
+				// 与热门推荐相同的综合评分，点击量、平均评分和评分数量取训练期数据
+				score := func(novel models.Novel) float64 {
+					return hotScore(novel.ClickCount, novel.AverageRating, s.ratingNum[novel.ID])
+				}
+				ranked = make([]models.Novel, len(s.catalog))
+				copy(ranked, s.catalog)
+				sort.SliceStable(ranked, func(i, j int) bool { return score(ranked[i]) > score(ranked[j]) })
+			}
+			return s.unseen(userID, ranked, k)
+		}
+	case EvalStrategyNewBook:
+		var fresh []models.Novel
+		return func(s *evalSnapshot, userID uint, k int) []uint {
+			if fresh == nil {
+				// 与新书推荐相同的条件，以切分时间作为当前时间
+				fresh = make([]models.Novel, 0)
+				for _, novel := range s.catalog {
+					if isNewBook(novel.CreatedAt, s.cutoff, novel.AverageRating, s.ratingNum[novel.ID]) {
+						fresh = append(fresh, novel)
+					}
+				}
+				sort.SliceStable(fresh, func(i, j int) bool { return fresh[i].CreatedAt.After(fresh[j].CreatedAt) })
+			}
+			return s.unseen(userID, fresh, k)
+		}
+	case EvalStrategyContent:
+		return func(s *evalSnapshot, userID uint, k int) []uint {
+			// 以读者训练期最近阅读（没有阅读时取最近评分）的小说为目标
+			var targetID uint
+			if history := s.reading[userID]; len(history) > 0 {
+				targetID = history[0].NovelID
+			} else if history := s.ratings[userID]; len(history) > 0 {
+				targetID = history[0].NovelID
+			}
+			target, ok := s.byID[targetID]
+			if !ok {
+				return nil
+			}
+			candidates := make([]models.Novel, 0, len(s.catalog))
+			for _, novel := range s.catalog {
+				if !s.seen[userID][novel.ID] {
+					candidates = append(candidates, novel)
+				}
+			}
+			return novelIDsOf(rs.similarByContent(target, candidates, k))
+		}
+	case EvalStrategyCollaborative:
+		return func(s *evalSnapshot, userID uint, k int) []uint {
+			scores := s.collaborativeScores(userID, k)
+			ranked := make([]scoredNovel, 0, len(scores))
+			for id, score := range scores {
+				if novel, ok := s.byID[id]; ok {
+					ranked = append(ranked, scoredNovel{novel: novel, score: score})
+				}
+			}
+			return s.unseenScored(userID, ranked, k)
+		}
+	case EvalStrategyPersonalized:
+		return func(s *evalSnapshot, userID uint, k int) []uint {
+			// 与个性化推荐相同的流程，候选和热度均取自训练期数据
+			preferences := rs.analyzeUserPreferences(s.reading[userID], s.ratings[userID], nil, &models.UserPreference{})
+			preferred := make(map[uint]bool)
+			for _, category := range preferences.PreferredCategories {
+				preferred[category.ID] = true
+			}
+			preferredKeywords := make(map[uint]bool)
+			for _, keyword := range preferences.PreferredKeywords {
+				preferredKeywords[keyword.ID] = true
+			}
+			// 属于喜欢的分类或带有喜欢的关键词，没有任何偏好时全部作为候选
+			matches := func(novel models.Novel) bool {
+				if len(preferred) == 0 && len(preferredKeywords) == 0 {
+					return true
+				}
+				for _, id := range categoryIDsOf(novel.Categories) {
+					if preferred[id] {
+						return true
+					}
+				}
+				for _, id := range keywordIDsOf(novel.Keywords) {
+					if preferredKeywords[id] {
+						return true
+					}
+				}
+				return false
+			}
+			candidates := make([]models.Novel, 0)
+			for _, novel := range s.catalog {
+				if matches(novel) {
+					candidates = append(candidates, novel)
+				}
+			}
+			sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].ClickCount > candidates[j].ClickCount })
+			if len(candidates) > k*2 {
+				candidates = candidates[:k*2]
+			}
+
+			cfScores := s.collaborativeScores(userID, k*2)
+			existing := make(map[uint]bool, len(candidates))
+			for _, novel := range candidates {
+				existing[novel.ID] = true
+			}
+			for id := range cfScores {
+				if novel, ok := s.byID[id]; ok && !existing[id] {
+					candidates = append(candidates, novel)
+				}
+			}
+			return s.unseenScored(userID, rs.blendScores(candidates, preferences, cfScores), k)
+		}
+	}
+	return nil
+}
+
+// collaborativeScores 按训练期的相似关系计算读者的协同过滤得分
+func (s *evalSnapshot) collaborativeScores(userID uint, limit int) map[uint]float64 {
+	weights := userInteractionWeights(s.reading[userID], s.ratings[userID], nil)
+	neighbors := make([]models.NovelNeighbor, 0)
+	for novelID := range weights {
+		neighbors = append(neighbors, s.neighbors[novelID]...)
+	}
+	return neighborScores(weights, neighbors, limit)
+}
+
+// unseen 按顺序取读者训练期没有行为的前 k 本小说
+func (s *evalSnapshot) unseen(userID uint, novels []models.Novel, k int) []uint {
+	ids := make([]uint, 0, k)
+	for _, novel := range novels {
+		if len(ids) >= k {
+			break
+		}
+		if !s.seen[userID][novel.ID] {
+			ids = append(ids, novel.ID)
+		}
+	}
+	return ids
+}
+
+// unseenScored 按得分排序后取读者训练期没有行为的前 k 本小说
+func (s *evalSnapshot) unseenScored(userID uint, scores []scoredNovel, k int) []uint {
+	sort.SliceStable(scores, func(i, j int) bool {
+		if scores[i].score != scores[j].score {
+			return scores[i].score > scores[j].score
+		}
+		return scores[i].novel.ID < scores[j].novel.ID
+	})
+	novels := make([]models.Novel, len(scores))
+	for i, scored := range scores {
+		novels[i] = scored.novel
+	}
+	return s.unseen(userID, novels, k)
+}
+
+// metrics 计算推荐列表前 k 本的评估指标，没有推荐结果的读者按0计入平均值
+func (s *evalSnapshot) metrics(users []uint, lists map[uint][]uint, k int) EvalMetrics {
+	result := EvalMetrics{K: k}
+	recommended := make(map[uint]bool)
+	recommendations := 0
+	for _, userID := range users {
+		list := lists[userID]
+		if len(list) > k {
+			list = list[:k]
+		}
+		relevant := s.test[userID]
+		hits := 0
+		dcg, idcg := 0.0, 0.0
+		for i, novelID := range list {
+			if relevant[novelID] {
+				hits++
+				dcg += 1 / math.Log2(float64(i+2))
+			}
+			recommended[novelID] = true
+			result.Novelty += -math.Log2(float64(s.readers[novelID]+1) / float64(s.trainUsers+1))
+			recommendations++
+		}
+		for i := 0; i < k && i < len(relevant); i++ {
+			idcg += 1 / math.Log2(float64(i+2))
+		}
+		result.Precision += float64(hits) / float64(k)
+		result.Recall += float64(hits) / float64(len(relevant))
+		if idcg > 0 {
+			result.NDCG += dcg / idcg
+		}
+	}
+	n := float64(len(users))
+	result.Precision /= n
+	result.Recall /= n
+	result.NDCG /= n
+	if len(s.catalog) > 0 {
+		result.Coverage = float64(len(recommended)) / float64(len(s.catalog))
+	}
+	if recommendations > 0 {
+		result.Novelty /= float64(recommendations)
+	}
+	return result
+}
+
+// novelIDsOf 提取小说ID
+func novelIDsOf(novels []models.Novel) []uint {
+	ids := make([]uint, len(novels))
+	for i, novel := range novels {
+		ids[i] = novel.ID
+	}
+	return ids
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"xiaoshuo-backend/models"
+)
+
+// 推荐理由类型
+const (
+	ReasonCategory       = "category"        // 属于喜欢的分类
+	ReasonKeyword        = "keyword"         // 带有喜欢的关键词
+	ReasonSimilarContent = "similar_content" // 与读过的小说内容相似
+	ReasonSimilarReaders = "similar_readers" // 相似读者也在读
+	ReasonPopular        = "popular"         // 热门高分
+)
+
+// ScoreComponents 推荐得分的组成，各部分之和等于总分
+// 与协同过滤混合时内容部分已按混合权重归一化，被不感兴趣反馈降权时各部分已乘以降权系数
+type ScoreComponents struct {
+	Category      float64 `json:"category"`      // 分类匹配得分
+	Keyword       float64 `json:"keyword"`       // 关键词匹配得分
+	Popularity    float64 `json:"popularity"`    // 点击量热度得分
+	Rating        float64 `json:"rating"`        // 平均评分得分
+	Collaborative float64 `json:"collaborative"` // 协同过滤得分
+	Penalty       float64 `json:"penalty"`       // 降权系数，1表示未降权
+	Total         float64 `json:"total"`         // 总分
+}
+
+// scale 按比例缩放各部分得分
+func (c *ScoreComponents) scale(factor float64) {
+	c.Category *= factor
+	c.Keyword *= factor
+	c.Popularity *= factor
+	c.Rating *= factor
+	c.Collaborative *= factor
+	c.Total *= factor
+}
+
+// RecommendationReason 推荐理由
+type RecommendationReason struct {
+	Type       string   `json:"type"`
+	Message    string   `json:"message"`               // 展示给读者的理由文案
+	Score      float64  `json:"score"`                 // 该理由对应的得分
+	Categories []string `json:"categories,omitempty"`  // 匹配的分类
+	Keywords   []string `json:"keywords,omitempty"`    // 匹配的关键词
+	NovelID    uint     `json:"novel_id,omitempty"`    // 关联的已读小说
+	NovelTitle string   `json:"novel_title,omitempty"` // 关联的已读小说标题
+	Similarity float64  `json:"similarity,omitempty"`  // 与关联小说的相似度
+}
+
+// RecommendationExplanation 一本推荐小说的理由和得分组成
+type RecommendationExplanation struct {
+	NovelID    uint                   `json:"novel_id"`
+	Score      float64                `json:"score"`
+	Reason     RecommendationReason   `json:"reason"`  // 主要理由
+	Reasons    []RecommendationReason `json:"reasons"` // 全部理由，按得分从高到低
+	Components ScoreComponents        `json:"components"`
+}
+
+// ExplainedRecommendation 带推荐理由的推荐结果
+type ExplainedRecommendation struct {
+	Novel       models.Novel
+	Explanation RecommendationExplanation
+}
+
+// explainRecommendations 为推荐结果生成推荐理由
+// weights 为读者对已有行为小说的权重，用于找出与推荐小说最相关的已读小说
+func (rs *RecommendationService) explainRecommendations(scores []scoredNovel, preferences UserPreferences, weights map[uint]float64) ([]ExplainedRecommendation, error) {
+	result := make([]ExplainedRecommendation, 0, len(scores))
+	if len(scores) == 0 {
+		return result, nil
+	}
+
+	seedIDs := make([]uint, 0, len(weights))
+	for novelID := range weights {
+		seedIDs = append(seedIDs, novelID)
+	}
+	recommendedIDs := make([]uint, len(scores))
+	for i, scored := range scores {
+		recommendedIDs[i] = scored.novel.ID
+	}
+
+	seeds := make(map[uint]models.Novel)
+	// 每本推荐小说协同过滤贡献最大的已读小说
+	bestNeighbor := make(map[uint]models.NovelNeighbor)
+	if len(seedIDs) > 0 {
+		var novels []models.Novel
+		if err := rs.DB.Preload("Categories").Preload("Keywords").Where("id IN ?", seedIDs).Find(&novels).Error; err != nil {
+			return nil, err
+		}
+		for _, novel := range novels {
+			seeds[novel.ID] = novel
+		}
+
+		var neighbors []models.NovelNeighbor
+		if err := rs.DB.Where("novel_id IN ? AND neighbor_id IN ?", seedIDs, recommendedIDs).Find(&neighbors).Error; err != nil {
+			return nil, err
+		}
+		for _, neighbor := range neighbors {
+			best, ok := bestNeighbor[neighbor.NeighborID]
+			if !ok || weights[neighbor.NovelID]*neighbor.Similarity > weights[best.NovelID]*best.Similarity {
+				bestNeighbor[neighbor.NeighborID] = neighbor
+			}
+		}
+	}
+
+	for _, scored := range scores {
+		novel, components := scored.novel, scored.components
+		reasons := make([]RecommendationReason, 0)
+
+		if components.Category > 0 {
+			names := matchedCategoryNames(novel.Categories, preferences.PreferredCategories)
+			reasons = append(reasons, RecommendationReason{
+				Type:       ReasonCategory,
+				Message:    fmt.Sprintf("你喜欢的%s类小说", strings.Join(names, "、")),
+				Score:      components.Category,
+				Categories: names,
+			})
+		}
+		if components.Keyword > 0 {
+			words := matchedKeywordWords(novel.Keywords, preferences.PreferredKeywords)
+			reasons = append(reasons, RecommendationReason{
+				Type:     ReasonKeyword,
+				Message:  fmt.Sprintf("包含你喜欢的「%s」", strings.Join(words, "」「")),
+				Score:    components.Keyword,
+				Keywords: words,
+			})
+		}
+		if components.Collaborative > 0 {
+			reason := RecommendationReason{
+				Type:    ReasonSimilarReaders,
+				Message: "和你口味相似的读者也在读",
+				Score:   components.Collaborative,
+			}
+			if neighbor, ok := bestNeighbor[novel.ID]; ok {
+				if seed, ok := seeds[neighbor.NovelID]; ok {
+					reason.Message = fmt.Sprintf("读过《%s》的读者也在读", seed.Title)
+					reason.NovelID, reason.NovelTitle, reason.Similarity = seed.ID, seed.Title, neighbor.Similarity
+				}
+			}
+			reasons = append(reasons, reason)
+		}
+
+		// 内容与某本已读小说相似时，分类和关键词的匹配可以具体到这本小说
+		var similar *RecommendationReason
+		bestSimilarity := 0.0
+		for _, seed := range seeds {
+			similarity := rs.calculateContentSimilarity(seed, novel)
+			if similarity > 0.5 && (similarity > bestSimilarity || similarity == bestSimilarity && similar != nil && seed.ID < similar.NovelID) {
+				bestSimilarity = similarity
+				similar = &RecommendationReason{
+					Type:       ReasonSimilarContent,
+					Message:    fmt.Sprintf("因为你读过《%s》", seed.Title),
+					Score:      components.Category + components.Keyword,
+					NovelID:    seed.ID,
+					NovelTitle: seed.Title,
+					Similarity: similarity,
+				}
+			}
+		}
+		if similar != nil {
+			reasons = append(reasons, *similar)
+		}
+
+		if popularity := components.Popularity + components.Rating; popularity > 0 || len(reasons) == 0 {
+			reasons = append(reasons, RecommendationReason{
+				Type:    ReasonPopular,
+				Message: "热门高分小说",
+				Score:   popularity,
+			})
+		}
+
+		sort.SliceStable(reasons, func(i, j int) bool { return reasons[i].Score > reasons[j].Score })
+		primary := reasons[0]
+		if similar != nil && (primary.Type == ReasonCategory || primary.Type == ReasonKeyword) {
+			primary = *similar
+		}
+
+		result = append(result, ExplainedRecommendation{
+			Novel: novel,
+			Explanation: RecommendationExplanation{
+				NovelID:    novel.ID,
+				Score:      scored.score,
+				Reason:     primary,
+				Reasons:    reasons,
+				Components: components,
+			},
+		})
+	}
+	return result, nil
+}
+
+// matchedCategoryNames 返回小说属于的喜欢分类名称
+func matchedCategoryNames(categories, preferred []models.Category) []string {
+	names := make([]string, 0)
+	for _, category := range categories {
+		for _, p := range preferred {
+			if category.ID == p.ID {
+				names = append(names, category.Name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// matchedKeywordWords 返回小说带有的喜欢关键词
+func matchedKeywordWords(keywords, preferred []models.Keyword) []string {
+	words := make([]string, 0)
+	for _, keyword := range keywords {
+		for _, p := range preferred {
+			if keyword.ID == p.ID {
+				words = append(words, keyword.Word)
+				break
+			}
+		}
+	}
+	return words
+}
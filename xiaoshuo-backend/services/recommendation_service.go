@@ -1,8 +1,10 @@
 package services
 
 import (
+	"fmt"
 	"math"
 	"sort"
+	"time"
 	"xiaoshuo-backend/models"
 
 	"gorm.io/gorm"
@@ -11,6 +13,9 @@ import (
 // RecommendationService 推荐服务
 type RecommendationService struct {
 	DB *gorm.DB
+
+	// 协同过滤得分的混合权重，为空时使用默认权重（用于A/B实验）
+	blendWeight *float64
 }
 
 // NewRecommendationService 创建推荐服务实例
@@ -18,6 +23,20 @@ func NewRecommendationService(db *gorm.DB) *RecommendationService {
 	return &RecommendationService{DB: db}
 }
 
+// WithCFBlendWeight 返回使用指定协同过滤混合权重的推荐服务副本
+func (rs *RecommendationService) WithCFBlendWeight(weight float64) *RecommendationService {
+	weight = math.Min(math.Max(weight, 0), 1)
+	return &RecommendationService{DB: rs.DB, blendWeight: &weight}
+}
+
+// cfWeight 个性化推荐中协同过滤得分的混合权重
+func (rs *RecommendationService) cfWeight() float64 {
+	if rs.blendWeight != nil {
+		return *rs.blendWeight
+	}
+	return cfBlendWeight
+}
+
 // ContentBasedRecommendation 基于内容的推荐
 func (rs *RecommendationService) ContentBasedRecommendation(novelID uint, limit int) ([]models.Novel, error) {
 	// 获取目标小说信息
@@ -30,6 +49,11 @@ func (rs *RecommendationService) ContentBasedRecommendation(novelID uint, limit
 	var allNovels []models.Novel
 	rs.DB.Preload("Categories").Preload("Keywords").Where("status = ? AND id != ?", "approved", novelID).Find(&allNovels)
 
+	return rs.similarByContent(targetNovel, allNovels, limit), nil
+}
+
+// similarByContent 从候选小说中选出与目标小说内容相似的小说
+func (rs *RecommendationService) similarByContent(targetNovel models.Novel, allNovels []models.Novel, limit int) []models.Novel {
 	// 计算相似度并排序
 	similarNovels := make([]models.Novel, 0)
 	for _, novel := range allNovels {
@@ -49,7 +73,7 @@ func (rs *RecommendationService) ContentBasedRecommendation(novelID uint, limit
 		similarNovels = similarNovels[:limit]
 	}
 
-	return similarNovels, nil
+	return similarNovels
 }
 
 // CalculateContentSimilarityForTest 计算内容相似度（用于测试）
@@ -144,12 +168,42 @@ func (rs *RecommendationService) calculateKeywordSimilarity(keywords1, keywords2
 	return float64(sameCount) / float64(unionCount)
 }
 
+// 热门推荐综合评分的权重：点击量40% + 平均评分（×10）30% + 评分数量20%
+const (
+	hotClickWeight       = 0.4
+	hotRatingWeight      = 0.3
+	hotRatingCountWeight = 0.2
+)
+
+// 新书推荐的条件：最近7天内上架，平均评分不低于3或评分数量不少于5
+const (
+	newBookDays           = 7
+	newBookMinRating      = 3.0
+	newBookMinRatingCount = 5
+)
+
+// hotScore 热门推荐的综合评分，热门推荐查询和离线评估共用
+func hotScore(clickCount int, averageRating float64, ratingCount int) float64 {
+	return float64(clickCount)*hotClickWeight + averageRating*10*hotRatingWeight + float64(ratingCount)*hotRatingCountWeight
+}
+
+// hotScoreSQL 与 hotScore 相同的综合评分SQL表达式，参数为点击量、平均评分和评分数量的列表达式
+func hotScoreSQL(clickCount, averageRating, ratingCount string) string {
+	return fmt.Sprintf("(%s * %g + %s * 10 * %g + %s * %g)",
+		clickCount, hotClickWeight, averageRating, hotRatingWeight, ratingCount, hotRatingCountWeight)
+}
+
+// isNewBook 判断小说在 now 时是否满足新书推荐的条件，新书推荐查询和离线评估共用
+func isNewBook(createdAt, now time.Time, averageRating float64, ratingCount int) bool {
+	return !createdAt.Before(now.AddDate(0, 0, -newBookDays)) &&
+		(averageRating >= newBookMinRating || ratingCount >= newBookMinRatingCount)
+}
+
 // HotRecommendation 热门推荐算法
 func (rs *RecommendationService) HotRecommendation(limit int) ([]models.Novel, error) {
 	var novels []models.Novel
 	
-	// 基于点击量、评分、评论数等综合评分推荐
-	// 计算综合评分：点击量权重40% + 平均评分权重30% + 评论数量权重20% + 上传时间权重10%
+	// 基于点击量、评分、评分数量的综合评分推荐（见 hotScore）
 	err := rs.DB.Raw(`
 		SELECT 
 			n.*,
@@ -159,10 +213,7 @@ func (rs *RecommendationService) HotRecommendation(limit int) ([]models.Novel, e
 		LEFT JOIN ratings r ON n.id = r.novel_id
 		WHERE n.status = 'approved'
 		GROUP BY n.id
-		ORDER BY 
-			(n.click_count * 0.4 + 
-			COALESCE(AVG(r.score), 0) * 10 * 0.3 + 
-			COUNT(r.id) * 0.2) DESC
+		ORDER BY `+hotScoreSQL("n.click_count", "COALESCE(AVG(r.score), 0)", "COUNT(r.id)")+` DESC
 		LIMIT ?
 	`, limit).Scan(&novels).Error
 	
@@ -177,7 +228,7 @@ func (rs *RecommendationService) HotRecommendation(limit int) ([]models.Novel, e
 func (rs *RecommendationService) NewBookRecommendation(limit int) ([]models.Novel, error) {
 	var novels []models.Novel
 	
-	// 获取最近7天内上传且审核通过的小说，评分高于3星或评分数量超过5条
+	// 获取满足新书条件（见 isNewBook）且审核通过的小说
 	err := rs.DB.Raw(`
 		SELECT 
 			n.*,
@@ -186,12 +237,12 @@ func (rs *RecommendationService) NewBookRecommendation(limit int) ([]models.Nove
 		FROM novels n
 		LEFT JOIN ratings r ON n.id = r.novel_id
 		WHERE n.status = 'approved' 
-			AND n.created_at >= DATE_SUB(NOW(), INTERVAL 7 DAY)
+			AND n.created_at >= ?
 		GROUP BY n.id
-		HAVING COALESCE(AVG(r.score), 0) >= 3.0 OR COUNT(r.id) >= 5
+		HAVING COALESCE(AVG(r.score), 0) >= ? OR COUNT(r.id) >= ?
 		ORDER BY n.created_at DESC
 		LIMIT ?
-	`, limit).Scan(&novels).Error
+	`, time.Now().AddDate(0, 0, -newBookDays), newBookMinRating, newBookMinRatingCount, limit).Scan(&novels).Error
 	
 	if err != nil {
 		return nil, err
@@ -202,6 +253,19 @@ func (rs *RecommendationService) NewBookRecommendation(limit int) ([]models.Nove
 
 // PersonalizedRecommendation 个性化推荐算法
 func (rs *RecommendationService) PersonalizedRecommendation(userID uint, limit int) ([]models.Novel, error) {
+	recommendations, err := rs.ExplainedPersonalizedRecommendation(userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	novels := make([]models.Novel, len(recommendations))
+	for i, recommendation := range recommendations {
+		novels[i] = recommendation.Novel
+	}
+	return novels, nil
+}
+
+// ExplainedPersonalizedRecommendation 个性化推荐，并给出每本小说的推荐理由和得分组成
+func (rs *RecommendationService) ExplainedPersonalizedRecommendation(userID uint, limit int) ([]ExplainedRecommendation, error) {
 	// 获取用户阅读历史和偏好
 	var readingHistory []models.ReadingProgress
 	rs.DB.Where("user_id = ?", userID).Order("updated_at DESC").Limit(20).Find(&readingHistory)
@@ -212,43 +276,83 @@ func (rs *RecommendationService) PersonalizedRecommendation(userID uint, limit i
 	var commentHistory []models.Comment
 	rs.DB.Where("user_id = ?", userID).Preload("Novel").Order("created_at DESC").Limit(20).Find(&commentHistory)
 
+	// 用户显式设置的偏好，与阅读行为推断的偏好合并
+	profile, err := NewUserPreferenceService(rs.DB).GetPreference(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 用户标记为不感兴趣的小说
+	var notInterested []models.Novel
+	rs.DB.Preload("Categories").Preload("Keywords").
+		Joins("JOIN recommendation_feedbacks ON recommendation_feedbacks.novel_id = novels.id AND recommendation_feedbacks.deleted_at IS NULL").
+		Where("recommendation_feedbacks.user_id = ? AND recommendation_feedbacks.type = ?", userID, FeedbackNotInterested).
+		Order("recommendation_feedbacks.updated_at DESC").Limit(50).Find(&notInterested)
+	excludedIDs := make([]uint, 0, len(notInterested))
+	for _, novel := range notInterested {
+		excludedIDs = append(excludedIDs, novel.ID)
+	}
+
 	// 分析用户偏好
-	userPreferences := rs.analyzeUserPreferences(readingHistory, ratingHistory, commentHistory)
+	userPreferences := rs.analyzeUserPreferences(readingHistory, ratingHistory, commentHistory, profile)
 
 	// 获取推荐候选小说
 	var candidateNovels []models.Novel
 	query := rs.DB.Where("status = 'approved'")
 
-	// 根据用户偏好过滤小说
-	if len(userPreferences.PreferredCategories) > 0 {
-		var categoryIDs []uint
-		for _, cat := range userPreferences.PreferredCategories {
-			categoryIDs = append(categoryIDs, cat.ID)
-		}
-		query = query.Joins("JOIN novel_categories ON novels.id = novel_categories.novel_id").
-			Where("novel_categories.category_id IN ?", categoryIDs)
+	// 根据用户偏好过滤小说：属于喜欢的分类或带有喜欢的关键词
+	categoryIDs := categoryIDsOf(userPreferences.PreferredCategories)
+	keywordIDs := keywordIDsOf(userPreferences.PreferredKeywords)
+	categoryNovels := rs.DB.Table("novel_categories").Select("novel_id").Where("category_id IN ?", categoryIDs)
+	keywordNovels := rs.DB.Table("novel_keywords").Select("novel_id").Where("keyword_id IN ?", keywordIDs)
+	switch {
+	case len(categoryIDs) > 0 && len(keywordIDs) > 0:
+		query = query.Where("novels.id IN (?) OR novels.id IN (?)", categoryNovels, keywordNovels)
+	case len(categoryIDs) > 0:
+		query = query.Where("novels.id IN (?)", categoryNovels)
+	case len(keywordIDs) > 0:
+		query = query.Where("novels.id IN (?)", keywordNovels)
 	}
 
-	if len(userPreferences.PreferredKeywords) > 0 {
-		var keywordIDs []uint
-		for _, kw := range userPreferences.PreferredKeywords {
-			keywordIDs = append(keywordIDs, kw.ID)
-		}
-		query = query.Joins("JOIN novel_keywords ON novels.id = novel_keywords.novel_id").
-			Where("novel_keywords.keyword_id IN ?", keywordIDs)
+	// 排除不喜欢的分类、关键词和不感兴趣的小说
+	if dislikedIDs := categoryIDsOf(userPreferences.DislikedCategories); len(dislikedIDs) > 0 {
+		query = query.Where("novels.id NOT IN (?)", rs.DB.Table("novel_categories").Select("novel_id").Where("category_id IN ?", dislikedIDs))
+	}
+	if dislikedIDs := keywordIDsOf(userPreferences.DislikedKeywords); len(dislikedIDs) > 0 {
+		query = query.Where("novels.id NOT IN (?)", rs.DB.Table("novel_keywords").Select("novel_id").Where("keyword_id IN ?", dislikedIDs))
+	}
+	if len(excludedIDs) > 0 {
+		query = query.Where("novels.id NOT IN ?", excludedIDs)
 	}
 
-	query.Preload("UploadUser").Preload("Categories").Preload("Keywords").Limit(limit * 2).Find(&candidateNovels)
+	// 没有任何偏好的新用户按热度取候选
+	query.Preload("UploadUser").Preload("Categories").Preload("Keywords").Order("click_count DESC").Limit(limit * 2).Find(&candidateNovels)
+
+	// 协同过滤：由读者行为相似的小说补充候选，并与内容得分混合
+	interactionWeights := userInteractionWeights(readingHistory, ratingHistory, commentHistory)
+	cfScores, err := rs.collaborativeScores(interactionWeights, limit*2)
+	if err != nil {
+		return nil, err
+	}
+	candidateNovels, err = rs.appendCandidates(candidateNovels, cfScores)
+	if err != nil {
+		return nil, err
+	}
 
 	// 对候选小说进行评分排序
-	scores := make([]struct {
-		novel models.Novel
-		score float64
-	}, len(candidateNovels))
+	scores := rs.blendScores(candidateNovels, userPreferences, cfScores)
 
-	for i, novel := range candidateNovels {
-		scores[i].novel = novel
-		scores[i].score = rs.calculatePersonalizedScore(novel, userPreferences)
+	// 与不感兴趣的小说相似的候选降低权重
+	similarToExcluded, err := rs.similarNovelIDs(excludedIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range scores {
+		if similarToExcluded[scores[i].novel.ID] || rs.resemblesAny(scores[i].novel, notInterested) {
+			scores[i].components.scale(notInterestedPenalty)
+			scores[i].components.Penalty = notInterestedPenalty
+			scores[i].score = scores[i].components.Total
+		}
 	}
 
 	// 按评分排序
@@ -257,7 +361,7 @@ func (rs *RecommendationService) PersonalizedRecommendation(userID uint, limit i
 	})
 
 	// 返回最高评分的小说
-	result := make([]models.Novel, 0, limit)
+	result := make([]scoredNovel, 0, limit)
 	for i := 0; i < len(scores) && len(result) < limit; i++ {
 		// 确保不推荐用户已经阅读过的小说
 		alreadyRead := false
@@ -267,20 +371,59 @@ func (rs *RecommendationService) PersonalizedRecommendation(userID uint, limit i
 				break
 			}
 		}
-		if !alreadyRead {
-			result = append(result, scores[i].novel)
+		if !alreadyRead && !userPreferences.excludes(scores[i].novel, excludedIDs) {
+			result = append(result, scores[i])
 		}
 	}
 
-	return result, nil
+	return rs.explainRecommendations(result, userPreferences, interactionWeights)
+}
+
+// scoredNovel 带得分的候选小说
+type scoredNovel struct {
+	novel      models.Novel
+	score      float64
+	components ScoreComponents
+}
+
+// blendScores 计算候选小说的内容得分，存在协同过滤得分时两者分别归一化后加权
+func (rs *RecommendationService) blendScores(candidates []models.Novel, preferences UserPreferences, cfScores map[uint]float64) []scoredNovel {
+	scores := make([]scoredNovel, len(candidates))
+	maxContent, maxCF := 0.0, 0.0
+	for i, novel := range candidates {
+		scores[i].novel = novel
+		scores[i].components = rs.personalizedComponents(novel, preferences)
+		scores[i].score = scores[i].components.Total
+		maxContent = math.Max(maxContent, scores[i].score)
+		maxCF = math.Max(maxCF, cfScores[novel.ID])
+	}
+	if maxCF > 0 {
+		// 内容得分的各组成部分按同一比例缩放，使各部分之和仍等于总分
+		weight := rs.cfWeight()
+		contentScale := 0.0
+		if maxContent > 0 {
+			contentScale = (1 - weight) / maxContent
+		}
+		for i := range scores {
+			components := &scores[i].components
+			components.scale(contentScale)
+			components.Collaborative = weight * cfScores[scores[i].novel.ID] / maxCF
+			components.Total += components.Collaborative
+			scores[i].score = components.Total
+		}
+	}
+	return scores
 }
 
 // analyzeUserPreferences 分析用户偏好
-func (rs *RecommendationService) analyzeUserPreferences(readingHistory []models.ReadingProgress, ratingHistory []models.Rating, commentHistory []models.Comment) UserPreferences {
+func (rs *RecommendationService) analyzeUserPreferences(readingHistory []models.ReadingProgress, ratingHistory []models.Rating, commentHistory []models.Comment, profile *models.UserPreference) UserPreferences {
 	preferences := UserPreferences{
 		PreferredCategories: make([]models.Category, 0),
 		PreferredKeywords:   make([]models.Keyword, 0),
+		DislikedCategories:  profile.DislikedCategories,
+		DislikedKeywords:    profile.DislikedKeywords,
 	}
+	preferences.PreferredKeywords = append(preferences.PreferredKeywords, profile.PreferredKeywords...)
 
 	// 统计用户阅读历史中的分类偏好
 	categoryScores := make(map[uint]float64)
@@ -307,6 +450,14 @@ func (rs *RecommendationService) analyzeUserPreferences(readingHistory []models.
 		}
 	}
 
+	// 合并用户显式设置的偏好：喜欢的分类加分，不喜欢的分类不作为偏好
+	for _, category := range profile.PreferredCategories {
+		categoryScores[category.ID] += explicitPreferenceScore
+	}
+	for _, category := range profile.DislikedCategories {
+		delete(categoryScores, category.ID)
+	}
+
 	// 将分类按得分排序
 	type categoryScore struct {
 		ID    uint
@@ -320,8 +471,12 @@ func (rs *RecommendationService) analyzeUserPreferences(readingHistory []models.
 		return sortedCategories[i].Score > sortedCategories[j].Score
 	})
 
-	// 获取得分最高的分类作为用户偏好
-	for i := 0; i < len(sortedCategories) && i < 5; i++ {
+	// 获取得分最高的分类作为用户偏好，显式喜欢的分类全部保留
+	maxCategories := 5
+	if len(profile.PreferredCategories) > maxCategories {
+		maxCategories = len(profile.PreferredCategories)
+	}
+	for i := 0; i < len(sortedCategories) && i < maxCategories; i++ {
 		var category models.Category
 		if rs.DB.First(&category, sortedCategories[i].ID).Error == nil {
 			preferences.PreferredCategories = append(preferences.PreferredCategories, category)
@@ -333,13 +488,18 @@ func (rs *RecommendationService) analyzeUserPreferences(readingHistory []models.
 
 // calculatePersonalizedScore 计算个性化评分
 func (rs *RecommendationService) calculatePersonalizedScore(novel models.Novel, preferences UserPreferences) float64 {
-	score := 0.0
+	return rs.personalizedComponents(novel, preferences).Total
+}
+
+// personalizedComponents 计算个性化评分的各组成部分
+func (rs *RecommendationService) personalizedComponents(novel models.Novel, preferences UserPreferences) ScoreComponents {
+	components := ScoreComponents{Penalty: 1}
 
 	// 匹配分类偏好
 	for _, userCat := range preferences.PreferredCategories {
 		for _, novelCat := range novel.Categories {
 			if userCat.ID == novelCat.ID {
-				score += 30.0 // 分类匹配给高分
+				components.Category += 30.0 // 分类匹配给高分
 				break
 			}
 		}
@@ -349,21 +509,109 @@ func (rs *RecommendationService) calculatePersonalizedScore(novel models.Novel,
 	for _, userKw := range preferences.PreferredKeywords {
 		for _, novelKw := range novel.Keywords {
 			if userKw.ID == novelKw.ID {
-				score += 20.0 // 关键词匹配给中等分数
+				components.Keyword += 20.0 // 关键词匹配给中等分数
 				break
 			}
 		}
 	}
 
 	// 基于点击量和评分的热度分
-	score += math.Min(float64(novel.ClickCount)/1000.0, 20.0) // 点击量分
-	score += novel.AverageRating * 2.0 // 评分分，直接使用float64值
+	components.Popularity = math.Min(float64(novel.ClickCount)/1000.0, 20.0) // 点击量分
+	components.Rating = novel.AverageRating * 2.0                             // 评分分，直接使用float64值
 
-	return score
+	components.Total = components.Category + components.Keyword + components.Popularity + components.Rating
+	return components
 }
 
 // UserPreferences 用户偏好结构
 type UserPreferences struct {
 	PreferredCategories []models.Category
 	PreferredKeywords   []models.Keyword
-}
\ No newline at end of file
+	DislikedCategories  []models.Category
+	DislikedKeywords    []models.Keyword
+}
+
+const (
+	explicitPreferenceScore = 20.0 // 用户显式喜欢的分类在偏好分析中的加分
+	notInterestedPenalty    = 0.5  // 与不感兴趣小说相似的候选的得分系数
+	notInterestedSimilarity = 0.6  // 内容相似度达到该值视为与不感兴趣的小说相似
+	notInterestedNeighbor   = 0.2  // 协同过滤相似度达到该值视为与不感兴趣的小说相似
+)
+
+// excludes 判断小说是否属于用户不喜欢的分类、关键词或已标记为不感兴趣
+func (p UserPreferences) excludes(novel models.Novel, excludedIDs []uint) bool {
+	for _, id := range excludedIDs {
+		if novel.ID == id {
+			return true
+		}
+	}
+	for _, disliked := range p.DislikedCategories {
+		for _, category := range novel.Categories {
+			if category.ID == disliked.ID {
+				return true
+			}
+		}
+	}
+	for _, disliked := range p.DislikedKeywords {
+		for _, keyword := range novel.Keywords {
+			if keyword.ID == disliked.ID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// similarNovelIDs 获取与给定小说协同过滤相似的小说
+func (rs *RecommendationService) similarNovelIDs(novelIDs []uint) (map[uint]bool, error) {
+	similar := make(map[uint]bool)
+	if len(novelIDs) == 0 {
+		return similar, nil
+	}
+	var neighborIDs []uint
+	if err := rs.DB.Model(&models.NovelNeighbor{}).
+		Where("novel_id IN ? AND similarity >= ?", novelIDs, notInterestedNeighbor).
+		Pluck("neighbor_id", &neighborIDs).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range neighborIDs {
+		similar[id] = true
+	}
+	return similar, nil
+}
+
+// resemblesAny 判断小说的内容是否与给定小说中的任意一本相似
+func (rs *RecommendationService) resemblesAny(novel models.Novel, others []models.Novel) bool {
+	for _, other := range others {
+		// 作者为空的小说不按作者判断相似
+		if novel.Author != "" && novel.Author == other.Author {
+			return true
+		}
+		// 没有分类和关键词的小说无法比较内容
+		if len(other.Categories) == 0 && len(other.Keywords) == 0 {
+			continue
+		}
+		if rs.calculateContentSimilarity(novel, other) >= notInterestedSimilarity {
+			return true
+		}
+	}
+	return false
+}
+
+// categoryIDsOf 提取分类ID
+func categoryIDsOf(categories []models.Category) []uint {
+	ids := make([]uint, len(categories))
+	for i, category := range categories {
+		ids[i] = category.ID
+	}
+	return ids
+}
+
+// keywordIDsOf 提取关键词ID
+func keywordIDsOf(keywords []models.Keyword) []uint {
+	ids := make([]uint, len(keywords))
+	for i, keyword := range keywords {
+		ids[i] = keyword.ID
+	}
+	return ids
+}
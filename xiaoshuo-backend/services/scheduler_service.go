@@ -0,0 +1,311 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// 定时任务触发方式
+const (
+	JobTriggerSchedule = "schedule"
+	JobTriggerManual   = "manual"
+)
+
+// 定时任务运行状态
+const (
+	JobRunStatusRunning = "running"
+	JobRunStatusSuccess = "success"
+	JobRunStatusFailed  = "failed"
+)
+
+// ErrJobNotFound 定时任务不存在
+var ErrJobNotFound = errors.New("定时任务不存在")
+
+// ErrJobRunning 定时任务正在运行（可能在其他实例上）
+var ErrJobRunning = errors.New("定时任务正在运行")
+
+// ScheduledJob 定时任务定义
+type ScheduledJob struct {
+	Name        string                                    // 任务名称，唯一
+	Description string                                    // 任务说明
+	Spec        string                                    // cron表达式（分 时 日 月 周）
+	Timeout     time.Duration                             // 运行超时时间，同时作为运行锁的有效期
+	Run         func(ctx context.Context) (string, error) // 任务逻辑，返回运行结果摘要
+
+	schedule *utils.CronSchedule
+}
+
+// ScheduledJobStatus 定时任务状态
+type ScheduledJobStatus struct {
+	Name        string                  `json:"name"`
+	Description string                  `json:"description"`
+	Spec        string                  `json:"spec"`
+	NextRunAt   time.Time               `json:"next_run_at"`
+	LastRun     *models.ScheduledJobRun `json:"last_run"`
+}
+
+// Scheduler 进程内定时任务调度器
+// 每个任务按cron表达式触发；多实例部署时通过Redis锁选出一个实例执行，运行记录保存在数据库中
+type Scheduler struct {
+	DB       *gorm.DB
+	instance string
+
+	mu     sync.Mutex
+	jobs   map[string]*ScheduledJob
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewScheduler 创建调度器实例
+func NewScheduler(db *gorm.DB) *Scheduler {
+	hostname, _ := os.Hostname()
+	return &Scheduler{
+		DB:       db,
+		instance: fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		jobs:     make(map[string]*ScheduledJob),
+	}
+}
+
+// Register 注册定时任务，需在 Start 之前调用
+func (s *Scheduler) Register(job ScheduledJob) error {
+	schedule, err := utils.ParseCronExpression(job.Spec)
+	if err != nil {
+		return err
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = 30 * time.Minute
+	}
+	job.schedule = schedule
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.jobs[job.Name]; exists {
+		return fmt.Errorf("定时任务 %s 重复注册", job.Name)
+	}
+	s.jobs[job.Name] = &job
+	return nil
+}
+
+// Start 为每个任务启动调度协程
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	now := time.Now()
+	for _, job := range s.jobs {
+		// 超过超时时间仍处于运行中的记录说明执行实例已中断，标记为失败
+		s.DB.Model(&models.ScheduledJobRun{}).
+			Where("job_name = ? AND status = ? AND started_at < ?", job.Name, JobRunStatusRunning, now.Add(-job.Timeout)).
+			Updates(map[string]interface{}{"status": JobRunStatusFailed, "finished_at": now, "error": "运行超时或实例中断"})
+
+		s.wg.Add(1)
+		go s.loop(ctx, job)
+	}
+}
+
+// Stop 停止调度，等待调度协程退出
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.cancel = nil
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		s.wg.Wait()
+	}
+}
+
+// loop 等待任务的下一个触发时间并执行
+func (s *Scheduler) loop(ctx context.Context, job *ScheduledJob) {
+	defer s.wg.Done()
+	for {
+		next := job.schedule.Next(time.Now())
+		if next.IsZero() {
+			log.Printf("定时任务 %s 没有下一次触发时间，停止调度", job.Name)
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		// 同一触发时间只允许一个实例执行
+		slotKey := fmt.Sprintf("scheduler:slot:%s:%d", job.Name, next.Unix())
+		if acquired, err := s.acquire(slotKey, job.Timeout+time.Hour); err != nil {
+			log.Printf("定时任务 %s 获取调度锁失败: %v", job.Name, err)
+			continue
+		} else if !acquired {
+			continue
+		}
+
+		if _, err := s.execute(ctx, job, JobTriggerSchedule, 0, false); err != nil && !errors.Is(err, ErrJobRunning) {
+			log.Printf("定时任务 %s 运行失败: %v", job.Name, err)
+		}
+	}
+}
+
+// Trigger 手动触发任务，任务在后台运行，立即返回运行记录
+func (s *Scheduler) Trigger(name string, adminUserID uint) (*models.ScheduledJobRun, error) {
+	s.mu.Lock()
+	job, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return s.execute(context.Background(), job, JobTriggerManual, adminUserID, true)
+}
+
+// execute 获取运行锁并执行任务，async 为 true 时创建运行记录后在后台执行
+func (s *Scheduler) execute(ctx context.Context, job *ScheduledJob, trigger string, triggeredBy uint, async bool) (*models.ScheduledJobRun, error) {
+	// 运行锁防止同一任务在多个实例或手动触发时并发执行
+	runningKey := "scheduler:running:" + job.Name
+	acquired, err := s.acquire(runningKey, job.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, ErrJobRunning
+	}
+
+	run := models.ScheduledJobRun{
+		JobName:     job.Name,
+		Trigger:     trigger,
+		TriggeredBy: triggeredBy,
+		Instance:    s.instance,
+		Status:      JobRunStatusRunning,
+		StartedAt:   time.Now(),
+	}
+	if err := s.DB.Create(&run).Error; err != nil {
+		s.release(runningKey)
+		return nil, err
+	}
+
+	finish := func() {
+		defer s.release(runningKey)
+
+		runCtx, cancel := context.WithTimeout(ctx, job.Timeout)
+		defer cancel()
+		result, runErr := safeRunJob(runCtx, job)
+
+		finishedAt := time.Now()
+		updates := map[string]interface{}{
+			"status":      JobRunStatusSuccess,
+			"finished_at": finishedAt,
+			"duration_ms": finishedAt.Sub(run.StartedAt).Milliseconds(),
+			"result":      result,
+		}
+		if runErr != nil {
+			updates["status"] = JobRunStatusFailed
+			updates["error"] = runErr.Error()
+			log.Printf("定时任务 %s 运行失败: %v", job.Name, runErr)
+		}
+		if err := s.DB.Model(&run).Updates(updates).Error; err != nil {
+			log.Printf("定时任务 %s 保存运行记录失败: %v", job.Name, err)
+		}
+	}
+
+	if async {
+		go finish()
+	} else {
+		finish()
+	}
+	return &run, nil
+}
+
+// safeRunJob 运行任务并将panic转换为错误
+func safeRunJob(ctx context.Context, job *ScheduledJob) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("任务异常: %v", r)
+		}
+	}()
+	return job.Run(ctx)
+}
+
+// acquire 获取Redis锁，未初始化缓存（单实例部署）时直接视为获取成功
+func (s *Scheduler) acquire(key string, ttl time.Duration) (bool, error) {
+	if utils.GlobalCache == nil {
+		return true, nil
+	}
+	return utils.GlobalCache.AcquireLock(key, s.instance, ttl)
+}
+
+// release 释放本实例持有的Redis锁
+func (s *Scheduler) release(key string) {
+	if utils.GlobalCache == nil {
+		return
+	}
+	if err := utils.GlobalCache.ReleaseLock(key, s.instance); err != nil {
+		log.Printf("释放定时任务锁 %s 失败: %v", key, err)
+	}
+}
+
+// ListJobs 列出全部任务及其下一次触发时间和最近一次运行记录
+func (s *Scheduler) ListJobs() ([]ScheduledJobStatus, error) {
+	s.mu.Lock()
+	jobs := make([]*ScheduledJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	s.mu.Unlock()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+
+	now := time.Now()
+	statuses := make([]ScheduledJobStatus, len(jobs))
+	for i, job := range jobs {
+		statuses[i] = ScheduledJobStatus{
+			Name:        job.Name,
+			Description: job.Description,
+			Spec:        job.Spec,
+			NextRunAt:   job.schedule.Next(now),
+		}
+		var lastRun models.ScheduledJobRun
+		err := s.DB.Where("job_name = ?", job.Name).Order("started_at DESC").First(&lastRun).Error
+		if err == nil {
+			statuses[i].LastRun = &lastRun
+		} else if err != gorm.ErrRecordNotFound {
+			return nil, err
+		}
+	}
+	return statuses, nil
+}
+
+// GetJobRuns 分页获取任务的运行记录，按开始时间倒序
+func (s *Scheduler) GetJobRuns(name string, page, limit int) ([]models.ScheduledJobRun, int64, error) {
+	s.mu.Lock()
+	_, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, 0, ErrJobNotFound
+	}
+
+	var runs []models.ScheduledJobRun
+	var total int64
+	query := s.DB.Model(&models.ScheduledJobRun{}).Where("job_name = ?", name)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * limit
+	if err := query.Order("started_at DESC").Offset(offset).Limit(limit).Find(&runs).Error; err != nil {
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
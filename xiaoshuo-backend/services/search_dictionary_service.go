@@ -0,0 +1,207 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidSynonym 同义词组无效
+var ErrInvalidSynonym = errors.New("同义词组无效")
+
+const (
+	maxSynonymWordLen       = 50   // 同义词的最大字数
+	maxSuggestionSearchStat = 5000 // 纠错建议最多使用的热门搜索词数量
+)
+
+// SearchDictionaryService 搜索词典服务，管理同义词并维护纠错建议的候选词
+// 同义词和候选词保存在各实例内存中，后台协程定期从数据库刷新，多实例部署时修改在一个刷新周期内生效
+type SearchDictionaryService struct {
+	DB              *gorm.DB
+	refreshInterval time.Duration
+	startOnce       sync.Once
+}
+
+// NewSearchDictionaryService 创建搜索词典服务实例
+func NewSearchDictionaryService(db *gorm.DB) *SearchDictionaryService {
+	return &SearchDictionaryService{DB: db, refreshInterval: 5 * time.Minute}
+}
+
+// Start 加载同义词和候选词，并启动后台定期刷新
+func (s *SearchDictionaryService) Start() {
+	s.startOnce.Do(func() {
+		go func() {
+			for {
+				if err := s.Refresh(); err != nil {
+					log.Printf("刷新搜索词典失败: %v", err)
+				}
+				time.Sleep(s.refreshInterval)
+			}
+		}()
+	})
+}
+
+// Refresh 从数据库重新加载同义词和纠错建议候选词
+func (s *SearchDictionaryService) Refresh() error {
+	if err := LoadSearchSynonyms(s.DB); err != nil {
+		return err
+	}
+	return LoadSuggestionCandidates(s.DB)
+}
+
+// LoadSearchSynonyms 加载全部同义词组
+func LoadSearchSynonyms(db *gorm.DB) error {
+	var rows []models.SearchSynonym
+	if err := db.Select("words").Find(&rows).Error; err != nil {
+		return err
+	}
+	groups := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		groups = append(groups, strings.Split(row.Words, ","))
+	}
+	utils.SetSearchSynonyms(groups)
+	return nil
+}
+
+// LoadSuggestionCandidates 以已审核小说的标题、作者和热门搜索词作为纠错建议的候选词
+// 标题和作者以小说点击量为权重，搜索词以搜索次数为权重
+func LoadSuggestionCandidates(db *gorm.DB) error {
+	var novels []models.Novel
+	if err := db.Select("title", "author", "click_count").Where("status = ?", "approved").Find(&novels).Error; err != nil {
+		return err
+	}
+	candidates := make([]utils.SuggestionCandidate, 0, len(novels)*2)
+	for _, novel := range novels {
+		candidates = append(candidates,
+			utils.SuggestionCandidate{Text: novel.Title, Weight: float64(novel.ClickCount)},
+			utils.SuggestionCandidate{Text: novel.Author, Weight: float64(novel.ClickCount)},
+		)
+	}
+
+	// 搜索统计表由搜索接口写入，尚未创建时只使用标题和作者
+	if db.Migrator().HasTable("search_stats") {
+		var stats []struct {
+			Keyword string
+			Count   int
+		}
+		if err := db.Table("search_stats").Select("keyword", "count").
+			Order("count DESC").Limit(maxSuggestionSearchStat).Find(&stats).Error; err != nil {
+			return err
+		}
+		for _, stat := range stats {
+			candidates = append(candidates, utils.SuggestionCandidate{Text: stat.Keyword, Weight: float64(stat.Count)})
+		}
+	}
+
+	utils.SetSuggestionCandidates(candidates)
+	return nil
+}
+
+// ListSynonyms 分页获取同义词组，keyword 不为空时只返回包含该词的组
+func (s *SearchDictionaryService) ListSynonyms(keyword string, page, limit int) ([]models.SearchSynonym, int64, error) {
+	query := s.DB.Model(&models.SearchSynonym{})
+	if keyword = strings.TrimSpace(keyword); keyword != "" {
+		query = query.Where("words LIKE ?", "%"+keyword+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var synonyms []models.SearchSynonym
+	if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&synonyms).Error; err != nil {
+		return nil, 0, err
+	}
+	return synonyms, total, nil
+}
+
+// CreateSynonym 创建同义词组，创建后立即在本实例生效
+func (s *SearchDictionaryService) CreateSynonym(words []string, adminUserID uint) (*models.SearchSynonym, error) {
+	joined, err := joinSynonymWords(words)
+	if err != nil {
+		return nil, err
+	}
+	synonym := models.SearchSynonym{Words: joined, CreatedByID: adminUserID}
+	if err := s.DB.Create(&synonym).Error; err != nil {
+		return nil, err
+	}
+	s.reloadSynonyms()
+	return &synonym, nil
+}
+
+// UpdateSynonym 修改同义词组的词语
+func (s *SearchDictionaryService) UpdateSynonym(id uint, words []string) (*models.SearchSynonym, error) {
+	joined, err := joinSynonymWords(words)
+	if err != nil {
+		return nil, err
+	}
+	var synonym models.SearchSynonym
+	if err := s.DB.First(&synonym, id).Error; err != nil {
+		return nil, err
+	}
+	if err := s.DB.Model(&synonym).Update("words", joined).Error; err != nil {
+		return nil, err
+	}
+	s.reloadSynonyms()
+	return &synonym, nil
+}
+
+// DeleteSynonym 删除同义词组，返回被删除的同义词组
+func (s *SearchDictionaryService) DeleteSynonym(id uint) (*models.SearchSynonym, error) {
+	var synonym models.SearchSynonym
+	if err := s.DB.First(&synonym, id).Error; err != nil {
+		return nil, err
+	}
+	if err := s.DB.Delete(&synonym).Error; err != nil {
+		return nil, err
+	}
+	s.reloadSynonyms()
+	return &synonym, nil
+}
+
+// reloadSynonyms 同义词修改后重新加载，失败时等待下次定期刷新
+func (s *SearchDictionaryService) reloadSynonyms() {
+	if err := LoadSearchSynonyms(s.DB); err != nil {
+		log.Printf("重新加载同义词失败: %v", err)
+	}
+}
+
+// joinSynonymWords 校验同义词并以逗号连接，规范化后相同的词只保留一个
+func joinSynonymWords(words []string) (string, error) {
+	seen := make(map[string]bool, len(words))
+	kept := make([]string, 0, len(words))
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+		if word == "" {
+			continue
+		}
+		if strings.ContainsAny(word, ",，") {
+			return "", fmt.Errorf("%w: 同义词 %s 不能包含逗号", ErrInvalidSynonym, word)
+		}
+		if utf8.RuneCountInString(word) > maxSynonymWordLen {
+			return "", fmt.Errorf("%w: 同义词 %s 超过%d个字", ErrInvalidSynonym, word, maxSynonymWordLen)
+		}
+		normalized := utils.NormalizeSearchText(word)
+		if seen[normalized] {
+			continue
+		}
+		seen[normalized] = true
+		kept = append(kept, word)
+	}
+	if len(kept) < 2 {
+		return "", fmt.Errorf("%w: 至少需要两个不同的词", ErrInvalidSynonym)
+	}
+	joined := strings.Join(kept, ",")
+	if utf8.RuneCountInString(joined) > 500 {
+		return "", fmt.Errorf("%w: 同义词组总长度超过500个字", ErrInvalidSynonym)
+	}
+	return joined, nil
+}
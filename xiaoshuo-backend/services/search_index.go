@@ -0,0 +1,133 @@
+package services
+
+import (
+	"log"
+	"time"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// PrepareSearchIndex 启动时加载分词词典，索引为新建（映射版本变化）时从数据库重建
+func PrepareSearchIndex(db *gorm.DB) {
+	if utils.GlobalSearchIndex == nil {
+		return
+	}
+	if err := LoadSearchDictionary(db); err != nil {
+		log.Printf("加载搜索分词词典失败: %v", err)
+	}
+	if !utils.GlobalSearchIndex.NeedsRebuild() {
+		return
+	}
+
+	log.Println("搜索索引映射已更新，开始重建索引")
+	total, failed, err := RebuildSearchIndex(db)
+	if err != nil {
+		log.Printf("重建搜索索引失败: %v", err)
+		return
+	}
+	log.Printf("搜索索引重建完成，共 %d 本小说，失败 %d 本", total, failed)
+}
+
+// LoadSearchDictionary 将关键词、分类名和已审核小说的标题、作者、主角加入分词词典
+func LoadSearchDictionary(db *gorm.DB) error {
+	var words []string
+	if err := db.Model(&models.Keyword{}).Pluck("word", &words).Error; err != nil {
+		return err
+	}
+	utils.AddSearchWords(words...)
+
+	var names []string
+	if err := db.Model(&models.Category{}).Pluck("name", &names).Error; err != nil {
+		return err
+	}
+	utils.AddSearchWords(names...)
+
+	var novels []models.Novel
+	if err := db.Select("title", "author", "protagonist").Where("status = ?", "approved").Find(&novels).Error; err != nil {
+		return err
+	}
+	for _, novel := range novels {
+		utils.AddSearchWords(novel.Title, novel.Author, novel.Protagonist)
+	}
+	return nil
+}
+
+// RebuildSearchIndex 为全部小说的元数据和章节内容重建索引，全部完成后记录映射版本
+// 重建前先把同步位置推进到最新的发件箱记录，之前的变更已包含在重建结果中
+// 返回小说总数和失败数量，有失败时不记录映射版本，下次启动会再次重建
+func RebuildSearchIndex(db *gorm.DB) (int, int, error) {
+	if utils.GlobalSearchIndex == nil {
+		return 0, 0, nil
+	}
+
+	var latestOutboxID uint
+	if err := db.Model(&models.SearchOutbox{}).Select("COALESCE(MAX(id), 0)").Scan(&latestOutboxID).Error; err != nil {
+		return 0, 0, err
+	}
+	cursor, err := utils.GlobalSearchIndex.OutboxCursor()
+	if err != nil {
+		return 0, 0, err
+	}
+	if latestOutboxID > cursor {
+		// 最新记录之前尚未提交的记录不会被重建读到，记为空缺由同步器继续等待
+		gaps, err := recentOutboxGaps(db, cursor, latestOutboxID)
+		if err != nil {
+			return 0, 0, err
+		}
+		pendingGaps, err := utils.GlobalSearchIndex.OutboxGaps()
+		if err != nil {
+			return 0, 0, err
+		}
+		for id, seenAt := range pendingGaps {
+			gaps[id] = seenAt
+		}
+		if err := utils.GlobalSearchIndex.SetOutboxProgress(latestOutboxID, gaps); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	var novelIDs []uint
+	if err := db.Model(&models.Novel{}).Order("id ASC").Pluck("id", &novelIDs).Error; err != nil {
+		return 0, 0, err
+	}
+
+	failed := 0
+	for _, novelID := range novelIDs {
+		if err := ReindexNovel(db, novelID); err != nil {
+			log.Printf("重建索引失败 (novel ID: %d): %v", novelID, err)
+			failed++
+		}
+	}
+	if failed == 0 {
+		if err := utils.GlobalSearchIndex.MarkRebuilt(); err != nil {
+			return len(novelIDs), failed, err
+		}
+	}
+	return len(novelIDs), failed, nil
+}
+
+// recentOutboxGaps 返回 (cursor, latest] 中最近 searchOutboxMaxGaps 个ID内尚不存在的发件箱记录ID
+func recentOutboxGaps(db *gorm.DB, cursor, latest uint) (map[uint]time.Time, error) {
+	from := cursor + 1
+	if latest-cursor > searchOutboxMaxGaps {
+		from = latest - searchOutboxMaxGaps + 1
+	}
+	var ids []uint
+	if err := db.Model(&models.SearchOutbox{}).Where("id BETWEEN ? AND ?", from, latest).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	existing := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		existing[id] = true
+	}
+	now := time.Now()
+	gaps := make(map[uint]time.Time)
+	for id := from; id <= latest; id++ {
+		if !existing[id] {
+			gaps[id] = now
+		}
+	}
+	return gaps, nil
+}
@@ -0,0 +1,343 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// 同一本小说连续同步失败达到该次数后跳过，避免阻塞后续变更
+	searchIndexMaxAttempts = 5
+	// 被跳过的小说间隔该时长后重试同步
+	searchIndexRetryInterval = 10 * time.Minute
+	// 发件箱记录ID在写入时分配、事务提交后才可见，晚提交的记录ID会小于已同步位置；
+	// 同步时跳过的ID在该时长内持续重读，超时后视为所在事务已回滚
+	searchOutboxGapTimeout = 10 * time.Minute
+	// 最多保留的ID空缺数量，超出时丢弃最早的空缺
+	searchOutboxMaxGaps = 10000
+)
+
+// SearchIndexStatus 搜索索引同步状态和一致性检查结果
+type SearchIndexStatus struct {
+	Cursor          uint       `json:"cursor"`            // 本实例索引已同步到的发件箱记录ID
+	LatestOutboxID  uint       `json:"latest_outbox_id"`  // 最新的发件箱记录ID
+	PendingChanges  int64      `json:"pending_changes"`   // 待同步的发件箱记录数
+	OpenGaps        int        `json:"open_gaps"`         // 同步位置之前等待事务提交的记录ID数
+	OldestPendingAt *time.Time `json:"oldest_pending_at"` // 最早一条待同步记录的写入时间
+	LagSeconds      float64    `json:"lag_seconds"`       // 同步延迟（秒），没有待同步记录时为0
+	LastRunAt       *time.Time `json:"last_run_at"`       // 最近一次同步时间
+	LastError       string     `json:"last_error"`        // 最近一次同步错误
+	SkippedNovelIDs []uint     `json:"skipped_novel_ids"` // 多次同步失败而被跳过的小说
+	DBNovels        int64      `json:"db_novels"`         // 数据库中的小说数
+	IndexNovels     int        `json:"index_novels"`      // 索引中的小说文档数
+	DBChapters      int64      `json:"db_chapters"`       // 数据库中的章节数
+	IndexChapters   int        `json:"index_chapters"`    // 索引中的章节文档数
+	Consistent      bool       `json:"consistent"`        // 数据库与索引的文档数是否一致，且没有被跳过的小说
+}
+
+// SearchIndexer 搜索索引同步器
+// 按ID顺序消费 search_outbox 表，把变更小说的当前数据库状态写入本实例的索引，重复处理同一记录结果不变；
+// 已处理到的记录ID和其间尚未提交的ID空缺保存在索引内部，多实例部署时各实例的本地索引分别同步
+type SearchIndexer struct {
+	DB           *gorm.DB
+	pollInterval time.Duration
+	batchSize    int
+	startOnce    sync.Once
+
+	mu        sync.Mutex
+	lastRunAt time.Time
+	lastError string
+	failures  map[uint]int          // 小说连续同步失败次数
+	skipped   map[uint]skippedNovel // 多次失败后跳过的小说，定期重试
+}
+
+// skippedNovel 被跳过的小说及其待同步的内容
+type skippedNovel struct {
+	withChapters bool
+	skippedAt    time.Time
+}
+
+// NewSearchIndexer 创建搜索索引同步器实例
+func NewSearchIndexer(db *gorm.DB) *SearchIndexer {
+	return &SearchIndexer{
+		DB:           db,
+		pollInterval: 2 * time.Second,
+		batchSize:    200,
+		failures:     make(map[uint]int),
+		skipped:      make(map[uint]skippedNovel),
+	}
+}
+
+// Start 启动后台同步协程
+func (s *SearchIndexer) Start() {
+	s.startOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(s.pollInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				if _, err := s.ProcessPending(); err != nil {
+					log.Printf("同步搜索索引失败: %v", err)
+				}
+			}
+		}()
+	})
+}
+
+// ProcessPending 同步全部待处理的发件箱记录并重试到期的被跳过小说，返回处理的记录数
+func (s *SearchIndexer) ProcessPending() (int, error) {
+	index := utils.GlobalSearchIndex
+	if index == nil {
+		return 0, nil
+	}
+	s.retrySkipped()
+
+	processed := 0
+	for {
+		n, err := s.processBatch(index)
+		processed += n
+		s.mu.Lock()
+		s.lastRunAt = time.Now()
+		if err != nil {
+			s.lastError = err.Error()
+		} else {
+			s.lastError = ""
+		}
+		s.mu.Unlock()
+		if err != nil || n < s.batchSize {
+			return processed, err
+		}
+	}
+}
+
+// processBatch 同步一批发件箱记录，同一小说的多条记录合并处理，全部成功后才推进同步位置
+// 同时重读此前跳过的ID空缺，已提交的记录一并同步，超时的空缺不再等待
+func (s *SearchIndexer) processBatch(index *utils.SearchIndex) (int, error) {
+	cursor, err := index.OutboxCursor()
+	if err != nil {
+		return 0, err
+	}
+	gaps, err := index.OutboxGaps()
+	if err != nil {
+		return 0, err
+	}
+
+	var rows []models.SearchOutbox
+	if err := s.DB.Where("id > ?", cursor).Order("id ASC").Limit(s.batchSize).Find(&rows).Error; err != nil {
+		return 0, err
+	}
+	var filled []models.SearchOutbox
+	if len(gaps) > 0 {
+		gapIDs := make([]uint, 0, len(gaps))
+		for id := range gaps {
+			gapIDs = append(gapIDs, id)
+		}
+		if err := s.DB.Where("id IN ?", gapIDs).Find(&filled).Error; err != nil {
+			return 0, err
+		}
+	}
+
+	now := time.Now()
+	expired := 0
+	for id, seenAt := range gaps {
+		if now.Sub(seenAt) > searchOutboxGapTimeout {
+			delete(gaps, id)
+			expired++
+		}
+	}
+	if len(rows) == 0 && len(filled) == 0 && expired == 0 {
+		return 0, nil
+	}
+
+	novelIDs := make([]uint, 0, len(rows)+len(filled))
+	chapters := make(map[uint]bool)
+	for _, row := range append(filled, rows...) {
+		if _, ok := chapters[row.NovelID]; !ok {
+			novelIDs = append(novelIDs, row.NovelID)
+			chapters[row.NovelID] = false
+		}
+		if row.Change == models.SearchOutboxChapters {
+			chapters[row.NovelID] = true
+		}
+	}
+
+	for _, novelID := range novelIDs {
+		if err := syncNovelIndex(s.DB, novelID, chapters[novelID]); err != nil {
+			if !s.recordFailure(novelID, chapters[novelID]) {
+				return 0, err
+			}
+			log.Printf("小说索引连续同步失败%d次，已跳过 (novel ID: %d): %v", searchIndexMaxAttempts, novelID, err)
+			continue
+		}
+		s.mu.Lock()
+		delete(s.failures, novelID)
+		// 只同步了元数据时，因章节同步失败而跳过的小说仍需重试
+		if chapters[novelID] || !s.skipped[novelID].withChapters {
+			delete(s.skipped, novelID)
+		}
+		s.mu.Unlock()
+	}
+
+	for _, row := range filled {
+		delete(gaps, row.ID)
+	}
+	next := cursor
+	for _, row := range rows {
+		from := next + 1
+		if row.ID-from > searchOutboxMaxGaps {
+			from = row.ID - searchOutboxMaxGaps
+		}
+		for id := from; id < row.ID; id++ {
+			gaps[id] = now
+		}
+		next = row.ID
+	}
+	if len(gaps) > searchOutboxMaxGaps {
+		gapIDs := make([]uint, 0, len(gaps))
+		for id := range gaps {
+			gapIDs = append(gapIDs, id)
+		}
+		sort.Slice(gapIDs, func(i, j int) bool { return gapIDs[i] < gapIDs[j] })
+		for _, id := range gapIDs[:len(gapIDs)-searchOutboxMaxGaps] {
+			delete(gaps, id)
+		}
+	}
+
+	if err := index.SetOutboxProgress(next, gaps); err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// recordFailure 记录小说同步失败，达到最大次数时返回 true 表示跳过
+func (s *SearchIndexer) recordFailure(novelID uint, withChapters bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[novelID]++
+	if s.failures[novelID] < searchIndexMaxAttempts {
+		return false
+	}
+	delete(s.failures, novelID)
+	if skipped, ok := s.skipped[novelID]; ok {
+		withChapters = withChapters || skipped.withChapters
+	}
+	s.skipped[novelID] = skippedNovel{withChapters: withChapters, skippedAt: time.Now()}
+	return true
+}
+
+// retrySkipped 重新同步跳过已超过重试间隔的小说，成功后移出跳过列表
+func (s *SearchIndexer) retrySkipped() {
+	now := time.Now()
+	due := make(map[uint]skippedNovel)
+	s.mu.Lock()
+	for novelID, skipped := range s.skipped {
+		if now.Sub(skipped.skippedAt) >= searchIndexRetryInterval {
+			due[novelID] = skipped
+		}
+	}
+	s.mu.Unlock()
+
+	for novelID, skipped := range due {
+		err := syncNovelIndex(s.DB, novelID, skipped.withChapters)
+		s.mu.Lock()
+		if err != nil {
+			skipped.skippedAt = now
+			s.skipped[novelID] = skipped
+		} else {
+			delete(s.skipped, novelID)
+		}
+		s.mu.Unlock()
+		if err != nil {
+			log.Printf("重试同步小说索引失败 (novel ID: %d): %v", novelID, err)
+		}
+	}
+}
+
+// syncNovelIndex 按数据库当前状态同步小说的索引，小说已删除时从索引中移除
+func syncNovelIndex(db *gorm.DB, novelID uint, withChapters bool) error {
+	var err error
+	if withChapters {
+		err = ReindexNovel(db, novelID)
+	} else {
+		err = ReindexNovelMetadata(db, novelID)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.GlobalSearchIndex.DeleteNovelFromIndex(novelID)
+	}
+	return err
+}
+
+// Status 返回同步延迟和数据库与索引的文档数对比
+func (s *SearchIndexer) Status() (*SearchIndexStatus, error) {
+	status := &SearchIndexStatus{SkippedNovelIDs: []uint{}}
+
+	s.mu.Lock()
+	if !s.lastRunAt.IsZero() {
+		lastRunAt := s.lastRunAt
+		status.LastRunAt = &lastRunAt
+	}
+	status.LastError = s.lastError
+	for novelID := range s.skipped {
+		status.SkippedNovelIDs = append(status.SkippedNovelIDs, novelID)
+	}
+	s.mu.Unlock()
+
+	if err := s.DB.Model(&models.SearchOutbox{}).Select("COALESCE(MAX(id), 0)").Scan(&status.LatestOutboxID).Error; err != nil {
+		return nil, err
+	}
+	if err := s.DB.Model(&models.Novel{}).Count(&status.DBNovels).Error; err != nil {
+		return nil, err
+	}
+	if err := s.DB.Model(&models.Chapter{}).
+		Where("novel_id IN (?)", s.DB.Model(&models.Novel{}).Select("id")).
+		Count(&status.DBChapters).Error; err != nil {
+		return nil, err
+	}
+
+	index := utils.GlobalSearchIndex
+	if index == nil {
+		return status, nil
+	}
+	cursor, err := index.OutboxCursor()
+	if err != nil {
+		return nil, err
+	}
+	status.Cursor = cursor
+	gaps, err := index.OutboxGaps()
+	if err != nil {
+		return nil, err
+	}
+	status.OpenGaps = len(gaps)
+
+	var oldest models.SearchOutbox
+	pending := s.DB.Model(&models.SearchOutbox{}).Where("id > ?", cursor)
+	if err := pending.Count(&status.PendingChanges).Error; err != nil {
+		return nil, err
+	}
+	if status.PendingChanges > 0 {
+		if err := s.DB.Where("id > ?", cursor).Order("id ASC").First(&oldest).Error; err != nil {
+			return nil, err
+		}
+		status.OldestPendingAt = &oldest.CreatedAt
+		status.LagSeconds = time.Since(oldest.CreatedAt).Seconds()
+	}
+
+	if status.IndexNovels, status.IndexChapters, err = index.DocumentCounts(); err != nil {
+		return nil, err
+	}
+	status.Consistent = int64(status.IndexNovels) == status.DBNovels && int64(status.IndexChapters) == status.DBChapters &&
+		len(status.SkippedNovelIDs) == 0
+	return status, nil
+}
+
+// PruneOutbox 删除早于给定时长的发件箱记录，返回删除数量
+func (s *SearchIndexer) PruneOutbox(olderThan time.Duration) (int64, error) {
+	result := s.DB.Unscoped().Where("created_at < ?", time.Now().Add(-olderThan)).Delete(&models.SearchOutbox{})
+	return result.RowsAffected, result.Error
+}
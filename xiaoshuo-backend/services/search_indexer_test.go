@@ -0,0 +1,199 @@
+//go:build sqlite
+
+package services
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// setupIndexerTest 创建带发件箱表的测试数据库和临时搜索索引，并写入三本已审核的小说
+func setupIndexerTest(t *testing.T) (*gorm.DB, *utils.SearchIndex) {
+	t.Helper()
+	db := openTestDB(t, &models.SearchOutbox{})
+	index, err := utils.NewSearchIndex(filepath.Join(t.TempDir(), "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.GlobalSearchIndex = index
+	t.Cleanup(func() {
+		utils.GlobalSearchIndex = nil
+		index.Close()
+	})
+
+	for i := uint(1); i <= 3; i++ {
+		novel := models.Novel{
+			Model: gorm.Model{ID: i}, Title: fmt.Sprintf("小说%d", i), Author: "作者",
+			Filepath: "x", FileHash: fmt.Sprint(i), Status: "approved",
+		}
+		if err := db.Create(&novel).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db, index
+}
+
+// addOutbox 以指定ID写入发件箱记录，模拟事务按任意顺序提交
+func addOutbox(t *testing.T, db *gorm.DB, id, novelID uint) {
+	t.Helper()
+	row := models.SearchOutbox{Model: gorm.Model{ID: id}, NovelID: novelID, Change: models.SearchOutboxNovel}
+	if err := db.Create(&row).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// outboxProgress 返回索引中的同步位置和排序后的空缺ID
+func outboxProgress(t *testing.T, index *utils.SearchIndex) (uint, []uint) {
+	t.Helper()
+	cursor, err := index.OutboxCursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gaps, err := index.OutboxGaps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]uint, 0, len(gaps))
+	for id := range gaps {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return cursor, ids
+}
+
+func indexedStatus(t *testing.T, index *utils.SearchIndex, novelID uint) string {
+	t.Helper()
+	status, err := index.IndexedNovelStatus(novelID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestSearchIndexerGaps(t *testing.T) {
+	db, index := setupIndexerTest(t)
+	indexer := NewSearchIndexer(db)
+
+	// ID 2 所在的事务尚未提交，同步位置越过它并记为空缺
+	addOutbox(t, db, 1, 1)
+	addOutbox(t, db, 3, 3)
+	if n, err := indexer.ProcessPending(); err != nil || n != 2 {
+		t.Fatalf("ProcessPending = %d, %v, want 2", n, err)
+	}
+	if cursor, gaps := outboxProgress(t, index); cursor != 3 || !reflect.DeepEqual(gaps, []uint{2}) {
+		t.Fatalf("progress = %d %v, want 3 [2]", cursor, gaps)
+	}
+	if status := indexedStatus(t, index, 2); status != "" {
+		t.Fatalf("novel 2 indexed before its outbox row committed: %q", status)
+	}
+
+	// 较小的ID晚提交后在下一次同步中被重读
+	addOutbox(t, db, 2, 2)
+	if _, err := indexer.ProcessPending(); err != nil {
+		t.Fatal(err)
+	}
+	if cursor, gaps := outboxProgress(t, index); cursor != 3 || len(gaps) != 0 {
+		t.Errorf("progress = %d %v, want 3 []", cursor, gaps)
+	}
+	if status := indexedStatus(t, index, 2); status != "approved" {
+		t.Errorf("novel 2 indexed status = %q, want approved", status)
+	}
+
+	// 超时仍未提交的空缺视为已回滚，不再等待
+	addOutbox(t, db, 5, 1)
+	if _, err := indexer.ProcessPending(); err != nil {
+		t.Fatal(err)
+	}
+	if cursor, gaps := outboxProgress(t, index); cursor != 5 || !reflect.DeepEqual(gaps, []uint{4}) {
+		t.Fatalf("progress = %d %v, want 5 [4]", cursor, gaps)
+	}
+	expired := map[uint]time.Time{4: time.Now().Add(-searchOutboxGapTimeout - time.Minute)}
+	if err := index.SetOutboxProgress(5, expired); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := indexer.ProcessPending(); err != nil {
+		t.Fatal(err)
+	}
+	if cursor, gaps := outboxProgress(t, index); cursor != 5 || len(gaps) != 0 {
+		t.Errorf("progress = %d %v, want 5 []", cursor, gaps)
+	}
+}
+
+func TestSearchIndexerStatusChangeReindexesChapters(t *testing.T) {
+	db, index := setupIndexerTest(t)
+	indexer := NewSearchIndexer(db)
+
+	chapter := models.Chapter{NovelID: 1, Position: 1, Title: "第一章", Content: "少年走进了城门"}
+	if err := db.Create(&chapter).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.SearchOutbox{NovelID: 1, Change: models.SearchOutboxChapters}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := indexer.ProcessPending(); err != nil {
+		t.Fatal(err)
+	}
+	if _, total, _ := index.SearchChapters("城门", 0, 1, 10); total != 1 {
+		t.Fatalf("chapter hits before status change = %d, want 1", total)
+	}
+
+	// 只记录了小说元数据变更，章节文档中的审核状态也要随之更新
+	if err := db.Model(&models.Novel{}).Where("id = ?", 1).Update("status", "rejected").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.SearchOutbox{NovelID: 1, Change: models.SearchOutboxNovel}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := indexer.ProcessPending(); err != nil {
+		t.Fatal(err)
+	}
+	if _, total, _ := index.SearchChapters("城门", 0, 1, 10); total != 0 {
+		t.Errorf("chapter hits after rejection = %d, want 0", total)
+	}
+}
+
+func TestRecentOutboxGaps(t *testing.T) {
+	db := openTestDB(t, &models.SearchOutbox{})
+	for _, id := range []uint{2, 3, 6} {
+		addOutbox(t, db, id, 1)
+	}
+	tests := []struct {
+		cursor, latest uint
+		want           []uint
+	}{
+		{0, 6, []uint{1, 4, 5}},
+		{3, 6, []uint{4, 5}},
+		{6, 6, []uint{}},
+	}
+	for _, tt := range tests {
+		gaps, err := recentOutboxGaps(db, tt.cursor, tt.latest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]uint, 0, len(gaps))
+		for id := range gaps {
+			got = append(got, id)
+		}
+		sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("recentOutboxGaps(%d, %d) = %v, want %v", tt.cursor, tt.latest, got, tt.want)
+		}
+	}
+
+	// 只检查最近 searchOutboxMaxGaps 个ID
+	gaps, err := recentOutboxGaps(db, 0, searchOutboxMaxGaps+6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := gaps[7]; len(gaps) != searchOutboxMaxGaps || !ok {
+		t.Errorf("recentOutboxGaps has %d gaps, want the %d IDs from 7", len(gaps), searchOutboxMaxGaps)
+	}
+}
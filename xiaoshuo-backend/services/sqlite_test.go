@@ -0,0 +1,46 @@
+//go:build sqlite
+
+package services
+
+// 需要数据库的测试使用 SQLite，驱动依赖 cgo：
+//
+//	CGO_ENABLED=1 go test -tags sqlite ./services/
+
+import (
+	"path/filepath"
+	"testing"
+	"xiaoshuo-backend/config"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/utils"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB 在临时目录中创建 SQLite 数据库并迁移小说相关的表
+func openTestDB(t *testing.T, extra ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables := append([]interface{}{&models.User{}, &models.Category{}, &models.Keyword{}, &models.Novel{}, &models.Chapter{}, &models.Volume{}}, extra...)
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// useUnreachableCache 让缓存指向不可用的 Redis，被测代码清理缓存时只会得到连接错误
+func useUnreachableCache(t *testing.T) {
+	t.Helper()
+	rdb, cache := config.RDB, utils.GlobalCache
+	config.RDB = redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	utils.InitCache()
+	t.Cleanup(func() {
+		config.RDB.Close()
+		config.RDB, utils.GlobalCache = rdb, cache
+	})
+}
@@ -0,0 +1,492 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"xiaoshuo-backend/models"
+	"xiaoshuo-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// 上传任务状态
+const (
+	UploadJobPending    = "pending"
+	UploadJobProcessing = "processing"
+	UploadJobCompleted  = "completed"
+	UploadJobFailed     = "failed"
+)
+
+// 处理中的任务定期更新心跳，超过租约时长没有心跳的任务视为执行实例已退出，可由其他工作协程重新领取
+const (
+	uploadJobLease             = 2 * time.Minute
+	uploadJobHeartbeatInterval = 30 * time.Second
+)
+
+// staleUploadJobCondition 租约已过期的处理中任务，升级前没有心跳的任务按开始时间判断
+const staleUploadJobCondition = "status = ? AND (heartbeat_at < ? OR (heartbeat_at IS NULL AND (started_at IS NULL OR started_at < ?)))"
+
+// 上传任务类型
+const (
+	UploadJobKindImport = "import" // 首次上传，解析文件并写入全部章节
+	UploadJobKindAppend = "append" // 连载追更，与已有章节比对后只追加新章节
+)
+
+// UploadJobService 上传文件异步解析服务
+// 任务持久化在 upload_jobs 表中，由固定数量的工作协程轮询领取执行
+type UploadJobService struct {
+	DB           *gorm.DB
+	workers      int
+	pollInterval time.Duration
+	notify       chan struct{}
+	startOnce    sync.Once
+}
+
+// NewUploadJobService 创建上传任务服务实例，workers 为并发解析的工作协程数
+func NewUploadJobService(db *gorm.DB, workers int) *UploadJobService {
+	if workers < 1 {
+		workers = 1
+	}
+	return &UploadJobService{
+		DB:           db,
+		workers:      workers,
+		pollInterval: 5 * time.Second,
+		notify:       make(chan struct{}, workers),
+	}
+}
+
+// Start 恢复孤立任务并启动工作协程
+func (s *UploadJobService) Start() {
+	s.startOnce.Do(func() {
+		if err := s.RecoverOrphanedJobs(); err != nil {
+			log.Printf("恢复上传解析任务失败: %v", err)
+		}
+		for i := 0; i < s.workers; i++ {
+			go s.workerLoop()
+		}
+	})
+}
+
+// Enqueue 在给定事务中创建解析任务，事务提交后需调用 Notify 唤醒工作协程
+func (s *UploadJobService) Enqueue(tx *gorm.DB, novelID uint, filePath string) (*models.UploadJob, error) {
+	job := models.UploadJob{
+		NovelID:     novelID,
+		FilePath:    filePath,
+		Kind:        UploadJobKindImport,
+		Status:      UploadJobPending,
+		MaxAttempts: 3,
+		NextRunAt:   time.Now(),
+	}
+	if err := tx.Create(&job).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// EnqueueAppend 创建追加新章节的任务并唤醒工作协程，文件在任务结束后删除
+func (s *UploadJobService) EnqueueAppend(novelID, userID uint, filePath, serialStatus string) (*models.UploadJob, error) {
+	job := models.UploadJob{
+		NovelID:      novelID,
+		FilePath:     filePath,
+		Kind:         UploadJobKindAppend,
+		UserID:       userID,
+		SerialStatus: serialStatus,
+		Status:       UploadJobPending,
+		MaxAttempts:  3,
+		NextRunAt:    time.Now(),
+	}
+	if err := s.DB.Create(&job).Error; err != nil {
+		return nil, err
+	}
+	s.Notify()
+	return &job, nil
+}
+
+// Notify 唤醒空闲的工作协程立即领取任务
+func (s *UploadJobService) Notify() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// GetLatestJob 获取小说最近一次的导入解析任务
+func (s *UploadJobService) GetLatestJob(novelID uint) (*models.UploadJob, error) {
+	var job models.UploadJob
+	if err := s.DB.Where("novel_id = ? AND kind = ?", novelID, UploadJobKindImport).Order("id DESC").First(&job).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetJob 获取小说的指定任务
+func (s *UploadJobService) GetJob(novelID, jobID uint) (*models.UploadJob, error) {
+	var job models.UploadJob
+	if err := s.DB.Where("id = ? AND novel_id = ?", jobID, novelID).First(&job).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// RecoverOrphanedJobs 恢复执行实例退出后未完成的任务
+// 租约已过期的 processing 任务重新排队，其他实例仍在处理的任务不受影响；章节状态停留在 processing 但没有任务的小说补建任务
+func (s *UploadJobService) RecoverOrphanedJobs() error {
+	staleBefore := time.Now().Add(-uploadJobLease)
+	result := s.DB.Model(&models.UploadJob{}).
+		Where(staleUploadJobCondition, UploadJobProcessing, staleBefore, staleBefore).
+		Updates(map[string]interface{}{
+			"status":       UploadJobPending,
+			"stage":        "",
+			"progress":     0,
+			"heartbeat_at": nil,
+			"next_run_at":  time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("已恢复 %d 个中断的上传解析任务", result.RowsAffected)
+	}
+
+	var orphanedNovels []models.Novel
+	if err := s.DB.Where("chapter_status IN ?", []string{UploadJobPending, UploadJobProcessing}).
+		Where("id NOT IN (?)", s.DB.Model(&models.UploadJob{}).Select("novel_id")).
+		Find(&orphanedNovels).Error; err != nil {
+		return err
+	}
+	for _, novel := range orphanedNovels {
+		if _, err := s.Enqueue(s.DB, novel.ID, novel.Filepath); err != nil {
+			log.Printf("补建上传解析任务失败 (novel ID: %d): %v", novel.ID, err)
+			continue
+		}
+		s.DB.Model(&models.Novel{}).Where("id = ?", novel.ID).Update("chapter_status", UploadJobPending)
+	}
+	if len(orphanedNovels) > 0 {
+		log.Printf("已为 %d 本小说补建上传解析任务", len(orphanedNovels))
+	}
+
+	return nil
+}
+
+// workerLoop 工作协程主循环，空闲时等待通知或定时轮询
+func (s *UploadJobService) workerLoop() {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			job, err := s.claimNextJob()
+			if err != nil {
+				log.Printf("领取上传解析任务失败: %v", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			s.runJob(job)
+		}
+
+		select {
+		case <-s.notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claimNextJob 领取下一个可执行的任务（排队中的任务或租约已过期的处理中任务），
+// 通过带原状态条件的更新保证多个工作协程和实例不会重复领取
+func (s *UploadJobService) claimNextJob() (*models.UploadJob, error) {
+	for {
+		now := time.Now()
+		staleBefore := now.Add(-uploadJobLease)
+		var job models.UploadJob
+		err := s.DB.Where("status = ? AND next_run_at <= ?", UploadJobPending, now).
+			Or(staleUploadJobCondition, UploadJobProcessing, staleBefore, staleBefore).
+			Order("next_run_at ASC, id ASC").
+			First(&job).Error
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		claim := s.DB.Model(&models.UploadJob{}).Where("id = ?", job.ID)
+		if job.Status == UploadJobProcessing {
+			claim = claim.Where(staleUploadJobCondition, UploadJobProcessing, staleBefore, staleBefore)
+		} else {
+			claim = claim.Where("status = ?", UploadJobPending)
+		}
+		result := claim.Updates(map[string]interface{}{
+			"status":       UploadJobProcessing,
+			"stage":        "parsing",
+			"progress":     0,
+			"attempts":     gorm.Expr("attempts + ?", 1),
+			"started_at":   now,
+			"heartbeat_at": now,
+		})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			// 已被其他工作协程领取，继续尝试下一个
+			continue
+		}
+
+		job.Status = UploadJobProcessing
+		job.Attempts++
+		job.StartedAt = &now
+		job.HeartbeatAt = &now
+		return &job, nil
+	}
+}
+
+// runJob 执行单个任务，执行期间持续更新心跳，失败时按退避策略重试
+func (s *UploadJobService) runJob(job *models.UploadJob) {
+	stop := make(chan struct{})
+	go s.keepAlive(job, stop)
+	defer close(stop)
+
+	var err error
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("解析过程中发生panic: %v", r)
+			}
+		}()
+		err = s.processJob(job)
+	}()
+
+	if err == nil {
+		return
+	}
+
+	log.Printf("上传解析任务失败 (job ID: %d, novel ID: %d, 第%d次): %v", job.ID, job.NovelID, job.Attempts, err)
+
+	// 追加任务不影响小说的章节解析状态
+	isImport := job.Kind != UploadJobKindAppend
+	if job.Attempts < job.MaxAttempts {
+		// 指数退避后重新排队
+		backoff := time.Duration(1<<uint(job.Attempts-1)) * 30 * time.Second
+		if !s.transitionJob(job, map[string]interface{}{
+			"status":         UploadJobPending,
+			"failure_reason": err.Error(),
+			"next_run_at":    time.Now().Add(backoff),
+		}) {
+			return
+		}
+		if isImport {
+			s.DB.Model(&models.Novel{}).Where("id = ?", job.NovelID).Update("chapter_status", UploadJobPending)
+		}
+		return
+	}
+
+	now := time.Now()
+	if !s.transitionJob(job, map[string]interface{}{
+		"status":         UploadJobFailed,
+		"failure_reason": err.Error(),
+		"finished_at":    now,
+	}) {
+		return
+	}
+	if isImport {
+		s.DB.Model(&models.Novel{}).Where("id = ?", job.NovelID).Update("chapter_status", UploadJobFailed)
+	} else {
+		utils.DeleteFile(job.FilePath)
+	}
+}
+
+// ownedJob 限定为本次领取的任务：租约过期后任务可能被其他工作协程重新领取，
+// 领取时 attempts 会加一，因此用领取时的 attempts 判断任务是否仍归当前协程所有
+func (s *UploadJobService) ownedJob(job *models.UploadJob) *gorm.DB {
+	return s.DB.Model(&models.UploadJob{}).
+		Where("id = ? AND status = ? AND attempts = ?", job.ID, UploadJobProcessing, job.Attempts)
+}
+
+// transitionJob 更新本次领取的任务状态，任务已被重新领取时不做修改并返回 false，
+// 调用方此时不应再更新小说的章节状态或删除文件
+func (s *UploadJobService) transitionJob(job *models.UploadJob, updates map[string]interface{}) bool {
+	result := s.ownedJob(job).Updates(updates)
+	if result.Error != nil {
+		log.Printf("更新上传解析任务状态失败 (job ID: %d): %v", job.ID, result.Error)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		log.Printf("上传解析任务已被重新领取，放弃本次结果 (job ID: %d, 第%d次)", job.ID, job.Attempts)
+		return false
+	}
+	return true
+}
+
+// keepAlive 定期更新处理中任务的心跳，直到 stop 关闭
+func (s *UploadJobService) keepAlive(job *models.UploadJob, stop <-chan struct{}) {
+	ticker := time.NewTicker(uploadJobHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := s.ownedJob(job).Update("heartbeat_at", time.Now()).Error; err != nil {
+				log.Printf("更新上传解析任务心跳失败 (job ID: %d): %v", job.ID, err)
+			}
+		}
+	}
+}
+
+// processJob 解析文件、保存分卷和章节并更新小说章节状态，搜索索引由 SearchIndexer 根据变更记录异步同步
+func (s *UploadJobService) processJob(job *models.UploadJob) error {
+	if job.Kind == UploadJobKindAppend {
+		return s.processAppendJob(job)
+	}
+
+	var novel models.Novel
+	if err := s.DB.Preload("Categories").Preload("Keywords").First(&novel, job.NovelID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			// 小说已被删除，无需重试
+			job.MaxAttempts = job.Attempts
+			return fmt.Errorf("小说不存在，任务终止")
+		}
+		return fmt.Errorf("获取小说信息失败: %v", err)
+	}
+	s.DB.Model(&novel).Update("chapter_status", UploadJobProcessing)
+
+	// 解析分卷和章节
+	volumes, err := utils.ParseVolumesFromFile(job.FilePath)
+	if err != nil {
+		return fmt.Errorf("章节解析失败: %v", err)
+	}
+	var chapters []models.Chapter
+	for _, volume := range volumes {
+		chapters = append(chapters, volume.Chapters...)
+	}
+	s.updateJobProgress(job, "saving", 30, len(chapters))
+
+	// 保存分卷和章节（重试时先清理上次残留的数据，保证幂等）
+	totalWords := 0
+	for i := range chapters {
+		totalWords += chapters[i].WordCount
+	}
+	const batchSize = 100
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("novel_id = ?", novel.ID).Delete(&models.Chapter{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("novel_id = ?", novel.ID).Delete(&models.Volume{}).Error; err != nil {
+			return err
+		}
+
+		// 先创建分卷，再为章节设置所属分卷
+		chapters = chapters[:0]
+		for _, volume := range volumes {
+			var volumeID uint
+			if volume.Title != "" {
+				record := models.Volume{
+					NovelID:      novel.ID,
+					Title:        volume.Title,
+					Position:     volume.Position,
+					WordCount:    volume.WordCount,
+					ChapterCount: volume.ChapterCount,
+				}
+				if err := tx.Create(&record).Error; err != nil {
+					return err
+				}
+				volumeID = record.ID
+			}
+			for _, chapter := range volume.Chapters {
+				chapter.NovelID = novel.ID
+				chapter.VolumeID = volumeID
+				chapter.ContentHash = utils.ChapterContentHash(chapter.Content)
+				chapters = append(chapters, chapter)
+			}
+		}
+
+		for start := 0; start < len(chapters); start += batchSize {
+			end := start + batchSize
+			if end > len(chapters) {
+				end = len(chapters)
+			}
+			batch := chapters[start:end]
+			if err := tx.Create(&batch).Error; err != nil {
+				return err
+			}
+			s.updateJobProgress(job, "saving", 30+50*end/len(chapters), len(chapters))
+		}
+		novelUpdates := map[string]interface{}{"last_chapter_at": time.Now()}
+		if totalWords > 0 {
+			novelUpdates["word_count"] = totalWords
+		}
+		return tx.Model(&models.Novel{}).Where("id = ?", novel.ID).Updates(novelUpdates).Error
+	})
+	if err != nil {
+		return fmt.Errorf("章节保存失败: %v", err)
+	}
+
+	// 章节写入时已记录索引变更，搜索索引由 SearchIndexer 异步同步
+
+	// 完成任务
+	now := time.Now()
+	if !s.transitionJob(job, map[string]interface{}{
+		"status":         UploadJobCompleted,
+		"stage":          "",
+		"progress":       100,
+		"chapter_count":  len(chapters),
+		"failure_reason": "",
+		"finished_at":    now,
+	}) {
+		return nil
+	}
+	s.DB.Model(&models.Novel{}).Where("id = ?", novel.ID).Update("chapter_status", UploadJobCompleted)
+	utils.GlobalCacheService.InvalidateNovelCache(novel.ID)
+
+	return nil
+}
+
+// processAppendJob 解析新版本文件，与已有章节比对后追加新章节，完成后删除文件
+func (s *UploadJobService) processAppendJob(job *models.UploadJob) error {
+	volumes, err := utils.ParseVolumesFromFile(job.FilePath)
+	if err != nil {
+		return fmt.Errorf("章节解析失败: %v", err)
+	}
+	chapterCount := 0
+	for _, volume := range volumes {
+		chapterCount += len(volume.Chapters)
+	}
+	s.updateJobProgress(job, "saving", 50, chapterCount)
+
+	update, err := NewNovelUpdateService(s.DB).AppendChapters(job.NovelID, job.UserID, NovelUpdateSourceFile, volumes, job.SerialStatus)
+	if err != nil {
+		if errors.Is(err, ErrInvalidChapterEdit) {
+			// 没有新章节等内容问题重试也无法成功
+			job.MaxAttempts = job.Attempts
+		}
+		return fmt.Errorf("追加章节失败: %v", err)
+	}
+
+	now := time.Now()
+	if !s.transitionJob(job, map[string]interface{}{
+		"status":         UploadJobCompleted,
+		"stage":          "",
+		"progress":       100,
+		"chapter_count":  update.AddedChapters,
+		"update_id":      update.ID,
+		"failure_reason": "",
+		"finished_at":    now,
+	}) {
+		return nil
+	}
+	utils.DeleteFile(job.FilePath)
+	return nil
+}
+
+// updateJobProgress 更新任务处理阶段和进度
+func (s *UploadJobService) updateJobProgress(job *models.UploadJob, stage string, progress int, chapterCount int) {
+	s.ownedJob(job).Updates(map[string]interface{}{
+		"stage":         stage,
+		"progress":      progress,
+		"chapter_count": chapterCount,
+	})
+}
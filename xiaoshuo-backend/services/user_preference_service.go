@@ -0,0 +1,259 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"xiaoshuo-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 推荐反馈类型
+const (
+	FeedbackNotInterested = "not_interested"
+)
+
+// ErrInvalidPreference 偏好设置参数无效
+var ErrInvalidPreference = errors.New("偏好设置无效")
+
+// PreferenceInput 用户提交的偏好设置
+type PreferenceInput struct {
+	PreferredCategoryIDs []uint   `json:"preferred_category_ids"`
+	DislikedCategoryIDs  []uint   `json:"disliked_category_ids"`
+	PreferredKeywords    []string `json:"preferred_keywords"`
+	DislikedKeywords     []string `json:"disliked_keywords"`
+}
+
+// OnboardingKeyword 新用户引导中可选择的关键词
+type OnboardingKeyword struct {
+	ID         uint   `json:"id"`
+	Word       string `json:"word"`
+	NovelCount int64  `json:"novel_count"`
+}
+
+// UserPreferenceService 用户偏好服务，管理显式偏好设置和推荐反馈
+type UserPreferenceService struct {
+	DB *gorm.DB
+}
+
+// NewUserPreferenceService 创建用户偏好服务实例
+func NewUserPreferenceService(db *gorm.DB) *UserPreferenceService {
+	return &UserPreferenceService{DB: db}
+}
+
+// GetPreference 获取用户的偏好设置，尚未设置时返回空的偏好（ID为0）
+func (s *UserPreferenceService) GetPreference(userID uint) (*models.UserPreference, error) {
+	preference := models.UserPreference{UserID: userID}
+	err := s.DB.Preload("PreferredCategories").Preload("DislikedCategories").
+		Preload("PreferredKeywords").Preload("DislikedKeywords").
+		Where("user_id = ?", userID).First(&preference).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return &preference, nil
+}
+
+// SavePreference 保存用户的偏好设置（整体替换），首次保存时记录完成引导的时间
+func (s *UserPreferenceService) SavePreference(userID uint, input PreferenceInput) (*models.UserPreference, error) {
+	if overlap := intersectIDs(input.PreferredCategoryIDs, input.DislikedCategoryIDs); len(overlap) > 0 {
+		return nil, fmt.Errorf("%w: 分类不能同时设为喜欢和不喜欢", ErrInvalidPreference)
+	}
+
+	preferredCategories, err := s.loadCategories(input.PreferredCategoryIDs)
+	if err != nil {
+		return nil, err
+	}
+	dislikedCategories, err := s.loadCategories(input.DislikedCategoryIDs)
+	if err != nil {
+		return nil, err
+	}
+	preferredKeywords, err := s.loadKeywords(input.PreferredKeywords)
+	if err != nil {
+		return nil, err
+	}
+	dislikedKeywords, err := s.loadKeywords(input.DislikedKeywords)
+	if err != nil {
+		return nil, err
+	}
+	for _, preferred := range preferredKeywords {
+		for _, disliked := range dislikedKeywords {
+			if preferred.ID == disliked.ID {
+				return nil, fmt.Errorf("%w: 关键词不能同时设为喜欢和不喜欢: %s", ErrInvalidPreference, preferred.Word)
+			}
+		}
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		var preference models.UserPreference
+		if err := tx.Where(models.UserPreference{UserID: userID}).FirstOrCreate(&preference).Error; err != nil {
+			return err
+		}
+		if preference.OnboardedAt == nil {
+			if err := tx.Model(&preference).Update("onboarded_at", time.Now()).Error; err != nil {
+				return err
+			}
+		}
+
+		replacements := []struct {
+			association string
+			values      interface{}
+		}{
+			{"PreferredCategories", preferredCategories},
+			{"DislikedCategories", dislikedCategories},
+			{"PreferredKeywords", preferredKeywords},
+			{"DislikedKeywords", dislikedKeywords},
+		}
+		for _, replacement := range replacements {
+			if err := tx.Model(&preference).Association(replacement.association).Replace(replacement.values); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPreference(userID)
+}
+
+// loadCategories 按ID加载分类，存在无效ID时返回错误
+func (s *UserPreferenceService) loadCategories(ids []uint) ([]models.Category, error) {
+	categories := make([]models.Category, 0)
+	if len(ids) == 0 {
+		return categories, nil
+	}
+	if err := s.DB.Where("id IN ?", ids).Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	if len(categories) != len(uniqueIDs(ids)) {
+		return nil, fmt.Errorf("%w: 包含不存在的分类", ErrInvalidPreference)
+	}
+	return categories, nil
+}
+
+// loadKeywords 按关键词内容加载关键词，存在未知关键词时返回错误
+func (s *UserPreferenceService) loadKeywords(words []string) ([]models.Keyword, error) {
+	keywords := make([]models.Keyword, 0)
+	normalized := make([]string, 0, len(words))
+	seen := make(map[string]bool)
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+		if word != "" && !seen[word] {
+			seen[word] = true
+			normalized = append(normalized, word)
+		}
+	}
+	if len(normalized) == 0 {
+		return keywords, nil
+	}
+	if err := s.DB.Where("word IN ?", normalized).Find(&keywords).Error; err != nil {
+		return nil, err
+	}
+	if len(keywords) != len(normalized) {
+		found := make(map[string]bool, len(keywords))
+		for _, keyword := range keywords {
+			found[keyword.Word] = true
+		}
+		for _, word := range normalized {
+			if !found[word] {
+				return nil, fmt.Errorf("%w: 关键词不存在: %s", ErrInvalidPreference, word)
+			}
+		}
+	}
+	return keywords, nil
+}
+
+// GetOnboardingOptions 获取新用户引导中可选择的分类和热门关键词
+func (s *UserPreferenceService) GetOnboardingOptions(keywordLimit int) ([]models.Category, []OnboardingKeyword, error) {
+	var categories []models.Category
+	if err := s.DB.Order("id ASC").Find(&categories).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var keywords []OnboardingKeyword
+	if err := s.DB.Model(&models.Keyword{}).
+		Select("keywords.id, keywords.word, COUNT(novels.id) AS novel_count").
+		Joins("JOIN novel_keywords ON novel_keywords.keyword_id = keywords.id").
+		Joins("JOIN novels ON novels.id = novel_keywords.novel_id AND novels.status = ? AND novels.deleted_at IS NULL", "approved").
+		Group("keywords.id, keywords.word").
+		Order("novel_count DESC").
+		Limit(keywordLimit).
+		Scan(&keywords).Error; err != nil {
+		return nil, nil, err
+	}
+	return categories, keywords, nil
+}
+
+// MarkNotInterested 将小说标记为不感兴趣，之后的推荐中不再出现，相似小说降低权重
+func (s *UserPreferenceService) MarkNotInterested(userID, novelID uint, reason string) (*models.RecommendationFeedback, error) {
+	var novel models.Novel
+	if err := s.DB.Select("id").First(&novel, novelID).Error; err != nil {
+		return nil, err
+	}
+
+	feedback := models.RecommendationFeedback{
+		UserID:  userID,
+		NovelID: novelID,
+		Type:    FeedbackNotInterested,
+		Reason:  reason,
+	}
+	if err := s.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "novel_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"type", "reason", "updated_at"}),
+	}).Create(&feedback).Error; err != nil {
+		return nil, err
+	}
+	return &feedback, nil
+}
+
+// RemoveFeedback 撤销对小说的反馈，返回是否存在该反馈
+func (s *UserPreferenceService) RemoveFeedback(userID, novelID uint) (bool, error) {
+	result := s.DB.Unscoped().Where("user_id = ? AND novel_id = ?", userID, novelID).Delete(&models.RecommendationFeedback{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetFeedbacks 分页获取用户的推荐反馈，按时间倒序
+func (s *UserPreferenceService) GetFeedbacks(userID uint, page, limit int) ([]models.RecommendationFeedback, int64, error) {
+	var feedbacks []models.RecommendationFeedback
+	var total int64
+	query := s.DB.Model(&models.RecommendationFeedback{}).Where("user_id = ?", userID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * limit
+	if err := query.Preload("Novel").Order("updated_at DESC").Offset(offset).Limit(limit).Find(&feedbacks).Error; err != nil {
+		return nil, 0, err
+	}
+	return feedbacks, total, nil
+}
+
+// uniqueIDs 去除重复的ID
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	result := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// intersectIDs 返回同时出现在两个列表中的ID
+func intersectIDs(a, b []uint) []uint {
+	set := make(map[uint]bool, len(a))
+	for _, id := range a {
+		set[id] = true
+	}
+	result := make([]uint, 0)
+	for _, id := range uniqueIDs(b) {
+		if set[id] {
+			result = append(result, id)
+		}
+	}
+	return result
+}
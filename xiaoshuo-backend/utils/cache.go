@@ -104,4 +104,22 @@ func (c *CacheManager) GetWithDefault(key string, defaultValue interface{}) inte
 		return defaultValue
 	}
 	return value
-}
\ No newline at end of file
+}
+
+// AcquireLock 获取分布式锁（仅当键不存在时设置），owner 用于释放时校验锁的持有者
+func (c *CacheManager) AcquireLock(key, owner string, expiration time.Duration) (bool, error) {
+	return c.client.SetNX(ctx, key, owner, expiration).Result()
+}
+
+// releaseLockScript 仅当锁仍由 owner 持有时删除锁，避免误删其他实例的锁
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// ReleaseLock 释放由 owner 持有的分布式锁
+func (c *CacheManager) ReleaseLock(key, owner string) error {
+	return releaseLockScript.Run(ctx, c.client, []string{key}, owner).Err()
+}
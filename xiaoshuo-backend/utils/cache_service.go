@@ -14,6 +14,8 @@ var CacheKeys = struct {
 	NovelInfo     func(uint) string
 	NovelContent  func(uint) string
 	NovelChapters func(uint) string
+	NovelVolumes  func(uint) string
+	ChapterInfo   func(uint) string
 	NovelList     func(int, int, map[string]interface{}) string
 	CategoryList  string
 	RankingList   func(string) string
@@ -31,6 +33,12 @@ var CacheKeys = struct {
 	NovelChapters: func(id uint) string {
 		return fmt.Sprintf("novel:chapters:%d", id)
 	},
+	NovelVolumes: func(id uint) string {
+		return fmt.Sprintf("novel:volumes:%d", id)
+	},
+	ChapterInfo: func(id uint) string {
+		return fmt.Sprintf("chapter:info:%d", id)
+	},
 	NovelList: func(page, limit int, query map[string]interface{}) string {
 		return fmt.Sprintf("novel:list:page:%d:limit:%d:query:%v", page, limit, query)
 	},
@@ -135,7 +143,7 @@ func (s *CacheService) GetNovelContentWithCache(novelID uint) (string, error) {
 // GetChapterWithCache 从缓存获取章节内容，如果缓存不存在则从数据库获取
 func (s *CacheService) GetChapterWithCache(chapterID uint) (models.Chapter, error) {
 	var chapter models.Chapter
-	cacheKey := fmt.Sprintf("chapter:info:%d", chapterID)
+	cacheKey := CacheKeys.ChapterInfo(chapterID)
 
 	err := GlobalCache.GetOrSet(cacheKey, &chapter, 1*time.Hour, func() (interface{}, error) {
 		var dbChapter models.Chapter
@@ -170,6 +178,27 @@ func (s *CacheService) GetNovelChaptersWithCache(novelID uint) ([]models.Chapter
 	return chapters, nil
 }
 
+// GetNovelVolumesWithCache 从缓存获取小说分卷列表，如果缓存不存在则从数据库获取
+func (s *CacheService) GetNovelVolumesWithCache(novelID uint) ([]models.Volume, error) {
+	var volumes []models.Volume
+	cacheKey := CacheKeys.NovelVolumes(novelID)
+
+	err := GlobalCache.GetOrSet(cacheKey, &volumes, 1*time.Hour, func() (interface{}, error) {
+		var dbVolumes []models.Volume
+		result := models.DB.Where("novel_id = ?", novelID).Order("position ASC").Find(&dbVolumes)
+		if result.Error != nil {
+			return []models.Volume{}, result.Error
+		}
+		return dbVolumes, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return volumes, nil
+}
+
 // InvalidateNovelCache 失效小说相关缓存
 func (s *CacheService) InvalidateNovelCache(novelID uint) error {
 	// 删除小说信息缓存
@@ -181,6 +210,15 @@ func (s *CacheService) InvalidateNovelCache(novelID uint) error {
 	// 删除小说章节列表缓存
 	GlobalCache.Delete(CacheKeys.NovelChapters(novelID))
 
+	// 删除小说分卷列表缓存
+	GlobalCache.Delete(CacheKeys.NovelVolumes(novelID))
+
+	return nil
+}
+
+// InvalidateChapterCache 失效章节内容缓存
+func (s *CacheService) InvalidateChapterCache(chapterID uint) error {
+	GlobalCache.Delete(CacheKeys.ChapterInfo(chapterID))
 	return nil
 }
 
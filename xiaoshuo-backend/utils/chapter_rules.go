@@ -0,0 +1,267 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"xiaoshuo-backend/models"
+)
+
+// 章节标题规则类型
+const (
+	ChapterRuleVolume   = "volume"
+	ChapterRuleChapter  = "chapter"
+	ChapterRulePrologue = "prologue"
+	ChapterRuleEpilogue = "epilogue"
+	ChapterRuleNumbered = "numbered"
+)
+
+// ChapterTitleRule 编译后的章节标题识别规则
+type ChapterTitleRule struct {
+	Name      string
+	Type      string
+	Pattern   *regexp.Regexp
+	MaxLength int
+}
+
+// ChapterParseOptions TXT章节解析选项
+type ChapterParseOptions struct {
+	Rules             []ChapterTitleRule // 按顺序匹配的标题规则
+	MinChapterLength  int                // 章节最少字数
+	MergeTinyChapters bool               // 是否将过短章节合并到上一章
+	MaxTitleLength    int                // 章节标题最大字符数
+}
+
+// ChapterSplit 章节切分结果，包含命中的规则信息，用于预览
+type ChapterSplit struct {
+	Chapter     models.Chapter `json:"chapter"`
+	RuleName    string         `json:"rule_name"`    // 命中的规则名称
+	RuleType    string         `json:"rule_type"`    // 命中的规则类型
+	VolumeTitle string         `json:"volume_title"` // 所属分卷标题，空字符串表示未分卷
+	StartLine   int            `json:"start_line"`   // 标题所在行号
+	MergedCount int            `json:"merged_count"` // 合并进本章的过短章节数
+}
+
+// chapterNumerals 中文数字与阿拉伯数字
+const chapterNumerals = `[一二三四五六七八九十百千万零〇两壹贰叁肆伍陆柒捌玖拾佰仟\d]+`
+
+// DefaultChapterRules 默认的章节标题规则
+func DefaultChapterRules() []models.ChapterRule {
+	return []models.ChapterRule{
+		{
+			Name:        "卷标题",
+			Type:        ChapterRuleVolume,
+			Pattern:     `^(第` + chapterNumerals + `[卷部集]|卷` + chapterNumerals + `)([\s:：、·.].*)?$`,
+			Priority:    10,
+			Description: "匹配“第一卷 风起”“卷三”等卷标题",
+			IsActive:    true,
+		},
+		{
+			Name:        "章节标题",
+			Type:        ChapterRuleChapter,
+			Pattern:     `^第` + chapterNumerals + `[章节回话].*$`,
+			Priority:    20,
+			Description: "匹配“第一章 开端”“第12回”等章节标题",
+			IsActive:    true,
+		},
+		{
+			Name:        "英文章节",
+			Type:        ChapterRuleChapter,
+			Pattern:     `(?i)^chapter\s+\d+([\s:.\-].*)?$`,
+			Priority:    30,
+			Description: "匹配“Chapter 1”等英文章节标题",
+			IsActive:    true,
+		},
+		{
+			Name:        "序章",
+			Type:        ChapterRulePrologue,
+			Pattern:     `(?i)^(序章|序言|序|楔子|引子|前言|prologue)([\s:：、].*)?$`,
+			Priority:    40,
+			Description: "匹配序章、楔子、引子等",
+			IsActive:    true,
+		},
+		{
+			Name:        "尾声",
+			Type:        ChapterRuleEpilogue,
+			Pattern:     `(?i)^(尾声|后记|终章|完本感言|番外` + chapterNumerals + `?|epilogue)([\s:：、].*)?$`,
+			Priority:    50,
+			Description: "匹配尾声、后记、番外等",
+			IsActive:    true,
+		},
+		{
+			Name:        "数字编号",
+			Type:        ChapterRuleNumbered,
+			Pattern:     `^\d{1,4}[.、．]\s*[^\s。，；！？…,;!?]{1,30}$`,
+			Priority:    60,
+			MaxLength:   20,
+			Description: "匹配“12. 标题”形式的编号标题，编号后必须有标题且不能是句子",
+			IsActive:    true,
+		},
+	}
+}
+
+// DefaultChapterParseSetting 默认的章节解析设置
+func DefaultChapterParseSetting() models.ChapterParseSetting {
+	return models.ChapterParseSetting{
+		MinChapterLength:  20,
+		MergeTinyChapters: true,
+		MaxTitleLength:    40,
+	}
+}
+
+// CompileChapterRules 编译章节标题规则，忽略未启用的规则
+func CompileChapterRules(rules []models.ChapterRule) ([]ChapterTitleRule, error) {
+	compiled := make([]ChapterTitleRule, 0, len(rules))
+	for _, rule := range rules {
+		if !rule.IsActive {
+			continue
+		}
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("规则 %s 的正则表达式无效: %v", rule.Name, err)
+		}
+		compiled = append(compiled, ChapterTitleRule{
+			Name:      rule.Name,
+			Type:      rule.Type,
+			Pattern:   pattern,
+			MaxLength: rule.MaxLength,
+		})
+	}
+	return compiled, nil
+}
+
+// NewChapterParseOptions 根据规则和设置构建解析选项
+func NewChapterParseOptions(rules []models.ChapterRule, setting models.ChapterParseSetting) (ChapterParseOptions, error) {
+	compiled, err := CompileChapterRules(rules)
+	if err != nil {
+		return ChapterParseOptions{}, err
+	}
+	return ChapterParseOptions{
+		Rules:             compiled,
+		MinChapterLength:  setting.MinChapterLength,
+		MergeTinyChapters: setting.MergeTinyChapters,
+		MaxTitleLength:    setting.MaxTitleLength,
+	}, nil
+}
+
+// LoadChapterParseOptions 从数据库加载章节解析规则和设置，没有配置时使用默认值
+func LoadChapterParseOptions() ChapterParseOptions {
+	rules := DefaultChapterRules()
+	setting := DefaultChapterParseSetting()
+
+	if models.DB != nil {
+		var dbRules []models.ChapterRule
+		if err := models.DB.Order("priority ASC, id ASC").Find(&dbRules).Error; err == nil && len(dbRules) > 0 {
+			rules = dbRules
+		}
+		var dbSetting models.ChapterParseSetting
+		if err := models.DB.First(&dbSetting).Error; err == nil {
+			setting = dbSetting
+		}
+	}
+
+	options, err := NewChapterParseOptions(rules, setting)
+	if err != nil {
+		// 数据库中的规则无效时回退到默认规则
+		options, _ = NewChapterParseOptions(DefaultChapterRules(), setting)
+	}
+	return options
+}
+
+// MatchTitle 判断行是否为章节标题，返回命中的规则
+func (o ChapterParseOptions) MatchTitle(line string) (*ChapterTitleRule, bool) {
+	length := len([]rune(line))
+	if length == 0 {
+		return nil, false
+	}
+	for i := range o.Rules {
+		rule := &o.Rules[i]
+		maxLength := rule.MaxLength
+		if maxLength <= 0 {
+			maxLength = o.MaxTitleLength
+		}
+		if maxLength > 0 && length > maxLength {
+			continue
+		}
+		if rule.Pattern.MatchString(line) {
+			return rule, true
+		}
+	}
+	return nil, false
+}
+
+// SplitChapters 按规则将文本行切分为章节
+func (o ChapterParseOptions) SplitChapters(lines []string) []ChapterSplit {
+	var splits []ChapterSplit
+	var current *ChapterSplit
+	var content strings.Builder
+	currentVolume := ""
+
+	finish := func() {
+		if current == nil {
+			return
+		}
+		current.Chapter.Content = content.String()
+		content.Reset()
+		if current.Chapter.Content != "" {
+			splits = append(splits, *current)
+		}
+		current = nil
+	}
+
+	for i, line := range lines {
+		trimmedLine := strings.TrimSpace(line)
+		if rule, ok := o.MatchTitle(trimmedLine); ok {
+			finish()
+			// 卷标题开始新的分卷，卷标题后紧跟的正文（如卷首语）作为该卷的一个章节
+			if rule.Type == ChapterRuleVolume {
+				currentVolume = trimmedLine
+			}
+			current = &ChapterSplit{
+				Chapter:     models.Chapter{Title: trimmedLine},
+				RuleName:    rule.Name,
+				RuleType:    rule.Type,
+				VolumeTitle: currentVolume,
+				StartLine:   i + 1,
+			}
+			continue
+		}
+		// 如果当前有章节，将当前行添加到章节内容中
+		if current != nil {
+			if content.Len() > 0 {
+				content.WriteString("\n")
+			}
+			content.WriteString(line)
+		}
+	}
+	finish()
+
+	if o.MergeTinyChapters && o.MinChapterLength > 0 {
+		splits = o.mergeTinyChapters(splits)
+	}
+
+	for i := range splits {
+		splits[i].Chapter.Position = i + 1
+		splits[i].Chapter.WordCount = calculateWordCount(splits[i].Chapter.Content)
+	}
+
+	return splits
+}
+
+// mergeTinyChapters 将字数过少的章节（通常是误识别的标题）连同标题合并到上一章
+// 卷标题不参与合并，也不跨分卷合并
+func (o ChapterParseOptions) mergeTinyChapters(splits []ChapterSplit) []ChapterSplit {
+	merged := make([]ChapterSplit, 0, len(splits))
+	for _, split := range splits {
+		tiny := calculateWordCount(split.Chapter.Content) < o.MinChapterLength
+		if tiny && split.RuleType != ChapterRuleVolume && len(merged) > 0 &&
+			merged[len(merged)-1].VolumeTitle == split.VolumeTitle {
+			prev := &merged[len(merged)-1]
+			prev.Chapter.Content += "\n" + split.Chapter.Title + "\n" + split.Chapter.Content
+			prev.MergedCount += 1 + split.MergedCount
+			continue
+		}
+		merged = append(merged, split)
+	}
+	return merged
+}
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 点击缓冲区的Redis键
+const (
+	clickPendingKey    = "clicks:pending"   // 待汇总的小时区间集合
+	clickHourKeyPrefix = "clicks:hour:"     // 小时区间内各小说的点击数（Hash）
+	clickRejectPrefix  = "clicks:rejected:" // 小时区间内各小说被拦截的点击数（Hash）
+	clickUVHourPrefix  = "clicks:uv:hour:"  // 小时区间内小说的独立读者（HyperLogLog）
+	clickUVDayPrefix   = "clicks:uv:day:"   // 当天小说的独立读者（HyperLogLog）
+	clickDonePrefix    = "clicks:done:"     // 已汇总结束的小时区间标记
+	clickKeyTTL        = 8 * 24 * time.Hour // 缓冲区键的保留时间，防止汇总任务长时间停止时无限增长
+	ClickHourLayout    = "2006010215"       // 小时区间标识格式
+	clickDayLayout     = "20060102"         // 天区间标识格式
+)
+
+// ErrClickBucketFinished 点击所在的小时区间已汇总结束，不再接受写入
+var ErrClickBucketFinished = errors.New("点击所在的小时区间已汇总结束")
+
+// ClickBucketStat 小时区间内单本小说的缓冲点击统计
+type ClickBucketStat struct {
+	NovelID    uint
+	Clicks     int64 // 区间内点击次数
+	Rejected   int64 // 区间内被拦截的点击次数
+	HourUnique int64 // 区间内独立读者数
+	DayUnique  int64 // 区间所在当天的独立读者数
+}
+
+// recordClickScript 区间未结束时累加点击数并记录独立读者，区间已结束时返回0
+// 汇总按区间累计值覆盖聚合表，结束后重新写入的点击会覆盖已汇总的数据，因此直接拒绝
+var recordClickScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[5]) == 1 then
+	return 0
+end
+redis.call("HINCRBY", KEYS[1], ARGV[1], 1)
+redis.call("EXPIRE", KEYS[1], ARGV[4])
+redis.call("PFADD", KEYS[2], ARGV[2])
+redis.call("EXPIRE", KEYS[2], ARGV[4])
+redis.call("PFADD", KEYS[3], ARGV[2])
+redis.call("EXPIRE", KEYS[3], ARGV[4])
+redis.call("SADD", KEYS[4], ARGV[3])
+return 1
+`)
+
+// recordRejectedClickScript 区间未结束时累加被拦截的点击数，区间已结束时返回0
+var recordRejectedClickScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[3]) == 1 then
+	return 0
+end
+redis.call("HINCRBY", KEYS[1], ARGV[1], 1)
+redis.call("EXPIRE", KEYS[1], ARGV[3])
+redis.call("SADD", KEYS[2], ARGV[2])
+return 1
+`)
+
+// RecordClick 将一次点击写入Redis缓冲区，reader 为读者标识（用户ID或IP等），用于统计独立读者
+// 所在小时区间已汇总结束时返回 ErrClickBucketFinished
+func (c *CacheManager) RecordClick(novelID uint, reader string, at time.Time) error {
+	hour := at.Format(ClickHourLayout)
+	day := at.Format(clickDayLayout)
+	keys := []string{
+		clickHourKeyPrefix + hour,
+		fmt.Sprintf("%s%s:%d", clickUVHourPrefix, hour, novelID),
+		fmt.Sprintf("%s%s:%d", clickUVDayPrefix, day, novelID),
+		clickPendingKey,
+		clickDonePrefix + hour,
+	}
+	recorded, err := recordClickScript.Run(ctx, c.client, keys,
+		strconv.FormatUint(uint64(novelID), 10), reader, hour, int64(clickKeyTTL/time.Second)).Int()
+	if err != nil {
+		return err
+	}
+	if recorded == 0 {
+		return ErrClickBucketFinished
+	}
+	return nil
+}
+
+// RecordRejectedClick 记录一次被拦截的点击，用于异常点击报告
+// 所在小时区间已汇总结束时返回 ErrClickBucketFinished
+func (c *CacheManager) RecordRejectedClick(novelID uint, at time.Time) error {
+	hour := at.Format(ClickHourLayout)
+	keys := []string{clickRejectPrefix + hour, clickPendingKey, clickDonePrefix + hour}
+	recorded, err := recordRejectedClickScript.Run(ctx, c.client, keys,
+		strconv.FormatUint(uint64(novelID), 10), hour, int64(clickKeyTTL/time.Second)).Int()
+	if err != nil {
+		return err
+	}
+	if recorded == 0 {
+		return ErrClickBucketFinished
+	}
+	return nil
+}
+
+// PendingClickBuckets 获取有待汇总点击的小时区间
+func (c *CacheManager) PendingClickBuckets() ([]string, error) {
+	return c.client.SMembers(ctx, clickPendingKey).Result()
+}
+
+// GetClickBucket 读取小时区间内各小说的累计点击数和独立读者数
+func (c *CacheManager) GetClickBucket(hour string) ([]ClickBucketStat, error) {
+	start, err := time.ParseInLocation(ClickHourLayout, hour, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("无效的点击区间 %s: %v", hour, err)
+	}
+	day := start.Format(clickDayLayout)
+
+	counts, err := c.client.HGetAll(ctx, clickHourKeyPrefix+hour).Result()
+	if err != nil {
+		return nil, err
+	}
+	rejected, err := c.client.HGetAll(ctx, clickRejectPrefix+hour).Result()
+	if err != nil {
+		return nil, err
+	}
+	// 只有被拦截点击的小说也需要汇总
+	for field := range rejected {
+		if _, ok := counts[field]; !ok {
+			counts[field] = "0"
+		}
+	}
+
+	stats := make([]ClickBucketStat, 0, len(counts))
+	for field, value := range counts {
+		novelID, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			continue
+		}
+		clicks, _ := strconv.ParseInt(value, 10, 64)
+		stat := ClickBucketStat{NovelID: uint(novelID), Clicks: clicks}
+		stat.Rejected, _ = strconv.ParseInt(rejected[field], 10, 64)
+		if stat.HourUnique, err = c.client.PFCount(ctx, fmt.Sprintf("%s%s:%d", clickUVHourPrefix, hour, novelID)).Result(); err != nil {
+			return nil, err
+		}
+		if stat.DayUnique, err = c.client.PFCount(ctx, fmt.Sprintf("%s%s:%d", clickUVDayPrefix, day, novelID)).Result(); err != nil {
+			return nil, err
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+// FinishClickBucket 小时区间结束并汇总完成后删除缓冲的点击数，并标记区间已结束，之后不再接受该区间的点击
+// 独立读者的HyperLogLog保留到过期，当天后续区间汇总时仍需要统计当天的独立读者
+func (c *CacheManager) FinishClickBucket(hour string) error {
+	pipe := c.client.TxPipeline()
+	pipe.Set(ctx, clickDonePrefix+hour, 1, clickKeyTTL)
+	pipe.Del(ctx, clickHourKeyPrefix+hour, clickRejectPrefix+hour)
+	pipe.SRem(ctx, clickPendingKey, hour)
+	_, err := pipe.Exec(ctx)
+	return err
+}
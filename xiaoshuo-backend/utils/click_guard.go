@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 点击防刷的Redis键
+const (
+	clickRatePrefix = "clicks:rate:" // 单个IP在时间窗口内的点击次数
+	clickSeenPrefix = "clicks:seen:" // 读者在去重窗口内已点击过的小说
+)
+
+// IncrClickRate 累加IP在当前时间窗口内的点击次数，返回累加后的次数
+func (c *CacheManager) IncrClickRate(ip string, window time.Duration) (int64, error) {
+	slot := time.Now().Unix() / int64(window/time.Second)
+	key := fmt.Sprintf("%s%s:%d", clickRatePrefix, ip, slot)
+
+	pipe := c.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// MarkClickSeen 在去重窗口内标记读者已点击小说，identities 为同一请求的多个读者标识（用户、IP、设备指纹）
+// 任一标识在窗口内已点击过该小说时返回 true
+func (c *CacheManager) MarkClickSeen(novelID uint, identities []string, window time.Duration) (bool, error) {
+	pipe := c.client.TxPipeline()
+	results := make([]*redis.BoolCmd, len(identities))
+	for i, identity := range identities {
+		key := fmt.Sprintf("%s%d:%s", clickSeenPrefix, novelID, identity)
+		results[i] = pipe.SetNX(ctx, key, 1, window)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	for _, result := range results {
+		if !result.Val() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
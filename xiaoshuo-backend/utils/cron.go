@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule 解析后的cron表达式（分 时 日 月 周）
+type CronSchedule struct {
+	Expression string
+	minutes    uint64
+	hours      uint64
+	days       uint64
+	months     uint64
+	weekdays   uint64
+	// 日和周同时受限（不以 * 开头）时，按cron惯例任一匹配即可
+	dayRestricted     bool
+	weekdayRestricted bool
+}
+
+// cronField cron表达式单个字段的取值范围
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"分钟", 0, 59},
+	{"小时", 0, 23},
+	{"日期", 1, 31},
+	{"月份", 1, 12},
+	{"星期", 0, 7},
+}
+
+// cronMacros 常用的cron表达式别名
+var cronMacros = map[string]string{
+	"@yearly":  "0 0 1 1 *",
+	"@monthly": "0 0 1 * *",
+	"@weekly":  "0 0 * * 0",
+	"@daily":   "0 0 * * *",
+	"@hourly":  "0 * * * *",
+}
+
+// ParseCronExpression 解析标准5段cron表达式，支持 *、列表(,)、范围(-)、步长(/) 以及 @daily 等别名
+// 星期字段中0和7都表示周日
+func ParseCronExpression(expression string) (*CronSchedule, error) {
+	spec := strings.TrimSpace(expression)
+	if macro, ok := cronMacros[spec]; ok {
+		spec = macro
+	}
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("cron表达式必须包含5个字段: %s", expression)
+	}
+
+	values := make([]uint64, len(parts))
+	for i, part := range parts {
+		bits, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron表达式 %s 无效: %v", expression, err)
+		}
+		values[i] = bits
+	}
+
+	// 星期7等同于星期0
+	if values[4]&(1<<7) != 0 {
+		values[4] |= 1
+	}
+
+	return &CronSchedule{
+		Expression:        expression,
+		minutes:           values[0],
+		hours:             values[1],
+		days:              values[2],
+		months:            values[3],
+		weekdays:          values[4],
+		dayRestricted:     !strings.HasPrefix(parts[2], "*"),
+		weekdayRestricted: !strings.HasPrefix(parts[4], "*"),
+	}, nil
+}
+
+// parseCronField 将单个字段解析为取值的位图
+func parseCronField(field string, spec cronField) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		step := 1
+		if index := strings.Index(item, "/"); index >= 0 {
+			value, err := strconv.Atoi(item[index+1:])
+			if err != nil || value <= 0 {
+				return 0, fmt.Errorf("%s字段的步长无效: %s", spec.name, item)
+			}
+			step = value
+			item = item[:index]
+		}
+
+		start, end := spec.min, spec.max
+		switch {
+		case item == "*":
+		case strings.Contains(item, "-"):
+			bounds := strings.SplitN(item, "-", 2)
+			var err1, err2 error
+			start, err1 = strconv.Atoi(bounds[0])
+			end, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("%s字段的范围无效: %s", spec.name, item)
+			}
+		default:
+			value, err := strconv.Atoi(item)
+			if err != nil {
+				return 0, fmt.Errorf("%s字段的值无效: %s", spec.name, item)
+			}
+			start = value
+			// 带步长的单个值表示从该值开始到最大值
+			if step == 1 {
+				end = value
+			}
+		}
+
+		if start < spec.min || end > spec.max || start > end {
+			return 0, fmt.Errorf("%s字段超出范围 %d-%d: %s", spec.name, spec.min, spec.max, item)
+		}
+		for value := start; value <= end; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+// Next 返回晚于给定时间的下一个触发时间（精确到分钟），五年内没有匹配时返回零值
+func (s *CronSchedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// matchDay 判断日期是否匹配日和星期字段
+func (s *CronSchedule) matchDay(t time.Time) bool {
+	dayMatch := s.days&(1<<uint(t.Day())) != 0
+	weekdayMatch := s.weekdays&(1<<uint(t.Weekday())) != 0
+	if s.dayRestricted && s.weekdayRestricted {
+		return dayMatch || weekdayMatch
+	}
+	return dayMatch && weekdayMatch
+}
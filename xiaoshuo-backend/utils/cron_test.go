@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronExpressionInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@never",
+	}
+	for _, expression := range tests {
+		if _, err := ParseCronExpression(expression); err == nil {
+			t.Errorf("ParseCronExpression(%q) succeeded, want error", expression)
+		}
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	// 2024-01-01 是周一
+	after := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		expression string
+		after      time.Time
+		want       time.Time
+	}{
+		{"* * * * *", after, time.Date(2024, 1, 1, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", after, time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{"0 3 * * *", after, time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)},
+		{"@hourly", after, time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"@daily", after, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", after, time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", after, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", after, time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", after, time.Date(2024, 1, 2, 9, 30, 0, 0, time.UTC)},
+		{"0 12 1,15 * *", after, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{"0 9 1,15 * *", after, time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", after, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 4 *", after, time.Time{}},
+		// 日和星期都受限时任一匹配即可：1月5日或周三
+		{"0 0 5 * 3", after, time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+		// 以 * 开头的带步长字段不算受限，必须同时匹配星期
+		{"0 0 */2 * 1", after, time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 10 * */2", after, time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		schedule, err := ParseCronExpression(tt.expression)
+		if err != nil {
+			t.Errorf("ParseCronExpression(%q): %v", tt.expression, err)
+			continue
+		}
+		if got := schedule.Next(tt.after); !got.Equal(tt.want) {
+			t.Errorf("%q.Next(%v) = %v, want %v", tt.expression, tt.after, got, tt.want)
+		}
+	}
+}
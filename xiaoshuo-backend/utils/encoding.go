@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// 支持识别的文本编码
+const (
+	EncodingUTF8    = "UTF-8"
+	EncodingUTF16LE = "UTF-16LE"
+	EncodingUTF16BE = "UTF-16BE"
+	EncodingGB18030 = "GB18030"
+	EncodingBig5    = "Big5"
+)
+
+// commonHanzi 常用汉字（含简繁两种写法），用于统计判断GBK/Big5解码结果是否合理
+const commonHanzi = "的一是不了人我在有他这个们中来上大为和国地到以说时要就出会可也你对生能而子那得于着下自之年过发后作里用道行所然家种事成方多经么去法学如都同现当没动面起看定天分还进好小部其些主样理心她本前开但因只从想实日军者意无力它与长把机十民第公此已工使情明性知全三又关点正业外将两高间由问很最重并物手应战向头文体政美相见被利什二等产或新己制身果加西斯月话合回特代内信表化老给世位次度门任常先海通教儿原东声提立及比员解水名真论处走义各入几口认条平系气题活尔更别打女变四神总何电数安少报才结反受目太量再感建务做接必场件计管期市直德资命山金指克许统区保至队形社便空决治展马科司五基眼书非则听白却界达光放强即像难且权思王象完设式色路记南品住告类求据程北边死张该交规万取拉格望觉术领共确传师观清今切院让识候带导争运笑飞风步改收根干造言联持组每济车亲极林服快办议往元英士证近失转夫令准布始怎呢存未远叫台单影具罗字爱击流备兵连调深商算质团集百需价花党华城石级整府离况亚请技际约示复病息究线似官火断精满支视消越器容照须九增研写称企八功吗包片史委乎查轻易早曾除农找装广显吧阿李标谈吃图念六引历首医局突专费号尽另周较注语仅考落青随选列武红响虽推势参希古众构房半节土投某案黑维革划敌致陈律足态护七兴派孩验责营星够章音跟志底站严巴例防族供效续施留讲型料终答紧黄绝奇察母京段依批群项故按河米围江织害斗双境客纪采举杀攻父苏密低朝友诉止细愿千值仍男钱破网热助倒育属坐帝限船脸职速刻乐否刚威毛状率甚独球般普怕弹校苦创假久错承印晚兰试股拿脑预谁益阳若哪微尼继送急血惊伤素药适波夜省初喜卫源食险待述陆习置居劳财环排福纳欢雷警获模充负云停木游龙树疑层冷洲冲射略范竟句室异激汉村哈策演简卡罪判担州静退既衣您宗积余痛检差富灵协角占配征修皮挥胜降阶审沉坚善妈刘读啊超免压银买皇养伊怀执副乱抗犯追帮宣佛岁航优怪香著田铁控税左右份穿艺背阵草脚概恶块顿敢守酒岛托央户烈洋哥索胡款靠评版宝座释景顾弟登货互付伯慢欧换闻危忙核暗姐介坏讨丽良序升监临亮露永呼味野架域沙掉括舰鱼杂误湾吉减编楚肯测败屋跑梦散温困剑渐封救贵枪缺楼县尚毫移娘朋画班智亦耳恩短掌恐遗固席松秘谢鲁遇康虑幸均销钟诗藏赶剧票损忽巨炮旧端探湖录叶春乡附吸予礼港雨呀板庭妇归睛饭额含顺输摇招婚脱补谓督毒油疗旅泽材灭逐莫笔亡鲜词圣择寻厂睡博勒烟授诺伦岸奥唐卖俄炸载洛健堂旁宫喝借君禁阴园谋宋避抓荣姑孙逃牙束跳顶玉镇雪午练迫爷篇肉嘴馆遍凡础洞卷坦牛宁纸诸训私庄祖丝翻暴森塔默握戏隐熟骨访弱蒙歌店鬼软典欲萨伙遭盘爸扩盖弄雄稳忘亿刺拥徒姆杨齐赛趣曲刀床迎冰虚玩析窗醒妻透购替塞努休虎扬途侵刑绿兄迅套贸毕唯谷轮库迹尤竞街促延震弃甲伟麻川申缓潜闪售灯针哲络抵朱埃抱鼓植纯夏忍页杰筑折郑贝尊吴秀混臣雅振染盛怒舞圆搞狂措姓残秋培迷诚宽宇猛摆梅毁伸摩盟末乃悲拍丁赵硬麦蒋操耶阻订彩抽赞魔纷沿喊违妹浪汇币丰蓝殊献桌啦瓦莱援译夺汽烧距裁偏符勇触课敬哭懂墙袭召罚侠厅拜巧侧韩冒债曼融惯享戴童犹乘挂奖绍厚纵障讯涉彻刊丈爆乌役描洗玛患妙镜唱烦签仙彼弗症仿倾牌陷鸟轰咱菜闭奋庆撤泪茶疾缘播朗杜奶季丹狗尾仪偷奔珠虫驻孔宜艾桥淡翼恨繁寒伴叹旦愈潮粮缩罢聚径恰挑袋灰捕徐珍幕映裂泰隔启尖忠累炎暂估泛荒偿横拒瑞忆孤鼻闹羊呆厉衡胞零穷舍码赫婆魂灾洪腿胆津俗辩胸晓劲贫仁偶辑邦恢赖圈摸仰润堆碰艇稍迟辆废净凶署壁御奉旋冬矿抬蛋晨伏吹鸡倍糊秦盾杯租骑乏隆诊奴摄丧污渡旗甘耐凭扎抢绪粗肩梁幻菲皆碎宙叔岩荡综爬荷悉蒂返井壮薄悄扫敏碍殖详迪矛霍允幅撒剩凯颗骂赏液番箱贴漫酸郎腰舒眉忧浮辛恋餐吓挺励辞艘键伍峰尺昨黎辈贯侦滑券崇扰宪绕趋慈乔阅汗枝拖墨胁插箭腊粉泥氏彭拔骗凤慧媒佩愤扑龄驱惜豪掩兼跃尸肃帕驶堡届欣惠册储飘桑闲惨洁踪勃宾频仇磨递邪撞拟滚奏巡颜剂绩贡疯坡瞧截燃焦殿伪柳锁逼颇昏劝呈搜勤戒驾漂饮曹朵仔柔俩孟腐幼践籍牧凉牲佳娜浓芳稿竹腹跌逻垂遵脉貌柏狱猜怜惑陶兽帐饰贷昌叙躺钢沟寄扶铺邓寿惧询汤盗肥尝匆辉奈扣廷澳嘛董迁凝慰厌脏腾幽怨鞋丢埋泉涌辖躲晋紫艰魏吾慌祝邮吐狠鉴曰械咬邻赤挤弯椅陪割揭韦悟聪雾锋梯猫祥阔誉筹丛牵鸣沈阁穆屈旨袖猎臂蛇贺柱抛鼠瑟戈牢逊迈欺吨琴衰瓶恼燕仲诱狼池疼卢仗冠粒遥吕玄尘冯抚浅敦纠钻晶岂峡苍喷耗凌敲菌赔涂粹扁亏寂煤熊恭湿循暖糖赋抑秩帽哀宿踏烂袁侯抖夹昆肝擦猪炼恒慎搬纽纹玻渔磁铜齿跨押怖漠疲叛遣兹祭醉拳弥斜档稀捷肤疫肿豆削岗晃吞宏癌肚隶履涨耀扭坛拨沃绘伐堪仆郭牺歼墓雇廉契拼惩捉覆刷劫嫌瓜歇雕闷乳串娃缴唤赢莲霸桃妥瘦搭赴岳嘉舱俊址庞耕锐缝悔邀玲惟斥宅添挖呵讼氧浩羽斤酷掠妖祸侍乙妨贪挣汪尿莉悬唇翰仓轨枚盐览傅帅庙芬屏寺胖璃愚滴疏萧姿颤丑劣柯寸扔盯辱匹俱辨饿蜂哦腔郁溃谨糟葛苗肠忌溜鸿爵鹏鹰笼丘桂滋聊挡纲肌茨壳痕碗穴膀卓贤卧膜毅锦欠哩函茫昂薛皱夸豫胃舌剥傲拾窝睁携陵哼棉晴铃填饲渴吻扮逆脆喘罩卜炉柴愉绳胎蓄眠竭喂傻慕浑奸扇柜悦拦诞饱乾泡贼亭夕爹酬儒姻卵氛泄杆挨僧蜜吟猩遂狭肖甜霞驳裕顽於摘矮秒卿畜咽披辅勾盆疆赌塑畏吵囊嗯泊肺骤缠冈羞瞪吊贾漏斑涛悠鹿俘锡卑葬铭滩嫁催璇翅盒蛮矣潘歧赐鲍锅廊拆灌勉盲宰佐啥胀扯禧辽抹筒棋裤唉朴咐孕誓喉妄拘链驰栏逝窃艳臭纤玑棵趁匠盈翁愁瞬婴孝颈倘浙谅蔽畅赠妮莎尉冻跪闯葡後厨鸭颠遮谊圳吁仑辟瘤嫂陀框谭亨钦庸歉芝吼甫衫摊宴嘱衷娇陕矩浦讶耸裸碧摧薪淋耻胶屠鹅饥盼脖虹翠崩账萍逢赚撑翔倡绵猴枯巫昭怔渊凑溪蠢禅阐旺寓藤匪伞碑挪琼脂谎慨菩萄狮掘抄岭晕逮砍掏狄晰罕挽脾舟痴蔡剪脊弓懒叉拐喃僚捐姊骚拓歪粘柄坑陌窄湘兆崖骄刹鞭芒筋聘钩棍嚷腺弦焰耍俯厘愣厦恳饶钉寡憾摔叠惹喻谱愧煌徽溶坠煞巾滥洒堵瓷咒姨棒郡浴媚稣淮哎屁漆淫巢吩撰啸滞玫硕钓蝶膝姚茂躯吏猿寨恕渠戚辰舶颁惶狐讽笨袍嘲啡泼衔倦涵雀旬僵撕肢垄夷逸茅侨舆窑涅蒲谦杭噢弊勋刮郊凄捧浸砖鼎篮蒸饼亩肾陡爪兔殷贞荐哑炭坟眨搏咳拢舅昧擅爽咖搁禄雌哨巩绢螺裹昔轩谬谍龟媳姜瞎冤鸦蓬巷琳栽沾诈斋瞒彪厄咨纺罐桶壤糕颂膨谐垒咕隙辣绑宠嘿兑霉挫稽辐乞纱裙嘻哇绣杖塘衍轴攀膊譬斌祈踢肆坎轿棚泣屡躁邱凰溢椎砸趟帘帆栖窜丸斩堤塌贩厢掀喀乖谜捏阎滨虏匙芦苹卸沼钥株祷剖熙哗劈怯棠胳桩瑰娱娶沫嗓蹲焚淘嫩韵衬匈钧竖峻豹捞菊鄙魄兜哄颖镑屑蚁壶怡渗秃迦旱哟咸焉谴宛稻铸锻伽詹毙恍贬烛骇芯汁桓坊驴朽靖佣汝碌迄冀荆崔雁绅珊榜诵傍彦醇笛禽勿娟瞄幢寞睹贿踩霆呜拱妃蔑谕缚诡篷淹腕煮倩卒勘馨逗甸贱炒灿敞蜡囚栗辜垫妒魁谣寇蛙愕屉蔬韬虐哥邵邑渝蓉" +
+	"們來為國這個說時會對過後發從當經動種實現麼於還進無間與開長門見問機關頭點學應體車義師業書東裡樣幾數聽軍氣電氣將兩報讓題變邊話給員區強隊場樂條總論結處難該認聲請員萬傳觀設術極號線驗離華單帶歡習網師燈親醫陽權氣記計錢嗎劍陣戰鬥讀寫買賣聖靈魔獸龍鳳鐵飛風雲臉歲愛語誰這裏說話"
+
+// commonHanziSet 常用汉字集合
+var commonHanziSet = func() map[rune]bool {
+	set := make(map[rune]bool, len([]rune(commonHanzi)))
+	for _, r := range commonHanzi {
+		set[r] = true
+	}
+	return set
+}()
+
+// DetectEncoding 检测文本数据的编码
+// 依次检查BOM、无BOM的UTF-16、合法UTF-8，最后对GB18030和Big5解码结果做常用字统计
+func DetectEncoding(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return EncodingUTF8
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return EncodingUTF16LE
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return EncodingUTF16BE
+	}
+
+	if encodingName := detectUTF16WithoutBOM(data); encodingName != "" {
+		return encodingName
+	}
+
+	if utf8.Valid(data) {
+		return EncodingUTF8
+	}
+
+	// 末尾可能被截断了半个字符，去掉后再判断一次
+	if len(data) > 3 {
+		for i := 1; i <= 3; i++ {
+			if utf8.Valid(data[:len(data)-i]) && !utf8.Valid(data[len(data)-i:]) {
+				return EncodingUTF8
+			}
+		}
+	}
+
+	gbScore := scoreDecodedText(data, simplifiedchinese.GB18030)
+	big5Score := scoreDecodedText(data, traditionalchinese.Big5)
+	if big5Score > gbScore {
+		return EncodingBig5
+	}
+	return EncodingGB18030
+}
+
+// DecodeToUTF8 检测数据编码并转换为UTF-8（去除BOM），返回转换后的数据和检测到的编码
+// 解码结果包含过多无法识别的字符时返回错误
+func DecodeToUTF8(data []byte) ([]byte, string, error) {
+	encodingName := DetectEncoding(data)
+
+	var decoded []byte
+	var err error
+	switch encodingName {
+	case EncodingUTF8:
+		decoded = bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})
+	case EncodingUTF16LE:
+		decoded, err = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder().Bytes(data)
+	case EncodingUTF16BE:
+		decoded, err = unicode.UTF16(unicode.BigEndian, unicode.UseBOM).NewDecoder().Bytes(data)
+	case EncodingGB18030:
+		decoded, err = simplifiedchinese.GB18030.NewDecoder().Bytes(data)
+	case EncodingBig5:
+		decoded, err = traditionalchinese.Big5.NewDecoder().Bytes(data)
+	}
+	if err != nil {
+		return nil, encodingName, fmt.Errorf("按%s编码解码失败: %v", encodingName, err)
+	}
+
+	// 无法映射的字节会被替换为U+FFFD，超过千分之五视为解码失败
+	total := utf8.RuneCount(decoded)
+	invalid := bytes.Count(decoded, []byte(string(utf8.RuneError)))
+	if total > 0 && invalid*200 > total {
+		return nil, encodingName, fmt.Errorf("无法识别文件编码，%d个字符解码失败", invalid)
+	}
+	if encodingName != EncodingUTF8 && total > 0 && commonHanziRatio(decoded) == 0 && !isMostlyASCII(decoded) {
+		return nil, encodingName, fmt.Errorf("无法识别文件编码")
+	}
+
+	return decoded, encodingName, nil
+}
+
+// ReadTextFileContent 读取文本文件并转换为UTF-8，返回内容和原始编码
+func ReadTextFileContent(filepath string) (string, string, error) {
+	fileInfo, err := os.Stat(filepath)
+	if err != nil {
+		return "", "", err
+	}
+
+	// 限制文件大小为50MB
+	const maxFileSize = 50 * 1024 * 1024
+	if fileInfo.Size() > maxFileSize {
+		return "", "", fmt.Errorf("文件过大，超过50MB限制")
+	}
+
+	data, err := os.ReadFile(filepath)
+	if err != nil {
+		return "", "", err
+	}
+	decoded, encodingName, err := DecodeToUTF8(data)
+	if err != nil {
+		return "", encodingName, err
+	}
+	return string(decoded), encodingName, nil
+}
+
+// detectUTF16WithoutBOM 根据零字节分布判断无BOM的UTF-16文本
+// UTF-8和GBK文本中的零字节只是偶尔出现的杂质，不能据此判断；要求换行符全部落在同一字节序，
+// 或零字节集中在奇数或偶数位置，并且按该字节序解码后是合理的文本
+func detectUTF16WithoutBOM(data []byte) string {
+	if len(data) < 4 || len(data)%2 != 0 {
+		return ""
+	}
+	sample := data
+	if len(sample) > 4096 {
+		sample = sample[:4096]
+	}
+	units := len(sample) / 2
+
+	evenZero, oddZero := 0, 0
+	evenNewline, oddNewline := 0, 0
+	for i := 0; i+1 < len(sample); i += 2 {
+		if sample[i] == 0 {
+			evenZero++
+		}
+		if sample[i+1] == 0 {
+			oddZero++
+		}
+		// UTF-16LE 换行为 0A 00，UTF-16BE 为 00 0A
+		if sample[i] == '\n' && sample[i+1] == 0 {
+			oddNewline++
+		}
+		if sample[i] == 0 && sample[i+1] == '\n' {
+			evenNewline++
+		}
+	}
+
+	// 以ASCII为主的UTF-16文本，至少一半的字符在同一位置是零字节，另一位置几乎没有
+	concentrated := func(zeros, others int) bool {
+		return zeros*2 >= units && others*10 <= zeros
+	}
+	var encodingName string
+	var endianness unicode.Endianness
+	switch {
+	case oddNewline > 0 && evenNewline == 0, evenNewline == 0 && oddNewline == 0 && concentrated(oddZero, evenZero):
+		encodingName, endianness = EncodingUTF16LE, unicode.LittleEndian
+	case evenNewline > 0 && oddNewline == 0, evenNewline == 0 && oddNewline == 0 && concentrated(evenZero, oddZero):
+		encodingName, endianness = EncodingUTF16BE, unicode.BigEndian
+	default:
+		return ""
+	}
+
+	decoded, err := unicode.UTF16(endianness, unicode.IgnoreBOM).NewDecoder().Bytes(sample)
+	if err != nil {
+		return ""
+	}
+	total := utf8.RuneCount(decoded)
+	invalid := bytes.Count(decoded, []byte(string(utf8.RuneError)))
+	if invalid*100 > total || commonHanziRatio(decoded) < 0.2 && !isMostlyASCII(decoded) {
+		return ""
+	}
+	return encodingName
+}
+
+// scoreDecodedText 对按指定编码解码的样本打分，常用字越多、无效字符越少得分越高
+func scoreDecodedText(data []byte, enc encoding.Encoding) float64 {
+	sample := data
+	if len(sample) > 64*1024 {
+		sample = sample[:64*1024]
+	}
+	decoded, err := enc.NewDecoder().Bytes(sample)
+	if err != nil {
+		return -1
+	}
+
+	total, common, invalid := 0, 0, 0
+	for _, r := range string(decoded) {
+		if r < 0x80 {
+			continue
+		}
+		total++
+		switch {
+		case r == utf8.RuneError:
+			invalid++
+		case commonHanziSet[r]:
+			common++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return (float64(common) - 5*float64(invalid)) / float64(total)
+}
+
+// commonHanziRatio 计算非ASCII字符中常用汉字的比例
+func commonHanziRatio(data []byte) float64 {
+	total, common := 0, 0
+	for _, r := range string(data) {
+		if r < 0x80 {
+			continue
+		}
+		total++
+		if commonHanziSet[r] {
+			common++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(common) / float64(total)
+}
+
+// isMostlyASCII 判断文本是否以ASCII字符为主
+func isMostlyASCII(data []byte) bool {
+	ascii := 0
+	for _, b := range data {
+		if b < 0x80 {
+			ascii++
+		}
+	}
+	return ascii*10 >= len(data)*9
+}
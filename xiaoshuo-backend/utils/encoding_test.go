@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+const testNovelText = "第一章 初入江湖\n他走进了城门，看见街上人来人往，心中暗想这里果然是天下最热闹的地方。\n" +
+	"第二章 风起云涌\n夜色渐深，远处传来一阵急促的马蹄声，众人都停下了手中的活计。\n"
+
+func encodeTestText(t *testing.T, enc encoding.Encoding, text string) []byte {
+	t.Helper()
+	data, err := enc.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDetectEncoding(t *testing.T) {
+	utf16LE := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	utf16BE := unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	gbk := encodeTestText(t, simplifiedchinese.GBK, testNovelText)
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"utf-8", []byte(testNovelText), EncodingUTF8},
+		{"utf-8 with bom", append([]byte{0xEF, 0xBB, 0xBF}, testNovelText...), EncodingUTF8},
+		{"utf-8 truncated", []byte(testNovelText + "天")[:len(testNovelText)+2], EncodingUTF8},
+		{"utf-16le with bom", encodeTestText(t, unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), testNovelText), EncodingUTF16LE},
+		{"utf-16be with bom", encodeTestText(t, unicode.UTF16(unicode.BigEndian, unicode.UseBOM), testNovelText), EncodingUTF16BE},
+		{"utf-16le without bom", encodeTestText(t, utf16LE, testNovelText), EncodingUTF16LE},
+		{"utf-16be without bom", encodeTestText(t, utf16BE, testNovelText), EncodingUTF16BE},
+		{"utf-16le ascii without newline", encodeTestText(t, utf16LE, "Chapter One: The Beginning"), EncodingUTF16LE},
+		{"utf-16be ascii without newline", encodeTestText(t, utf16BE, "Chapter One: The Beginning"), EncodingUTF16BE},
+		{"gbk", gbk, EncodingGB18030},
+		{"gbk with stray nul", append(append([]byte{}, gbk[:len(gbk)-1]...), 0), EncodingGB18030},
+		{"big5", encodeTestText(t, traditionalchinese.Big5, "第一章 這裡說話的人們來了，為什麼還沒有開門？\n他們說這個國家會變。\n"), EncodingBig5},
+		{"ascii with nul", []byte("hello\x00world, this is plain text\n"), EncodingUTF8},
+	}
+	for _, tt := range tests {
+		if got := DetectEncoding(tt.data); got != tt.want {
+			t.Errorf("%s: DetectEncoding = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeToUTF8(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"utf-8 with bom", append([]byte{0xEF, 0xBB, 0xBF}, testNovelText...)},
+		{"utf-16le without bom", encodeTestText(t, unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), testNovelText)},
+		{"gbk", encodeTestText(t, simplifiedchinese.GBK, testNovelText)},
+	}
+	for _, tt := range tests {
+		decoded, _, err := DecodeToUTF8(tt.data)
+		if err != nil {
+			t.Errorf("%s: DecodeToUTF8: %v", tt.name, err)
+			continue
+		}
+		if string(decoded) != testNovelText {
+			t.Errorf("%s: DecodeToUTF8 = %q", tt.name, strings.TrimSpace(string(decoded)))
+		}
+	}
+}
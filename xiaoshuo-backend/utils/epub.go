@@ -0,0 +1,501 @@
+package utils
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"xiaoshuo-backend/models"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// maxEPUBEntrySize 压缩包内单个文件解压后的最大字节数，防止压缩炸弹
+const maxEPUBEntrySize = 20 * 1024 * 1024
+
+// errEPUBEntryTooLarge 压缩包内文件解压后超过大小限制
+var errEPUBEntryTooLarge = errors.New("EPUB内文件超过20MB")
+
+// epubContainer META-INF/container.xml 结构
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// epubPackage OPF包文件结构
+type epubPackage struct {
+	Title    string `xml:"metadata>title"`
+	Manifest []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Spine struct {
+		Toc      string `xml:"toc,attr"`
+		Itemrefs []struct {
+			IDRef  string `xml:"idref,attr"`
+			Linear string `xml:"linear,attr"`
+		} `xml:"itemref"`
+	} `xml:"spine"`
+}
+
+// epubNavPoint NCX目录节点（支持嵌套）
+type epubNavPoint struct {
+	Label   string `xml:"navLabel>text"`
+	Content struct {
+		Src string `xml:"src,attr"`
+	} `xml:"content"`
+	Children []epubNavPoint `xml:"navPoint"`
+}
+
+// epubNCX NCX目录文件结构
+type epubNCX struct {
+	NavPoints []epubNavPoint `xml:"navMap>navPoint"`
+}
+
+// ParseChapterFromEPUB 解析EPUB文件的章节
+// 通过 META-INF/container.xml 定位OPF文件，按spine顺序读取内容文档，
+// 章节标题优先取自NCX/nav目录，每个有正文的内容文档生成一个章节
+func ParseChapterFromEPUB(filepath string) ([]models.Chapter, error) {
+	chapters, _, err := parseEPUB(filepath)
+	return chapters, err
+}
+
+// ParseVolumesFromEPUB 解析EPUB文件的分卷和章节
+// 目录存在嵌套层级时，顶层目录项作为分卷；否则按章节规则识别分卷标题页
+func ParseVolumesFromEPUB(filepath string) ([]models.Volume, error) {
+	chapters, volumeTitles, err := parseEPUB(filepath)
+	if err != nil {
+		return nil, err
+	}
+	return GroupChaptersByVolume(chapters, volumeTitles), nil
+}
+
+// parseEPUB 解析EPUB文件，返回章节及每个章节所属的分卷标题
+func parseEPUB(filepath string) ([]models.Chapter, []string, error) {
+	reader, err := zip.OpenReader(filepath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("打开EPUB文件失败: %v", err)
+	}
+	defer reader.Close()
+
+	// 建立压缩包内文件索引
+	files := make(map[string]*zip.File, len(reader.File))
+	for _, f := range reader.File {
+		files[f.Name] = f
+	}
+
+	// 读取container.xml，定位OPF文件
+	var container epubContainer
+	if err := decodeEPUBXML(files, "META-INF/container.xml", &container); err != nil {
+		return nil, nil, fmt.Errorf("读取container.xml失败: %v", err)
+	}
+	opfPath := ""
+	for _, rootfile := range container.Rootfiles {
+		if rootfile.FullPath != "" {
+			opfPath = rootfile.FullPath
+			break
+		}
+	}
+	if opfPath == "" {
+		return nil, nil, fmt.Errorf("EPUB文件缺少OPF包文件")
+	}
+
+	var pkg epubPackage
+	if err := decodeEPUBXML(files, opfPath, &pkg); err != nil {
+		return nil, nil, fmt.Errorf("读取OPF文件失败: %v", err)
+	}
+	opfDir := path.Dir(opfPath)
+
+	// 建立manifest索引
+	hrefByID := make(map[string]string, len(pkg.Manifest))
+	mediaTypeByID := make(map[string]string, len(pkg.Manifest))
+	navPath := ""
+	for _, item := range pkg.Manifest {
+		hrefByID[item.ID] = resolveEPUBPath(opfDir, item.Href)
+		mediaTypeByID[item.ID] = item.MediaType
+		if containsField(item.Properties, "nav") {
+			navPath = resolveEPUBPath(opfDir, item.Href)
+		}
+	}
+
+	// 读取目录，建立 内容文档路径 -> 章节标题/分卷标题 的映射
+	tocTitles := make(map[string]string)
+	tocVolumes := make(map[string]string)
+	if ncxPath, ok := hrefByID[pkg.Spine.Toc]; ok {
+		var ncx epubNCX
+		if err := decodeEPUBXML(files, ncxPath, &ncx); err == nil {
+			collectNCXTitles(ncx.NavPoints, path.Dir(ncxPath), "", tocTitles, tocVolumes)
+		}
+	}
+	if len(tocTitles) == 0 && navPath != "" {
+		collectNavTitles(files, navPath, tocTitles, tocVolumes)
+	}
+
+	// 目录没有层级时，按章节规则识别分卷标题页
+	var options ChapterParseOptions
+	matchVolumes := len(tocVolumes) == 0
+	if matchVolumes {
+		options = LoadChapterParseOptions()
+	}
+	currentVolume := ""
+
+	// 按spine顺序解析内容文档
+	var chapters []models.Chapter
+	var volumeTitles []string
+	position := 1
+	for _, itemref := range pkg.Spine.Itemrefs {
+		docPath, ok := hrefByID[itemref.IDRef]
+		if !ok || docPath == navPath {
+			continue
+		}
+		mediaType := mediaTypeByID[itemref.IDRef]
+		if mediaType != "" && mediaType != "application/xhtml+xml" && mediaType != "text/html" {
+			continue
+		}
+
+		data, err := readEPUBFile(files, docPath)
+		if errors.Is(err, errEPUBEntryTooLarge) {
+			return nil, nil, err
+		}
+		if err != nil {
+			continue
+		}
+		docTitle, content := extractEPUBText(data)
+		if strings.TrimSpace(content) == "" {
+			// 封面、插图等没有正文的页面不作为章节
+			continue
+		}
+
+		title := tocTitles[docPath]
+		if title == "" {
+			title = docTitle
+		}
+		wordCount := calculateWordCount(content)
+
+		if matchVolumes {
+			if rule, ok := options.MatchTitle(title); ok && rule.Type == ChapterRuleVolume {
+				currentVolume = title
+				// 只有卷名和简短说明的分卷标题页不作为章节
+				if wordCount < options.MinChapterLength {
+					continue
+				}
+			}
+		} else {
+			currentVolume = tocVolumes[docPath]
+		}
+
+		if title == "" {
+			title = fmt.Sprintf("第%d章", position)
+		}
+		if len([]rune(title)) > 200 {
+			title = string([]rune(title)[:200])
+		}
+
+		chapters = append(chapters, models.Chapter{
+			Title:     title,
+			Content:   content,
+			Position:  position,
+			WordCount: wordCount,
+		})
+		volumeTitles = append(volumeTitles, currentVolume)
+		position++
+	}
+
+	if len(chapters) == 0 {
+		return nil, nil, fmt.Errorf("EPUB文件中没有找到可解析的章节")
+	}
+
+	return chapters, volumeTitles, nil
+}
+
+// readEPUBFile 读取压缩包内指定路径的文件，超过大小限制时返回 errEPUBEntryTooLarge
+func readEPUBFile(files map[string]*zip.File, name string) ([]byte, error) {
+	f, ok := files[name]
+	if !ok {
+		return nil, fmt.Errorf("文件不存在: %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	// 多读一个字节判断是否超限，避免静默截断
+	data, err := io.ReadAll(io.LimitReader(rc, maxEPUBEntrySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxEPUBEntrySize {
+		return nil, fmt.Errorf("%w: %s", errEPUBEntryTooLarge, name)
+	}
+	return data, nil
+}
+
+// decodeEPUBXML 读取并解析压缩包内的XML文件
+func decodeEPUBXML(files map[string]*zip.File, name string, v interface{}) error {
+	data, err := readEPUBFile(files, name)
+	if err != nil {
+		return err
+	}
+	decoder := newLenientXMLDecoder(strings.NewReader(string(data)))
+	return decoder.Decode(v)
+}
+
+// newLenientXMLDecoder 创建宽松模式的XML解码器，兼容不规范的XHTML
+func newLenientXMLDecoder(r io.Reader) *xml.Decoder {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		// 按声明的编码（如 GBK、Big5）转换为UTF-8，无法识别的编码按UTF-8处理
+		encoding, err := htmlindex.Get(charset)
+		if err != nil {
+			return input, nil
+		}
+		return encoding.NewDecoder().Reader(input), nil
+	}
+	return decoder
+}
+
+// resolveEPUBPath 将相对路径解析为压缩包内的绝对路径（去除锚点）
+func resolveEPUBPath(baseDir, href string) string {
+	if idx := strings.Index(href, "#"); idx >= 0 {
+		href = href[:idx]
+	}
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	if baseDir == "." || baseDir == "" {
+		return path.Clean(href)
+	}
+	return path.Join(baseDir, href)
+}
+
+// collectNCXTitles 递归收集NCX目录中的章节标题，同一文档取第一个标题
+// 含有子节点的顶层目录项视为分卷，其下所有文档记录所属分卷标题
+func collectNCXTitles(navPoints []epubNavPoint, baseDir string, volume string, titles map[string]string, volumes map[string]string) {
+	for _, point := range navPoints {
+		label := normalizeSpaces(point.Label)
+		pointVolume := volume
+		if pointVolume == "" && len(point.Children) > 0 {
+			pointVolume = label
+		}
+		if point.Content.Src != "" && label != "" {
+			docPath := resolveEPUBPath(baseDir, point.Content.Src)
+			if _, exists := titles[docPath]; !exists {
+				titles[docPath] = label
+			}
+			if _, exists := volumes[docPath]; !exists && pointVolume != "" {
+				volumes[docPath] = pointVolume
+			}
+		}
+		collectNCXTitles(point.Children, baseDir, pointVolume, titles, volumes)
+	}
+}
+
+// collectNavTitles 收集EPUB3 nav文档中 toc 导航的章节标题
+// 嵌套列表中的顶层目录项视为分卷
+func collectNavTitles(files map[string]*zip.File, navPath string, titles map[string]string, volumes map[string]string) {
+	data, err := readEPUBFile(files, navPath)
+	if err != nil {
+		return
+	}
+	baseDir := path.Dir(navPath)
+	decoder := newLenientXMLDecoder(strings.NewReader(string(data)))
+
+	inToc := false
+	navDepth := 0
+	currentHref := ""
+	var label strings.Builder
+	inLink := false
+	listDepth := 0
+	topLabel, topDocPath := "", ""
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(t.Name.Local)
+			if name == "nav" {
+				if inToc {
+					navDepth++
+				} else if containsField(attrValue(t, "type"), "toc") {
+					inToc = true
+					navDepth = 1
+				}
+			}
+			if inToc && name == "ol" {
+				listDepth++
+			}
+			if inToc && name == "a" {
+				inLink = true
+				currentHref = attrValue(t, "href")
+				label.Reset()
+			}
+		case xml.EndElement:
+			name := strings.ToLower(t.Name.Local)
+			if inToc && name == "a" && inLink {
+				inLink = false
+				text := normalizeSpaces(label.String())
+				if currentHref != "" && text != "" {
+					docPath := resolveEPUBPath(baseDir, currentHref)
+					if _, exists := titles[docPath]; !exists {
+						titles[docPath] = text
+					}
+					if listDepth <= 1 {
+						topLabel, topDocPath = text, docPath
+					} else if topLabel != "" {
+						if _, exists := volumes[topDocPath]; !exists {
+							volumes[topDocPath] = topLabel
+						}
+						if _, exists := volumes[docPath]; !exists {
+							volumes[docPath] = topLabel
+						}
+					}
+				}
+			}
+			if inToc && name == "ol" && listDepth > 0 {
+				listDepth--
+			}
+			if inToc && name == "nav" {
+				navDepth--
+				if navDepth == 0 {
+					return
+				}
+			}
+		case xml.CharData:
+			if inLink {
+				label.Write(t)
+			}
+		}
+	}
+}
+
+// extractEPUBText 从XHTML内容文档中提取标题和纯文本正文
+// 块级元素转换为换行，script/style/head 内容忽略
+func extractEPUBText(data []byte) (string, string) {
+	decoder := newLenientXMLDecoder(strings.NewReader(string(data)))
+
+	blockElements := map[string]bool{
+		"p": true, "div": true, "br": true, "li": true, "tr": true,
+		"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+		"section": true, "article": true, "blockquote": true, "pre": true, "hr": true,
+	}
+	headingElements := map[string]bool{"h1": true, "h2": true, "h3": true}
+
+	var lines []string
+	var current strings.Builder
+	var heading strings.Builder
+	var docTitle, firstHeading string
+	skipDepth := 0
+	inTitle := false
+	inHeading := false
+
+	flush := func() {
+		line := normalizeSpaces(current.String())
+		if line != "" {
+			lines = append(lines, line)
+		}
+		current.Reset()
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(t.Name.Local)
+			switch {
+			case name == "script" || name == "style":
+				skipDepth++
+			case name == "title":
+				inTitle = true
+			case headingElements[name] && firstHeading == "":
+				inHeading = true
+				heading.Reset()
+			}
+			if blockElements[name] {
+				flush()
+			}
+		case xml.EndElement:
+			name := strings.ToLower(t.Name.Local)
+			switch {
+			case name == "script" || name == "style":
+				if skipDepth > 0 {
+					skipDepth--
+				}
+			case name == "title":
+				inTitle = false
+			case headingElements[name] && inHeading:
+				inHeading = false
+				firstHeading = normalizeSpaces(heading.String())
+			}
+			if blockElements[name] {
+				flush()
+			}
+		case xml.CharData:
+			if skipDepth > 0 {
+				continue
+			}
+			if inTitle {
+				docTitle += string(t)
+				continue
+			}
+			if inHeading {
+				heading.Write(t)
+			}
+			current.Write(t)
+		}
+	}
+	flush()
+
+	// 正文首行与标题相同时去除，避免标题重复出现在内容中
+	title := firstHeading
+	if title == "" {
+		title = normalizeSpaces(docTitle)
+	}
+	if len(lines) > 0 && title != "" && lines[0] == title {
+		lines = lines[1:]
+	}
+
+	return title, strings.Join(lines, "\n")
+}
+
+// normalizeSpaces 合并连续空白字符并去除首尾空白
+func normalizeSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// containsField 判断以空白分隔的属性值中是否包含指定项
+func containsField(value, field string) bool {
+	for _, f := range strings.Fields(value) {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// attrValue 获取元素属性值（忽略命名空间）
+func attrValue(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"archive/zip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+const testEPUBContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`
+
+const testEPUBPackage = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata><title>测试</title></metadata>
+  <manifest>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    <item id="c1" href="text/c1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="c2" href="text/c2.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine toc="ncx"><itemref idref="c1"/><itemref idref="c2"/></spine>
+</package>`
+
+const testEPUBNCX = `<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/"><navMap>
+  <navPoint><navLabel><text>第一卷</text></navLabel>
+    <navPoint><navLabel><text>第一章 开始</text></navLabel><content src="text/c1.xhtml"/></navPoint>
+    <navPoint><navLabel><text>第二章 继续</text></navLabel><content src="text/c2.xhtml#p1"/></navPoint>
+  </navPoint>
+</navMap></ncx>`
+
+// writeTestEPUB 在临时目录中写入EPUB文件，files 为压缩包内路径到内容的映射
+func writeTestEPUB(t *testing.T, files map[string][]byte) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "test.epub")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for path, data := range files {
+		entry, err := w.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := entry.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func testEPUBFiles(c1, c2 []byte) map[string][]byte {
+	return map[string][]byte{
+		"META-INF/container.xml": []byte(testEPUBContainer),
+		"OEBPS/content.opf":      []byte(testEPUBPackage),
+		"OEBPS/toc.ncx":          []byte(testEPUBNCX),
+		"OEBPS/text/c1.xhtml":    c1,
+		"OEBPS/text/c2.xhtml":    c2,
+	}
+}
+
+func TestParseVolumesFromEPUB(t *testing.T) {
+	gbk, err := simplifiedchinese.GBK.NewEncoder().Bytes([]byte(
+		`<?xml version="1.0" encoding="GBK"?><html><body><h1>第二章</h1><p>他继续向前走。</p></body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		c1       []byte
+		c2       []byte
+		titles   []string
+		contents []string
+	}{
+		{
+			name:     "utf-8",
+			c1:       []byte(`<html><head><title>忽略</title></head><body><h1>第一章</h1><p>天色&nbsp;渐暗。</p><p>风起了</p></body></html>`),
+			c2:       []byte(`<?xml version="1.0" encoding="UTF-8"?><html><body><p>继续前行</p></body></html>`),
+			titles:   []string{"第一章 开始", "第二章 继续"},
+			contents: []string{"天色 渐暗。", "继续前行"},
+		},
+		{
+			name:     "declared gbk",
+			c1:       []byte(`<html><body><p>第一段</p></body></html>`),
+			c2:       gbk,
+			titles:   []string{"第一章 开始", "第二章 继续"},
+			contents: []string{"第一段", "他继续向前走。"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			volumes, err := ParseVolumesFromEPUB(writeTestEPUB(t, testEPUBFiles(tt.c1, tt.c2)))
+			if err != nil {
+				t.Fatalf("ParseVolumesFromEPUB: %v", err)
+			}
+			if len(volumes) != 1 || volumes[0].Title != "第一卷" {
+				t.Fatalf("volumes = %+v, want one volume 第一卷", volumes)
+			}
+			chapters := volumes[0].Chapters
+			if len(chapters) != len(tt.titles) {
+				t.Fatalf("got %d chapters, want %d", len(chapters), len(tt.titles))
+			}
+			for i, chapter := range chapters {
+				if chapter.Title != tt.titles[i] {
+					t.Errorf("chapter %d title = %q, want %q", i, chapter.Title, tt.titles[i])
+				}
+				if !strings.Contains(chapter.Content, tt.contents[i]) {
+					t.Errorf("chapter %d content = %q, want it to contain %q", i, chapter.Content, tt.contents[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseEPUBRejectsOversizedEntry(t *testing.T) {
+	large := make([]byte, maxEPUBEntrySize+1)
+	for i := range large {
+		large[i] = 'a'
+	}
+	name := writeTestEPUB(t, testEPUBFiles([]byte(`<html><body><p>正文</p></body></html>`), large))
+	if _, err := ParseChapterFromEPUB(name); !errors.Is(err, errEPUBEntryTooLarge) {
+		t.Fatalf("ParseChapterFromEPUB error = %v, want %v", err, errEPUBEntryTooLarge)
+	}
+}
@@ -1,117 +1,68 @@
 package utils
 
 import (
-	"bufio"
+	"crypto/sha256"
 	"fmt"
 	"os"
-	"regexp"
 	"strings"
 	"xiaoshuo-backend/models"
 )
 
 // ParseChapterFromTXT 解析TXT文件的章节
+// 章节标题识别规则和切分设置从数据库加载，未配置时使用默认规则
 func ParseChapterFromTXT(filepath string) ([]models.Chapter, error) {
-	file, err := os.Open(filepath)
+	splits, err := SplitChaptersFromTXT(filepath, LoadChapterParseOptions())
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-
-	// 定义章节标题的正则表达式
-	// 支持中文数字和阿拉伯数字的章节格式
-	chapterRegex := regexp.MustCompile(`^(第[一二三四五六七八九十百千万零\d]+[章节回部卷].*|Chapter\s+\d+|Prologue|Epilogue|引子|序|尾声|后记|\d+\..*|.*卷.*|\d+)$`)
-
-	var chapters []models.Chapter
-	var currentChapter *models.Chapter
-	chapterIndex := 1
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		trimmedLine := strings.TrimSpace(line)
-
-		// 检查是否是章节标题（长度不能太长，一般章节标题不会超过50个字符）
-		if chapterRegex.MatchString(trimmedLine) && len(trimmedLine) < 50 {
-			// 如果已经有当前章节，先保存它
-			if currentChapter != nil && currentChapter.Content != "" {
-				currentChapter.WordCount = calculateWordCount(currentChapter.Content)
-				chapters = append(chapters, *currentChapter)
-			}
-
-			// 创建新章节
-			currentChapter = &models.Chapter{
-				Title:    trimmedLine,
-				Content:  "",
-				Position: chapterIndex,
-			}
-			chapterIndex++
-		} else {
-			// 如果当前有章节，将当前行添加到章节内容中
-			if currentChapter != nil {
-				if currentChapter.Content != "" {
-					currentChapter.Content += "\n"
-				}
-				currentChapter.Content += line
-			}
-		}
+
+	chapters := make([]models.Chapter, len(splits))
+	for i, split := range splits {
+		chapters[i] = split.Chapter
 	}
+	return chapters, nil
+}
 
-	if err := scanner.Err(); err != nil {
+// SplitChaptersFromTXT 按指定选项切分TXT文件，返回包含命中规则信息的切分结果
+func SplitChaptersFromTXT(filepath string, options ChapterParseOptions) ([]ChapterSplit, error) {
+	// 按检测到的编码转换为UTF-8，兼容未转换编码的历史文件
+	content, _, err := ReadTextFileContent(filepath)
+	if err != nil {
 		return nil, err
 	}
-
-	// 保存最后一个章节
-	if currentChapter != nil && currentChapter.Content != "" {
-		currentChapter.WordCount = calculateWordCount(currentChapter.Content)
-		chapters = append(chapters, *currentChapter)
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
 	}
 
+	splits := options.SplitChapters(lines)
+
 	// 如果没有找到任何章节，将整个文件作为一个章节
-	if len(chapters) == 0 {
-		content, err := ReadFileContent(filepath)
-		if err != nil {
-			return nil, err
-		}
-		chapters = []models.Chapter{
+	if len(splits) == 0 {
+		splits = []ChapterSplit{
 			{
-				Title:     "第一章",
-				Content:   content,
-				Position:  1,
-				WordCount: calculateWordCount(content),
+				Chapter: models.Chapter{
+					Title:     "第一章",
+					Content:   content,
+					Position:  1,
+					WordCount: calculateWordCount(content),
+				},
 			},
 		}
 	}
 
-	return chapters, nil
+	return splits, nil
 }
 
-// ParseChapterFromEPUB 解析EPUB文件的章节
-func ParseChapterFromEPUB(filepath string) ([]models.Chapter, error) {
-	// 由于EPUB解析库的复杂性，我们返回一个占位章节
-	// 在实际部署中，需要使用EPUB解析库来提取章节
-	content, err := ReadFileContent(filepath)
-	if err != nil {
-		return nil, err
-	}
-
-	// 对于EPUB文件，我们暂时返回一个包含整个内容的章节
-	chapters := []models.Chapter{
-		{
-			Title:     "第一章",
-			Content:   removeHTMLTags(content),
-			Position:  1,
-			WordCount: calculateWordCount(removeHTMLTags(content)),
-		},
-	}
-
-	return chapters, nil
+// CalculateWordCount 计算字数（去除空白字符后的字符数）
+func CalculateWordCount(content string) int {
+	return calculateWordCount(content)
 }
 
-// removeHTMLTags 移除HTML标签
-func removeHTMLTags(htmlContent string) string {
-	// 使用正则表达式简单移除HTML标签
-	re := regexp.MustCompile(`<[^>]*>`)
-	return re.ReplaceAllString(htmlContent, "")
+// ChapterContentHash 计算章节内容哈希值，忽略空白字符差异
+func ChapterContentHash(content string) string {
+	normalized := strings.Join(strings.Fields(content), "")
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(normalized)))
 }
 
 // calculateWordCount 计算字数
@@ -2,20 +2,65 @@ package utils
 
 import (
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 	"xiaoshuo-backend/models"
 
 	"github.com/blevesearch/bleve/v2"
-	"github.com/blevesearch/bleve/v2/analysis/analyzer/standard"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/whitespace"
+	"github.com/blevesearch/bleve/v2/mapping"
 	"github.com/blevesearch/bleve/v2/search/query"
 )
 
+// 搜索索引映射版本，修改分析器或字段映射时递增，启动时发现版本不一致会删除旧索引并重建
+const (
+	searchMappingVersion    = "6"
+	searchMappingVersionKey = "mapping_version"
+	searchOutboxCursorKey   = "outbox_cursor" // 索引已同步到的发件箱记录ID
+	searchOutboxGapsKey     = "outbox_gaps"   // 同步位置之前尚未出现的发件箱记录ID
+)
+
 // SearchIndex 全文搜索索引管理器
 type SearchIndex struct {
-	index bleve.Index
+	index        bleve.Index
+	needsRebuild bool // 索引为新建，需要从数据库重建
 }
 
 var GlobalSearchIndex *SearchIndex
 
+// 索引文档类型
+const (
+	docTypeNovel   = "novel"
+	docTypeChapter = "chapter"
+)
+
+// novelDoc 小说索引文档
+type novelDoc struct {
+	DocType       string    `json:"doc_type"`
+	ID            uint      `json:"id"`
+	Title         string    `json:"title"`
+	Author        string    `json:"author"`
+	Protagonist   string    `json:"protagonist"`
+	Description   string    `json:"description"`
+	Keywords      string    `json:"keywords"`
+	Pinyin        string    `json:"pinyin"`
+	Status        string    `json:"status"`
+	SerialStatus  string    `json:"serial_status"`
+	CategoryIDs   []string  `json:"category_ids"`
+	Categories    []string  `json:"categories"` // 规范化后的分类名，用于按分类名搜索
+	Tags          []string  `json:"tags"` // 规范化后的关键词，用于精确过滤
+	WordCount     int       `json:"word_count"`
+	AverageRating float64   `json:"average_rating"`
+	RatingCount   int       `json:"rating_count"`
+	ClickCount    int       `json:"click_count"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
 // InitSearchIndex 初始化搜索索引
 func InitSearchIndex(indexPath string) error {
 	var err error
@@ -23,51 +68,155 @@ func InitSearchIndex(indexPath string) error {
 	return err
 }
 
-// NewSearchIndex 创建新的搜索索引
+// NewSearchIndex 打开或创建搜索索引
+// 已有索引的映射版本与当前版本不一致（或上次重建未完成）时删除后重新创建，并标记为需要重建
 func NewSearchIndex(indexPath string) (*SearchIndex, error) {
-	// 创建自定义映射
-	mapping := bleve.NewIndexMapping()
-	
-	// 为小说创建映射
-	novelMapping := bleve.NewDocumentMapping()
-	
-	// 为标题、作者、主角、描述等字段配置搜索
-	titleFieldMapping := bleve.NewTextFieldMapping()
-	titleFieldMapping.Analyzer = standard.Name
-	novelMapping.AddFieldMappingsAt("Title", titleFieldMapping)
-	
-	authorFieldMapping := bleve.NewTextFieldMapping()
-	authorFieldMapping.Analyzer = standard.Name
-	novelMapping.AddFieldMappingsAt("Author", authorFieldMapping)
-	
-	protagonistFieldMapping := bleve.NewTextFieldMapping()
-	protagonistFieldMapping.Analyzer = standard.Name
-	novelMapping.AddFieldMappingsAt("Protagonist", protagonistFieldMapping)
-	
-	descriptionFieldMapping := bleve.NewTextFieldMapping()
-	descriptionFieldMapping.Analyzer = standard.Name
-	novelMapping.AddFieldMappingsAt("Description", descriptionFieldMapping)
-	
-	// 为关键词字段配置搜索
-	keywordFieldMapping := bleve.NewTextFieldMapping()
-	keywordFieldMapping.Analyzer = standard.Name
-	novelMapping.AddFieldMappingsAt("Keywords", keywordFieldMapping)
-	
-	// 应用映射到小说类型
-	mapping.AddDocumentMapping("novel", novelMapping)
-	
-	// 打开或创建索引
-	index, err := bleve.New(indexPath, mapping)
+	index, err := bleve.Open(indexPath)
+	if err == nil {
+		version, verr := index.GetInternal([]byte(searchMappingVersionKey))
+		if verr == nil && string(version) == searchMappingVersion {
+			return &SearchIndex{index: index}, nil
+		}
+		index.Close()
+		if err := os.RemoveAll(indexPath); err != nil {
+			return nil, fmt.Errorf("failed to remove outdated search index: %v", err)
+		}
+	} else if err != bleve.ErrorIndexPathDoesNotExist {
+		return nil, fmt.Errorf("failed to open search index: %v", err)
+	}
+
+	index, err = bleve.New(indexPath, newIndexMapping())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create search index: %v", err)
+	}
+	return &SearchIndex{index: index, needsRebuild: true}, nil
+}
+
+// newIndexMapping 创建索引映射，文本字段默认使用中文分析器
+func newIndexMapping() *mapping.IndexMappingImpl {
+	indexMapping := bleve.NewIndexMapping()
+	err := indexMapping.AddCustomAnalyzer(CJKAnalyzerName, map[string]interface{}{
+		"type":      custom.Name,
+		"tokenizer": cjkTokenizerName,
+	})
+	if err == nil {
+		err = indexMapping.AddCustomAnalyzer(PinyinAnalyzerName, map[string]interface{}{
+			"type":          custom.Name,
+			"tokenizer":     whitespace.Name,
+			"token_filters": []string{lowercase.Name},
+		})
+	}
 	if err != nil {
-		// 如果已存在则打开
-		if index, err = bleve.Open(indexPath); err != nil {
-			return nil, fmt.Errorf("failed to create/open search index: %v", err)
+		panic(err)
+	}
+	indexMapping.DefaultAnalyzer = CJKAnalyzerName
+
+	// 文档不区分类型，字段映射设置在默认映射上
+	docMapping := indexMapping.DefaultMapping
+	for _, field := range []string{"title", "author", "protagonist", "description", "keywords", "chapter_title", "content"} {
+		fieldMapping := bleve.NewTextFieldMapping()
+		fieldMapping.Analyzer = CJKAnalyzerName
+		docMapping.AddFieldMappingsAt(field, fieldMapping)
+	}
+
+	// 章节文档所属小说、章节ID和章节位置，小说文档用于过滤和排序的数值
+	for _, field := range []string{"novel_id", "chapter_id", "position", "word_count", "average_rating", "rating_count", "click_count"} {
+		docMapping.AddFieldMappingsAt(field, bleve.NewNumericFieldMapping())
+	}
+
+	// 整体作为一个词、只用于过滤和分面的字段
+	for _, field := range []string{"doc_type", "status", "serial_status", "category_ids", "categories", "tags"} {
+		fieldMapping := bleve.NewTextFieldMapping()
+		fieldMapping.Analyzer = keyword.Name
+		fieldMapping.IncludeTermVectors = false
+		docMapping.AddFieldMappingsAt(field, fieldMapping)
+	}
+	docMapping.AddFieldMappingsAt("updated_at", bleve.NewDateTimeFieldMapping())
+
+	// 标题、作者、主角的全拼和首字母
+	pinyinFieldMapping := bleve.NewTextFieldMapping()
+	pinyinFieldMapping.Analyzer = PinyinAnalyzerName
+	pinyinFieldMapping.Store = false
+	docMapping.AddFieldMappingsAt("pinyin", pinyinFieldMapping)
+
+	return indexMapping
+}
+
+// NeedsRebuild 索引是否为新建，需要从数据库重建
+func (s *SearchIndex) NeedsRebuild() bool {
+	return s.needsRebuild
+}
+
+// OutboxCursor 返回索引已同步到的发件箱记录ID，新建的索引为0
+func (s *SearchIndex) OutboxCursor() (uint, error) {
+	value, err := s.index.GetInternal([]byte(searchOutboxCursorKey))
+	if err != nil || len(value) == 0 {
+		return 0, err
+	}
+	cursor, err := strconv.ParseUint(string(value), 10, 64)
+	return uint(cursor), err
+}
+
+// OutboxGaps 返回同步位置之前尚未出现的发件箱记录ID及首次发现空缺的时间
+func (s *SearchIndex) OutboxGaps() (map[uint]time.Time, error) {
+	gaps := make(map[uint]time.Time)
+	value, err := s.index.GetInternal([]byte(searchOutboxGapsKey))
+	if err != nil || len(value) == 0 {
+		return gaps, err
+	}
+	for _, item := range strings.Split(string(value), ",") {
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		id, err := strconv.ParseUint(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		seenAt, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			continue
 		}
+		gaps[uint(id)] = time.Unix(seenAt, 0)
 	}
-	
-	return &SearchIndex{
-		index: index,
-	}, nil
+	return gaps, nil
+}
+
+// SetOutboxProgress 在同一批次中记录索引已同步到的发件箱记录ID和尚未出现的记录ID
+func (s *SearchIndex) SetOutboxProgress(cursor uint, gaps map[uint]time.Time) error {
+	items := make([]string, 0, len(gaps))
+	for id, seenAt := range gaps {
+		items = append(items, fmt.Sprintf("%d:%d", id, seenAt.Unix()))
+	}
+	batch := s.index.NewBatch()
+	batch.SetInternal([]byte(searchOutboxCursorKey), []byte(strconv.FormatUint(uint64(cursor), 10)))
+	batch.SetInternal([]byte(searchOutboxGapsKey), []byte(strings.Join(items, ",")))
+	return s.index.Batch(batch)
+}
+
+// DocumentCounts 返回索引中的小说和章节文档数量
+func (s *SearchIndex) DocumentCounts() (novels int, chapters int, err error) {
+	count := func(docType string) (int, error) {
+		result, err := s.index.Search(bleve.NewSearchRequestOptions(termQuery("doc_type", docType), 0, 0, false))
+		if err != nil {
+			return 0, err
+		}
+		return int(result.Total), nil
+	}
+	if novels, err = count(docTypeNovel); err != nil {
+		return 0, 0, err
+	}
+	chapters, err = count(docTypeChapter)
+	return novels, chapters, err
+}
+
+// MarkRebuilt 重建完成后记录映射版本，之后启动不再重建
+func (s *SearchIndex) MarkRebuilt() error {
+	if err := s.index.SetInternal([]byte(searchMappingVersionKey), []byte(searchMappingVersion)); err != nil {
+		return err
+	}
+	s.needsRebuild = false
+	return nil
 }
 
 // IndexNovel 为小说建立索引
@@ -78,44 +227,66 @@ func (s *SearchIndex) IndexNovel(novel models.Novel) error {
 		keywordsStr += keyword.Word + " "
 	}
 	
+	// 标题、作者、主角和关键词加入分词词典
+	AddSearchWords(novel.Title, novel.Author, novel.Protagonist)
+	for _, keyword := range novel.Keywords {
+		AddSearchWords(keyword.Word)
+	}
+
+	categoryIDs := make([]string, 0, len(novel.Categories))
+	categoryNames := make([]string, 0, len(novel.Categories))
+	for _, category := range novel.Categories {
+		categoryIDs = append(categoryIDs, strconv.FormatUint(uint64(category.ID), 10))
+		categoryNames = append(categoryNames, NormalizeSearchText(category.Name))
+	}
+	tags := make([]string, 0, len(novel.Keywords))
+	for _, keyword := range novel.Keywords {
+		tags = append(tags, NormalizeSearchText(keyword.Word))
+	}
+	// 更新时间以最新章节时间为准，没有章节更新记录时取小说的修改时间
+	updatedAt := novel.UpdatedAt
+	if novel.LastChapterAt != nil {
+		updatedAt = *novel.LastChapterAt
+	}
+
 	// 创建用于索引的文档
-	doc := struct {
-		ID          uint   `json:"id"`
-		Title       string `json:"title"`
-		Author      string `json:"author"`
-		Protagonist string `json:"protagonist"`
-		Description string `json:"description"`
-		Keywords    string `json:"keywords"`
-	}{
-		ID:          novel.ID,
-		Title:       novel.Title,
-		Author:      novel.Author,
-		Protagonist: novel.Protagonist,
-		Description: novel.Description,
-		Keywords:    keywordsStr,
+	doc := novelDoc{
+		DocType:       docTypeNovel,
+		ID:            novel.ID,
+		Title:         novel.Title,
+		Author:        novel.Author,
+		Protagonist:   novel.Protagonist,
+		Description:   novel.Description,
+		Keywords:      keywordsStr,
+		Pinyin:        pinyinText(novel.Title, novel.Author, novel.Protagonist),
+		Status:        novel.Status,
+		SerialStatus:  novel.SerialStatus,
+		CategoryIDs:   categoryIDs,
+		Categories:    categoryNames,
+		Tags:          tags,
+		WordCount:     novel.WordCount,
+		AverageRating: novel.AverageRating,
+		RatingCount:   novel.RatingCount,
+		ClickCount:    novel.ClickCount,
+		UpdatedAt:     updatedAt,
 	}
-	
+
 	// 索引文档
 	docID := fmt.Sprintf("novel_%d", novel.ID)
 	return s.index.Index(docID, doc)
 }
 
-// IndexNovelContent 为小说内容建立索引
-func (s *SearchIndex) IndexNovelContent(novelID uint, content string) error {
-	doc := struct {
-		ID      uint   `json:"id"`
-		Content string `json:"content"`
-	}{
-		ID:      novelID,
-		Content: content,
+// SearchNovels 按关键词搜索小说
+func (s *SearchIndex) SearchNovels(queryStr string, page, size int) ([]uint, int, error) {
+	result, err := s.SearchNovelsWithOptions(NovelSearchOptions{Query: queryStr, Page: page, Size: size})
+	if err != nil {
+		return nil, 0, err
 	}
-	
-	docID := fmt.Sprintf("content_%d", novelID)
-	return s.index.Index(docID, doc)
+	return result.NovelIDs, result.Total, nil
 }
 
-// SearchNovels 搜索小说
-func (s *SearchIndex) SearchNovels(queryStr string, page, size int) ([]uint, int, error) {
+// novelTextQuery 在小说标题、作者、描述、主角、关键词和拼音中匹配查询词
+func novelTextQuery(queryStr string) query.Query {
 	// 创建布尔查询，组合多个字段的搜索
 	boolQuery := bleve.NewBooleanQuery()
 	
@@ -140,78 +311,83 @@ func (s *SearchIndex) SearchNovels(queryStr string, page, size int) ([]uint, int
 	keywordsQuery.SetField("keywords")
 	boolQuery.AddShould(keywordsQuery)
 
-	// 创建搜索请求
-	searchRequest := bleve.NewSearchRequest(boolQuery)
-	
-	// 设置分页
-	searchRequest.From = (page - 1) * size
-	searchRequest.Size = size
-	
-	// 执行搜索
-	result, err := s.index.Search(searchRequest)
-	if err != nil {
-		return nil, 0, fmt.Errorf("search failed: %v", err)
-	}
-	
-	// 提取小说ID
-	var novelIDs []uint
-	for _, hit := range result.Hits {
-		var novelID uint
-		_, err := fmt.Sscanf(hit.ID, "novel_%d", &novelID)
-		if err != nil {
-			continue
+	normalized := strings.TrimSpace(NormalizeSearchText(queryStr))
+
+	// 单个汉字无法匹配二元切分的词，按词前缀匹配
+	if runes := []rune(normalized); len(runes) == 1 && isCJKRune(runes[0]) {
+		for _, field := range []string{"title", "author", "protagonist", "keywords"} {
+			prefixQuery := query.NewPrefixQuery(normalized)
+			prefixQuery.SetField(field)
+			boolQuery.AddShould(prefixQuery)
 		}
-		novelIDs = append(novelIDs, novelID)
 	}
-	
-	return novelIDs, int(result.Total), nil
-}
 
-// SearchNovelContent 搜索小说内容
-func (s *SearchIndex) SearchNovelContent(queryStr string, page, size int) ([]uint, int, error) {
-	// 创建内容搜索查询
-	contentQuery := query.NewMatchQuery(queryStr)
-	contentQuery.SetField("content")
-	
-	// 创建搜索请求
-	searchRequest := bleve.NewSearchRequest(contentQuery)
-	
-	// 设置分页
-	searchRequest.From = (page - 1) * size
-	searchRequest.Size = size
-	
-	// 执行搜索
-	result, err := s.index.Search(searchRequest)
-	if err != nil {
-		return nil, 0, fmt.Errorf("content search failed: %v", err)
+	// 查询为字母时按拼音全拼或首字母匹配，如 "dpcq"、"doupo"
+	if isPinyinQuery(normalized) {
+		pinyinStr := strings.NewReplacer(" ", "", "'", "").Replace(normalized)
+
+		pinyinQuery := query.NewTermQuery(pinyinStr)
+		pinyinQuery.SetField("pinyin")
+		pinyinQuery.SetBoost(2)
+		boolQuery.AddShould(pinyinQuery)
+
+		if len(pinyinStr) >= 2 {
+			pinyinPrefixQuery := query.NewPrefixQuery(pinyinStr)
+			pinyinPrefixQuery.SetField("pinyin")
+			boolQuery.AddShould(pinyinPrefixQuery)
+		}
+
+		// 拼音拼错时按编辑距离模糊匹配，如 "doupocangqoing"
+		if len(pinyinStr) >= 4 {
+			boolQuery.AddShould(fuzzyQuery("pinyin", pinyinStr))
+		}
 	}
-	
-	// 提取小说ID
-	var novelIDs []uint
-	for _, hit := range result.Hits {
-		var novelID uint
-		_, err := fmt.Sscanf(hit.ID, "content_%d", &novelID)
-		if err != nil {
+
+	// 英文单词拼错时按编辑距离模糊匹配
+	for _, word := range strings.Fields(normalized) {
+		if len(word) < 4 || !isPinyinQuery(word) {
 			continue
 		}
-		novelIDs = append(novelIDs, novelID)
+		for _, field := range []string{"title", "author", "protagonist", "keywords"} {
+			boolQuery.AddShould(fuzzyQuery(field, word))
+		}
 	}
-	
-	return novelIDs, int(result.Total), nil
+
+	// 同义词改写后的查询，如 "网游" 同时匹配 "游戏"，得分低于原词
+	for _, expansion := range expandSynonyms(normalized) {
+		for _, field := range []string{"title", "description", "protagonist", "keywords"} {
+			synonymQuery := query.NewMatchQuery(expansion)
+			synonymQuery.SetField(field)
+			synonymQuery.SetBoost(0.8)
+			boolQuery.AddShould(synonymQuery)
+		}
+	}
+
+	return boolQuery
+}
+
+// fuzzyQuery 编辑距离模糊查询，8个字母以上容许两处错误，得分低于精确匹配
+func fuzzyQuery(field, term string) query.Query {
+	q := query.NewFuzzyQuery(term)
+	q.SetField(field)
+	q.SetFuzziness(allowedEditDistance(len(term)))
+	q.SetBoost(0.5)
+	return q
 }
 
-// DeleteNovelFromIndex 从索引中删除小说
+// DeleteNovelFromIndex 从索引中删除小说及其全部章节
 func (s *SearchIndex) DeleteNovelFromIndex(novelID uint) error {
-	docID := fmt.Sprintf("novel_%d", novelID)
-	err1 := s.index.Delete(docID)
-	
-	contentDocID := fmt.Sprintf("content_%d", novelID)
-	err2 := s.index.Delete(contentDocID)
-	
-	if err1 != nil {
-		return err1
+	docIDs, err := s.chapterDocIDs(novelID)
+	if err != nil {
+		return err
 	}
-	return err2
+
+	batch := s.index.NewBatch()
+	batch.Delete(fmt.Sprintf("novel_%d", novelID))
+	for _, docID := range docIDs {
+		batch.Delete(docID)
+	}
+	return s.index.Batch(batch)
 }
 
 // Close 关闭索引
@@ -226,12 +402,21 @@ func (s *SearchIndex) SearchSuggestions(queryStr string, limit int) ([]interface
 		return []interface{}{}, nil
 	}
 	
+	// 只在已审核小说的文档中查找建议
+	suggestionQuery := func(q query.Query) query.Query {
+		return query.NewConjunctionQuery([]query.Query{
+			termQuery("doc_type", docTypeNovel),
+			termQuery("status", visibleNovelStatus),
+			q,
+		})
+	}
+
 	// 首先尝试使用模糊查询来获取更灵活的匹配
 	fuzzyQuery := query.NewFuzzyQuery(queryStr)
 	fuzzyQuery.SetFuzziness(1) // 设置模糊度为1，允许一个字符的差异
 	
 	// 创建搜索请求
-	searchRequest := bleve.NewSearchRequest(fuzzyQuery)
+	searchRequest := bleve.NewSearchRequest(suggestionQuery(fuzzyQuery))
 	
 	// 设置返回结果数量限制
 	searchRequest.From = 0
@@ -243,7 +428,7 @@ func (s *SearchIndex) SearchSuggestions(queryStr string, limit int) ([]interface
 	if err != nil {
 		// 如果模糊搜索失败，尝试使用前缀查询
 		prefixQuery := query.NewPrefixQuery(queryStr)
-		searchRequest := bleve.NewSearchRequest(prefixQuery)
+		searchRequest := bleve.NewSearchRequest(suggestionQuery(prefixQuery))
 		searchRequest.Size = limit
 		searchRequest.Fields = []string{"title", "author", "protagonist"}
 		
@@ -0,0 +1,272 @@
+package utils
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve/v2/analysis"
+	"github.com/blevesearch/bleve/v2/registry"
+	"golang.org/x/text/width"
+)
+
+// 搜索分析器名称
+const (
+	CJKAnalyzerName    = "xiaoshuo_cjk"    // 中文分析器：词典分词加二元切分
+	PinyinAnalyzerName = "xiaoshuo_pinyin" // 拼音分析器：按空白切分并转小写
+	cjkTokenizerName   = "xiaoshuo_cjk"
+
+	maxDictWordLen = 8 // 词典词语的最大字数
+)
+
+var (
+	hanTablesOnce sync.Once
+	pinyinOfRune  map[rune]string
+	simplifiedOf  map[rune]rune
+)
+
+// loadHanTables 展开拼音表和繁简对照表
+func loadHanTables() {
+	hanTablesOnce.Do(func() {
+		pinyinOfRune = make(map[rune]string, 21000)
+		for syllable, chars := range pinyinSyllables {
+			for _, r := range chars {
+				pinyinOfRune[r] = syllable
+			}
+		}
+
+		simplifiedOf = make(map[rune]rune, utf8.RuneCountInString(traditionalPairs)/2)
+		pairs := []rune(traditionalPairs)
+		for i := 0; i+1 < len(pairs); i += 2 {
+			simplifiedOf[pairs[i]] = pairs[i+1]
+		}
+	})
+}
+
+// normalizeRune 全角转半角、繁体转简体并转小写
+func normalizeRune(r rune) rune {
+	if r == '　' {
+		return ' '
+	}
+	if p := width.LookupRune(r); p.Kind() == width.EastAsianFullwidth {
+		if narrow := p.Narrow(); narrow != 0 {
+			r = narrow
+		}
+	}
+	if s, ok := simplifiedOf[r]; ok {
+		r = s
+	}
+	return unicode.ToLower(r)
+}
+
+// NormalizeSearchText 将文本规范化为索引使用的形式（全角转半角、繁体转简体、转小写）
+func NormalizeSearchText(text string) string {
+	loadHanTables()
+	return strings.Map(normalizeRune, text)
+}
+
+// isCJKRune 判断是否为按字切分的东亚文字
+func isCJKRune(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// searchDictionary 中文分词词典，收录小说标题、作者、主角、关键词和分类名
+type searchDictionary struct {
+	mu    sync.RWMutex
+	words map[string]struct{}
+}
+
+var dictionary = &searchDictionary{words: make(map[string]struct{})}
+
+// AddSearchWords 向分词词典添加词语，只收录2到8个字的中文词语
+func AddSearchWords(words ...string) {
+	dictionary.mu.Lock()
+	defer dictionary.mu.Unlock()
+	for _, word := range words {
+		word = NormalizeSearchText(strings.TrimSpace(word))
+		runes := []rune(word)
+		if len(runes) < 2 || len(runes) > maxDictWordLen {
+			continue
+		}
+		allCJK := true
+		for _, r := range runes {
+			if !isCJKRune(r) {
+				allCJK = false
+				break
+			}
+		}
+		if allCJK {
+			dictionary.words[word] = struct{}{}
+		}
+	}
+}
+
+// has 判断词典是否收录了词语
+func (d *searchDictionary) has(word string) bool {
+	_, ok := d.words[word]
+	return ok
+}
+
+// cjkChar 规范化后的字符及其在原文中的字节位置
+type cjkChar struct {
+	r          rune
+	start, end int
+}
+
+// cjkTokenizer 中文分词器
+// 中日韩文字按二元切分（单独一个字时保留单字），词典中收录的长词在首字位置额外输出，
+// 字母和数字连续的部分作为一个词；输出的词均已规范化，偏移量对应原文
+type cjkTokenizer struct{}
+
+func (t *cjkTokenizer) Tokenize(input []byte) analysis.TokenStream {
+	loadHanTables()
+	stream := make(analysis.TokenStream, 0, len(input)/3)
+	position := 0
+	var run []cjkChar
+	runCJK := false
+
+	flush := func() {
+		if len(run) == 0 {
+			return
+		}
+		if runCJK {
+			position = t.emitCJK(&stream, input, run, position)
+		} else {
+			position++
+			stream = append(stream, t.token(input, run, position, wordType(run)))
+		}
+		run = run[:0]
+	}
+
+	for offset := 0; offset < len(input); {
+		r, size := utf8.DecodeRune(input[offset:])
+		char := cjkChar{r: normalizeRune(r), start: offset, end: offset + size}
+		offset += size
+
+		switch {
+		case isCJKRune(char.r):
+			if !runCJK {
+				flush()
+				runCJK = true
+			}
+			run = append(run, char)
+		case unicode.IsLetter(char.r) || unicode.IsDigit(char.r) || unicode.IsMark(char.r):
+			if runCJK {
+				flush()
+				runCJK = false
+			}
+			run = append(run, char)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return stream
+}
+
+// emitCJK 输出一段连续中日韩文字的词，返回最后一个词的位置
+func (t *cjkTokenizer) emitCJK(stream *analysis.TokenStream, input []byte, run []cjkChar, position int) int {
+	if len(run) == 1 {
+		*stream = append(*stream, t.token(input, run, position+1, analysis.Ideographic))
+		return position + 1
+	}
+
+	dictionary.mu.RLock()
+	defer dictionary.mu.RUnlock()
+	for i := 0; i+1 < len(run); i++ {
+		*stream = append(*stream, t.token(input, run[i:i+2], position+i+1, analysis.Ideographic))
+		// 从当前字开始的最长词典词
+		for l := min(maxDictWordLen, len(run)-i); l > 2; l-- {
+			if dictionary.has(runeString(run[i : i+l])) {
+				*stream = append(*stream, t.token(input, run[i:i+l], position+i+1, analysis.Ideographic))
+				break
+			}
+		}
+	}
+	return position + len(run) - 1
+}
+
+func (t *cjkTokenizer) token(input []byte, chars []cjkChar, position int, typ analysis.TokenType) *analysis.Token {
+	return &analysis.Token{
+		Term:     []byte(runeString(chars)),
+		Start:    chars[0].start,
+		End:      chars[len(chars)-1].end,
+		Position: position,
+		Type:     typ,
+	}
+}
+
+func runeString(chars []cjkChar) string {
+	var builder strings.Builder
+	for _, char := range chars {
+		builder.WriteRune(char.r)
+	}
+	return builder.String()
+}
+
+func wordType(chars []cjkChar) analysis.TokenType {
+	for _, char := range chars {
+		if !unicode.IsDigit(char.r) {
+			return analysis.AlphaNumeric
+		}
+	}
+	return analysis.Numeric
+}
+
+// Pinyin 返回文本的全拼和首字母，非汉字的字母和数字原样保留，其它字符忽略
+// 例如 "斗破苍穹" 返回 "doupocangqiong" 和 "dpcq"
+func Pinyin(text string) (full string, initials string) {
+	loadHanTables()
+	var fullBuilder, initialBuilder strings.Builder
+	for _, r := range NormalizeSearchText(text) {
+		if syllable, ok := pinyinOfRune[r]; ok {
+			fullBuilder.WriteString(syllable)
+			initialBuilder.WriteByte(syllable[0])
+		} else if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			fullBuilder.WriteRune(r)
+			initialBuilder.WriteRune(r)
+		}
+	}
+	return fullBuilder.String(), initialBuilder.String()
+}
+
+// pinyinText 生成拼音字段内容，每段文本的全拼和首字母以空格分隔
+func pinyinText(texts ...string) string {
+	parts := make([]string, 0, len(texts)*2)
+	for _, text := range texts {
+		full, initials := Pinyin(text)
+		if full == "" {
+			continue
+		}
+		parts = append(parts, full)
+		if initials != full {
+			parts = append(parts, initials)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// isPinyinQuery 判断查询是否可能是拼音或拼音首字母
+func isPinyinQuery(queryStr string) bool {
+	hasLetter := false
+	for _, r := range queryStr {
+		switch {
+		case r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+			hasLetter = true
+		case r >= '0' && r <= '9' || r == ' ' || r == '\'':
+		default:
+			return false
+		}
+	}
+	return hasLetter
+}
+
+func init() {
+	err := registry.RegisterTokenizer(cjkTokenizerName, func(config map[string]interface{}, cache *registry.Cache) (analysis.Tokenizer, error) {
+		return &cjkTokenizer{}, nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,46 @@
+package utils
+
+import "testing"
+
+func TestPinyin(t *testing.T) {
+	tests := []struct {
+		text     string
+		full     string
+		initials string
+	}{
+		{"斗破苍穹", "doupocangqiong", "dpcq"},
+		{"促醋簇猝", "cucucucu", "cccc"},
+		{"粗蹴酢", "cucucu", "ccc"},
+		{"篡窜汆爨", "cuancuancuancuan", "cccc"},
+		{"大主宰", "dazhuzai", "dzz"},
+		{"凡人修仙传", "fanrenxiuxianchuan", "frxxc"},
+		{"遮天2", "zhetian2", "zt2"},
+		{"鬥破蒼穹", "doupocangqiong", "dpcq"},
+		{"ＡＢＣ小说", "abcxiaoshuo", "abcxs"},
+		{"《斗罗》！", "douluo", "dl"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		full, initials := Pinyin(tt.text)
+		if full != tt.full || initials != tt.initials {
+			t.Errorf("Pinyin(%q) = %q, %q, want %q, %q", tt.text, full, initials, tt.full, tt.initials)
+		}
+	}
+}
+
+func TestNormalizeSearchText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"鬥破蒼穹", "斗破苍穹"},
+		{"ＡＢＣ１２３", "abc123"},
+		{"Hello　World", "hello world"},
+		{"斗破苍穹", "斗破苍穹"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeSearchText(tt.text); got != tt.want {
+			t.Errorf("NormalizeSearchText(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+	"xiaoshuo-backend/models"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/highlight/highlighter/html"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+const (
+	chapterScanLimit   = 1000 // 按章节聚合小说时最多扫描的章节数
+	maxMatchesPerHit   = 50   // 每个章节最多返回的匹配位置数
+	chapterDocIDFormat = "chapter_%d"
+	visibleNovelStatus = "approved" // 章节搜索只返回该审核状态小说的章节
+)
+
+// TextMatch 匹配文字在章节正文中的位置，按字符计算，End 不包含
+type TextMatch struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Text  string `json:"text"`
+}
+
+// ChapterHit 章节搜索结果
+type ChapterHit struct {
+	NovelID    uint        `json:"novel_id"`
+	ChapterID  uint        `json:"chapter_id"`
+	Position   int         `json:"position"`
+	Title      string      `json:"title"`
+	Score      float64     `json:"score"`
+	Fragments  []string    `json:"fragments"`   // 正文高亮片段，匹配文字以<mark>标记
+	Matches    []TextMatch `json:"matches"`     // 正文中的匹配位置，最多50个
+	MatchCount int         `json:"match_count"` // 正文中的匹配总数
+}
+
+// chapterDoc 章节索引文档
+type chapterDoc struct {
+	DocType      string `json:"doc_type"`
+	NovelID      uint   `json:"novel_id"`
+	Status       string `json:"status"` // 所属小说的审核状态
+	ChapterID    uint   `json:"chapter_id"`
+	Position     int    `json:"position"`
+	ChapterTitle string `json:"chapter_title"`
+	Content      string `json:"content"`
+}
+
+// IndexNovelChapters 为小说的章节逐章建立索引，并删除索引中已不存在的章节
+// 章节文档带有小说的审核状态，小说状态变化后需要重新为章节建立索引
+func (s *SearchIndex) IndexNovelChapters(novel models.Novel, chapters []models.Chapter) error {
+	existing, err := s.chapterDocIDs(novel.ID)
+	if err != nil {
+		return err
+	}
+
+	batch := s.index.NewBatch()
+	current := make(map[string]bool, len(chapters))
+	for _, chapter := range chapters {
+		docID := fmt.Sprintf(chapterDocIDFormat, chapter.ID)
+		current[docID] = true
+		doc := chapterDoc{
+			DocType:      docTypeChapter,
+			NovelID:      novel.ID,
+			Status:       novel.Status,
+			ChapterID:    chapter.ID,
+			Position:     chapter.Position,
+			ChapterTitle: chapter.Title,
+			Content:      chapter.Content,
+		}
+		if err := batch.Index(docID, doc); err != nil {
+			return err
+		}
+	}
+	for _, docID := range existing {
+		if !current[docID] {
+			batch.Delete(docID)
+		}
+	}
+	return s.index.Batch(batch)
+}
+
+// IndexedNovelStatus 返回索引中小说文档的审核状态，小说未建立索引时返回空字符串
+func (s *SearchIndex) IndexedNovelStatus(novelID uint) (string, error) {
+	searchRequest := bleve.NewSearchRequest(query.NewDocIDQuery([]string{fmt.Sprintf("novel_%d", novelID)}))
+	searchRequest.Fields = []string{"status"}
+	result, err := s.index.Search(searchRequest)
+	if err != nil || len(result.Hits) == 0 {
+		return "", err
+	}
+	status, _ := result.Hits[0].Fields["status"].(string)
+	return status, nil
+}
+
+// chapterDocIDs 返回索引中小说的全部章节文档ID
+func (s *SearchIndex) chapterDocIDs(novelID uint) ([]string, error) {
+	var docIDs []string
+	for {
+		searchRequest := bleve.NewSearchRequestOptions(novelIDQuery(novelID), chapterScanLimit, len(docIDs), false)
+		result, err := s.index.Search(searchRequest)
+		if err != nil {
+			return nil, err
+		}
+		for _, hit := range result.Hits {
+			docIDs = append(docIDs, hit.ID)
+		}
+		if len(result.Hits) < chapterScanLimit {
+			return docIDs, nil
+		}
+	}
+}
+
+// novelIDQuery 匹配指定小说的章节文档
+func novelIDQuery(novelID uint) query.Query {
+	value := float64(novelID)
+	inclusive := true
+	q := query.NewNumericRangeInclusiveQuery(&value, &value, &inclusive, &inclusive)
+	q.SetField("novel_id")
+	return q
+}
+
+// chapterTextQuery 在章节标题和正文中按短语匹配，空白分隔的多个短语需全部出现
+func chapterTextQuery(queryStr string) query.Query {
+	parts := strings.Fields(queryStr)
+	fieldQuery := func(field string) query.Query {
+		phrases := make([]query.Query, 0, len(parts))
+		for _, part := range parts {
+			phraseQuery := query.NewMatchPhraseQuery(part)
+			phraseQuery.SetField(field)
+			phrases = append(phrases, phraseQuery)
+		}
+		return query.NewConjunctionQuery(phrases)
+	}
+	return query.NewDisjunctionQuery([]query.Query{fieldQuery("content"), fieldQuery("chapter_title")})
+}
+
+// visibleChapterQuery 在已审核小说的章节中按 chapterTextQuery 匹配
+func visibleChapterQuery(queryStr string) *query.ConjunctionQuery {
+	return query.NewConjunctionQuery([]query.Query{termQuery("status", visibleNovelStatus), chapterTextQuery(queryStr)})
+}
+
+// SearchChapters 搜索已审核小说的章节，返回高亮片段和匹配位置
+// novelID 大于0时只在该小说内搜索，结果按章节顺序排列；否则按相关度排列
+func (s *SearchIndex) SearchChapters(queryStr string, novelID uint, page, size int) ([]ChapterHit, int, error) {
+	if strings.TrimSpace(queryStr) == "" {
+		return []ChapterHit{}, 0, nil
+	}
+
+	q := visibleChapterQuery(queryStr)
+	if novelID > 0 {
+		q.AddQuery(novelIDQuery(novelID))
+	}
+
+	searchRequest := bleve.NewSearchRequestOptions(q, size, (page-1)*size, false)
+	searchRequest.Fields = []string{"novel_id", "chapter_id", "position", "chapter_title", "content"}
+	searchRequest.IncludeLocations = true
+	searchRequest.Highlight = bleve.NewHighlightWithStyle(html.Name)
+	searchRequest.Highlight.AddField("content")
+	if novelID > 0 {
+		searchRequest.SortBy([]string{"position"})
+	}
+
+	result, err := s.index.Search(searchRequest)
+	if err != nil {
+		return nil, 0, fmt.Errorf("chapter search failed: %v", err)
+	}
+
+	hits := make([]ChapterHit, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		content, _ := hit.Fields["content"].(string)
+		title, _ := hit.Fields["chapter_title"].(string)
+		matches := textMatches(content, hit.Locations["content"])
+		chapterHit := ChapterHit{
+			NovelID:    uint(fieldNumber(hit.Fields["novel_id"])),
+			ChapterID:  uint(fieldNumber(hit.Fields["chapter_id"])),
+			Position:   int(fieldNumber(hit.Fields["position"])),
+			Title:      title,
+			Score:      hit.Score,
+			Fragments:  hit.Fragments["content"],
+			MatchCount: len(matches),
+		}
+		if len(matches) > maxMatchesPerHit {
+			matches = matches[:maxMatchesPerHit]
+		}
+		chapterHit.Matches = matches
+		if chapterHit.Fragments == nil {
+			chapterHit.Fragments = []string{}
+		}
+		hits = append(hits, chapterHit)
+	}
+	return hits, int(result.Total), nil
+}
+
+// SearchNovelContent 搜索已审核小说的内容，按匹配章节的相关度返回小说ID
+func (s *SearchIndex) SearchNovelContent(queryStr string, page, size int) ([]uint, int, error) {
+	if strings.TrimSpace(queryStr) == "" {
+		return []uint{}, 0, nil
+	}
+
+	searchRequest := bleve.NewSearchRequestOptions(visibleChapterQuery(queryStr), chapterScanLimit, 0, false)
+	searchRequest.Fields = []string{"novel_id"}
+	result, err := s.index.Search(searchRequest)
+	if err != nil {
+		return nil, 0, fmt.Errorf("content search failed: %v", err)
+	}
+
+	// 同一小说的多个章节只保留相关度最高的一个
+	var novelIDs []uint
+	seen := make(map[uint]bool)
+	for _, hit := range result.Hits {
+		novelID := uint(fieldNumber(hit.Fields["novel_id"]))
+		if novelID == 0 || seen[novelID] {
+			continue
+		}
+		seen[novelID] = true
+		novelIDs = append(novelIDs, novelID)
+	}
+
+	total := len(novelIDs)
+	from := (page - 1) * size
+	if from >= total {
+		return []uint{}, total, nil
+	}
+	return novelIDs[from:min(from+size, total)], total, nil
+}
+
+// textMatches 将匹配词的字节位置合并为连续的匹配区间，并换算为字符位置
+// 中文按二元切分，一个短语对应多个相互重叠的词，合并后即为短语在正文中的位置
+func textMatches(content string, termLocations search.TermLocationMap) []TextMatch {
+	var locations search.Locations
+	for _, locs := range termLocations {
+		locations = append(locations, locs...)
+	}
+	sort.Slice(locations, func(i, j int) bool { return locations[i].Start < locations[j].Start })
+
+	matches := make([]TextMatch, 0)
+	start, end := -1, -1
+	flush := func() {
+		if start < 0 || end > len(content) {
+			return
+		}
+		runeStart := utf8.RuneCountInString(content[:start])
+		text := content[start:end]
+		matches = append(matches, TextMatch{
+			Start: runeStart,
+			End:   runeStart + utf8.RuneCountInString(text),
+			Text:  text,
+		})
+	}
+	for _, location := range locations {
+		locStart, locEnd := int(location.Start), int(location.End)
+		if start >= 0 && locStart < end {
+			end = max(end, locEnd)
+			continue
+		}
+		flush()
+		start, end = locStart, locEnd
+	}
+	flush()
+	return matches
+}
+
+// fieldNumber 读取存储的数值字段
+func fieldNumber(value interface{}) float64 {
+	number, _ := value.(float64)
+	return number
+}
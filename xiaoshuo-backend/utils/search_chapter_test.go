@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"path/filepath"
+	"testing"
+	"xiaoshuo-backend/models"
+
+	"gorm.io/gorm"
+)
+
+func TestSearchChaptersOnlyApproved(t *testing.T) {
+	index, err := NewSearchIndex(filepath.Join(t.TempDir(), "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+
+	novels := []models.Novel{
+		{Model: gorm.Model{ID: 1}, Title: "斗破苍穹", Status: "approved"},
+		{Model: gorm.Model{ID: 2}, Title: "凡人修仙传", Status: "pending"},
+	}
+	for _, novel := range novels {
+		chapters := []models.Chapter{
+			{Model: gorm.Model{ID: novel.ID*10 + 1}, Position: 1, Title: "第一章", Content: "少年走进了城门"},
+			{Model: gorm.Model{ID: novel.ID*10 + 2}, Position: 2, Title: "第二章", Content: "城门外风起云涌"},
+		}
+		if err := index.IndexNovel(novel); err != nil {
+			t.Fatal(err)
+		}
+		if err := index.IndexNovelChapters(novel, chapters); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hits, total, err := index.SearchChapters("城门", 0, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(hits) != 1 || hits[0].NovelID != 1 {
+		t.Errorf("SearchChapters = %+v, total %d, want one hit of novel 1 and total 2", hits, total)
+	}
+	if _, total, _ := index.SearchChapters("城门", 2, 1, 10); total != 0 {
+		t.Errorf("SearchChapters in pending novel total = %d, want 0", total)
+	}
+	if ids, total, _ := index.SearchNovelContent("城门", 1, 10); total != 1 || ids[0] != 1 {
+		t.Errorf("SearchNovelContent = %v, total %d, want [1]", ids, total)
+	}
+
+	if status, err := index.IndexedNovelStatus(2); err != nil || status != "pending" {
+		t.Errorf("IndexedNovelStatus(2) = %q, %v, want pending", status, err)
+	}
+	// 搜索建议只来自已审核的小说文档，不包括章节和待审核小说
+	if suggestions, _ := index.SearchSuggestions("凡人修仙传", 10); len(suggestions) != 0 {
+		t.Errorf("SearchSuggestions(凡人修仙传) = %v, want none", suggestions)
+	}
+	if suggestions, _ := index.SearchSuggestions("斗破苍穹", 10); len(suggestions) != 1 {
+		t.Errorf("SearchSuggestions(斗破苍穹) = %v, want one", suggestions)
+	}
+
+	if status, err := index.IndexedNovelStatus(3); err != nil || status != "" {
+		t.Errorf("IndexedNovelStatus(3) = %q, %v, want empty", status, err)
+	}
+}
@@ -0,0 +1,251 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// 小说搜索排序方式
+const (
+	SearchSortRelevance = "relevance" // 相关度
+	SearchSortRating    = "rating"    // 评分
+	SearchSortClicks    = "clicks"    // 点击量
+	SearchSortNewest    = "newest"    // 最近更新
+)
+
+// 分面名称
+const (
+	FacetCategory  = "category"
+	FacetWordCount = "word_count"
+	FacetRating    = "rating"
+)
+
+// NovelSearchOptions 小说搜索的过滤、排序和分页参数，零值表示不限
+type NovelSearchOptions struct {
+	Query         string     // 查询词，为空时匹配全部小说
+	Advanced      bool       // 查询词按搜索语法解析，见 ParseNovelQuery
+	CategoryIDs   []uint     // 属于其中任一分类
+	Keywords      []string   // 包含全部关键词
+	MinWords      int        // 最少字数
+	MaxWords      int        // 最多字数
+	MinRating     float64    // 最低平均评分
+	MaxRating     float64    // 最高平均评分
+	Status        string     // 审核状态
+	SerialStatus  string     // 连载状态：serializing、completed
+	UpdatedAfter  *time.Time // 更新时间不早于
+	UpdatedBefore *time.Time // 更新时间早于
+	Sort          string     // 排序方式，默认按相关度
+	Facets        bool       // 是否返回分面统计
+	Page          int
+	Size          int
+}
+
+// FacetCount 分面中的一项及其数量
+type FacetCount struct {
+	Key   string `json:"key"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// NovelSearchResult 小说搜索结果
+type NovelSearchResult struct {
+	NovelIDs []uint
+	Total    int
+	Facets   map[string][]FacetCount // 分类的 Name 为空，由调用方填充分类名称
+}
+
+// numericBand 数值分面的一个区间，Min 包含、Max 不包含
+type numericBand struct {
+	Key  string
+	Name string
+	Min  *float64
+	Max  *float64
+}
+
+func bound(v float64) *float64 { return &v }
+
+// 字数区间
+var wordCountBands = []numericBand{
+	{Key: "lt_300k", Name: "30万字以下", Max: bound(300000)},
+	{Key: "300k_1m", Name: "30万-100万字", Min: bound(300000), Max: bound(1000000)},
+	{Key: "1m_2m", Name: "100万-200万字", Min: bound(1000000), Max: bound(2000000)},
+	{Key: "2m_5m", Name: "200万-500万字", Min: bound(2000000), Max: bound(5000000)},
+	{Key: "gte_5m", Name: "500万字以上", Min: bound(5000000)},
+}
+
+// 评分区间，评分为0-10分制
+var ratingBands = []numericBand{
+	{Key: "gte_9", Name: "9分以上", Min: bound(9)},
+	{Key: "8_9", Name: "8-9分", Min: bound(8), Max: bound(9)},
+	{Key: "6_8", Name: "6-8分", Min: bound(6), Max: bound(8)},
+	{Key: "lt_6", Name: "6分以下", Max: bound(6)},
+}
+
+// SearchNovelsWithOptions 按查询词、过滤条件和排序搜索小说，可同时返回分面统计
+func (s *SearchIndex) SearchNovelsWithOptions(opts NovelSearchOptions) (*NovelSearchResult, error) {
+	if opts.Page < 1 {
+		opts.Page = 1
+	}
+	if opts.Size < 1 {
+		opts.Size = 10
+	}
+
+	filterQuery, err := novelFilterQuery(opts)
+	if err != nil {
+		return nil, err
+	}
+	searchRequest := bleve.NewSearchRequestOptions(filterQuery, opts.Size, (opts.Page-1)*opts.Size, false)
+	switch opts.Sort {
+	case SearchSortRating:
+		searchRequest.SortBy([]string{"-average_rating", "-rating_count", "-_score"})
+	case SearchSortClicks:
+		searchRequest.SortBy([]string{"-click_count", "-_score"})
+	case SearchSortNewest:
+		searchRequest.SortBy([]string{"-updated_at", "-_score"})
+	default:
+		searchRequest.SortBy([]string{"-_score", "-click_count"})
+	}
+	if opts.Facets {
+		searchRequest.AddFacet(FacetCategory, bleve.NewFacetRequest("category_ids", 50))
+		searchRequest.AddFacet(FacetWordCount, numericFacet("word_count", wordCountBands))
+		searchRequest.AddFacet(FacetRating, numericFacet("average_rating", ratingBands))
+	}
+
+	result, err := s.index.Search(searchRequest)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %v", err)
+	}
+
+	novelIDs := make([]uint, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		var novelID uint
+		if _, err := fmt.Sscanf(hit.ID, "novel_%d", &novelID); err != nil {
+			continue
+		}
+		novelIDs = append(novelIDs, novelID)
+	}
+
+	searchResult := &NovelSearchResult{NovelIDs: novelIDs, Total: int(result.Total)}
+	if opts.Facets {
+		searchResult.Facets = map[string][]FacetCount{
+			FacetCategory:  termFacetCounts(result.Facets[FacetCategory]),
+			FacetWordCount: bandFacetCounts(result.Facets[FacetWordCount], wordCountBands),
+			FacetRating:    bandFacetCounts(result.Facets[FacetRating], ratingBands),
+		}
+	}
+	return searchResult, nil
+}
+
+// novelFilterQuery 组合查询词和过滤条件，只匹配小说文档
+func novelFilterQuery(opts NovelSearchOptions) (query.Query, error) {
+	boolQuery := bleve.NewBooleanQuery()
+	boolQuery.AddMust(termQuery("doc_type", docTypeNovel))
+
+	if strings.TrimSpace(opts.Query) != "" {
+		if !opts.Advanced {
+			boolQuery.AddMust(novelTextQuery(opts.Query))
+		} else if textQuery, err := ParseNovelQuery(opts.Query); err != nil {
+			return nil, err
+		} else {
+			boolQuery.AddMust(textQuery)
+		}
+	}
+	if opts.Status != "" {
+		boolQuery.AddMust(termQuery("status", opts.Status))
+	}
+	if opts.SerialStatus != "" {
+		boolQuery.AddMust(termQuery("serial_status", opts.SerialStatus))
+	}
+	if len(opts.CategoryIDs) > 0 {
+		categories := make([]query.Query, 0, len(opts.CategoryIDs))
+		for _, categoryID := range opts.CategoryIDs {
+			categories = append(categories, termQuery("category_ids", strconv.FormatUint(uint64(categoryID), 10)))
+		}
+		boolQuery.AddMust(query.NewDisjunctionQuery(categories))
+	}
+	for _, word := range opts.Keywords {
+		if word = NormalizeSearchText(strings.TrimSpace(word)); word != "" {
+			boolQuery.AddMust(termQuery("tags", word))
+		}
+	}
+	if opts.MinWords > 0 || opts.MaxWords > 0 {
+		boolQuery.AddMust(numericRange("word_count", float64(opts.MinWords), float64(opts.MaxWords)))
+	}
+	if opts.MinRating > 0 || opts.MaxRating > 0 {
+		boolQuery.AddMust(numericRange("average_rating", opts.MinRating, opts.MaxRating))
+	}
+	if opts.UpdatedAfter != nil || opts.UpdatedBefore != nil {
+		var start, end time.Time
+		if opts.UpdatedAfter != nil {
+			start = *opts.UpdatedAfter
+		}
+		if opts.UpdatedBefore != nil {
+			end = *opts.UpdatedBefore
+		}
+		dateQuery := query.NewDateRangeQuery(start, end)
+		dateQuery.SetField("updated_at")
+		boolQuery.AddMust(dateQuery)
+	}
+	return boolQuery, nil
+}
+
+func termQuery(field, term string) query.Query {
+	q := query.NewTermQuery(term)
+	q.SetField(field)
+	return q
+}
+
+// numericRange 闭区间数值范围查询，min 或 max 为0表示不限
+func numericRange(field string, min, max float64) query.Query {
+	var minPtr, maxPtr *float64
+	if min > 0 {
+		minPtr = &min
+	}
+	if max > 0 {
+		maxPtr = &max
+	}
+	inclusive := true
+	q := query.NewNumericRangeInclusiveQuery(minPtr, maxPtr, &inclusive, &inclusive)
+	q.SetField(field)
+	return q
+}
+
+func numericFacet(field string, bands []numericBand) *bleve.FacetRequest {
+	facet := bleve.NewFacetRequest(field, len(bands))
+	for _, band := range bands {
+		facet.AddNumericRange(band.Key, band.Min, band.Max)
+	}
+	return facet
+}
+
+func termFacetCounts(facet *search.FacetResult) []FacetCount {
+	counts := make([]FacetCount, 0)
+	if facet == nil || facet.Terms == nil {
+		return counts
+	}
+	for _, term := range facet.Terms.Terms() {
+		counts = append(counts, FacetCount{Key: term.Term, Count: term.Count})
+	}
+	return counts
+}
+
+// bandFacetCounts 按区间定义的顺序返回各区间数量，没有匹配的区间数量为0
+func bandFacetCounts(facet *search.FacetResult, bands []numericBand) []FacetCount {
+	byKey := make(map[string]int)
+	if facet != nil {
+		for _, numeric := range facet.NumericRanges {
+			byKey[numeric.Name] = numeric.Count
+		}
+	}
+	counts := make([]FacetCount, 0, len(bands))
+	for _, band := range bands {
+		counts = append(counts, FacetCount{Key: band.Key, Name: band.Name, Count: byKey[band.Key]})
+	}
+	return counts
+}
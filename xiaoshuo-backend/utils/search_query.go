@@ -0,0 +1,332 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// ErrInvalidSearchQuery 搜索语法错误
+var ErrInvalidSearchQuery = errors.New("搜索语法错误")
+
+// 搜索语法支持的限定字段（含中文别名），值为规范名称
+var searchQueryFields = map[string]string{
+	"title":       "title",
+	"标题":          "title",
+	"书名":          "title",
+	"author":      "author",
+	"作者":          "author",
+	"protagonist": "protagonist",
+	"主角":          "protagonist",
+	"keyword":     "keyword",
+	"tag":         "keyword",
+	"关键词":         "keyword",
+	"标签":          "keyword",
+	"category":    "category",
+	"分类":          "category",
+	"words":       "words",
+	"字数":          "words",
+	"rating":      "rating",
+	"评分":          "rating",
+	"clicks":      "clicks",
+	"点击":          "clicks",
+}
+
+// 数值限定字段对应的索引字段
+var searchQueryNumericFields = map[string]string{
+	"words":  "word_count",
+	"rating": "average_rating",
+	"clicks": "click_count",
+}
+
+// 不限字段的短语和排除条件匹配的文本字段
+var searchQueryTextFields = []string{"title", "author", "protagonist", "description", "keywords"}
+
+// queryTerm 搜索语法中的一个条件
+type queryTerm struct {
+	pos    int    // 条件在查询中的位置（第几个字符），用于错误提示
+	negate bool   // 以 - 开头的排除条件
+	field  string // 限定字段的规范名称，为空表示不限字段
+	value  string
+	quoted bool // 值为引号括起的短语
+	or     bool // OR 运算符
+}
+
+// ParseNovelQuery 将搜索语法编译为小说查询
+//
+// 支持的语法：
+//   - 空格分隔的条件需同时满足，如 `斗破 苍穹`
+//   - 字段限定：title:、author:、protagonist:、keyword:、category:，如 `author:天蚕土豆`
+//   - 引号短语：`"退婚流"` 或 `title:"斗破 苍穹"`
+//   - 排除：`-后宫`、`-category:都市`
+//   - OR：`category:玄幻 OR category:仙侠`，OR 也可写作 |
+//   - 数值范围：words:、rating:、clicks: 后接 >、>=、<、<=、N..M 或单个数值，字数可用万为单位，如 `words:>200万`
+//
+// 没有限定字段的普通词合并后按原有的多字段和拼音方式匹配
+func ParseNovelQuery(queryStr string) (query.Query, error) {
+	terms, err := lexSearchQuery(queryStr)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按 OR 分组，组内任一条件满足即可，组与组之间需同时满足
+	var groups [][]queryTerm
+	for i, term := range terms {
+		if !term.or {
+			if i > 0 && terms[i-1].or {
+				groups[len(groups)-1] = append(groups[len(groups)-1], term)
+			} else {
+				groups = append(groups, []queryTerm{term})
+			}
+			continue
+		}
+		if i == 0 || i == len(terms)-1 || terms[i-1].or || terms[i+1].or {
+			return nil, fmt.Errorf("%w: 第%d个字符处的 OR 两侧都需要搜索条件", ErrInvalidSearchQuery, term.pos)
+		}
+	}
+
+	boolQuery := query.NewBooleanQuery(nil, nil, nil)
+	var plainWords []string
+	for _, group := range groups {
+		if len(group) == 1 {
+			term := group[0]
+			if term.field == "" && !term.quoted && !term.negate {
+				plainWords = append(plainWords, term.value)
+				continue
+			}
+			q, err := compileQueryTerm(term)
+			if err != nil {
+				return nil, err
+			}
+			if term.negate {
+				boolQuery.AddMustNot(q)
+			} else {
+				boolQuery.AddMust(q)
+			}
+			continue
+		}
+
+		alternatives := make([]query.Query, 0, len(group))
+		for _, term := range group {
+			if term.negate {
+				return nil, fmt.Errorf("%w: 第%d个字符处的排除条件不能与 OR 组合使用", ErrInvalidSearchQuery, term.pos)
+			}
+			q, err := compileQueryTerm(term)
+			if err != nil {
+				return nil, err
+			}
+			alternatives = append(alternatives, q)
+		}
+		boolQuery.AddMust(query.NewDisjunctionQuery(alternatives))
+	}
+	if len(plainWords) > 0 {
+		boolQuery.AddMust(novelTextQuery(strings.Join(plainWords, " ")))
+	}
+	return boolQuery, nil
+}
+
+// lexSearchQuery 将查询拆分为条件，引号和冒号支持全角写法
+func lexSearchQuery(queryStr string) ([]queryTerm, error) {
+	runes := []rune(queryStr)
+	terms := make([]queryTerm, 0)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		term := queryTerm{pos: i + 1}
+		if isNegationRune(runes[i]) && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) {
+			term.negate = true
+			i++
+		}
+
+		// 读取到空白或引号为止的部分，其中可能带有字段限定
+		start := i
+		for i < len(runes) && !unicode.IsSpace(runes[i]) && !isQuoteRune(runes[i]) {
+			i++
+		}
+		word := string(runes[start:i])
+		if colon := strings.IndexAny(word, ":："); colon > 0 {
+			name := word[:colon]
+			if field, ok := searchQueryFields[strings.ToLower(name)]; ok {
+				term.field = field
+				_, size := utf8.DecodeRuneInString(word[colon:])
+				word = word[colon+size:]
+			} else if isASCIIWord(name) {
+				return nil, fmt.Errorf("%w: 第%d个字符处的字段 %s: 不存在，可用字段为 title、author、protagonist、keyword、category、words、rating、clicks，搜索含冒号的文字请加引号", ErrInvalidSearchQuery, term.pos, name)
+			}
+		}
+
+		if i < len(runes) && isQuoteRune(runes[i]) {
+			if word != "" {
+				return nil, fmt.Errorf("%w: 第%d个字符处的引号前缺少空格", ErrInvalidSearchQuery, i+1)
+			}
+			open := i
+			i++
+			start = i
+			for i < len(runes) && !isQuoteRune(runes[i]) {
+				i++
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("%w: 第%d个字符处的引号没有闭合", ErrInvalidSearchQuery, open+1)
+			}
+			word = string(runes[start:i])
+			term.quoted = true
+			i++
+			if i < len(runes) && !unicode.IsSpace(runes[i]) {
+				return nil, fmt.Errorf("%w: 第%d个字符处的引号后缺少空格", ErrInvalidSearchQuery, i+1)
+			}
+		}
+
+		term.value = strings.TrimSpace(word)
+		if !term.quoted && !term.negate && term.field == "" && (term.value == "OR" || term.value == "|") {
+			term.or = true
+		} else if term.value == "" {
+			if term.field != "" {
+				return nil, fmt.Errorf("%w: 第%d个字符处的字段 %s: 后缺少搜索内容", ErrInvalidSearchQuery, term.pos, term.field)
+			}
+			if !term.quoted {
+				return nil, fmt.Errorf("%w: 第%d个字符处的 - 后缺少搜索内容", ErrInvalidSearchQuery, term.pos)
+			}
+			continue
+		}
+		terms = append(terms, term)
+	}
+	return terms, nil
+}
+
+// compileQueryTerm 将单个条件编译为查询
+func compileQueryTerm(term queryTerm) (query.Query, error) {
+	if indexField, ok := searchQueryNumericFields[term.field]; ok {
+		return numericQueryTerm(term, indexField)
+	}
+
+	value := NormalizeSearchText(term.value)
+	switch term.field {
+	case "title", "author", "protagonist":
+		return fieldTextQuery(term.field, value), nil
+	case "keyword":
+		return synonymTermQuery("tags", value), nil
+	case "category":
+		return synonymTermQuery("categories", value), nil
+	}
+
+	// 不限字段：排除条件和引号短语按短语匹配，避免只匹配到部分二元词
+	if !term.quoted && !term.negate {
+		return novelTextQuery(term.value), nil
+	}
+	alternatives := make([]query.Query, 0, len(searchQueryTextFields))
+	for _, field := range searchQueryTextFields {
+		alternatives = append(alternatives, fieldTextQuery(field, value))
+	}
+	return query.NewDisjunctionQuery(alternatives), nil
+}
+
+// fieldTextQuery 在字段中按短语匹配，空白分隔的多个短语需全部出现，单个汉字按词前缀匹配
+func fieldTextQuery(field, text string) query.Query {
+	if parts := strings.Fields(text); len(parts) > 1 {
+		phrases := make([]query.Query, 0, len(parts))
+		for _, part := range parts {
+			phrases = append(phrases, fieldTextQuery(field, part))
+		}
+		return query.NewConjunctionQuery(phrases)
+	}
+	if runes := []rune(text); len(runes) == 1 && isCJKRune(runes[0]) {
+		prefixQuery := query.NewPrefixQuery(text)
+		prefixQuery.SetField(field)
+		return prefixQuery
+	}
+	phraseQuery := query.NewMatchPhraseQuery(text)
+	phraseQuery.SetField(field)
+	return phraseQuery
+}
+
+// synonymTermQuery 精确匹配词语或其任一同义词
+func synonymTermQuery(field, value string) query.Query {
+	alternatives := []query.Query{termQuery(field, value)}
+	for _, synonym := range synonymsOf(value) {
+		alternatives = append(alternatives, termQuery(field, synonym))
+	}
+	if len(alternatives) == 1 {
+		return alternatives[0]
+	}
+	return query.NewDisjunctionQuery(alternatives)
+}
+
+// numericQueryTerm 解析 >N、>=N、<N、<=N、N..M 或 N 形式的数值范围
+func numericQueryTerm(term queryTerm, indexField string) (query.Query, error) {
+	invalid := fmt.Errorf("%w: 第%d个字符处 %s:%s 不是有效的数值范围，可写作 %s:>N、%s:<=N 或 %s:N..M",
+		ErrInvalidSearchQuery, term.pos, term.field, term.value, term.field, term.field, term.field)
+
+	value := NormalizeSearchText(strings.ReplaceAll(term.value, " ", ""))
+	var min, max *float64
+	minInclusive, maxInclusive := true, true
+	parse := func(s string) (*float64, bool) {
+		multiplier := 1.0
+		if strings.HasSuffix(s, "万") {
+			s, multiplier = strings.TrimSuffix(s, "万"), 10000
+		}
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		n *= multiplier
+		return &n, true
+	}
+
+	var ok bool
+	switch {
+	case strings.HasPrefix(value, ">="):
+		min, ok = parse(value[2:])
+	case strings.HasPrefix(value, ">"):
+		min, ok = parse(value[1:])
+		minInclusive = false
+	case strings.HasPrefix(value, "<="):
+		max, ok = parse(value[2:])
+	case strings.HasPrefix(value, "<"):
+		max, ok = parse(value[1:])
+		maxInclusive = false
+	case strings.Contains(value, ".."):
+		bounds := strings.SplitN(value, "..", 2)
+		if min, ok = parse(bounds[0]); ok {
+			max, ok = parse(bounds[1])
+		}
+		if ok && *min > *max {
+			return nil, fmt.Errorf("%w: 第%d个字符处 %s:%s 的下限大于上限", ErrInvalidSearchQuery, term.pos, term.field, term.value)
+		}
+	default:
+		if min, ok = parse(value); ok {
+			max = min
+		}
+	}
+	if !ok {
+		return nil, invalid
+	}
+
+	q := query.NewNumericRangeInclusiveQuery(min, max, &minInclusive, &maxInclusive)
+	q.SetField(indexField)
+	return q, nil
+}
+
+func isQuoteRune(r rune) bool {
+	return r == '"' || r == '“' || r == '”' || r == '＂'
+}
+
+func isNegationRune(r rune) bool {
+	return r == '-' || r == '－'
+}
+
+func isASCIIWord(s string) bool {
+	for _, r := range s {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || r == '_') {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"xiaoshuo-backend/models"
+
+	"gorm.io/gorm"
+)
+
+func TestLexSearchQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []queryTerm
+	}{
+		{"斗破 苍穹", []queryTerm{{pos: 1, value: "斗破"}, {pos: 4, value: "苍穹"}}},
+		{"author:天蚕土豆", []queryTerm{{pos: 1, field: "author", value: "天蚕土豆"}}},
+		{"TITLE:斗破", []queryTerm{{pos: 1, field: "title", value: "斗破"}}},
+		{"作者:天蚕土豆", []queryTerm{{pos: 1, field: "author", value: "天蚕土豆"}}},
+		{"作者：天蚕土豆", []queryTerm{{pos: 1, field: "author", value: "天蚕土豆"}}},
+		{"书名:斗破 主角:萧炎", []queryTerm{{pos: 1, field: "title", value: "斗破"}, {pos: 7, field: "protagonist", value: "萧炎"}}},
+		{"标签:退婚流 分类:玄幻", []queryTerm{{pos: 1, field: "keyword", value: "退婚流"}, {pos: 8, field: "category", value: "玄幻"}}},
+		{"字数:>100万 评分:>=8 点击:1000", []queryTerm{
+			{pos: 1, field: "words", value: ">100万"}, {pos: 10, field: "rating", value: ">=8"}, {pos: 17, field: "clicks", value: "1000"},
+		}},
+		{`"退婚 流"`, []queryTerm{{pos: 1, value: "退婚 流", quoted: true}}},
+		{"“退婚 流”", []queryTerm{{pos: 1, value: "退婚 流", quoted: true}}},
+		{"＂退婚＂", []queryTerm{{pos: 1, value: "退婚", quoted: true}}},
+		{"title:“斗破 苍穹”", []queryTerm{{pos: 1, field: "title", value: "斗破 苍穹", quoted: true}}},
+		{"-后宫", []queryTerm{{pos: 1, negate: true, value: "后宫"}}},
+		{"－后宫", []queryTerm{{pos: 1, negate: true, value: "后宫"}}},
+		{"-category:都市", []queryTerm{{pos: 1, negate: true, field: "category", value: "都市"}}},
+		{"-“后宫 种马”", []queryTerm{{pos: 1, negate: true, value: "后宫 种马", quoted: true}}},
+		{"- 后宫", []queryTerm{{pos: 1, value: "-"}, {pos: 3, value: "后宫"}}},
+		{"玄幻 OR 仙侠", []queryTerm{{pos: 1, value: "玄幻"}, {pos: 4, value: "OR", or: true}, {pos: 7, value: "仙侠"}}},
+		{"玄幻 | 仙侠", []queryTerm{{pos: 1, value: "玄幻"}, {pos: 4, value: "|", or: true}, {pos: 6, value: "仙侠"}}},
+		{`"OR"`, []queryTerm{{pos: 1, value: "OR", quoted: true}}},
+		{"凡人:修仙", []queryTerm{{pos: 1, value: "凡人:修仙"}}},
+		{`"a:b"`, []queryTerm{{pos: 1, value: "a:b", quoted: true}}},
+		{`""`, []queryTerm{}},
+		{"", []queryTerm{}},
+	}
+	for _, tt := range tests {
+		got, err := lexSearchQuery(tt.query)
+		if err != nil {
+			t.Errorf("lexSearchQuery(%q): %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lexSearchQuery(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseNovelQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		msg   string
+	}{
+		{"foo:bar", "字段 foo: 不存在"},
+		{"title:", "后缺少搜索内容"},
+		{`"退婚`, "引号没有闭合"},
+		{`退婚"流"`, "引号前缺少空格"},
+		{`"退婚"流`, "引号后缺少空格"},
+		{"OR 玄幻", "OR 两侧都需要搜索条件"},
+		{"玄幻 OR", "OR 两侧都需要搜索条件"},
+		{"| 玄幻", "OR 两侧都需要搜索条件"},
+		{"玄幻 OR OR 仙侠", "OR 两侧都需要搜索条件"},
+		{"-玄幻 OR 仙侠", "排除条件不能与 OR 组合使用"},
+		{"words:abc", "不是有效的数值范围"},
+		{"words:>", "不是有效的数值范围"},
+		{"rating:-1", "不是有效的数值范围"},
+		{"words:300万..100万", "下限大于上限"},
+		{"clicks:10..5", "下限大于上限"},
+	}
+	for _, tt := range tests {
+		_, err := ParseNovelQuery(tt.query)
+		if !errors.Is(err, ErrInvalidSearchQuery) || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("ParseNovelQuery(%q) error = %v, want %q", tt.query, err, tt.msg)
+		}
+	}
+}
+
+func TestParseNovelQuerySearch(t *testing.T) {
+	index, err := NewSearchIndex(filepath.Join(t.TempDir(), "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+
+	novels := []models.Novel{
+		{
+			Model: gorm.Model{ID: 1}, Title: "斗破苍穹", Author: "天蚕土豆", Protagonist: "萧炎",
+			Description: "天才少年退婚之后奋起", WordCount: 5320000, AverageRating: 8.5, ClickCount: 9000,
+			Categories: []models.Category{{Model: gorm.Model{ID: 1}, Name: "玄幻"}},
+			Keywords:   []models.Keyword{{Word: "退婚流"}, {Word: "升级"}},
+		},
+		{
+			Model: gorm.Model{ID: 2}, Title: "凡人修仙传", Author: "忘语", Protagonist: "韩立",
+			Description: "凡人也能修成正果", WordCount: 7440000, AverageRating: 9.1, ClickCount: 8000,
+			Categories: []models.Category{{Model: gorm.Model{ID: 2}, Name: "仙侠"}},
+			Keywords:   []models.Keyword{{Word: "凡人流"}},
+		},
+		{
+			Model: gorm.Model{ID: 3}, Title: "都市之最强狂兵", Author: "烈焰滔滔", Protagonist: "苏锐",
+			Description: "兵王回归都市", WordCount: 1500000, AverageRating: 6.2, ClickCount: 500,
+			Categories: []models.Category{{Model: gorm.Model{ID: 3}, Name: "都市"}},
+			Keywords:   []models.Keyword{{Word: "后宫"}},
+		},
+	}
+	for _, novel := range novels {
+		if err := index.IndexNovel(novel); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []uint
+	}{
+		{"作者:天蚕土豆", []uint{1}},
+		{"作者：忘语", []uint{2}},
+		{"author:忘语 OR author:烈焰滔滔", []uint{2, 3}},
+		{"主角:萧炎", []uint{1}},
+		{"标签:退婚流", []uint{1}},
+		{"分类:玄幻 | 分类:仙侠", []uint{1, 2}},
+		{"“凡人修仙”", []uint{2}},
+		{"title:“最强 狂兵”", []uint{3}},
+		{"-后宫", []uint{1, 2}},
+		{"-标签:后宫 -分类:玄幻", []uint{2}},
+		{"-“退婚”", []uint{2, 3}},
+		{"words:>200万", []uint{1, 2}},
+		{"字数:<=150万", []uint{3}},
+		{"words:100万..600万", []uint{1, 3}},
+		{"rating:>=8.5", []uint{1, 2}},
+		{"rating:>8.5", []uint{2}},
+		{"clicks:500", []uint{3}},
+		{"分类:仙侠 words:>200万 -后宫", []uint{2}},
+	}
+	for _, tt := range tests {
+		result, err := index.SearchNovelsWithOptions(NovelSearchOptions{Query: tt.query, Advanced: true, Size: 10})
+		if err != nil {
+			t.Errorf("search %q: %v", tt.query, err)
+			continue
+		}
+		got := append([]uint{}, result.NovelIDs...)
+		sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("search %q = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
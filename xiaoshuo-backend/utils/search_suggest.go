@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SuggestionCandidate "您是不是要找"的候选词，Weight 越大越优先
+type SuggestionCandidate struct {
+	Text   string
+	Weight float64
+}
+
+// suggestionEntry 预先计算好规范化文本和拼音的候选词
+type suggestionEntry struct {
+	text       string
+	normalized []rune
+	pinyin     []rune
+	initials   []rune
+	weight     float64
+}
+
+var suggestions = struct {
+	mu      sync.RWMutex
+	entries []suggestionEntry
+}{}
+
+// SetSuggestionCandidates 替换纠错建议的候选词，相同的词保留最大权重
+func SetSuggestionCandidates(candidates []SuggestionCandidate) {
+	byText := make(map[string]int, len(candidates))
+	entries := make([]suggestionEntry, 0, len(candidates))
+	for _, candidate := range candidates {
+		text := strings.TrimSpace(candidate.Text)
+		normalized := NormalizeSearchText(text)
+		if normalized == "" {
+			continue
+		}
+		if i, ok := byText[normalized]; ok {
+			if candidate.Weight > entries[i].weight {
+				entries[i].weight = candidate.Weight
+			}
+			continue
+		}
+		full, initials := Pinyin(text)
+		byText[normalized] = len(entries)
+		entries = append(entries, suggestionEntry{
+			text:       text,
+			normalized: []rune(normalized),
+			pinyin:     []rune(full),
+			initials:   []rune(initials),
+			weight:     candidate.Weight,
+		})
+	}
+
+	suggestions.mu.Lock()
+	suggestions.entries = entries
+	suggestions.mu.Unlock()
+}
+
+// SuggestQuery 为没有结果的查询找出编辑距离最近的标题、作者或热门搜索词，按距离和权重排序，最多返回 limit 个
+// 中文查询与候选词逐字比较；字母查询与候选词本身、全拼和首字母比较
+func SuggestQuery(queryStr string, limit int) []string {
+	normalized := strings.TrimSpace(NormalizeSearchText(queryStr))
+	query := []rune(normalized)
+	latin := isPinyinQuery(normalized)
+	if latin {
+		normalized = strings.NewReplacer(" ", "", "'", "").Replace(normalized)
+		query = []rune(normalized)
+		if len(query) < 3 {
+			return nil
+		}
+	} else if len(query) < 2 {
+		return nil
+	}
+	maxDistance := allowedEditDistance(len(query))
+
+	suggestions.mu.RLock()
+	defer suggestions.mu.RUnlock()
+
+	type match struct {
+		entry    *suggestionEntry
+		distance int
+	}
+	matches := make([]match, 0)
+	for i, entry := range suggestions.entries {
+		distance := editDistance(query, entry.normalized, maxDistance)
+		if latin {
+			if d := editDistance(query, entry.pinyin, maxDistance); d < distance {
+				distance = d
+			}
+			// 首字母较短，只容许一处错误
+			if len(query) >= 4 {
+				if d := editDistance(query, entry.initials, 1); d <= 1 && d < distance {
+					distance = d
+				}
+			}
+		}
+		if distance == 0 || distance > maxDistance {
+			continue
+		}
+		matches = append(matches, match{entry: &suggestions.entries[i], distance: distance})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].entry.weight > matches[j].entry.weight
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	texts := make([]string, 0, len(matches))
+	for _, m := range matches {
+		texts = append(texts, m.entry.text)
+	}
+	return texts
+}
+
+// allowedEditDistance 按查询长度容许的编辑距离，短查询只容许一处错误
+func allowedEditDistance(length int) int {
+	if length >= 8 {
+		return 2
+	}
+	return 1
+}
+
+// editDistance 计算两个字符串的编辑距离，超过 max 时提前返回 max+1
+func editDistance(a, b []rune, max int) int {
+	if diff := len(a) - len(b); diff > max || -diff > max {
+		return max + 1
+	}
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if curr[j] < rowMin {
+				rowMin = curr[j]
+			}
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
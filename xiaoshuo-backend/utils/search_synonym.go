@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 一次查询最多展开的同义改写数量
+const maxSynonymExpansions = 8
+
+// synonymDictionary 同义词词典，组内的词互为同义词
+type synonymDictionary struct {
+	mu       sync.RWMutex
+	synonyms map[string][]string // 规范化后的词 -> 同组的其它词
+}
+
+var synonyms = &synonymDictionary{synonyms: make(map[string][]string)}
+
+// SetSearchSynonyms 替换同义词词典，每组中的词互为同义词，词语会加入分词词典
+func SetSearchSynonyms(groups [][]string) {
+	next := make(map[string][]string)
+	for _, group := range groups {
+		words := make([]string, 0, len(group))
+		seen := make(map[string]bool, len(group))
+		for _, word := range group {
+			word = NormalizeSearchText(strings.TrimSpace(word))
+			if word != "" && !seen[word] {
+				seen[word] = true
+				words = append(words, word)
+			}
+		}
+		if len(words) < 2 {
+			continue
+		}
+		AddSearchWords(words...)
+		for _, word := range words {
+			for _, other := range words {
+				if other != word && !containsString(next[word], other) {
+					next[word] = append(next[word], other)
+				}
+			}
+		}
+	}
+
+	synonyms.mu.Lock()
+	synonyms.synonyms = next
+	synonyms.mu.Unlock()
+}
+
+// synonymsOf 返回词语的同义词
+func synonymsOf(word string) []string {
+	synonyms.mu.RLock()
+	defer synonyms.mu.RUnlock()
+	return synonyms.synonyms[NormalizeSearchText(word)]
+}
+
+// expandSynonyms 将规范化后的查询中出现的词替换为同义词，返回改写后的查询
+// 较长的词优先替换，如同时收录了"修仙"和"修仙小说"时只替换"修仙小说"
+func expandSynonyms(normalized string) []string {
+	synonyms.mu.RLock()
+	defer synonyms.mu.RUnlock()
+	if len(synonyms.synonyms) == 0 {
+		return nil
+	}
+
+	words := make([]string, 0)
+	for word := range synonyms.synonyms {
+		if strings.Contains(normalized, word) {
+			words = append(words, word)
+		}
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if len(words[i]) != len(words[j]) {
+			return len(words[i]) > len(words[j])
+		}
+		return words[i] < words[j]
+	})
+
+	expansions := make([]string, 0)
+	covered := make([]string, 0, len(words))
+	for _, word := range words {
+		// 已被更长的同义词覆盖的词不再替换
+		overlapped := false
+		for _, longer := range covered {
+			if strings.Contains(longer, word) {
+				overlapped = true
+				break
+			}
+		}
+		if overlapped {
+			continue
+		}
+		covered = append(covered, word)
+		for _, synonym := range synonyms.synonyms[word] {
+			if len(expansions) == maxSynonymExpansions {
+				return expansions
+			}
+			expansions = append(expansions, strings.ReplaceAll(normalized, word, synonym))
+		}
+	}
+	return expansions
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"xiaoshuo-backend/models"
+)
+
+// ParseVolumesFromFile 按文件类型解析分卷和章节
+func ParseVolumesFromFile(filepath string) ([]models.Volume, error) {
+	if IsEPUBFile(filepath) {
+		return ParseVolumesFromEPUB(filepath)
+	}
+	return ParseVolumesFromTXT(filepath)
+}
+
+// ParseVolumesFromTXT 解析TXT文件的分卷和章节，分卷由卷标题规则识别
+func ParseVolumesFromTXT(filepath string) ([]models.Volume, error) {
+	splits, err := SplitChaptersFromTXT(filepath, LoadChapterParseOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	chapters := make([]models.Chapter, len(splits))
+	volumeTitles := make([]string, len(splits))
+	for i, split := range splits {
+		chapters[i] = split.Chapter
+		volumeTitles[i] = split.VolumeTitle
+	}
+	return GroupChaptersByVolume(chapters, volumeTitles), nil
+}
+
+// GroupChaptersByVolume 按章节所属分卷标题将连续的章节分组
+// volumeTitles[i] 为第i个章节所属的分卷标题，标题为空的分组表示未分卷的章节，不对应分卷记录
+func GroupChaptersByVolume(chapters []models.Chapter, volumeTitles []string) []models.Volume {
+	var volumes []models.Volume
+	position := 0
+	for i, chapter := range chapters {
+		title := ""
+		if i < len(volumeTitles) {
+			title = volumeTitles[i]
+		}
+		if len(volumes) == 0 || volumes[len(volumes)-1].Title != title {
+			volume := models.Volume{Title: title}
+			if title != "" {
+				position++
+				volume.Position = position
+			}
+			volumes = append(volumes, volume)
+		}
+		volume := &volumes[len(volumes)-1]
+		volume.Chapters = append(volume.Chapters, chapter)
+		volume.WordCount += chapter.WordCount
+		volume.ChapterCount++
+	}
+	return volumes
+}